@@ -2,9 +2,20 @@ package v1
 
 import (
 	"github.com/gin-gonic/gin"
+	"go_chat/pkg/constants"
 	"net/http"
 )
 
+// authUuid 获取鉴权中间件写入的登录用户uuid
+func authUuid(c *gin.Context) string {
+	return c.GetString(constants.CTX_UUID)
+}
+
+// authSid 获取鉴权中间件写入的当前登录id
+func authSid(c *gin.Context) string {
+	return c.GetString(constants.CTX_SID)
+}
+
 func JsonBack(c *gin.Context, message string, ret int, data interface{}) {
 	if ret == 0 {
 		if data != nil {
@@ -29,5 +40,11 @@ func JsonBack(c *gin.Context, message string, ret int, data interface{}) {
 			"code":    500,
 			"message": message,
 		})
+	} else if ret == -3 {
+		// 频率限制或账号锁定，message中带有需要等待的时间
+		c.JSON(http.StatusOK, gin.H{
+			"code":    429,
+			"message": message,
+		})
 	}
 }
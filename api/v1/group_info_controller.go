@@ -20,22 +20,14 @@ func CreateGroup(c *gin.Context) {
 		})
 		return
 	}
+	createGroupReq.OwnerId = authUuid(c)
 	message, ret := gorm.GroupInfoService.CreateGroup(createGroupReq)
 	JsonBack(c, message, ret, nil)
 }
 
 // LoadMyGroup 获取我创建的群聊
 func LoadMyGroup(c *gin.Context) {
-	var loadMyGroupReq request.OwnlistRequest
-	if err := c.BindJSON(&loadMyGroupReq); err != nil {
-		zlog.Error(err.Error())
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"message": constants.SYSTEM_ERROR,
-		})
-		return
-	}
-	message, groupList, ret := gorm.GroupInfoService.LoadMyGroup(loadMyGroupReq.OwnerId)
+	message, groupList, ret := gorm.GroupInfoService.LoadMyGroup(authUuid(c))
 	JsonBack(c, message, ret, groupList)
 }
 
@@ -65,6 +57,7 @@ func EnterGroupDirectly(c *gin.Context) {
 		})
 		return
 	}
+	req.ContactId = authUuid(c)
 	message, ret := gorm.GroupInfoService.EnterGroupDirectly(req.OwnerId, req.ContactId)
 	JsonBack(c, message, ret, nil)
 }
@@ -80,6 +73,7 @@ func LeaveGroup(c *gin.Context) {
 		})
 		return
 	}
+	req.UserId = authUuid(c)
 	message, ret := gorm.GroupInfoService.LeaveGroup(req.UserId, req.GroupId)
 	JsonBack(c, message, ret, nil)
 }
@@ -95,7 +89,8 @@ func DismissGroup(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.GroupInfoService.DismissGroup(req.GroupId)
+	req.OwnerId = authUuid(c)
+	message, ret := gorm.GroupInfoService.DismissGroup(req.OwnerId, req.GroupId)
 	JsonBack(c, message, ret, nil)
 }
 
@@ -125,6 +120,7 @@ func UpdateGroupInfo(c *gin.Context) {
 		})
 		return
 	}
+	req.OwnerId = authUuid(c)
 	message, ret := gorm.GroupInfoService.UpdateGroupInfo(req)
 	JsonBack(c, message, ret, nil)
 }
@@ -155,6 +151,7 @@ func RemoveGroupMembers(c *gin.Context) {
 		})
 		return
 	}
+	req.OwnerId = authUuid(c)
 	message, ret := gorm.GroupInfoService.RemoveGroupMembers(req)
 	JsonBack(c, message, ret, nil)
 }
@@ -18,6 +18,7 @@ func GetMessageList(c *gin.Context) {
 		})
 		return
 	}
+	req.UserOneId = authUuid(c)
 	message, rsp, ret := gorm.MessageService.GetMessageList(req.UserOneId, req.UserTwoId)
 	JsonBack(c, message, ret, rsp)
 }
@@ -32,6 +33,111 @@ func GetGroupMessageList(c *gin.Context) {
 		})
 		return
 	}
-	message, rsp, ret := gorm.MessageService.GetGroupMessageList(req.GroupId)
+	message, rsp, ret := gorm.MessageService.GetGroupMessageList(authUuid(c), req.GroupId)
+	JsonBack(c, message, ret, rsp)
+}
+
+// GetMessagePage 分页获取聊天记录
+func GetMessagePage(c *gin.Context) {
+	var req request.GetMessagePageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.UserOneId = authUuid(c)
+	message, rsp, ret := gorm.MessageService.GetMessagePage(req)
+	JsonBack(c, message, ret, rsp)
+}
+
+// GetGroupMessagePage 分页获取群聊消息记录
+func GetGroupMessagePage(c *gin.Context) {
+	var req request.GetGroupMessagePageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.UserId = authUuid(c)
+	message, rsp, ret := gorm.MessageService.GetGroupMessagePage(req)
+	JsonBack(c, message, ret, rsp)
+}
+
+// RecallMessage 撤回消息
+func RecallMessage(c *gin.Context) {
+	var req request.RecallMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.OperatorId = authUuid(c)
+	message, ret := gorm.MessageService.RecallMessage(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// EditMessage 编辑消息
+func EditMessage(c *gin.Context) {
+	var req request.EditMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.SendId = authUuid(c)
+	message, ret := gorm.MessageService.EditMessage(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// GetMessageThread 获取群聊话题
+func GetMessageThread(c *gin.Context) {
+	var req request.GetMessageThreadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.UserId = authUuid(c)
+	message, rsp, ret := gorm.MessageService.GetMessageThread(req)
+	JsonBack(c, message, ret, rsp)
+}
+
+// ToggleReaction 回应或取消回应消息
+func ToggleReaction(c *gin.Context) {
+	var req request.ToggleReactionRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.UserId = authUuid(c)
+	message, rsp, ret := gorm.MessageService.ToggleReaction(req)
+	JsonBack(c, message, ret, rsp)
+}
+
+// SearchMessages 搜索聊天记录
+func SearchMessages(c *gin.Context) {
+	var req request.SearchMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.UserId = authUuid(c)
+	message, rsp, ret := gorm.MessageService.SearchMessages(req)
 	JsonBack(c, message, ret, rsp)
 }
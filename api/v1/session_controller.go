@@ -20,37 +20,20 @@ func OpenSession(c *gin.Context) {
 		})
 		return
 	}
+	openSessionReq.SendId = authUuid(c)
 	message, sessionId, ret := gorm.SessionService.OpenSession(openSessionReq)
 	JsonBack(c, message, ret, sessionId)
 }
 
 // GetUserSessionList 获取用户会话列表
 func GetUserSessionList(c *gin.Context) {
-	var getUserSessionListReq request.OwnlistRequest
-	if err := c.BindJSON(&getUserSessionListReq); err != nil {
-		zlog.Error(err.Error())
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"message": constants.SYSTEM_ERROR,
-		})
-		return
-	}
-	message, sessionList, ret := gorm.SessionService.GetUserSessionList(getUserSessionListReq.OwnerId)
+	message, sessionList, ret := gorm.SessionService.GetUserSessionList(authUuid(c))
 	JsonBack(c, message, ret, sessionList)
 }
 
 // GetGroupSessionList 获取用户群聊列表
 func GetGroupSessionList(c *gin.Context) {
-	var getGroupListReq request.OwnlistRequest
-	if err := c.BindJSON(&getGroupListReq); err != nil {
-		zlog.Error(err.Error())
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"message": constants.SYSTEM_ERROR,
-		})
-		return
-	}
-	message, groupList, ret := gorm.SessionService.GetGroupSessionList(getGroupListReq.OwnerId)
+	message, groupList, ret := gorm.SessionService.GetGroupSessionList(authUuid(c))
 	JsonBack(c, message, ret, groupList)
 }
 
@@ -65,6 +48,7 @@ func DeleteSession(c *gin.Context) {
 		})
 		return
 	}
+	deleteSessionReq.OwnerId = authUuid(c)
 	message, ret := gorm.SessionService.DeleteSession(deleteSessionReq.OwnerId, deleteSessionReq.SessionId)
 	JsonBack(c, message, ret, nil)
 }
@@ -80,6 +64,23 @@ func CheckOpenSessionAllowed(c *gin.Context) {
 		})
 		return
 	}
+	req.SendId = authUuid(c)
 	message, res, ret := gorm.SessionService.CheckOpenSessionAllowed(req.SendId, req.ReceiveId)
 	JsonBack(c, message, ret, res)
 }
+
+// MarkSessionRead 标记会话已读
+func MarkSessionRead(c *gin.Context) {
+	var req request.MarkSessionReadRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.OwnerId = authUuid(c)
+	message, ret := gorm.SessionService.MarkSessionRead(req)
+	JsonBack(c, message, ret, nil)
+}
@@ -0,0 +1,107 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/service/upload"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/zlog"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// multipartOverhead 请求体中除文件外的表单字段和边界
+const multipartOverhead = 1 << 20
+
+// UploadAvatar 上传头像，表单字段为file
+func UploadAvatar(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, constants.AVATAR_MAX_SIZE*1024+multipartOverhead)
+	fileHeader, ok := formFile(c)
+	if !ok {
+		return
+	}
+	message, rsp, ret := upload.UploadService.UploadAvatar(c.Request.Context(), fileHeader)
+	JsonBack(c, message, ret, rsp)
+}
+
+// UploadFile 上传聊天文件，表单字段为file，type为消息类型，语音消息会解析时长
+func UploadFile(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, constants.UPLOAD_MAX_SIZE*1024+multipartOverhead)
+	fileHeader, ok := formFile(c)
+	if !ok {
+		return
+	}
+	messageType, _ := strconv.Atoi(c.PostForm("type"))
+	message, rsp, ret := upload.UploadService.UploadFile(c.Request.Context(), fileHeader, messageType)
+	JsonBack(c, message, ret, rsp)
+}
+
+// InitUpload 开始分片上传，返回upload_id和分片大小，相同文件上传过时直接返回文件
+func InitUpload(c *gin.Context) {
+	var req request.InitUploadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.UserId = authUuid(c)
+	message, rsp, ret := upload.UploadService.InitUpload(req)
+	JsonBack(c, message, ret, rsp)
+}
+
+// UploadChunk 上传一个分片，表单字段为upload_id、offset、checksum和file
+func UploadChunk(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, constants.CHUNK_SIZE*1024+multipartOverhead)
+	fileHeader, ok := formFile(c)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseInt(c.PostForm("offset"), 10, 64)
+	if err != nil {
+		JsonBack(c, "分片偏移量不合法", -2, nil)
+		return
+	}
+	req := request.UploadChunkRequest{
+		UserId:   authUuid(c),
+		UploadId: c.PostForm("upload_id"),
+		Offset:   offset,
+		Checksum: c.PostForm("checksum"),
+	}
+	message, rsp, ret := upload.UploadService.UploadChunk(req, fileHeader)
+	JsonBack(c, message, ret, rsp)
+}
+
+// CompleteUpload 所有分片上传后合并，返回的字段和uploadFile一致
+func CompleteUpload(c *gin.Context) {
+	var req request.CompleteUploadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.UserId = authUuid(c)
+	message, rsp, ret := upload.UploadService.CompleteUpload(c.Request.Context(), req)
+	JsonBack(c, message, ret, rsp)
+}
+
+// formFile 读取上传的文件，失败时直接返回错误
+func formFile(c *gin.Context) (*multipart.FileHeader, bool) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			JsonBack(c, "文件过大", -2, nil)
+			return nil, false
+		}
+		zlog.Error(err.Error())
+		JsonBack(c, "请选择要上传的文件", -2, nil)
+		return nil, false
+	}
+	return fileHeader, true
+}
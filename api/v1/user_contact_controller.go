@@ -12,30 +12,13 @@ import (
 
 // GetUserList 获取联系人列表
 func GetUserList(c *gin.Context) {
-	var myUserListReq request.OwnlistRequest
-	if err := c.BindJSON(&myUserListReq); err != nil {
-		zlog.Error(err.Error())
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"message": constants.SYSTEM_ERROR,
-		})
-	}
-	message, userList, ret := gorm.UserContactService.GetUserList(myUserListReq.OwnerId)
+	message, userList, ret := gorm.UserContactService.GetUserList(authUuid(c))
 	JsonBack(c, message, ret, userList)
 }
 
 // LoadMyJoinedGroup 获取我加入的群聊
 func LoadMyJoinedGroup(c *gin.Context) {
-	var loadMyJoinedGroupReq request.OwnlistRequest
-	if err := c.BindJSON(&loadMyJoinedGroupReq); err != nil {
-		zlog.Error(err.Error())
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"message": constants.SYSTEM_ERROR,
-		})
-		return
-	}
-	message, groupList, ret := gorm.UserContactService.LoadMyJoinedGroup(loadMyJoinedGroupReq.OwnerId)
+	message, groupList, ret := gorm.UserContactService.LoadMyJoinedGroup(authUuid(c))
 	JsonBack(c, message, ret, groupList)
 }
 
@@ -66,6 +49,7 @@ func DeleteContact(c *gin.Context) {
 		})
 		return
 	}
+	deleteContactReq.OwnerId = authUuid(c)
 	message, ret := gorm.UserContactService.DeleteContact(deleteContactReq.OwnerId, deleteContactReq.ContactId)
 	JsonBack(c, message, ret, nil)
 }
@@ -81,22 +65,14 @@ func ApplyContact(c *gin.Context) {
 		})
 		return
 	}
+	applyContactReq.OwnerId = authUuid(c)
 	message, ret := gorm.UserContactService.ApplyContact(applyContactReq)
 	JsonBack(c, message, ret, nil)
 }
 
 // GetNewContactList 获取新的联系人申请列表
 func GetNewContactList(c *gin.Context) {
-	var req request.OwnlistRequest
-	if err := c.BindJSON(&req); err != nil {
-		zlog.Error(err.Error())
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"message": constants.SYSTEM_ERROR,
-		})
-		return
-	}
-	message, data, ret := gorm.UserContactService.GetNewContactList(req.OwnerId)
+	message, data, ret := gorm.UserContactService.GetNewContactList(authUuid(c))
 	JsonBack(c, message, ret, data)
 }
 
@@ -111,7 +87,12 @@ func PassContactApply(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.PassContactApply(passContactApplyReq.OwnerId, passContactApplyReq.ContactId)
+	ownerId, message, ret := applyOwnerId(c, passContactApplyReq.OwnerId)
+	if ret != 0 {
+		JsonBack(c, message, ret, nil)
+		return
+	}
+	message, ret = gorm.UserContactService.PassContactApply(ownerId, passContactApplyReq.ContactId)
 	JsonBack(c, message, ret, nil)
 }
 
@@ -126,6 +107,7 @@ func BlackContact(c *gin.Context) {
 		})
 		return
 	}
+	req.OwnerId = authUuid(c)
 	message, ret := gorm.UserContactService.BlackContact(req.OwnerId, req.ContactId)
 	JsonBack(c, message, ret, nil)
 }
@@ -141,6 +123,7 @@ func CancelBlackContact(c *gin.Context) {
 		})
 		return
 	}
+	req.OwnerId = authUuid(c)
 	message, ret := gorm.UserContactService.CancelBlackContact(req.OwnerId, req.ContactId)
 	JsonBack(c, message, ret, nil)
 }
@@ -156,6 +139,10 @@ func GetAddGroupList(c *gin.Context) {
 		})
 		return
 	}
+	if message, ret := gorm.GroupInfoService.CheckGroupOwner(req.GroupId, authUuid(c)); ret != 0 {
+		JsonBack(c, message, ret, nil)
+		return
+	}
 	message, data, ret := gorm.UserContactService.GetAddGroupList(req.GroupId)
 	JsonBack(c, message, ret, data)
 }
@@ -171,7 +158,12 @@ func RefuseContactApply(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.RefuseContactApply(passContactApplyReq.OwnerId, passContactApplyReq.ContactId)
+	ownerId, message, ret := applyOwnerId(c, passContactApplyReq.OwnerId)
+	if ret != 0 {
+		JsonBack(c, message, ret, nil)
+		return
+	}
+	message, ret = gorm.UserContactService.RefuseContactApply(ownerId, passContactApplyReq.ContactId)
 	JsonBack(c, message, ret, nil)
 }
 
@@ -186,6 +178,23 @@ func BlackApply(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.BlackApply(req.OwnerId, req.ContactId)
+	ownerId, message, ret := applyOwnerId(c, req.OwnerId)
+	if ret != 0 {
+		JsonBack(c, message, ret, nil)
+		return
+	}
+	message, ret = gorm.UserContactService.BlackApply(ownerId, req.ContactId)
 	JsonBack(c, message, ret, nil)
 }
+
+// applyOwnerId 处理申请的一方：好友申请是登录用户本人，加群申请是群聊，需要登录用户是群主
+func applyOwnerId(c *gin.Context, groupId string) (string, string, int) {
+	uuid := authUuid(c)
+	if groupId == "" || groupId == uuid {
+		return uuid, "", 0
+	}
+	if message, ret := gorm.GroupInfoService.CheckGroupOwner(groupId, uuid); ret != 0 {
+		return "", message, ret
+	}
+	return groupId, "", 0
+}
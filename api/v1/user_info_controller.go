@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go_chat/internal/dto/request"
+	"go_chat/internal/service/auth"
 	"go_chat/internal/service/gorm"
 	"go_chat/pkg/constants"
 	"go_chat/pkg/zlog"
@@ -20,6 +21,7 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
+	loginReq.ClientIp = c.ClientIP()
 	message, userInfo, ret := gorm.UserInfoService.Login(loginReq)
 	JsonBack(c, message, ret, userInfo)
 }
@@ -34,7 +36,8 @@ func SendSmsCode(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserInfoService.SendSmsCode(req.Telephone)
+	req.ClientIp = c.ClientIP()
+	message, ret := gorm.UserInfoService.SendSmsCode(req)
 	JsonBack(c, message, ret, nil)
 }
 
@@ -65,6 +68,7 @@ func SmsLogin(c *gin.Context) {
 		})
 		return
 	}
+	req.ClientIp = c.ClientIP()
 	message, userInfo, ret := gorm.UserInfoService.SmsLogin(req)
 	JsonBack(c, message, ret, userInfo)
 }
@@ -80,10 +84,91 @@ func UpdateUserInfo(c *gin.Context) {
 		})
 		return
 	}
+	req.Uuid = authUuid(c)
+	req.ClientIp = c.ClientIP()
 	message, ret := gorm.UserInfoService.UpdateUserInfo(req)
 	JsonBack(c, message, ret, nil)
 }
 
+// VerifyEmail 验证新邮箱
+func VerifyEmail(c *gin.Context) {
+	var req request.VerifyEmailRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	message, ret := gorm.UserInfoService.VerifyEmail(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// SendEmailCode 发送邮箱登录验证码
+func SendEmailCode(c *gin.Context) {
+	var req request.SendEmailCodeRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.ClientIp = c.ClientIP()
+	message, ret := gorm.UserInfoService.SendEmailCode(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// EmailLogin 邮箱登录
+func EmailLogin(c *gin.Context) {
+	var req request.EmailLoginRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.ClientIp = c.ClientIP()
+	message, userInfo, ret := gorm.UserInfoService.EmailLogin(req)
+	JsonBack(c, message, ret, userInfo)
+}
+
+// ForgotPassword 发送重置密码邮件
+func ForgotPassword(c *gin.Context) {
+	var req request.ForgotPasswordRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.ClientIp = c.ClientIP()
+	message, ret := gorm.UserInfoService.ForgotPassword(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// ResetPassword 通过邮件中的链接重置密码
+func ResetPassword(c *gin.Context) {
+	var req request.ResetPasswordRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.UserInfoService.ResetPassword(req)
+	JsonBack(c, message, ret, nil)
+}
+
 // GetUserInfo 获取用户信息
 func GetUserInfo(c *gin.Context) {
 	var req request.GetUserInfoRequest
@@ -98,3 +183,149 @@ func GetUserInfo(c *gin.Context) {
 	message, userInfo, ret := gorm.UserInfoService.GetUserInfo(req.Uuid)
 	JsonBack(c, message, ret, userInfo)
 }
+
+// ChangePassword 修改密码
+func ChangePassword(c *gin.Context) {
+	var req request.ChangePasswordRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	message, ret := gorm.UserInfoService.ChangePassword(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// RefreshToken 刷新token
+func RefreshToken(c *gin.Context) {
+	var req request.RefreshTokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, tokenRsp, ret := auth.AuthService.RefreshToken(req.RefreshToken, c.ClientIP())
+	JsonBack(c, message, ret, tokenRsp)
+}
+
+// Logout 退出登录
+func Logout(c *gin.Context) {
+	message, ret := auth.AuthService.Logout(authUuid(c), authSid(c))
+	JsonBack(c, message, ret, nil)
+}
+
+// GetDevices 我的登录设备
+func GetDevices(c *gin.Context) {
+	message, deviceList, ret := auth.AuthService.GetDevices(authUuid(c), authSid(c))
+	JsonBack(c, message, ret, deviceList)
+}
+
+// RevokeDevice 下线某个设备
+func RevokeDevice(c *gin.Context) {
+	var req request.RevokeDeviceRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	req.CurrentSid = authSid(c)
+	message, ret := auth.AuthService.RevokeDevice(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// RevokeOtherDevices 下线其他所有设备
+func RevokeOtherDevices(c *gin.Context) {
+	message, ret := auth.AuthService.RevokeOtherDevices(authUuid(c), authSid(c))
+	JsonBack(c, message, ret, nil)
+}
+
+// GetUserInfoList 管理员查看用户列表
+func GetUserInfoList(c *gin.Context) {
+	var req request.GetUserInfoListRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	message, userList, ret := gorm.UserInfoService.GetUserInfoList(req)
+	JsonBack(c, message, ret, userList)
+}
+
+// AbleUsers 管理员启用用户
+func AbleUsers(c *gin.Context) {
+	var req request.ManageUsersRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	message, ret := gorm.UserInfoService.AbleUsers(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// DisableUsers 管理员禁用用户
+func DisableUsers(c *gin.Context) {
+	var req request.ManageUsersRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	message, ret := gorm.UserInfoService.DisableUsers(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// DeleteUsers 管理员删除用户
+func DeleteUsers(c *gin.Context) {
+	var req request.ManageUsersRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	message, ret := gorm.UserInfoService.DeleteUsers(req)
+	JsonBack(c, message, ret, nil)
+}
+
+// SetAdmin 设置或取消管理员
+func SetAdmin(c *gin.Context) {
+	var req request.SetAdminRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	req.Uuid = authUuid(c)
+	message, ret := gorm.UserInfoService.SetAdmin(req)
+	JsonBack(c, message, ret, nil)
+}
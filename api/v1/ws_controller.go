@@ -0,0 +1,21 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"go_chat/internal/service/chat"
+	"go_chat/pkg/zlog"
+)
+
+// WsLogin wss登录
+func WsLogin(c *gin.Context) {
+	if err := chat.NewClientInit(c, authUuid(c), authSid(c)); err != nil {
+		// 升级失败时gorilla已经写回了错误响应
+		zlog.Error(err.Error())
+	}
+}
+
+// WsLogout wss登出
+func WsLogout(c *gin.Context) {
+	message, ret := chat.ClientLogout(authUuid(c), authSid(c))
+	JsonBack(c, message, ret, nil)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go_chat/internal/config"
+	"go_chat/internal/dao"
+	"go_chat/internal/https_server"
+	"go_chat/internal/service/auth"
+	"go_chat/internal/service/cache"
+	"go_chat/internal/service/chat"
+	"go_chat/internal/service/gorm"
+	"go_chat/internal/service/kafka"
+	"go_chat/internal/service/mail"
+	myredis "go_chat/internal/service/redis"
+	"go_chat/internal/service/sms"
+	"go_chat/internal/service/storage"
+	"go_chat/internal/service/upload"
+	"go_chat/pkg/zlog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	configPath := flag.String("config", "", "配置文件路径，未指定时读取环境变量 "+config.ENV_CONFIG_PATH+" 或默认路径")
+	flag.Parse()
+
+	conf, err := config.LoadConfig(*configPath)
+	if err != nil {
+		zlog.Fatal(err.Error())
+	}
+	if err := conf.Validate(); err != nil {
+		zlog.Fatal("配置不合法：\n" + err.Error())
+	}
+	if err := zlog.Init(conf.LogPath); err != nil {
+		zlog.Fatal(err.Error())
+	}
+
+	if err := dao.Init(); err != nil {
+		zlog.Fatal(err.Error())
+	}
+	if err := myredis.Init(); err != nil {
+		zlog.Fatal(err.Error())
+	}
+	useKafka := conf.KafkaConfig.MessageMode == "kafka"
+	if useKafka {
+		kafka.KafkaService.KafkaInit()
+	}
+
+	// 组装依赖
+	store := dao.NewGormStore(dao.GormDB)
+	redisCache := cache.NewRedisCache()
+	smsSender, err := sms.NewFromConfig(conf)
+	if err != nil {
+		zlog.Fatal(err.Error())
+	}
+	sms.Init(redisCache, smsSender)
+	mailer, err := mail.NewFromConfig(conf)
+	if err != nil {
+		zlog.Fatal(err.Error())
+	}
+	mail.Init(mailer)
+	chat.Init(store)
+	auth.Init(redisCache, store, chat.ChatServer)
+	gorm.Init(store, redisCache, auth.AuthService, chat.ChatServer)
+	storageCtx, cancelStorage := context.WithTimeout(context.Background(), shutdownTimeout)
+	avatars, files, err := storage.NewFromConfig(storageCtx, conf)
+	cancelStorage()
+	if err != nil {
+		zlog.Fatal(err.Error())
+	}
+	upload.Init(avatars, files, redisCache)
+	cleanCtx, stopClean := context.WithCancel(context.Background())
+	go upload.CleanChunks(cleanCtx)
+	go auth.AuthService.CleanSessions(cleanCtx)
+	go chat.ChatServer.Start()
+
+	https_server.Init()
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", conf.MainConfig.Host, conf.MainConfig.Port),
+		Handler: https_server.GE,
+	}
+	go func() {
+		zlog.Info("服务启动，监听 " + srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zlog.Fatal(err.Error())
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	zlog.Info("收到退出信号，开始关闭服务")
+
+	// 先停止接收新请求并等待进行中的请求结束，websocket连接已被劫持，不在此列
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		zlog.Error(err.Error())
+	}
+	// 断开所有websocket连接，停止消息分发
+	chat.ChatServer.Close()
+	stopClean()
+	if useKafka {
+		kafka.KafkaService.KafkaClose()
+	}
+	if err := myredis.Close(); err != nil {
+		zlog.Error(err.Error())
+	}
+	if sqlDB, err := dao.GormDB.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			zlog.Error(err.Error())
+		}
+	}
+	zlog.Info("服务已退出")
+}
@@ -1,56 +1,117 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"github.com/BurntSushi/toml"
 	"log"
+	"os"
+	"reflect"
+	"strconv"
 	"time"
 )
 
 type MainConfig struct {
-	AppName string `toml:"appName"`
-	Host    string `toml:"host"`
-	Port    int    `toml:"port"`
+	AppName string `toml:"appName" env:"GOCHAT_APP_NAME"`
+	Host    string `toml:"host" env:"GOCHAT_HOST"`
+	Port    int    `toml:"port" env:"GOCHAT_PORT"`
+	// TrustedProxies 逗号分隔的反向代理IP或CIDR，只有来自这些地址的X-Forwarded-For才被信任，为空时直接使用连接的IP
+	TrustedProxies string `toml:"trustedProxies" env:"GOCHAT_TRUSTED_PROXIES"`
 }
 
 type MysqlConfig struct {
-	Host         string `toml:"host"`
-	Port         int    `toml:"port"`
-	User         string `toml:"user"`
-	Password     string `toml:"password"`
-	DatabaseName string `toml:"databaseName"`
+	Host         string `toml:"host" env:"GOCHAT_MYSQL_HOST"`
+	Port         int    `toml:"port" env:"GOCHAT_MYSQL_PORT"`
+	User         string `toml:"user" env:"GOCHAT_MYSQL_USER"`
+	Password     string `toml:"password" env:"GOCHAT_MYSQL_PASSWORD"`
+	DatabaseName string `toml:"databaseName" env:"GOCHAT_MYSQL_DATABASE_NAME"`
 }
 
 type RedisConfig struct {
-	Host     string `toml:"host"`
-	Port     int    `toml:"port"`
-	Password string `toml:"password"`
-	Db       int    `toml:"db"`
+	Host     string `toml:"host" env:"GOCHAT_REDIS_HOST"`
+	Port     int    `toml:"port" env:"GOCHAT_REDIS_PORT"`
+	Password string `toml:"password" env:"GOCHAT_REDIS_PASSWORD"`
+	Db       int    `toml:"db" env:"GOCHAT_REDIS_DB"`
 }
 
 type AuthCodeConfig struct {
-	AccessKeyID     string `toml:"accessKeyID"`
-	AccessKeySecret string `toml:"accessKeySecret"`
-	SignName        string `toml:"signName"`
-	TemplateCode    string `toml:"templateCode"`
+	AccessKeyID     string `toml:"accessKeyID" env:"GOCHAT_AUTH_CODE_ACCESS_KEY_ID"`
+	AccessKeySecret string `toml:"accessKeySecret" env:"GOCHAT_AUTH_CODE_ACCESS_KEY_SECRET"`
+	SignName        string `toml:"signName" env:"GOCHAT_AUTH_CODE_SIGN_NAME"`
+	TemplateCode    string `toml:"templateCode" env:"GOCHAT_AUTH_CODE_TEMPLATE_CODE"`
+	Provider        string `toml:"provider" env:"GOCHAT_AUTH_CODE_PROVIDER"`
+	GatewayURL      string `toml:"gatewayURL" env:"GOCHAT_AUTH_CODE_GATEWAY_URL"`
+	GatewayToken    string `toml:"gatewayToken" env:"GOCHAT_AUTH_CODE_GATEWAY_TOKEN"`
 }
 
 type LogConfig struct {
-	LogPath string `toml:"logPath"`
+	LogPath string `toml:"logPath" env:"GOCHAT_LOG_PATH"`
 }
 
 type KafkaConfig struct {
-	MessageMode string        `toml:"messageMode"`
-	HostPort    string        `toml:"hostPort"`
-	LoginTopic  string        `toml:"loginTopic"`
-	LogoutTopic string        `toml:"logoutTopic"`
-	ChatTopic   string        `toml:"chatTopic"`
-	Partition   int           `toml:"partition"`
-	Timeout     time.Duration `toml:"timeout"`
+	MessageMode string        `toml:"messageMode" env:"GOCHAT_KAFKA_MESSAGE_MODE"`
+	HostPort    string        `toml:"hostPort" env:"GOCHAT_KAFKA_HOST_PORT"`
+	LoginTopic  string        `toml:"loginTopic" env:"GOCHAT_KAFKA_LOGIN_TOPIC"`
+	LogoutTopic string        `toml:"logoutTopic" env:"GOCHAT_KAFKA_LOGOUT_TOPIC"`
+	ChatTopic   string        `toml:"chatTopic" env:"GOCHAT_KAFKA_CHAT_TOPIC"`
+	Partition   int           `toml:"partition" env:"GOCHAT_KAFKA_PARTITION"`
+	Timeout     time.Duration `toml:"timeout" env:"GOCHAT_KAFKA_TIMEOUT"`
+}
+
+type TokenConfig struct {
+	Secret             string        `toml:"secret" env:"GOCHAT_TOKEN_SECRET"`
+	AccessTokenExpire  time.Duration `toml:"accessTokenExpire" env:"GOCHAT_TOKEN_ACCESS_TOKEN_EXPIRE"`
+	RefreshTokenExpire time.Duration `toml:"refreshTokenExpire" env:"GOCHAT_TOKEN_REFRESH_TOKEN_EXPIRE"`
 }
 
 type StaticSrcConfig struct {
-	StaticAvatarPath string `toml:"staticAvatarPath"`
-	StaticFilePath   string `toml:"staticFilePath"`
+	StaticAvatarPath string `toml:"staticAvatarPath" env:"GOCHAT_STATIC_AVATAR_PATH"`
+	StaticFilePath   string `toml:"staticFilePath" env:"GOCHAT_STATIC_FILE_PATH"`
+}
+
+type StorageConfig struct {
+	Backend     string        `toml:"backend" env:"GOCHAT_STORAGE_BACKEND"`
+	Endpoint    string        `toml:"endpoint" env:"GOCHAT_STORAGE_ENDPOINT"`
+	AccessKey   string        `toml:"accessKey" env:"GOCHAT_STORAGE_ACCESS_KEY"`
+	SecretKey   string        `toml:"secretKey" env:"GOCHAT_STORAGE_SECRET_KEY"`
+	Bucket      string        `toml:"bucket" env:"GOCHAT_STORAGE_BUCKET"`
+	Region      string        `toml:"region" env:"GOCHAT_STORAGE_REGION"`
+	UseSSL      bool          `toml:"useSSL" env:"GOCHAT_STORAGE_USE_SSL"`
+	PublicURL   string        `toml:"publicURL" env:"GOCHAT_STORAGE_PUBLIC_URL"`
+	ChunkDir    string        `toml:"chunkDir" env:"GOCHAT_STORAGE_CHUNK_DIR"`
+	ChunkExpire time.Duration `toml:"chunkExpire" env:"GOCHAT_STORAGE_CHUNK_EXPIRE"`
+}
+
+type MailConfig struct {
+	MailProvider     string `toml:"provider" env:"GOCHAT_MAIL_PROVIDER"`
+	SmtpHost         string `toml:"smtpHost" env:"GOCHAT_MAIL_SMTP_HOST"`
+	SmtpPort         int    `toml:"smtpPort" env:"GOCHAT_MAIL_SMTP_PORT"`
+	SmtpUsername     string `toml:"smtpUsername" env:"GOCHAT_MAIL_SMTP_USERNAME"`
+	SmtpPassword     string `toml:"smtpPassword" env:"GOCHAT_MAIL_SMTP_PASSWORD"`
+	SmtpTLS          string `toml:"smtpTLS" env:"GOCHAT_MAIL_SMTP_TLS"`
+	MailFrom         string `toml:"from" env:"GOCHAT_MAIL_FROM"`
+	PasswordResetURL string `toml:"passwordResetURL" env:"GOCHAT_MAIL_PASSWORD_RESET_URL"`
+}
+
+// RateLimitConfig 登录和短信验证码的频率限制，为0时使用默认值
+type RateLimitConfig struct {
+	LoginWindow        time.Duration `toml:"loginWindow" env:"GOCHAT_RATE_LIMIT_LOGIN_WINDOW"`
+	LoginPhoneLimit    int           `toml:"loginPhoneLimit" env:"GOCHAT_RATE_LIMIT_LOGIN_PHONE_LIMIT"`
+	LoginIpLimit       int           `toml:"loginIpLimit" env:"GOCHAT_RATE_LIMIT_LOGIN_IP_LIMIT"`
+	PasswordFailLimit  int           `toml:"passwordFailLimit" env:"GOCHAT_RATE_LIMIT_PASSWORD_FAIL_LIMIT"`
+	LockoutBase        time.Duration `toml:"lockoutBase" env:"GOCHAT_RATE_LIMIT_LOCKOUT_BASE"`
+	LockoutMax         time.Duration `toml:"lockoutMax" env:"GOCHAT_RATE_LIMIT_LOCKOUT_MAX"`
+	SmsWindow          time.Duration `toml:"smsWindow" env:"GOCHAT_RATE_LIMIT_SMS_WINDOW"`
+	SmsPhoneLimit      int           `toml:"smsPhoneLimit" env:"GOCHAT_RATE_LIMIT_SMS_PHONE_LIMIT"`
+	SmsIpLimit         int           `toml:"smsIpLimit" env:"GOCHAT_RATE_LIMIT_SMS_IP_LIMIT"`
+	SmsPhoneDailyQuota int           `toml:"smsPhoneDailyQuota" env:"GOCHAT_RATE_LIMIT_SMS_PHONE_DAILY_QUOTA"`
+	SmsIpDailyQuota    int           `toml:"smsIpDailyQuota" env:"GOCHAT_RATE_LIMIT_SMS_IP_DAILY_QUOTA"`
+	SmsCodeMaxAttempts int           `toml:"smsCodeMaxAttempts" env:"GOCHAT_RATE_LIMIT_SMS_CODE_MAX_ATTEMPTS"`
+}
+
+type MessageConfig struct {
+	RecallWindow time.Duration `toml:"recallWindow" env:"GOCHAT_MESSAGE_RECALL_WINDOW"`
+	EditWindow   time.Duration `toml:"editWindow" env:"GOCHAT_MESSAGE_EDIT_WINDOW"`
 }
 
 type Config struct {
@@ -60,30 +121,222 @@ type Config struct {
 	AuthCodeConfig  `toml:"authCodeConfig"`
 	LogConfig       `toml:"logConfig"`
 	KafkaConfig     `toml:"kafkaConfig"`
+	TokenConfig     `toml:"tokenConfig"`
 	StaticSrcConfig `toml:"staticSrcConfig"`
+	MessageConfig   `toml:"messageConfig"`
+	StorageConfig   `toml:"storageConfig"`
+	RateLimitConfig `toml:"rateLimitConfig"`
+	MailConfig      `toml:"mailConfig"`
+}
+
+// ENV_CONFIG_PATH 指定配置文件路径的环境变量，优先级低于 -config 参数
+const ENV_CONFIG_PATH = "GOCHAT_CONFIG"
+
+// defaultConfigPaths 未指定路径时依次查找
+var defaultConfigPaths = []string{
+	"./configs/config.toml",
+	"/etc/go_chat/config.toml",
 }
 
 var config *Config
 
-func LoadConfig() error {
-	if _, err := toml.DecodeFile("C:\\Users\\Administrator\\Desktop\\go_chat\\configs\\config.toml", config); err != nil {
-		log.Fatal(err.Error())
-		return err
+// LoadConfig 加载配置文件，再用环境变量覆盖
+// path为空时依次尝试 GOCHAT_CONFIG 和默认路径，都不存在时只使用环境变量
+func LoadConfig(path string) (*Config, error) {
+	conf := new(Config)
+	path, err := resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if _, err := toml.DecodeFile(path, conf); err != nil {
+			return nil, fmt.Errorf("解析配置文件%s失败: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(conf).Elem()); err != nil {
+		return nil, err
+	}
+	config = conf
+	return conf, nil
+}
+
+// resolvePath 确定配置文件路径，显式指定的路径必须存在
+func resolvePath(path string) (string, error) {
+	if path == "" {
+		path = os.Getenv(ENV_CONFIG_PATH)
+	}
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("配置文件%s不可用: %w", path, err)
+		}
+		return path, nil
+	}
+	for _, p := range defaultConfigPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// applyEnv 按字段的env标签用环境变量覆盖配置，解析失败的字段一并返回
+func applyEnv(v reflect.Value) error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int, reflect.Int64:
+			// time.Duration 与toml中一致，按整数读取，单位由使用方决定
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("环境变量%s=%q不是整数", name, value))
+				continue
+			}
+			field.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("环境变量%s=%q不是布尔值", name, value))
+				continue
+			}
+			field.SetBool(b)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate 校验配置，一次返回所有不合法的字段
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	validPort := func(port int) bool {
+		return port > 0 && port < 65536
 	}
 
-	//// Ubuntu22.04云服务器部署
-	//if _, err := toml.DecodeFile("/root/project/go_chat/configs/config.toml", config); err != nil {
-	//	log.Fatal(err.Error())
-	//	return err
-	//}
+	check(c.AppName != "", "mainConfig.appName 不能为空")
+	check(validPort(c.MainConfig.Port), "mainConfig.port=%d 不是合法端口", c.MainConfig.Port)
+
+	check(c.MysqlConfig.Host != "", "mysqlConfig.host 不能为空")
+	check(validPort(c.MysqlConfig.Port), "mysqlConfig.port=%d 不是合法端口", c.MysqlConfig.Port)
+	check(c.MysqlConfig.User != "", "mysqlConfig.user 不能为空")
+	check(c.DatabaseName != "", "mysqlConfig.databaseName 不能为空")
+
+	check(c.RedisConfig.Host != "", "redisConfig.host 不能为空")
+	check(validPort(c.RedisConfig.Port), "redisConfig.port=%d 不是合法端口", c.RedisConfig.Port)
+	check(c.Db >= 0, "redisConfig.db=%d 不能为负数", c.Db)
+
+	check(c.LogPath != "", "logConfig.logPath 不能为空")
+
+	switch c.MessageMode {
+	case "", "channel":
+	case "kafka":
+		check(c.HostPort != "", "kafkaConfig.hostPort 不能为空")
+		check(c.ChatTopic != "", "kafkaConfig.chatTopic 不能为空")
+		check(c.Timeout > 0, "kafkaConfig.timeout 必须大于0")
+	default:
+		check(false, "kafkaConfig.messageMode=%q 只能是 channel 或 kafka", c.MessageMode)
+	}
+
+	check(len(c.Secret) >= 16, "tokenConfig.secret 长度不能少于16")
+	check(c.AccessTokenExpire > 0, "tokenConfig.accessTokenExpire 必须大于0")
+	check(c.RefreshTokenExpire > 0, "tokenConfig.refreshTokenExpire 必须大于0")
+
+	switch c.Provider {
+	case "", "aliyun":
+		check(c.AccessKeyID != "", "authCodeConfig.accessKeyID 不能为空")
+		check(c.AccessKeySecret != "", "authCodeConfig.accessKeySecret 不能为空")
+		check(c.SignName != "", "authCodeConfig.signName 不能为空")
+		check(c.TemplateCode != "", "authCodeConfig.templateCode 不能为空")
+	case "http":
+		check(c.GatewayURL != "", "authCodeConfig.gatewayURL 不能为空")
+	case "local":
+	default:
+		check(false, "authCodeConfig.provider=%q 只能是 aliyun、http 或 local", c.Provider)
+	}
+
+	check(c.StaticAvatarPath != "", "staticSrcConfig.staticAvatarPath 不能为空")
+	check(c.StaticFilePath != "", "staticSrcConfig.staticFilePath 不能为空")
+
+	switch c.StorageConfig.Backend {
+	case "", "local":
+	case "s3":
+		check(c.StorageConfig.Endpoint != "", "storageConfig.endpoint 不能为空")
+		check(c.StorageConfig.Bucket != "", "storageConfig.bucket 不能为空")
+		check(c.StorageConfig.AccessKey != "", "storageConfig.accessKey 不能为空")
+		check(c.StorageConfig.SecretKey != "", "storageConfig.secretKey 不能为空")
+	default:
+		check(false, "storageConfig.backend=%q 只能是 local 或 s3", c.StorageConfig.Backend)
+	}
+	check(c.ChunkExpire >= 0, "storageConfig.chunkExpire 不能小于0")
+
+	switch c.MailProvider {
+	case "", "smtp":
+		check(c.SmtpHost != "", "mailConfig.smtpHost 不能为空")
+		check(validPort(c.SmtpPort), "mailConfig.smtpPort=%d 不是合法端口", c.SmtpPort)
+		check(c.MailFrom != "", "mailConfig.from 不能为空")
+		switch c.SmtpTLS {
+		case "", "starttls", "tls", "none":
+		default:
+			check(false, "mailConfig.smtpTLS=%q 只能是 starttls、tls 或 none", c.SmtpTLS)
+		}
+	case "local":
+	default:
+		check(false, "mailConfig.provider=%q 只能是 smtp 或 local", c.MailProvider)
+	}
+	check(c.PasswordResetURL != "", "mailConfig.passwordResetURL 不能为空")
+
+	r := c.RateLimitConfig
+	for _, field := range []struct {
+		name  string
+		value int64
+	}{
+		{"loginWindow", int64(r.LoginWindow)},
+		{"loginPhoneLimit", int64(r.LoginPhoneLimit)},
+		{"loginIpLimit", int64(r.LoginIpLimit)},
+		{"passwordFailLimit", int64(r.PasswordFailLimit)},
+		{"lockoutBase", int64(r.LockoutBase)},
+		{"lockoutMax", int64(r.LockoutMax)},
+		{"smsWindow", int64(r.SmsWindow)},
+		{"smsPhoneLimit", int64(r.SmsPhoneLimit)},
+		{"smsIpLimit", int64(r.SmsIpLimit)},
+		{"smsPhoneDailyQuota", int64(r.SmsPhoneDailyQuota)},
+		{"smsIpDailyQuota", int64(r.SmsIpDailyQuota)},
+		{"smsCodeMaxAttempts", int64(r.SmsCodeMaxAttempts)},
+	} {
+		check(field.value >= 0, "rateLimitConfig.%s 不能小于0", field.name)
+	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
+// GetConfig 获取配置，未加载时按默认规则加载，加载失败返回空配置
 func GetConfig() *Config {
 	if config == nil {
-		config = new(Config)
-		_ = LoadConfig()
+		if _, err := LoadConfig(""); err != nil {
+			log.Println(err.Error())
+			config = new(Config)
+		}
 	}
 	return config
 }
@@ -0,0 +1,45 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"go_chat/pkg/enum/contact_apply/contact_apply_status_enum"
+	"gorm.io/gorm"
+)
+
+type gormApplyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormApplyRepository) Get(userId, contactId string) (*model.ContactApply, error) {
+	var apply model.ContactApply
+	if err := r.db.First(&apply, "user_id = ? AND contact_id = ?", userId, contactId).Error; err != nil {
+		return nil, err
+	}
+	return &apply, nil
+}
+
+func (r *gormApplyRepository) ListPendingByContact(contactId string) ([]model.ContactApply, error) {
+	var applyList []model.ContactApply
+	err := r.db.Where("contact_id = ? AND status = ?", contactId, contact_apply_status_enum.PENDING).Find(&applyList).Error
+	return applyList, err
+}
+
+func (r *gormApplyRepository) Create(apply *model.ContactApply) error {
+	return r.db.Create(apply).Error
+}
+
+func (r *gormApplyRepository) Save(apply *model.ContactApply) error {
+	return r.db.Save(apply).Error
+}
+
+func (r *gormApplyRepository) SoftDelete(userId, contactId string) error {
+	return r.db.Model(&model.ContactApply{}).Where("user_id = ? AND contact_id = ?", userId, contactId).Update("deleted_at", deletedNow()).Error
+}
+
+func (r *gormApplyRepository) SoftDeleteByContact(contactId string) error {
+	return r.db.Model(&model.ContactApply{}).Where("contact_id = ?", contactId).Update("deleted_at", deletedNow()).Error
+}
+
+func (r *gormApplyRepository) SoftDeleteByUser(userId string) error {
+	return r.db.Model(&model.ContactApply{}).Where("user_id = ?", userId).Update("deleted_at", deletedNow()).Error
+}
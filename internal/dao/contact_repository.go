@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+type gormContactRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormContactRepository) Get(userId, contactId string) (*model.UserContact, error) {
+	var contact model.UserContact
+	if err := r.db.First(&contact, "user_id = ? AND contact_id = ?", userId, contactId).Error; err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+func (r *gormContactRepository) ListByUser(userId string, excludeStatus ...int8) ([]model.UserContact, error) {
+	query := r.db.Order("created_at DESC").Where("user_id = ?", userId)
+	if len(excludeStatus) > 0 {
+		query = query.Where("status NOT IN ?", excludeStatus)
+	}
+	var contactList []model.UserContact
+	err := query.Find(&contactList).Error
+	return contactList, err
+}
+
+func (r *gormContactRepository) Create(contact *model.UserContact) error {
+	return r.db.Create(contact).Error
+}
+
+func (r *gormContactRepository) Save(contact *model.UserContact) error {
+	return r.db.Save(contact).Error
+}
+
+func (r *gormContactRepository) UpdateStatus(userId, contactId string, status int8) error {
+	return r.db.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", userId, contactId).Updates(map[string]interface{}{
+		"status":    status,
+		"update_at": time.Now(),
+	}).Error
+}
+
+func (r *gormContactRepository) SoftDelete(userId, contactId string, status *int8) error {
+	updates := map[string]interface{}{
+		"deleted_at": deletedNow(),
+	}
+	if status != nil {
+		updates["status"] = *status
+	}
+	return r.db.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", userId, contactId).Updates(updates).Error
+}
+
+func (r *gormContactRepository) SoftDeleteByContact(contactId string) error {
+	return r.db.Model(&model.UserContact{}).Where("contact_id = ?", contactId).Update("deleted_at", deletedNow()).Error
+}
+
+func (r *gormContactRepository) SoftDeleteByUser(userId string) error {
+	return r.db.Model(&model.UserContact{}).Where("user_id = ?", userId).Update("deleted_at", deletedNow()).Error
+}
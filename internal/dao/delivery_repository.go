@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type gormDeliveryRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeliveryRepository) GetCursor(userId, sid string) (*model.DeliveryCursor, error) {
+	var cursor model.DeliveryCursor
+	if err := r.db.First(&cursor, "user_id = ? AND sid = ?", userId, sid).Error; err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// Advance 第一次投递时插入，之后只在message更新时才覆盖
+func (r *gormDeliveryRepository) Advance(userId, sid string, message *model.Message) error {
+	cursor := model.DeliveryCursor{
+		UserId:     userId,
+		Sid:        sid,
+		MessageId:  message.Uuid,
+		MessageSeq: message.Id,
+		MessageAt:  message.CreatedAt,
+		UpdatedAt:  time.Now(),
+	}
+	res := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&cursor)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return r.db.Model(&model.DeliveryCursor{}).
+		Where("user_id = ? AND sid = ? AND (message_at < ? OR (message_at = ? AND message_seq < ?))", userId, sid, message.CreatedAt, message.CreatedAt, message.Id).
+		Updates(map[string]interface{}{
+			"message_id":  message.Uuid,
+			"message_seq": message.Id,
+			"message_at":  message.CreatedAt,
+			"updated_at":  cursor.UpdatedAt,
+		}).Error
+}
+
+func (r *gormDeliveryRepository) DeleteStale(userId string) error {
+	return r.db.Where("user_id = ? AND sid NOT IN (?)", userId,
+		r.db.Model(&model.DeviceSession{}).Select("sid").Where("user_id = ?", userId)).
+		Delete(&model.DeliveryCursor{}).Error
+}
+
+func (r *gormDeliveryRepository) DeleteOrphaned() (int64, error) {
+	res := r.db.Where("sid NOT IN (?)", r.db.Model(&model.DeviceSession{}).Select("sid")).Delete(&model.DeliveryCursor{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+type gormDeviceRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeviceRepository) GetBySid(sid string) (*model.DeviceSession, error) {
+	var device model.DeviceSession
+	if err := r.db.First(&device, "sid = ?", sid).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) GetByDevice(userId, deviceId string) (*model.DeviceSession, error) {
+	var device model.DeviceSession
+	if err := r.db.First(&device, "user_id = ? AND device_id = ?", userId, deviceId).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) ListByUser(userId string) ([]model.DeviceSession, error) {
+	var deviceList []model.DeviceSession
+	err := r.db.Where("user_id = ?", userId).Order("last_active_at DESC").Order("id DESC").Find(&deviceList).Error
+	return deviceList, err
+}
+
+func (r *gormDeviceRepository) Create(device *model.DeviceSession) error {
+	return r.db.Create(device).Error
+}
+
+func (r *gormDeviceRepository) Touch(sid, ip string, at time.Time) error {
+	updates := map[string]interface{}{"last_active_at": at}
+	if ip != "" {
+		updates["ip"] = ip
+	}
+	return r.db.Model(&model.DeviceSession{}).Where("sid = ?", sid).Updates(updates).Error
+}
+
+func (r *gormDeviceRepository) Delete(sid string) (int64, error) {
+	res := r.db.Where("sid = ?", sid).Delete(&model.DeviceSession{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *gormDeviceRepository) DeleteInactive(before time.Time) (int64, error) {
+	res := r.db.Where("last_active_at < ?", before).Delete(&model.DeviceSession{})
+	return res.RowsAffected, res.Error
+}
@@ -11,22 +11,36 @@ import (
 
 var GormDB *gorm.DB
 
-func init() {
+// Init 连接mysql并自动迁移表结构
+func Init() error {
 	conf := config.GetConfig()
 	user := conf.User
 	password := conf.MysqlConfig.Password
 	host := conf.MysqlConfig.Host
 	port := conf.MysqlConfig.Port
-	appName := conf.AppName
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, password, host, port, appName)
-	// dsn := fmt.Sprintf("%s@unix(/var/run/mysqld/mysqld.sock)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, appName)
+	databaseName := conf.DatabaseName
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, password, host, port, databaseName)
+	// dsn := fmt.Sprintf("%s@unix(/var/run/mysqld/mysqld.sock)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, databaseName)
 	var err error
-	GormDB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// 唯一索引冲突转换为 ErrDuplicatedKey
+	GormDB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
-		zlog.Fatal(err.Error())
+		return err
 	}
-	err = GormDB.AutoMigrate(&model.UserInfo{}, &model.GroupInfo{}, &model.UserContact{}, &model.Session{}, &model.ContactApply{}, &model.Message{}) // 自动迁移，如果没有建表，会自动创建对应的表
+	// 建唯一索引之前先清理重复的邮箱
+	if err := migrateUserEmails(GormDB); err != nil {
+		return err
+	}
+	err = GormDB.AutoMigrate(&model.UserInfo{}, &model.GroupInfo{}, &model.GroupMember{}, &model.UserContact{}, &model.Session{}, &model.ContactApply{}, &model.Message{}, &model.DeliveryCursor{}, &model.MessageReaction{}, &model.DeviceSession{}) // 自动迁移，如果没有建表，会自动创建对应的表
 	if err != nil {
-		zlog.Fatal(err.Error())
+		return err
+	}
+	if err := migrateGroupMembers(GormDB); err != nil {
+		return err
+	}
+	if err := migrateDeliveryCursors(GormDB); err != nil {
+		return err
 	}
+	zlog.Info("mysql连接成功")
+	return nil
 }
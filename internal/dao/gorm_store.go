@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 基于mysql的Store
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Users() UserRepository {
+	return &gormUserRepository{db: s.db}
+}
+
+func (s *gormStore) Groups() GroupRepository {
+	return &gormGroupRepository{db: s.db}
+}
+
+func (s *gormStore) GroupMembers() GroupMemberRepository {
+	return &gormGroupMemberRepository{db: s.db}
+}
+
+func (s *gormStore) Contacts() ContactRepository {
+	return &gormContactRepository{db: s.db}
+}
+
+func (s *gormStore) Sessions() SessionRepository {
+	return &gormSessionRepository{db: s.db}
+}
+
+func (s *gormStore) Applies() ApplyRepository {
+	return &gormApplyRepository{db: s.db}
+}
+
+func (s *gormStore) Messages() MessageRepository {
+	return &gormMessageRepository{db: s.db}
+}
+
+func (s *gormStore) Deliveries() DeliveryRepository {
+	return &gormDeliveryRepository{db: s.db}
+}
+
+func (s *gormStore) Reactions() ReactionRepository {
+	return &gormReactionRepository{db: s.db}
+}
+
+func (s *gormStore) Devices() DeviceRepository {
+	return &gormDeviceRepository{db: s.db}
+}
+
+func (s *gormStore) Searcher() MessageSearcher {
+	return &mysqlMessageSearcher{db: s.db}
+}
+
+func (s *gormStore) Transaction(fn func(tx Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// deletedNow 软删除时写入的deleted_at
+func deletedNow() gorm.DeletedAt {
+	return gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
@@ -0,0 +1,37 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+)
+
+type gormGroupMemberRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormGroupMemberRepository) Get(groupId, userId string) (*model.GroupMember, error) {
+	var member model.GroupMember
+	if err := r.db.First(&member, "group_id = ? AND user_id = ?", groupId, userId).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *gormGroupMemberRepository) ListByGroup(groupId string) ([]model.GroupMember, error) {
+	var memberList []model.GroupMember
+	err := r.db.Order("joined_at ASC, id ASC").Where("group_id = ?", groupId).Find(&memberList).Error
+	return memberList, err
+}
+
+func (r *gormGroupMemberRepository) Create(member *model.GroupMember) error {
+	return r.db.Create(member).Error
+}
+
+func (r *gormGroupMemberRepository) Delete(groupId, userId string) (int64, error) {
+	res := r.db.Where("group_id = ? AND user_id = ?", groupId, userId).Delete(&model.GroupMember{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *gormGroupMemberRepository) DeleteByGroup(groupId string) error {
+	return r.db.Where("group_id = ?", groupId).Delete(&model.GroupMember{}).Error
+}
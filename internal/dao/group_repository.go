@@ -0,0 +1,41 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+)
+
+type gormGroupRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormGroupRepository) GetByUuid(uuid string) (*model.GroupInfo, error) {
+	var group model.GroupInfo
+	if err := r.db.First(&group, "uuid = ?", uuid).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *gormGroupRepository) ListByOwner(ownerId string) ([]model.GroupInfo, error) {
+	var groupList []model.GroupInfo
+	err := r.db.Order("created_at DESC").Where("owner_id = ?", ownerId).Find(&groupList).Error
+	return groupList, err
+}
+
+func (r *gormGroupRepository) Create(group *model.GroupInfo) error {
+	return r.db.Create(group).Error
+}
+
+// Save 不写member_cnt，群人数只通过AddMemberCnt修改，避免覆盖并发的进退群
+func (r *gormGroupRepository) Save(group *model.GroupInfo) error {
+	return r.db.Omit("member_cnt").Save(group).Error
+}
+
+func (r *gormGroupRepository) SoftDelete(uuid string) error {
+	return r.db.Model(&model.GroupInfo{}).Where("uuid = ?", uuid).Update("deleted_at", deletedNow()).Error
+}
+
+func (r *gormGroupRepository) AddMemberCnt(uuid string, delta int) error {
+	return r.db.Model(&model.GroupInfo{}).Where("uuid = ?", uuid).Update("member_cnt", gorm.Expr("member_cnt + ?", delta)).Error
+}
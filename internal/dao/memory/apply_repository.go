@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"go_chat/pkg/enum/contact_apply/contact_apply_status_enum"
+)
+
+type applyRepository struct {
+	s *Store
+}
+
+func (r *applyRepository) Get(userId, contactId string) (*model.ContactApply, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, a := range r.s.applies {
+		if a.UserId == userId && a.ContactId == contactId && !a.DeletedAt.Valid {
+			return &a, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *applyRepository) ListPendingByContact(contactId string) ([]model.ContactApply, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var applyList []model.ContactApply
+	for _, a := range r.s.applies {
+		if a.ContactId == contactId && a.Status == contact_apply_status_enum.PENDING && !a.DeletedAt.Valid {
+			applyList = append(applyList, a)
+		}
+	}
+	return applyList, nil
+}
+
+func (r *applyRepository) Create(apply *model.ContactApply) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	apply.Id = r.s.genId()
+	r.s.applies = append(r.s.applies, *apply)
+	return nil
+}
+
+func (r *applyRepository) Save(apply *model.ContactApply) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.applies {
+		if r.s.applies[i].Id == apply.Id {
+			r.s.applies[i] = *apply
+			return nil
+		}
+	}
+	apply.Id = r.s.genId()
+	r.s.applies = append(r.s.applies, *apply)
+	return nil
+}
+
+func (r *applyRepository) SoftDelete(userId, contactId string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.applies {
+		a := &r.s.applies[i]
+		if a.UserId == userId && a.ContactId == contactId && !a.DeletedAt.Valid {
+			a.DeletedAt = deletedNow()
+		}
+	}
+	return nil
+}
+
+func (r *applyRepository) SoftDeleteByContact(contactId string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.applies {
+		a := &r.s.applies[i]
+		if a.ContactId == contactId && !a.DeletedAt.Valid {
+			a.DeletedAt = deletedNow()
+		}
+	}
+	return nil
+}
+
+func (r *applyRepository) SoftDeleteByUser(userId string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.applies {
+		a := &r.s.applies[i]
+		if a.UserId == userId && !a.DeletedAt.Valid {
+			a.DeletedAt = deletedNow()
+		}
+	}
+	return nil
+}
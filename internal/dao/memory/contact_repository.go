@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"sort"
+	"time"
+)
+
+type contactRepository struct {
+	s *Store
+}
+
+func (r *contactRepository) Get(userId, contactId string) (*model.UserContact, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, c := range r.s.contacts {
+		if c.UserId == userId && c.ContactId == contactId && !c.DeletedAt.Valid {
+			return &c, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *contactRepository) ListByUser(userId string, excludeStatus ...int8) ([]model.UserContact, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var contactList []model.UserContact
+	for _, c := range r.s.contacts {
+		if c.UserId != userId || c.DeletedAt.Valid || containsStatus(excludeStatus, c.Status) {
+			continue
+		}
+		contactList = append(contactList, c)
+	}
+	sort.SliceStable(contactList, func(i, j int) bool {
+		return contactList[i].CreatedAt.After(contactList[j].CreatedAt)
+	})
+	return contactList, nil
+}
+
+func (r *contactRepository) Create(contact *model.UserContact) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	contact.Id = r.s.genId()
+	r.s.contacts = append(r.s.contacts, *contact)
+	return nil
+}
+
+func (r *contactRepository) Save(contact *model.UserContact) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.contacts {
+		if r.s.contacts[i].Id == contact.Id {
+			r.s.contacts[i] = *contact
+			return nil
+		}
+	}
+	contact.Id = r.s.genId()
+	r.s.contacts = append(r.s.contacts, *contact)
+	return nil
+}
+
+func (r *contactRepository) UpdateStatus(userId, contactId string, status int8) error {
+	r.update(func(c *model.UserContact) bool {
+		return c.UserId == userId && c.ContactId == contactId
+	}, func(c *model.UserContact) {
+		c.Status = status
+		c.UpdateAt = time.Now()
+	})
+	return nil
+}
+
+func (r *contactRepository) SoftDelete(userId, contactId string, status *int8) error {
+	r.update(func(c *model.UserContact) bool {
+		return c.UserId == userId && c.ContactId == contactId
+	}, func(c *model.UserContact) {
+		c.DeletedAt = deletedNow()
+		if status != nil {
+			c.Status = *status
+		}
+	})
+	return nil
+}
+
+func (r *contactRepository) SoftDeleteByContact(contactId string) error {
+	r.update(func(c *model.UserContact) bool {
+		return c.ContactId == contactId
+	}, func(c *model.UserContact) {
+		c.DeletedAt = deletedNow()
+	})
+	return nil
+}
+
+func (r *contactRepository) SoftDeleteByUser(userId string) error {
+	r.update(func(c *model.UserContact) bool {
+		return c.UserId == userId
+	}, func(c *model.UserContact) {
+		c.DeletedAt = deletedNow()
+	})
+	return nil
+}
+
+// update 修改所有匹配且未删除的记录
+func (r *contactRepository) update(match func(c *model.UserContact) bool, apply func(c *model.UserContact)) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.contacts {
+		c := &r.s.contacts[i]
+		if !c.DeletedAt.Valid && match(c) {
+			apply(c)
+		}
+	}
+}
+
+func containsStatus(statusList []int8, status int8) bool {
+	for _, s := range statusList {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
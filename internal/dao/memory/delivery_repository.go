@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"time"
+)
+
+type deliveryRepository struct {
+	s *Store
+}
+
+func (r *deliveryRepository) GetCursor(userId, sid string) (*model.DeliveryCursor, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, c := range r.s.cursors {
+		if c.UserId == userId && c.Sid == sid {
+			return &c, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *deliveryRepository) Advance(userId, sid string, message *model.Message) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.cursors {
+		c := &r.s.cursors[i]
+		if c.UserId != userId || c.Sid != sid {
+			continue
+		}
+		current := model.Message{Id: c.MessageSeq, CreatedAt: c.MessageAt}
+		if messageLess(&current, message) {
+			c.MessageId = message.Uuid
+			c.MessageSeq = message.Id
+			c.MessageAt = message.CreatedAt
+			c.UpdatedAt = time.Now()
+		}
+		return nil
+	}
+	r.s.cursors = append(r.s.cursors, model.DeliveryCursor{
+		Id:         r.s.genId(),
+		UserId:     userId,
+		Sid:        sid,
+		MessageId:  message.Uuid,
+		MessageSeq: message.Id,
+		MessageAt:  message.CreatedAt,
+		UpdatedAt:  time.Now(),
+	})
+	return nil
+}
+
+func (r *deliveryRepository) DeleteStale(userId string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	live := make(map[string]bool)
+	for _, d := range r.s.devices {
+		if d.UserId == userId {
+			live[d.Sid] = true
+		}
+	}
+	kept := r.s.cursors[:0:0]
+	for _, c := range r.s.cursors {
+		if c.UserId != userId || live[c.Sid] {
+			kept = append(kept, c)
+		}
+	}
+	r.s.cursors = kept
+	return nil
+}
+
+func (r *deliveryRepository) DeleteOrphaned() (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	live := make(map[string]bool, len(r.s.devices))
+	for _, d := range r.s.devices {
+		live[d.Sid] = true
+	}
+	var removed int64
+	kept := r.s.cursors[:0:0]
+	for _, c := range r.s.cursors {
+		if live[c.Sid] {
+			kept = append(kept, c)
+		} else {
+			removed++
+		}
+	}
+	r.s.cursors = kept
+	return removed, nil
+}
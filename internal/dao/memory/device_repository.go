@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"sort"
+	"time"
+)
+
+type deviceRepository struct {
+	s *Store
+}
+
+func (r *deviceRepository) find(match func(device *model.DeviceSession) bool) (*model.DeviceSession, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, device := range r.s.devices {
+		if match(&device) {
+			return &device, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *deviceRepository) GetBySid(sid string) (*model.DeviceSession, error) {
+	return r.find(func(device *model.DeviceSession) bool { return device.Sid == sid })
+}
+
+func (r *deviceRepository) GetByDevice(userId, deviceId string) (*model.DeviceSession, error) {
+	return r.find(func(device *model.DeviceSession) bool {
+		return device.UserId == userId && device.DeviceId == deviceId
+	})
+}
+
+func (r *deviceRepository) ListByUser(userId string) ([]model.DeviceSession, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var deviceList []model.DeviceSession
+	for _, device := range r.s.devices {
+		if device.UserId == userId {
+			deviceList = append(deviceList, device)
+		}
+	}
+	sort.SliceStable(deviceList, func(i, j int) bool {
+		if !deviceList[i].LastActiveAt.Equal(deviceList[j].LastActiveAt) {
+			return deviceList[i].LastActiveAt.After(deviceList[j].LastActiveAt)
+		}
+		return deviceList[i].Id > deviceList[j].Id
+	})
+	return deviceList, nil
+}
+
+func (r *deviceRepository) Create(device *model.DeviceSession) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	device.Id = r.s.genId()
+	r.s.devices = append(r.s.devices, *device)
+	return nil
+}
+
+func (r *deviceRepository) Touch(sid, ip string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.devices {
+		if r.s.devices[i].Sid == sid {
+			r.s.devices[i].LastActiveAt = at
+			if ip != "" {
+				r.s.devices[i].Ip = ip
+			}
+		}
+	}
+	return nil
+}
+
+func (r *deviceRepository) Delete(sid string) (int64, error) {
+	return r.remove(func(device *model.DeviceSession) bool { return device.Sid == sid }), nil
+}
+
+func (r *deviceRepository) DeleteInactive(before time.Time) (int64, error) {
+	return r.remove(func(device *model.DeviceSession) bool { return device.LastActiveAt.Before(before) }), nil
+}
+
+func (r *deviceRepository) remove(match func(device *model.DeviceSession) bool) int64 {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var removed int64
+	kept := r.s.devices[:0:0]
+	for i := range r.s.devices {
+		if match(&r.s.devices[i]) {
+			removed++
+			continue
+		}
+		kept = append(kept, r.s.devices[i])
+	}
+	r.s.devices = kept
+	return removed
+}
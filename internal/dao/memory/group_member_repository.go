@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"fmt"
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"sort"
+)
+
+type groupMemberRepository struct {
+	s *Store
+}
+
+func (r *groupMemberRepository) Get(groupId, userId string) (*model.GroupMember, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, m := range r.s.members {
+		if m.GroupId == groupId && m.UserId == userId {
+			return &m, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *groupMemberRepository) ListByGroup(groupId string) ([]model.GroupMember, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var memberList []model.GroupMember
+	for _, m := range r.s.members {
+		if m.GroupId == groupId {
+			memberList = append(memberList, m)
+		}
+	}
+	sort.SliceStable(memberList, func(i, j int) bool {
+		if memberList[i].JoinedAt.Equal(memberList[j].JoinedAt) {
+			return memberList[i].Id < memberList[j].Id
+		}
+		return memberList[i].JoinedAt.Before(memberList[j].JoinedAt)
+	})
+	return memberList, nil
+}
+
+// Create 模拟(group_id, user_id)唯一索引
+func (r *groupMemberRepository) Create(member *model.GroupMember) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, m := range r.s.members {
+		if m.GroupId == member.GroupId && m.UserId == member.UserId {
+			return fmt.Errorf("duplicate group member %s %s", member.GroupId, member.UserId)
+		}
+	}
+	member.Id = r.s.genId()
+	r.s.members = append(r.s.members, *member)
+	return nil
+}
+
+func (r *groupMemberRepository) Delete(groupId, userId string) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var affected int64
+	memberList := r.s.members[:0:0]
+	for _, m := range r.s.members {
+		if m.GroupId == groupId && m.UserId == userId {
+			affected++
+			continue
+		}
+		memberList = append(memberList, m)
+	}
+	r.s.members = memberList
+	return affected, nil
+}
+
+func (r *groupMemberRepository) DeleteByGroup(groupId string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	memberList := r.s.members[:0:0]
+	for _, m := range r.s.members {
+		if m.GroupId != groupId {
+			memberList = append(memberList, m)
+		}
+	}
+	r.s.members = memberList
+	return nil
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"sort"
+)
+
+type groupRepository struct {
+	s *Store
+}
+
+func (r *groupRepository) GetByUuid(uuid string) (*model.GroupInfo, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, g := range r.s.groups {
+		if g.Uuid == uuid && !g.DeletedAt.Valid {
+			return &g, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *groupRepository) ListByOwner(ownerId string) ([]model.GroupInfo, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var groupList []model.GroupInfo
+	for _, g := range r.s.groups {
+		if g.OwnerId == ownerId && !g.DeletedAt.Valid {
+			groupList = append(groupList, g)
+		}
+	}
+	sort.SliceStable(groupList, func(i, j int) bool {
+		return groupList[i].CreatedAt.After(groupList[j].CreatedAt)
+	})
+	return groupList, nil
+}
+
+func (r *groupRepository) Create(group *model.GroupInfo) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	group.Id = r.s.genId()
+	r.s.groups = append(r.s.groups, *group)
+	return nil
+}
+
+func (r *groupRepository) Save(group *model.GroupInfo) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.groups {
+		if r.s.groups[i].Id == group.Id {
+			memberCnt := r.s.groups[i].MemberCnt
+			r.s.groups[i] = *group
+			r.s.groups[i].MemberCnt = memberCnt
+			return nil
+		}
+	}
+	group.Id = r.s.genId()
+	r.s.groups = append(r.s.groups, *group)
+	return nil
+}
+
+func (r *groupRepository) SoftDelete(uuid string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.groups {
+		if r.s.groups[i].Uuid == uuid && !r.s.groups[i].DeletedAt.Valid {
+			r.s.groups[i].DeletedAt = deletedNow()
+		}
+	}
+	return nil
+}
+
+func (r *groupRepository) AddMemberCnt(uuid string, delta int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.groups {
+		if r.s.groups[i].Uuid == uuid && !r.s.groups[i].DeletedAt.Valid {
+			r.s.groups[i].MemberCnt += delta
+		}
+	}
+	return nil
+}
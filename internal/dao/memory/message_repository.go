@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"go_chat/pkg/enum/message/message_status_enum"
+	"sort"
+	"time"
+)
+
+type messageRepository struct {
+	s *Store
+}
+
+func (r *messageRepository) GetByUuid(uuid string) (*model.Message, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, m := range r.s.messages {
+		if m.Uuid == uuid {
+			return &m, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+// GetForUpdate 事务之间本来就串行执行，不需要额外加锁
+func (r *messageRepository) GetForUpdate(uuid string) (*model.Message, error) {
+	return r.GetByUuid(uuid)
+}
+
+func (r *messageRepository) ListBetween(userOneId, userTwoId string) ([]model.Message, error) {
+	return r.filter(func(m *model.Message) bool {
+		return isBetween(m, userOneId, userTwoId)
+	}, false), nil
+}
+
+func (r *messageRepository) ListByReceiveId(receiveId string) ([]model.Message, error) {
+	return r.filter(func(m *model.Message) bool {
+		return m.ReceiveId == receiveId
+	}, false), nil
+}
+
+func (r *messageRepository) Page(q dao.MessagePageQuery) ([]model.Message, error) {
+	messageList := r.filter(func(m *model.Message) bool {
+		if q.GroupId != "" {
+			if m.ReceiveId != q.GroupId {
+				return false
+			}
+		} else if !isBetween(m, q.UserOneId, q.UserTwoId) {
+			return false
+		}
+		if c := q.Cursor; c != nil {
+			if q.Older {
+				return messageLess(m, c)
+			}
+			return messageLess(c, m)
+		}
+		return true
+	}, q.Older)
+	if q.Limit > 0 && len(messageList) > q.Limit {
+		messageList = messageList[:q.Limit]
+	}
+	return messageList, nil
+}
+
+func (r *messageRepository) CountRange(q dao.MessageRangeQuery) (int64, error) {
+	return int64(len(r.inRange(q))), nil
+}
+
+func (r *messageRepository) SendIdsInRange(q dao.MessageRangeQuery) ([]string, error) {
+	var sendIds []string
+	seen := make(map[string]bool)
+	for _, m := range r.inRange(q) {
+		if !seen[m.SendId] {
+			seen[m.SendId] = true
+			sendIds = append(sendIds, m.SendId)
+		}
+	}
+	return sendIds, nil
+}
+
+func (r *messageRepository) inRange(q dao.MessageRangeQuery) []model.Message {
+	return r.filter(func(m *model.Message) bool {
+		if q.GroupId != "" {
+			if m.ReceiveId != q.GroupId {
+				return false
+			}
+		} else if !isBetween(m, q.UserOneId, q.UserTwoId) {
+			return false
+		}
+		if q.After != nil && !messageLess(q.After, m) {
+			return false
+		}
+		if q.Until != nil && messageLess(q.Until, m) {
+			return false
+		}
+		return q.ExcludeSendId == "" || m.SendId != q.ExcludeSendId
+	}, false)
+}
+
+func (r *messageRepository) ListForUser(userId string, after *model.Message, limit int) ([]model.Message, error) {
+	r.s.mu.RLock()
+	joinedAt := make(map[string]time.Time)
+	for _, member := range r.s.members {
+		if member.UserId == userId {
+			joinedAt[member.GroupId] = member.JoinedAt
+		}
+	}
+	r.s.mu.RUnlock()
+	messageList := r.filter(func(m *model.Message) bool {
+		if m.SendId == userId {
+			return false
+		}
+		if m.ReceiveId != userId {
+			at, ok := joinedAt[m.ReceiveId]
+			if !ok || m.CreatedAt.Before(at) {
+				return false
+			}
+		}
+		return after == nil || messageLess(after, m)
+	}, false)
+	if limit > 0 && len(messageList) > limit {
+		messageList = messageList[:limit]
+	}
+	return messageList, nil
+}
+
+func (r *messageRepository) Create(message *model.Message) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	message.Id = r.s.genId()
+	r.s.messages = append(r.s.messages, *message)
+	return nil
+}
+
+func (r *messageRepository) MarkSent(uuid string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.messages {
+		m := &r.s.messages[i]
+		if m.Uuid == uuid && m.Status == message_status_enum.UNSENT {
+			m.Status = message_status_enum.SENT
+			m.SendAt = sql.NullTime{Time: at, Valid: true}
+		}
+	}
+	return nil
+}
+
+// filter 返回匹配的消息，按(created_at, id)排序
+func (r *messageRepository) filter(match func(m *model.Message) bool, desc bool) []model.Message {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var messageList []model.Message
+	for _, m := range r.s.messages {
+		if match(&m) {
+			messageList = append(messageList, m)
+		}
+	}
+	sort.SliceStable(messageList, func(i, j int) bool {
+		if desc {
+			return messageLess(&messageList[j], &messageList[i])
+		}
+		return messageLess(&messageList[i], &messageList[j])
+	})
+	return messageList
+}
+
+func messageLess(a, b *model.Message) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.Id < b.Id
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+func isBetween(m *model.Message, userOneId, userTwoId string) bool {
+	return (m.SendId == userOneId && m.ReceiveId == userTwoId) || (m.SendId == userTwoId && m.ReceiveId == userOneId)
+}
+
+func (r *messageRepository) ListByUuids(uuids []string) ([]model.Message, error) {
+	set := make(map[string]bool, len(uuids))
+	for _, uuid := range uuids {
+		set[uuid] = true
+	}
+	return r.filter(func(m *model.Message) bool {
+		return set[m.Uuid]
+	}, false), nil
+}
+
+func (r *messageRepository) ListByThread(threadId string) ([]model.Message, error) {
+	return r.filter(func(m *model.Message) bool {
+		return m.ThreadId == threadId
+	}, false), nil
+}
+
+func (r *messageRepository) Edit(uuid, content string, history json.RawMessage, at time.Time) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.messages {
+		m := &r.s.messages[i]
+		if m.Uuid == uuid && m.IsRecalled == 0 {
+			m.Content = content
+			m.IsEdited = 1
+			m.EditedAt = sql.NullTime{Time: at, Valid: true}
+			m.EditHistory = history
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *messageRepository) Recall(uuid, operatorId string, at time.Time) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.messages {
+		m := &r.s.messages[i]
+		if m.Uuid == uuid && m.IsRecalled == 0 {
+			m.Content, m.Url, m.AVdata = "", "", ""
+			m.FileType, m.FileName, m.FileSize = "", "", ""
+			m.Width, m.Height, m.Duration, m.Thumbnails = 0, 0, 0, nil
+			m.EditHistory = nil
+			m.IsRecalled = 1
+			m.RecalledAt = sql.NullTime{Time: at, Valid: true}
+			m.RecalledBy = operatorId
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"strings"
+)
+
+// messageSearcher 逐条做子串匹配，只用于测试
+type messageSearcher struct {
+	s *Store
+}
+
+func (r *messageSearcher) Search(q dao.MessageSearchQuery) ([]model.Message, int64, error) {
+	r.s.mu.RLock()
+	joined := make(map[string]bool)
+	for _, member := range r.s.members {
+		if member.UserId == q.UserId {
+			joined[member.GroupId] = true
+		}
+	}
+	r.s.mu.RUnlock()
+	keyword := strings.ToLower(q.Keyword)
+	messageList := (&messageRepository{r.s}).filter(func(m *model.Message) bool {
+		if m.IsRecalled == 1 {
+			return false
+		}
+		if !strings.Contains(strings.ToLower(m.Content), keyword) && !strings.Contains(strings.ToLower(m.FileName), keyword) {
+			return false
+		}
+		if m.SendId != q.UserId && m.ReceiveId != q.UserId && !joined[m.ReceiveId] {
+			return false
+		}
+		if q.ContactId != "" {
+			if q.ContactId[0] == 'G' {
+				if m.ReceiveId != q.ContactId {
+					return false
+				}
+			} else if !isBetween(m, q.UserId, q.ContactId) {
+				return false
+			}
+		}
+		if q.SendId != "" && m.SendId != q.SendId {
+			return false
+		}
+		if q.Type != nil && m.Type != *q.Type {
+			return false
+		}
+		if !q.Since.IsZero() && m.CreatedAt.Before(q.Since) {
+			return false
+		}
+		return q.Until.IsZero() || m.CreatedAt.Before(q.Until)
+	}, true)
+	total := int64(len(messageList))
+	if q.Offset >= len(messageList) {
+		return nil, total, nil
+	}
+	messageList = messageList[q.Offset:]
+	if q.Limit > 0 && len(messageList) > q.Limit {
+		messageList = messageList[:q.Limit]
+	}
+	return messageList, total, nil
+}
@@ -0,0 +1,65 @@
+package memory
+
+import "go_chat/internal/model"
+
+type reactionRepository struct {
+	s *Store
+}
+
+func (r *reactionRepository) ListByMessages(messageIds []string) ([]model.MessageReaction, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	set := make(map[string]bool, len(messageIds))
+	for _, messageId := range messageIds {
+		set[messageId] = true
+	}
+	var reactionList []model.MessageReaction
+	for _, reaction := range r.s.reactions {
+		if set[reaction.MessageId] {
+			reactionList = append(reactionList, reaction)
+		}
+	}
+	return reactionList, nil
+}
+
+func (r *reactionRepository) Create(reaction *model.MessageReaction) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.reactions {
+		if existing.MessageId == reaction.MessageId && existing.UserId == reaction.UserId && existing.Emoji == reaction.Emoji {
+			return nil
+		}
+	}
+	reaction.Id = r.s.genId()
+	r.s.reactions = append(r.s.reactions, *reaction)
+	return nil
+}
+
+func (r *reactionRepository) Delete(messageId, userId, emoji string) (int64, error) {
+	return r.remove(func(reaction *model.MessageReaction) bool {
+		return reaction.MessageId == messageId && reaction.UserId == userId && reaction.Emoji == emoji
+	}), nil
+}
+
+func (r *reactionRepository) DeleteByMessage(messageId string) error {
+	r.remove(func(reaction *model.MessageReaction) bool {
+		return reaction.MessageId == messageId
+	})
+	return nil
+}
+
+func (r *reactionRepository) remove(match func(reaction *model.MessageReaction) bool) int64 {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var removed int64
+	kept := r.s.reactions[:0:0]
+	for i := range r.s.reactions {
+		if match(&r.s.reactions[i]) {
+			removed++
+			continue
+		}
+		kept = append(kept, r.s.reactions[i])
+	}
+	r.s.reactions = kept
+	return removed
+}
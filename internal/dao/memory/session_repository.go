@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"database/sql"
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"sort"
+	"time"
+)
+
+type sessionRepository struct {
+	s *Store
+}
+
+func (r *sessionRepository) find(match func(s *model.Session) bool) (*model.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, s := range r.s.sessions {
+		if !s.DeletedAt.Valid && match(&s) {
+			return &s, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *sessionRepository) GetByUuid(uuid string) (*model.Session, error) {
+	return r.find(func(s *model.Session) bool { return s.Uuid == uuid })
+}
+
+func (r *sessionRepository) GetByPair(sendId, receiveId string) (*model.Session, error) {
+	return r.find(func(s *model.Session) bool { return s.SendId == sendId && s.ReceiveId == receiveId })
+}
+
+func (r *sessionRepository) ListBySendId(sendId string) ([]model.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var sessionList []model.Session
+	for _, s := range r.s.sessions {
+		if s.SendId == sendId && !s.DeletedAt.Valid {
+			sessionList = append(sessionList, s)
+		}
+	}
+	sort.SliceStable(sessionList, func(i, j int) bool {
+		return sessionList[i].CreatedAt.After(sessionList[j].CreatedAt)
+	})
+	return sessionList, nil
+}
+
+func (r *sessionRepository) Create(session *model.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	session.Id = r.s.genId()
+	r.s.sessions = append(r.s.sessions, *session)
+	return nil
+}
+
+func (r *sessionRepository) Save(session *model.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.sessions {
+		if r.s.sessions[i].Id == session.Id {
+			r.s.sessions[i] = *session
+			return nil
+		}
+	}
+	session.Id = r.s.genId()
+	r.s.sessions = append(r.s.sessions, *session)
+	return nil
+}
+
+func (r *sessionRepository) SoftDeleteByPair(sendId, receiveId string) error {
+	r.update(func(s *model.Session) bool {
+		return s.SendId == sendId && s.ReceiveId == receiveId
+	}, func(s *model.Session) {
+		s.DeletedAt = deletedNow()
+	})
+	return nil
+}
+
+func (r *sessionRepository) SoftDeleteByReceiveId(receiveId string) error {
+	r.update(func(s *model.Session) bool {
+		return s.ReceiveId == receiveId
+	}, func(s *model.Session) {
+		s.DeletedAt = deletedNow()
+	})
+	return nil
+}
+
+func (r *sessionRepository) SoftDeleteBySendId(sendId string) error {
+	r.update(func(s *model.Session) bool {
+		return s.SendId == sendId
+	}, func(s *model.Session) {
+		s.DeletedAt = deletedNow()
+	})
+	return nil
+}
+
+func (r *sessionRepository) UpdateReceiveInfo(receiveId, receiveName, avatar string) error {
+	r.update(func(s *model.Session) bool {
+		return s.ReceiveId == receiveId
+	}, func(s *model.Session) {
+		s.ReceiveName = receiveName
+		s.Avatar = avatar
+	})
+	return nil
+}
+
+func (r *sessionRepository) UpdateLastMessage(sendId, receiveId, lastMessage string, at time.Time) error {
+	r.update(func(s *model.Session) bool {
+		if receiveId[0] == 'G' {
+			return s.ReceiveId == receiveId
+		}
+		return (s.SendId == sendId && s.ReceiveId == receiveId) || (s.SendId == receiveId && s.ReceiveId == sendId)
+	}, func(s *model.Session) {
+		s.LastMessage = lastMessage
+		s.LastMessageAt = sql.NullTime{Time: at, Valid: true}
+		if s.SendId != sendId {
+			s.UnreadCnt++
+		}
+	})
+	return nil
+}
+
+func (r *sessionRepository) SetLastMessage(sendId, receiveId, lastMessage string) error {
+	r.update(func(s *model.Session) bool {
+		if receiveId[0] == 'G' {
+			return s.ReceiveId == receiveId
+		}
+		return (s.SendId == sendId && s.ReceiveId == receiveId) || (s.SendId == receiveId && s.ReceiveId == sendId)
+	}, func(s *model.Session) {
+		s.LastMessage = lastMessage
+	})
+	return nil
+}
+
+func (r *sessionRepository) UnreadCounts(sendId string) (map[string]int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, s := range r.s.sessions {
+		if s.SendId == sendId && !s.DeletedAt.Valid && s.UnreadCnt > 0 {
+			counts[s.Uuid] = s.UnreadCnt
+		}
+	}
+	return counts, nil
+}
+
+func (r *sessionRepository) UpdateReadCursor(uuid, messageId string, readAt time.Time, unreadCnt int) (bool, error) {
+	moved := false
+	r.update(func(s *model.Session) bool {
+		if s.Uuid != uuid {
+			return false
+		}
+		return !s.ReadAt.Valid || s.ReadAt.Time.Before(readAt) || (s.ReadAt.Time.Equal(readAt) && s.ReadMessageId != messageId)
+	}, func(s *model.Session) {
+		s.ReadMessageId = messageId
+		s.ReadAt = sql.NullTime{Time: readAt, Valid: true}
+		s.UnreadCnt = unreadCnt
+		moved = true
+	})
+	return moved, nil
+}
+
+func (r *sessionRepository) CountReaders(receiveId string, at time.Time, excludeSendId string) (int64, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var count int64
+	for _, s := range r.s.sessions {
+		if s.ReceiveId == receiveId && s.SendId != excludeSendId && !s.DeletedAt.Valid && s.ReadAt.Valid && !s.ReadAt.Time.Before(at) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// update 修改所有匹配且未删除的记录
+func (r *sessionRepository) update(match func(s *model.Session) bool, apply func(s *model.Session)) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.sessions {
+		s := &r.s.sessions[i]
+		if !s.DeletedAt.Valid && match(s) {
+			apply(s)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Package memory 内存版的Store，只用于单元测试，不做持久化
+package memory
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Store 所有表都放在切片里，由一把锁保护，软删除的记录对查询不可见
+type Store struct {
+	mu        sync.RWMutex
+	txMu      sync.Mutex // 事务之间串行执行
+	nextId    int64
+	users     []model.UserInfo
+	groups    []model.GroupInfo
+	members   []model.GroupMember
+	contacts  []model.UserContact
+	sessions  []model.Session
+	applies   []model.ContactApply
+	messages  []model.Message
+	cursors   []model.DeliveryCursor
+	reactions []model.MessageReaction
+	devices   []model.DeviceSession
+}
+
+var _ dao.Store = (*Store)(nil)
+
+// NewStore 创建一个空的Store
+func NewStore() *Store {
+	return new(Store)
+}
+
+func (s *Store) Users() dao.UserRepository {
+	return &userRepository{s}
+}
+
+func (s *Store) Groups() dao.GroupRepository {
+	return &groupRepository{s}
+}
+
+func (s *Store) GroupMembers() dao.GroupMemberRepository {
+	return &groupMemberRepository{s}
+}
+
+func (s *Store) Contacts() dao.ContactRepository {
+	return &contactRepository{s}
+}
+
+func (s *Store) Sessions() dao.SessionRepository {
+	return &sessionRepository{s}
+}
+
+func (s *Store) Applies() dao.ApplyRepository {
+	return &applyRepository{s}
+}
+
+func (s *Store) Messages() dao.MessageRepository {
+	return &messageRepository{s}
+}
+
+func (s *Store) Deliveries() dao.DeliveryRepository {
+	return &deliveryRepository{s}
+}
+
+func (s *Store) Reactions() dao.ReactionRepository {
+	return &reactionRepository{s}
+}
+
+func (s *Store) Devices() dao.DeviceRepository {
+	return &deviceRepository{s}
+}
+
+func (s *Store) Searcher() dao.MessageSearcher {
+	return &messageSearcher{s}
+}
+
+// Transaction 执行前先拍快照，fn返回error时整体恢复
+// 事务内再开事务直接复用外层事务
+// 事务之间串行执行，但不隔离事务外的写入：恢复时整张表被替换，事务执行期间其他goroutine不经事务写入的数据会一起丢失，
+// 测试中不能在事务执行的同时并发写Store
+func (s *Store) Transaction(fn func(tx dao.Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	snapshot := s.snapshot()
+	if err := fn(txStore{s}); err != nil {
+		s.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+type txStore struct {
+	*Store
+}
+
+func (t txStore) Transaction(fn func(tx dao.Store) error) error {
+	return fn(t)
+}
+
+func (s *Store) snapshot() *Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &Store{
+		nextId:    s.nextId,
+		users:     append([]model.UserInfo(nil), s.users...),
+		groups:    append([]model.GroupInfo(nil), s.groups...),
+		members:   append([]model.GroupMember(nil), s.members...),
+		contacts:  append([]model.UserContact(nil), s.contacts...),
+		sessions:  append([]model.Session(nil), s.sessions...),
+		applies:   append([]model.ContactApply(nil), s.applies...),
+		messages:  append([]model.Message(nil), s.messages...),
+		cursors:   append([]model.DeliveryCursor(nil), s.cursors...),
+		reactions: append([]model.MessageReaction(nil), s.reactions...),
+		devices:   append([]model.DeviceSession(nil), s.devices...),
+	}
+}
+
+func (s *Store) restore(snapshot *Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextId = snapshot.nextId
+	s.users = snapshot.users
+	s.groups = snapshot.groups
+	s.members = snapshot.members
+	s.contacts = snapshot.contacts
+	s.sessions = snapshot.sessions
+	s.applies = snapshot.applies
+	s.messages = snapshot.messages
+	s.cursors = snapshot.cursors
+	s.reactions = snapshot.reactions
+	s.devices = snapshot.devices
+}
+
+// Clone 复制当前的数据，测试中用来和操作之后的数据比较
+func (s *Store) Clone() *Store {
+	return s.snapshot()
+}
+
+// Equal 两个Store的数据是否完全相同，空表和nil视为相同
+func (s *Store) Equal(other *Store) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	return s.nextId == other.nextId &&
+		sameRows(s.users, other.users) &&
+		sameRows(s.groups, other.groups) &&
+		sameRows(s.members, other.members) &&
+		sameRows(s.contacts, other.contacts) &&
+		sameRows(s.sessions, other.sessions) &&
+		sameRows(s.applies, other.applies) &&
+		sameRows(s.messages, other.messages) &&
+		sameRows(s.cursors, other.cursors) &&
+		sameRows(s.reactions, other.reactions) &&
+		sameRows(s.devices, other.devices)
+}
+
+func sameRows[T any](a, b []T) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// genId 模拟自增主键，调用方需持有写锁
+func (s *Store) genId() int64 {
+	s.nextId++
+	return s.nextId
+}
+
+func deletedNow() gorm.DeletedAt {
+	return gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
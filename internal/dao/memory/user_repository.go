@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"database/sql"
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"sort"
+	"strings"
+	"time"
+)
+
+type userRepository struct {
+	s *Store
+}
+
+func (r *userRepository) find(match func(u *model.UserInfo) bool) (*model.UserInfo, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for i := range r.s.users {
+		u := r.s.users[i]
+		if !u.DeletedAt.Valid && match(&u) {
+			return &u, nil
+		}
+	}
+	return nil, dao.ErrRecordNotFound
+}
+
+func (r *userRepository) GetByUuid(uuid string) (*model.UserInfo, error) {
+	return r.find(func(u *model.UserInfo) bool { return u.Uuid == uuid })
+}
+
+func (r *userRepository) GetByTelephone(telephone string) (*model.UserInfo, error) {
+	return r.find(func(u *model.UserInfo) bool { return u.Telephone == telephone })
+}
+
+func (r *userRepository) GetByVerifiedEmail(email string) (*model.UserInfo, error) {
+	return r.find(func(u *model.UserInfo) bool { return u.Email.Valid && u.Email.String == email && u.EmailVerified == 1 })
+}
+
+// emailTaken 和数据库的唯一索引一致，已删除的用户也算，调用方需要持有锁
+func (r *userRepository) emailTaken(user *model.UserInfo) bool {
+	if !user.Email.Valid {
+		return false
+	}
+	for i := range r.s.users {
+		u := &r.s.users[i]
+		if u.Id != user.Id && u.Email.Valid && strings.EqualFold(u.Email.String, user.Email.String) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *userRepository) Create(user *model.UserInfo) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if r.emailTaken(user) {
+		return dao.ErrDuplicatedKey
+	}
+	user.Id = r.s.genId()
+	r.s.users = append(r.s.users, *user)
+	return nil
+}
+
+func (r *userRepository) Save(user *model.UserInfo) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if r.emailTaken(user) {
+		return dao.ErrDuplicatedKey
+	}
+	for i := range r.s.users {
+		if r.s.users[i].Id == user.Id {
+			r.s.users[i] = *user
+			return nil
+		}
+	}
+	user.Id = r.s.genId()
+	r.s.users = append(r.s.users, *user)
+	return nil
+}
+
+func (r *userRepository) UpdatePassword(uuid, password string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.users {
+		if r.s.users[i].Uuid == uuid && !r.s.users[i].DeletedAt.Valid {
+			r.s.users[i].Password = password
+		}
+	}
+	return nil
+}
+
+func (r *userRepository) Page(query dao.UserPageQuery) ([]model.UserInfo, int64, error) {
+	r.s.mu.RLock()
+	keyword := strings.ToLower(query.Keyword)
+	var userList []model.UserInfo
+	for _, u := range r.s.users {
+		if u.DeletedAt.Valid {
+			continue
+		}
+		if keyword != "" && !strings.Contains(strings.ToLower(u.Nickname), keyword) &&
+			!strings.Contains(u.Telephone, keyword) && !strings.Contains(strings.ToLower(u.Email.String), keyword) {
+			continue
+		}
+		if query.Status != nil && u.Status != *query.Status {
+			continue
+		}
+		if query.IsAdmin != nil && u.IsAdmin != *query.IsAdmin {
+			continue
+		}
+		userList = append(userList, u)
+	}
+	r.s.mu.RUnlock()
+	sort.SliceStable(userList, func(i, j int) bool {
+		if !userList[i].CreatedAt.Equal(userList[j].CreatedAt) {
+			return userList[i].CreatedAt.After(userList[j].CreatedAt)
+		}
+		return userList[i].Id > userList[j].Id
+	})
+	total := int64(len(userList))
+	if query.Offset >= len(userList) {
+		return nil, total, nil
+	}
+	userList = userList[query.Offset:]
+	if query.Limit > 0 && len(userList) > query.Limit {
+		userList = userList[:query.Limit]
+	}
+	return userList, total, nil
+}
+
+func (r *userRepository) UpdateStatus(uuid string, status int8) error {
+	r.update(uuid, func(u *model.UserInfo) { u.Status = status })
+	return nil
+}
+
+func (r *userRepository) UpdateIsAdmin(uuid string, isAdmin int8) error {
+	r.update(uuid, func(u *model.UserInfo) { u.IsAdmin = isAdmin })
+	return nil
+}
+
+func (r *userRepository) SoftDelete(uuid string) error {
+	r.update(uuid, func(u *model.UserInfo) {
+		u.DeletedAt = deletedNow()
+		u.Email, u.EmailVerified = sql.NullString{}, 0
+	})
+	return nil
+}
+
+// update 修改未删除的用户
+func (r *userRepository) update(uuid string, apply func(u *model.UserInfo)) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.users {
+		if r.s.users[i].Uuid == uuid && !r.s.users[i].DeletedAt.Valid {
+			apply(&r.s.users[i])
+		}
+	}
+}
+
+func (r *userRepository) UpdateLastOfflineAt(uuid string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.users {
+		if r.s.users[i].Uuid == uuid && !r.s.users[i].DeletedAt.Valid {
+			r.s.users[i].LastOfflineAt = sql.NullTime{Time: at, Valid: true}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package dao
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go_chat/internal/model"
+	"go_chat/pkg/enum/message/message_status_enum"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type gormMessageRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormMessageRepository) GetByUuid(uuid string) (*model.Message, error) {
+	var message model.Message
+	if err := r.db.First(&message, "uuid = ?", uuid).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (r *gormMessageRepository) GetForUpdate(uuid string) (*model.Message, error) {
+	var message model.Message
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&message, "uuid = ?", uuid).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+func (r *gormMessageRepository) ListBetween(userOneId, userTwoId string) ([]model.Message, error) {
+	var messageList []model.Message
+	err := r.db.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", userOneId, userTwoId, userTwoId, userOneId).Order("created_at ASC").Find(&messageList).Error
+	return messageList, err
+}
+
+func (r *gormMessageRepository) ListByReceiveId(receiveId string) ([]model.Message, error) {
+	var messageList []model.Message
+	err := r.db.Where("receive_id = ?", receiveId).Order("created_at ASC").Find(&messageList).Error
+	return messageList, err
+}
+
+// Page 按(created_at, id)做keyset分页
+func (r *gormMessageRepository) Page(q MessagePageQuery) ([]model.Message, error) {
+	query := r.db
+	if q.GroupId != "" {
+		query = query.Where("receive_id = ?", q.GroupId)
+	} else {
+		query = query.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", q.UserOneId, q.UserTwoId, q.UserTwoId, q.UserOneId)
+	}
+	if c := q.Cursor; c != nil {
+		if q.Older {
+			query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", c.CreatedAt, c.CreatedAt, c.Id)
+		} else {
+			query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", c.CreatedAt, c.CreatedAt, c.Id)
+		}
+	}
+	if q.Older {
+		query = query.Order("created_at DESC").Order("id DESC")
+	} else {
+		query = query.Order("created_at ASC").Order("id ASC")
+	}
+	var messageList []model.Message
+	err := query.Limit(q.Limit).Find(&messageList).Error
+	return messageList, err
+}
+
+// rangeQuery (created_at, id)在(After, Until]之间
+func (r *gormMessageRepository) rangeQuery(q MessageRangeQuery) *gorm.DB {
+	query := r.db.Model(&model.Message{})
+	if q.GroupId != "" {
+		query = query.Where("receive_id = ?", q.GroupId)
+	} else {
+		query = query.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", q.UserOneId, q.UserTwoId, q.UserTwoId, q.UserOneId)
+	}
+	if c := q.After; c != nil {
+		query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", c.CreatedAt, c.CreatedAt, c.Id)
+	}
+	if c := q.Until; c != nil {
+		query = query.Where("created_at < ? OR (created_at = ? AND id <= ?)", c.CreatedAt, c.CreatedAt, c.Id)
+	}
+	if q.ExcludeSendId != "" {
+		query = query.Where("send_id <> ?", q.ExcludeSendId)
+	}
+	return query
+}
+
+func (r *gormMessageRepository) CountRange(q MessageRangeQuery) (int64, error) {
+	var count int64
+	err := r.rangeQuery(q).Count(&count).Error
+	return count, err
+}
+
+func (r *gormMessageRepository) SendIdsInRange(q MessageRangeQuery) ([]string, error) {
+	var sendIds []string
+	err := r.rangeQuery(q).Distinct("send_id").Pluck("send_id", &sendIds).Error
+	return sendIds, err
+}
+
+func (r *gormMessageRepository) ListForUser(userId string, after *model.Message, limit int) ([]model.Message, error) {
+	query := r.db.Table("message AS m").Select("m.*").
+		Joins("LEFT JOIN group_member AS gm ON gm.group_id = m.receive_id AND gm.user_id = ?", userId).
+		Where("m.send_id <> ?", userId).
+		Where("m.receive_id = ? OR (gm.id IS NOT NULL AND m.created_at >= gm.joined_at)", userId)
+	if after != nil {
+		query = query.Where("m.created_at > ? OR (m.created_at = ? AND m.id > ?)", after.CreatedAt, after.CreatedAt, after.Id)
+	}
+	var messageList []model.Message
+	err := query.Order("m.created_at ASC").Order("m.id ASC").Limit(limit).Find(&messageList).Error
+	return messageList, err
+}
+
+func (r *gormMessageRepository) Create(message *model.Message) error {
+	return r.db.Create(message).Error
+}
+
+func (r *gormMessageRepository) MarkSent(uuid string, at time.Time) error {
+	return r.db.Model(&model.Message{}).Where("uuid = ? AND status = ?", uuid, message_status_enum.UNSENT).Updates(map[string]interface{}{
+		"status":  message_status_enum.SENT,
+		"send_at": sql.NullTime{Time: at, Valid: true},
+	}).Error
+}
+
+func (r *gormMessageRepository) ListByUuids(uuids []string) ([]model.Message, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+	var messageList []model.Message
+	err := r.db.Where("uuid IN ?", uuids).Find(&messageList).Error
+	return messageList, err
+}
+
+func (r *gormMessageRepository) ListByThread(threadId string) ([]model.Message, error) {
+	var messageList []model.Message
+	err := r.db.Where("thread_id = ?", threadId).Order("created_at ASC").Order("id ASC").Find(&messageList).Error
+	return messageList, err
+}
+
+func (r *gormMessageRepository) Edit(uuid, content string, history json.RawMessage, at time.Time) (bool, error) {
+	result := r.db.Model(&model.Message{}).Where("uuid = ? AND is_recalled = 0", uuid).Updates(map[string]interface{}{
+		"content":      content,
+		"is_edited":    1,
+		"edited_at":    sql.NullTime{Time: at, Valid: true},
+		"edit_history": history,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormMessageRepository) Recall(uuid, operatorId string, at time.Time) (bool, error) {
+	result := r.db.Model(&model.Message{}).Where("uuid = ? AND is_recalled = 0", uuid).Updates(map[string]interface{}{
+		"content":      "",
+		"url":          "",
+		"file_type":    "",
+		"file_name":    "",
+		"file_size":    "",
+		"av_data":      "",
+		"width":        0,
+		"height":       0,
+		"duration":     0,
+		"thumbnails":   nil,
+		"edit_history": nil,
+		"is_recalled":  1,
+		"recalled_at":  sql.NullTime{Time: at, Valid: true},
+		"recalled_by":  operatorId,
+	})
+	return result.RowsAffected > 0, result.Error
+}
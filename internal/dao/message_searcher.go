@@ -0,0 +1,62 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"strings"
+	"unicode/utf8"
+)
+
+// ngramTokenSize 和MySQL的ngram_token_size一致，更短的关键词用不上全文索引
+const ngramTokenSize = 2
+
+// mysqlMessageSearcher 基于content和file_name上的FULLTEXT(ngram)索引
+type mysqlMessageSearcher struct {
+	db *gorm.DB
+}
+
+func (r *mysqlMessageSearcher) Search(q MessageSearchQuery) ([]model.Message, int64, error) {
+	query := r.db.Model(&model.Message{})
+	if utf8.RuneCountInString(q.Keyword) < ngramTokenSize {
+		like := "%" + escapeLike(q.Keyword) + "%"
+		query = query.Where("content LIKE ? OR file_name LIKE ?", like, like)
+	} else {
+		// 按短语匹配，避免ngram把关键词拆开后匹配到不相关的内容
+		phrase := `"` + strings.ReplaceAll(q.Keyword, `"`, " ") + `"`
+		query = query.Where("MATCH(content, file_name) AGAINST(? IN BOOLEAN MODE)", phrase)
+	}
+	joinedGroups := r.db.Model(&model.GroupMember{}).Select("group_id").Where("user_id = ?", q.UserId)
+	query = query.Where("is_recalled = 0").
+		Where("send_id = ? OR receive_id = ? OR receive_id IN (?)", q.UserId, q.UserId, joinedGroups)
+	if q.ContactId != "" {
+		if q.ContactId[0] == 'G' {
+			query = query.Where("receive_id = ?", q.ContactId)
+		} else {
+			query = query.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", q.UserId, q.ContactId, q.ContactId, q.UserId)
+		}
+	}
+	if q.SendId != "" {
+		query = query.Where("send_id = ?", q.SendId)
+	}
+	if q.Type != nil {
+		query = query.Where("type = ?", *q.Type)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("created_at < ?", q.Until)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var messageList []model.Message
+	err := query.Order("created_at DESC").Order("id DESC").Offset(q.Offset).Limit(q.Limit).Find(&messageList).Error
+	return messageList, total, err
+}
+
+// escapeLike 转义LIKE的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
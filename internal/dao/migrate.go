@@ -0,0 +1,148 @@
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_chat/internal/model"
+	"go_chat/pkg/enum/group_info/member_role_enum"
+	"go_chat/pkg/zlog"
+	"gorm.io/gorm"
+	"time"
+)
+
+// migrateGroupMembers 把旧的group_info.members json列回填到group_member表，完成后删除该列
+// 列不存在说明已经迁移过，直接跳过
+func migrateGroupMembers(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&model.GroupInfo{}, "members") {
+		return nil
+	}
+	type legacyGroup struct {
+		Uuid      string
+		OwnerId   string
+		Members   []byte
+		CreatedAt time.Time
+	}
+	var groupList []legacyGroup
+	if err := db.Table("group_info").Select("uuid, owner_id, members, created_at").
+		Where("deleted_at IS NULL").Find(&groupList).Error; err != nil {
+		return err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, group := range groupList {
+			var userIds []string
+			if len(group.Members) > 0 {
+				if err := json.Unmarshal(group.Members, &userIds); err != nil {
+					return fmt.Errorf("群聊%s成员解析失败：%w", group.Uuid, err)
+				}
+			}
+			// 旧数据可能漏了群主或有重复成员
+			seen := make(map[string]bool, len(userIds)+1)
+			var memberList []model.GroupMember
+			for _, userId := range append([]string{group.OwnerId}, userIds...) {
+				if userId == "" || seen[userId] {
+					continue
+				}
+				seen[userId] = true
+				role := int8(member_role_enum.MEMBER)
+				if userId == group.OwnerId {
+					role = member_role_enum.OWNER
+				}
+				memberList = append(memberList, model.GroupMember{
+					GroupId:  group.Uuid,
+					UserId:   userId,
+					Role:     role,
+					JoinedAt: group.CreatedAt,
+				})
+			}
+			if err := tx.Where("group_id = ?", group.Uuid).Delete(&model.GroupMember{}).Error; err != nil {
+				return err
+			}
+			if len(memberList) > 0 {
+				if err := tx.Create(&memberList).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Table("group_info").Where("uuid = ?", group.Uuid).
+				Update("member_cnt", len(memberList)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// mysql的DDL不能回滚，放在回填事务之外
+	if err := db.Migrator().DropColumn(&model.GroupInfo{}, "members"); err != nil {
+		return err
+	}
+	zlog.Info(fmt.Sprintf("group_member回填完成，共%d个群聊", len(groupList)))
+	return nil
+}
+
+// migrateUserEmails 邮箱改为可空的唯一索引，在AutoMigrate建索引之前执行
+// 空字符串改为NULL；同一邮箱有多个账号时，保留未删除且已验证的账号，没有时保留最早的账号，其余账号解绑
+// 新索引已存在说明已经迁移过，直接跳过
+func migrateUserEmails(db *gorm.DB) error {
+	const legacyIndex, uniqueIndex = "idx_user_info_email", "idx_user_info_email_unique"
+	if !db.Migrator().HasTable(&model.UserInfo{}) || db.Migrator().HasIndex(&model.UserInfo{}, uniqueIndex) {
+		return nil
+	}
+	if db.Migrator().HasIndex(&model.UserInfo{}, legacyIndex) {
+		if err := db.Migrator().DropIndex(&model.UserInfo{}, legacyIndex); err != nil {
+			return err
+		}
+	}
+	var unbound int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE user_info SET email = NULL WHERE email = ''").Error; err != nil {
+			return err
+		}
+		res := tx.Exec(`UPDATE user_info u JOIN (
+				SELECT email, COALESCE(MIN(CASE WHEN email_verified = 1 AND deleted_at IS NULL THEN id END), MIN(id)) AS keep_id
+				FROM user_info WHERE email IS NOT NULL GROUP BY email HAVING COUNT(*) > 1
+			) d ON u.email = d.email
+			SET u.email = NULL, u.email_verified = 0
+			WHERE u.id <> d.keep_id`)
+		unbound = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return err
+	}
+	zlog.Info(fmt.Sprintf("user_info邮箱迁移完成，%d个账号的重复邮箱已解绑", unbound))
+	return nil
+}
+
+// migrateDeliveryCursors 投递游标从每个用户一条改为每次登录一条
+// 旧游标的sid为空：先删除旧的user_id唯一索引，再把旧游标复制给该用户现有的每次登录，然后删除旧游标
+// 复制和删除在同一个事务中，中途失败时下次启动重新执行
+func migrateDeliveryCursors(db *gorm.DB) error {
+	const legacyIndex = "idx_delivery_cursor_user_id"
+	if db.Migrator().HasIndex(&model.DeliveryCursor{}, legacyIndex) {
+		if err := db.Migrator().DropIndex(&model.DeliveryCursor{}, legacyIndex); err != nil {
+			return err
+		}
+	}
+	var legacy int64
+	if err := db.Model(&model.DeliveryCursor{}).Where("sid = ?", "").Count(&legacy).Error; err != nil || legacy == 0 {
+		return err
+	}
+	var copied int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec(`INSERT INTO delivery_cursor (user_id, sid, message_id, message_seq, message_at, updated_at)
+			SELECT c.user_id, d.sid, c.message_id, c.message_seq, c.message_at, c.updated_at
+			FROM delivery_cursor c JOIN device_session d ON d.user_id = c.user_id
+			WHERE c.sid = ''`)
+		if res.Error != nil {
+			return res.Error
+		}
+		copied = res.RowsAffected
+		return tx.Where("sid = ?", "").Delete(&model.DeliveryCursor{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	zlog.Info(fmt.Sprintf("delivery_cursor迁移完成，%d条旧游标按登录复制为%d条", legacy, copied))
+	return nil
+}
@@ -0,0 +1,34 @@
+package dao
+
+import (
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormReactionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormReactionRepository) ListByMessages(messageIds []string) ([]model.MessageReaction, error) {
+	if len(messageIds) == 0 {
+		return nil, nil
+	}
+	var reactionList []model.MessageReaction
+	err := r.db.Where("message_id IN ?", messageIds).Order("created_at ASC").Order("id ASC").Find(&reactionList).Error
+	return reactionList, err
+}
+
+// Create 已经回应过时忽略
+func (r *gormReactionRepository) Create(reaction *model.MessageReaction) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction).Error
+}
+
+func (r *gormReactionRepository) Delete(messageId, userId, emoji string) (int64, error) {
+	res := r.db.Where("message_id = ? AND user_id = ? AND emoji = ?", messageId, userId, emoji).Delete(&model.MessageReaction{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *gormReactionRepository) DeleteByMessage(messageId string) error {
+	return r.db.Where("message_id = ?", messageId).Delete(&model.MessageReaction{}).Error
+}
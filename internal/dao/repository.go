@@ -0,0 +1,241 @@
+package dao
+
+import (
+	"encoding/json"
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ErrRecordNotFound 查询单条记录不存在时返回，各实现保持一致
+var ErrRecordNotFound = gorm.ErrRecordNotFound
+
+// ErrDuplicatedKey 写入违反唯一索引时返回，各实现保持一致
+var ErrDuplicatedKey = gorm.ErrDuplicatedKey
+
+// UserRepository 用户
+type UserRepository interface {
+	GetByUuid(uuid string) (*model.UserInfo, error)
+	GetByTelephone(telephone string) (*model.UserInfo, error)
+	// GetByVerifiedEmail 只查找邮箱已验证的用户
+	GetByVerifiedEmail(email string) (*model.UserInfo, error)
+	// Create 和 Save 写入的邮箱已被其他用户使用时返回 ErrDuplicatedKey
+	Create(user *model.UserInfo) error
+	Save(user *model.UserInfo) error
+	UpdatePassword(uuid, password string) error
+	UpdateLastOfflineAt(uuid string, at time.Time) error
+	// Page 按创建时间倒序返回一页用户和总数，供管理员查看
+	Page(query UserPageQuery) ([]model.UserInfo, int64, error)
+	UpdateStatus(uuid string, status int8) error
+	UpdateIsAdmin(uuid string, isAdmin int8) error
+	// SoftDelete 同时解绑邮箱，注销后邮箱可以被其他账号绑定
+	SoftDelete(uuid string) error
+}
+
+// UserPageQuery 用户分页条件，零值的条件不生效
+type UserPageQuery struct {
+	Keyword string // 匹配昵称、手机号和邮箱
+	Status  *int8
+	IsAdmin *int8
+	Offset  int
+	Limit   int
+}
+
+// GroupRepository 群聊
+type GroupRepository interface {
+	GetByUuid(uuid string) (*model.GroupInfo, error)
+	// ListByOwner 按创建时间倒序
+	ListByOwner(ownerId string) ([]model.GroupInfo, error)
+	Create(group *model.GroupInfo) error
+	Save(group *model.GroupInfo) error
+	SoftDelete(uuid string) error
+	// AddMemberCnt 原子地增减群人数，需和group_member的写入放在同一事务里
+	AddMemberCnt(uuid string, delta int) error
+}
+
+// GroupMemberRepository 群成员
+type GroupMemberRepository interface {
+	Get(groupId, userId string) (*model.GroupMember, error)
+	// ListByGroup 按入群时间升序
+	ListByGroup(groupId string) ([]model.GroupMember, error)
+	Create(member *model.GroupMember) error
+	// Delete 返回实际删除的行数，不是成员时为0
+	Delete(groupId, userId string) (int64, error)
+	DeleteByGroup(groupId string) error
+}
+
+// ContactRepository 联系人，群聊成员也以 UserContact 记录
+type ContactRepository interface {
+	Get(userId, contactId string) (*model.UserContact, error)
+	// ListByUser 按创建时间倒序，跳过excludeStatus中的状态
+	ListByUser(userId string, excludeStatus ...int8) ([]model.UserContact, error)
+	Create(contact *model.UserContact) error
+	Save(contact *model.UserContact) error
+	UpdateStatus(userId, contactId string, status int8) error
+	// SoftDelete 删除联系人，status不为nil时同时修改状态
+	SoftDelete(userId, contactId string, status *int8) error
+	// SoftDeleteByContact 删除所有联系人为contactId的记录，用于解散群聊
+	SoftDeleteByContact(contactId string) error
+	// SoftDeleteByUser 删除userId的所有联系人，用于注销用户
+	SoftDeleteByUser(userId string) error
+}
+
+// SessionRepository 会话
+type SessionRepository interface {
+	GetByUuid(uuid string) (*model.Session, error)
+	GetByPair(sendId, receiveId string) (*model.Session, error)
+	// ListBySendId 按创建时间倒序
+	ListBySendId(sendId string) ([]model.Session, error)
+	Create(session *model.Session) error
+	Save(session *model.Session) error
+	SoftDeleteByPair(sendId, receiveId string) error
+	SoftDeleteByReceiveId(receiveId string) error
+	SoftDeleteBySendId(sendId string) error
+	// UpdateReceiveInfo 对方改名或换头像时同步所有会话
+	UpdateReceiveInfo(receiveId, receiveName, avatar string) error
+	// UpdateLastMessage 群聊更新所有成员的会话，单聊更新双方的会话，除发送者外未读数加一
+	UpdateLastMessage(sendId, receiveId, lastMessage string, at time.Time) error
+	// SetLastMessage 最新消息被编辑或撤回时改写会话的最新消息，不改时间和未读数
+	SetLastMessage(sendId, receiveId, lastMessage string) error
+	// UnreadCounts sendId所有未读数大于0的会话，key为会话uuid
+	UnreadCounts(sendId string) (map[string]int, error)
+	// UpdateReadCursor 已读游标只能前进，游标没有变化时返回false
+	UpdateReadCursor(uuid, messageId string, readAt time.Time, unreadCnt int) (bool, error)
+	// CountReaders 群聊中已读到at的成员数，不含excludeSendId
+	CountReaders(receiveId string, at time.Time, excludeSendId string) (int64, error)
+}
+
+// ApplyRepository 好友申请和加群申请
+type ApplyRepository interface {
+	Get(userId, contactId string) (*model.ContactApply, error)
+	ListPendingByContact(contactId string) ([]model.ContactApply, error)
+	Create(apply *model.ContactApply) error
+	Save(apply *model.ContactApply) error
+	SoftDelete(userId, contactId string) error
+	SoftDeleteByContact(contactId string) error
+	// SoftDeleteByUser 删除userId发出的所有申请
+	SoftDeleteByUser(userId string) error
+}
+
+// MessagePageQuery 消息分页条件，UserOneId/UserTwoId 与 GroupId 二选一
+type MessagePageQuery struct {
+	UserOneId string
+	UserTwoId string
+	GroupId   string
+	Cursor    *model.Message // 为nil时从最新或最早开始
+	Older     bool           // true 取游标之前的消息，按时间倒序返回；false 取之后的，按时间升序返回
+	Limit     int
+}
+
+// MessageRangeQuery 会话中(After, Until]之间的消息，UserOneId/UserTwoId 与 GroupId 二选一
+type MessageRangeQuery struct {
+	UserOneId     string
+	UserTwoId     string
+	GroupId       string
+	After         *model.Message // 为nil时从最早开始
+	Until         *model.Message // 为nil时到最新
+	ExcludeSendId string         // 不统计该用户发的消息
+}
+
+// MessageSearchQuery 消息搜索条件，只搜索UserId参与的单聊和所在的群聊，不含已撤回的消息
+type MessageSearchQuery struct {
+	UserId    string
+	Keyword   string    // 匹配Content和FileName
+	SendId    string    // 为空时不限发送者
+	ContactId string    // 限定会话，单聊为对方uuid，群聊为群uuid，为空时不限
+	Type      *int8     // 为nil时不限消息类型
+	Since     time.Time // 零值时不限
+	Until     time.Time // 零值时不限，不含Until
+	Offset    int
+	Limit     int
+}
+
+// MessageSearcher 消息全文搜索，默认实现用MySQL的FULLTEXT索引，可以换成嵌入式索引
+type MessageSearcher interface {
+	// Search 按(created_at, id)倒序返回一页结果和总数
+	Search(query MessageSearchQuery) ([]model.Message, int64, error)
+}
+
+// MessageRepository 消息
+type MessageRepository interface {
+	GetByUuid(uuid string) (*model.Message, error)
+	// GetForUpdate 在事务中读取消息并加行锁，其他事务要等到当前事务结束才能读取或修改这条消息
+	GetForUpdate(uuid string) (*model.Message, error)
+	// ListBetween 两个用户之间的消息，按时间升序
+	ListBetween(userOneId, userTwoId string) ([]model.Message, error)
+	// ListByReceiveId 发往receiveId的消息，按时间升序
+	ListByReceiveId(receiveId string) ([]model.Message, error)
+	Page(query MessagePageQuery) ([]model.Message, error)
+	CountRange(query MessageRangeQuery) (int64, error)
+	// SendIdsInRange 范围内消息的发送者，去重
+	SendIdsInRange(query MessageRangeQuery) ([]string, error)
+	Create(message *model.Message) error
+	// MarkSent 未发送的消息标记为已发送
+	MarkSent(uuid string, at time.Time) error
+	// ListForUser 发给userId的消息，包括单聊和入群之后的群聊，不含自己发的
+	// 按(created_at, id)升序取after之后的limit条，after为nil时从最早开始
+	ListForUser(userId string, after *model.Message, limit int) ([]model.Message, error)
+	// ListByUuids 按uuid批量查询，不保证顺序
+	ListByUuids(uuids []string) ([]model.Message, error)
+	// ListByThread 话题下的所有回复，按(created_at, id)升序，不含根消息
+	ListByThread(threadId string) ([]model.Message, error)
+	// Edit 修改未撤回消息的内容并记录编辑历史，消息已撤回时返回false
+	Edit(uuid, content string, history json.RawMessage, at time.Time) (bool, error)
+	// Recall 撤回消息并清空内容和编辑历史，消息已撤回时返回false
+	Recall(uuid, operatorId string, at time.Time) (bool, error)
+}
+
+// DeliveryRepository 每次登录的消息投递进度，sid和device_session.sid一致
+type DeliveryRepository interface {
+	// GetCursor 没有投递过时返回 ErrRecordNotFound
+	GetCursor(userId, sid string) (*model.DeliveryCursor, error)
+	// Advance 把游标推进到message，只能前进
+	Advance(userId, sid string, message *model.Message) error
+	// DeleteStale 删除userId已经注销或过期的登录的游标
+	DeleteStale(userId string) error
+	// DeleteOrphaned 删除所有用户已经注销或过期的登录的游标，返回删除的数量
+	DeleteOrphaned() (int64, error)
+}
+
+// ReactionRepository 消息的表情回应
+type ReactionRepository interface {
+	// ListByMessages 按回应时间升序
+	ListByMessages(messageIds []string) ([]model.MessageReaction, error)
+	Create(reaction *model.MessageReaction) error
+	// Delete 返回删除的行数，为0说明没有回应过
+	Delete(messageId, userId, emoji string) (int64, error)
+	DeleteByMessage(messageId string) error
+}
+
+// DeviceRepository 登录设备
+type DeviceRepository interface {
+	GetBySid(sid string) (*model.DeviceSession, error)
+	// GetByDevice 同一用户同一设备的登录，没有时返回 ErrRecordNotFound
+	GetByDevice(userId, deviceId string) (*model.DeviceSession, error)
+	// ListByUser 按最近活跃时间倒序
+	ListByUser(userId string) ([]model.DeviceSession, error)
+	Create(device *model.DeviceSession) error
+	// Touch 更新最近活跃时间，ip为空时不修改
+	Touch(sid, ip string, at time.Time) error
+	// Delete 返回删除的行数，已经删除时为0
+	Delete(sid string) (int64, error)
+	// DeleteInactive 删除所有用户在before之前就不再活跃的登录，这些登录的refresh token已经过期，返回删除的数量
+	DeleteInactive(before time.Time) (int64, error)
+}
+
+// Store 聚合所有repository，service通过它访问数据
+type Store interface {
+	Users() UserRepository
+	Groups() GroupRepository
+	GroupMembers() GroupMemberRepository
+	Contacts() ContactRepository
+	Sessions() SessionRepository
+	Applies() ApplyRepository
+	Messages() MessageRepository
+	Deliveries() DeliveryRepository
+	Reactions() ReactionRepository
+	Devices() DeviceRepository
+	Searcher() MessageSearcher
+	// Transaction 在事务中执行fn，fn返回error时回滚，fn内只能使用传入的tx
+	Transaction(fn func(tx Store) error) error
+}
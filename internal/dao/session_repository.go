@@ -0,0 +1,118 @@
+package dao
+
+import (
+	"database/sql"
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSessionRepository) GetByUuid(uuid string) (*model.Session, error) {
+	var session model.Session
+	if err := r.db.First(&session, "uuid = ?", uuid).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) GetByPair(sendId, receiveId string) (*model.Session, error) {
+	var session model.Session
+	if err := r.db.First(&session, "send_id = ? AND receive_id = ?", sendId, receiveId).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) ListBySendId(sendId string) ([]model.Session, error) {
+	var sessionList []model.Session
+	err := r.db.Order("created_at DESC").Where("send_id = ?", sendId).Find(&sessionList).Error
+	return sessionList, err
+}
+
+func (r *gormSessionRepository) Create(session *model.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *gormSessionRepository) Save(session *model.Session) error {
+	return r.db.Save(session).Error
+}
+
+func (r *gormSessionRepository) SoftDeleteByPair(sendId, receiveId string) error {
+	return r.db.Model(&model.Session{}).Where("send_id = ? AND receive_id = ?", sendId, receiveId).Update("deleted_at", deletedNow()).Error
+}
+
+func (r *gormSessionRepository) SoftDeleteByReceiveId(receiveId string) error {
+	return r.db.Model(&model.Session{}).Where("receive_id = ?", receiveId).Update("deleted_at", deletedNow()).Error
+}
+
+func (r *gormSessionRepository) SoftDeleteBySendId(sendId string) error {
+	return r.db.Model(&model.Session{}).Where("send_id = ?", sendId).Update("deleted_at", deletedNow()).Error
+}
+
+func (r *gormSessionRepository) UpdateReceiveInfo(receiveId, receiveName, avatar string) error {
+	return r.db.Model(&model.Session{}).Where("receive_id = ?", receiveId).Updates(map[string]interface{}{
+		"receive_name": receiveName,
+		"avatar":       avatar,
+	}).Error
+}
+
+func (r *gormSessionRepository) UpdateLastMessage(sendId, receiveId, lastMessage string, at time.Time) error {
+	query := r.db.Model(&model.Session{})
+	if receiveId[0] == 'G' {
+		query = query.Where("receive_id = ?", receiveId)
+	} else {
+		query = query.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", sendId, receiveId, receiveId, sendId)
+	}
+	return query.Updates(map[string]interface{}{
+		"last_message":    lastMessage,
+		"last_message_at": sql.NullTime{Time: at, Valid: true},
+		"unread_cnt":      gorm.Expr("CASE WHEN send_id = ? THEN unread_cnt ELSE unread_cnt + 1 END", sendId),
+	}).Error
+}
+
+func (r *gormSessionRepository) SetLastMessage(sendId, receiveId, lastMessage string) error {
+	query := r.db.Model(&model.Session{})
+	if receiveId[0] == 'G' {
+		query = query.Where("receive_id = ?", receiveId)
+	} else {
+		query = query.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", sendId, receiveId, receiveId, sendId)
+	}
+	return query.Update("last_message", lastMessage).Error
+}
+
+func (r *gormSessionRepository) UnreadCounts(sendId string) (map[string]int, error) {
+	var rows []struct {
+		Uuid      string
+		UnreadCnt int
+	}
+	err := r.db.Model(&model.Session{}).Select("uuid, unread_cnt").Where("send_id = ? AND unread_cnt > 0", sendId).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Uuid] = row.UnreadCnt
+	}
+	return counts, nil
+}
+
+func (r *gormSessionRepository) UpdateReadCursor(uuid, messageId string, readAt time.Time, unreadCnt int) (bool, error) {
+	res := r.db.Model(&model.Session{}).
+		Where("uuid = ? AND (read_at IS NULL OR read_at < ? OR (read_at = ? AND read_message_id <> ?))", uuid, readAt, readAt, messageId).
+		Updates(map[string]interface{}{
+			"read_message_id": messageId,
+			"read_at":         sql.NullTime{Time: readAt, Valid: true},
+			"unread_cnt":      unreadCnt,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *gormSessionRepository) CountReaders(receiveId string, at time.Time, excludeSendId string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Session{}).Where("receive_id = ? AND send_id <> ? AND read_at >= ?", receiveId, excludeSendId, at).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"database/sql"
+	"go_chat/internal/model"
+	"gorm.io/gorm"
+	"time"
+)
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormUserRepository) GetByUuid(uuid string) (*model.UserInfo, error) {
+	var user model.UserInfo
+	if err := r.db.First(&user, "uuid = ?", uuid).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) GetByTelephone(telephone string) (*model.UserInfo, error) {
+	var user model.UserInfo
+	if err := r.db.First(&user, "telephone = ?", telephone).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) GetByVerifiedEmail(email string) (*model.UserInfo, error) {
+	var user model.UserInfo
+	if err := r.db.First(&user, "email = ? AND email_verified = 1", email).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) Create(user *model.UserInfo) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) Save(user *model.UserInfo) error {
+	return r.db.Save(user).Error
+}
+
+func (r *gormUserRepository) UpdatePassword(uuid, password string) error {
+	return r.db.Model(&model.UserInfo{}).Where("uuid = ?", uuid).Update("password", password).Error
+}
+
+func (r *gormUserRepository) Page(query UserPageQuery) ([]model.UserInfo, int64, error) {
+	db := r.db.Model(&model.UserInfo{})
+	if query.Keyword != "" {
+		like := "%" + escapeLike(query.Keyword) + "%"
+		db = db.Where("nickname LIKE ? OR telephone LIKE ? OR email LIKE ?", like, like, like)
+	}
+	if query.Status != nil {
+		db = db.Where("status = ?", *query.Status)
+	}
+	if query.IsAdmin != nil {
+		db = db.Where("is_admin = ?", *query.IsAdmin)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var userList []model.UserInfo
+	err := db.Order("created_at DESC").Order("id DESC").Offset(query.Offset).Limit(query.Limit).Find(&userList).Error
+	return userList, total, err
+}
+
+func (r *gormUserRepository) UpdateStatus(uuid string, status int8) error {
+	return r.db.Model(&model.UserInfo{}).Where("uuid = ?", uuid).Update("status", status).Error
+}
+
+func (r *gormUserRepository) UpdateIsAdmin(uuid string, isAdmin int8) error {
+	return r.db.Model(&model.UserInfo{}).Where("uuid = ?", uuid).Update("is_admin", isAdmin).Error
+}
+
+func (r *gormUserRepository) SoftDelete(uuid string) error {
+	return r.db.Model(&model.UserInfo{}).Where("uuid = ?", uuid).Updates(map[string]interface{}{
+		"deleted_at":     deletedNow(),
+		"email":          nil,
+		"email_verified": 0,
+	}).Error
+}
+
+func (r *gormUserRepository) UpdateLastOfflineAt(uuid string, at time.Time) error {
+	return r.db.Model(&model.UserInfo{}).Where("uuid = ?", uuid).Update("last_offline_at", sql.NullTime{Time: at, Valid: true}).Error
+}
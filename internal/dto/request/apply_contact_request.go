@@ -1,7 +1,7 @@
 package request
 
 type ApplyContactRequest struct {
-	OwnerId   string `json:"owner_id"`
+	OwnerId   string `json:"-"` // 登录用户，由中间件写入
 	ContactId string `json:"contact_id"`
 	Message   string `json:"message"`
 }
@@ -1,6 +1,6 @@
 package request
 
 type BlackApplyRequest struct {
-	OwnerId   string `json:"owner_id"`
+	OwnerId   string `json:"owner_id"` // 处理加群申请时为群聊id，处理好友申请时不填
 	ContactId string `json:"contact_id"`
 }
@@ -1,6 +1,6 @@
 package request
 
 type BlackContactRequest struct {
-	OwnerId   string `json:"owner_id"`
+	OwnerId   string `json:"-"` // 登录用户，由中间件写入
 	ContactId string `json:"contact_id"`
 }
@@ -0,0 +1,7 @@
+package request
+
+type ChangePasswordRequest struct {
+	Uuid        string `json:"-"` // 登录用户，由中间件写入
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
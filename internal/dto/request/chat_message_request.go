@@ -0,0 +1,23 @@
+package request
+
+import "go_chat/internal/model"
+
+type ChatMessageRequest struct {
+	SessionId  string            `json:"session_id"` // 只用于核对，消息的会话以服务端记录为准
+	Type       int8              `json:"type"`
+	Content    string            `json:"content"`
+	Url        string            `json:"url"`
+	SendId     string            `json:"-"` // 连接所属的登录用户
+	SendName   string            `json:"-"` // 发送者的昵称和头像以用户信息为准
+	SendAvatar string            `json:"-"`
+	ReceiveId  string            `json:"receive_id"`
+	FileSize   string            `json:"file_size"`
+	FileType   string            `json:"file_type"`
+	FileName   string            `json:"file_name"`
+	AVdata     string            `json:"av_data"`
+	Width      int               `json:"width"` // 以下为上传接口返回的媒体信息，原样带上
+	Height     int               `json:"height"`
+	Duration   int               `json:"duration"` // 语音时长，单位毫秒
+	Thumbnails []model.Thumbnail `json:"thumbnails"`
+	ReplyToId  string            `json:"reply_to_id"` // 回复的消息uuid，可以不传
+}
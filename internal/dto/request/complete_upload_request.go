@@ -0,0 +1,6 @@
+package request
+
+type CompleteUploadRequest struct {
+	UserId   string `json:"-"` // 登录用户，由中间件写入
+	UploadId string `json:"upload_id"`
+}
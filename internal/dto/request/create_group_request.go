@@ -1,7 +1,7 @@
 package request
 
 type CreateGroupRequest struct {
-	OwnerId string `json:"owner_id"`
+	OwnerId string `json:"-"` // 登录用户，由中间件写入
 	Name    string `json:"name"`
 	Notice  string `json:"notice"`
 	AddMode int8   `json:"add_mode"`
@@ -0,0 +1,8 @@
+package request
+
+// DeviceInfo 登录时客户端上报的设备信息，嵌入各登录请求中
+type DeviceInfo struct {
+	DeviceId   string `json:"device_id"`   // 客户端首次启动时生成并保存，同一设备重复登录时顶掉旧的登录
+	Platform   string `json:"platform"`    // ios/android/windows/mac/linux/web
+	DeviceName string `json:"device_name"` // 展示给用户的设备名称，如 iPhone 15
+}
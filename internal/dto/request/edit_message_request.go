@@ -0,0 +1,7 @@
+package request
+
+type EditMessageRequest struct {
+	SendId    string `json:"-"` // 登录用户，由中间件写入，只有发送者可以编辑
+	MessageId string `json:"message_id"`
+	Content   string `json:"content"`
+}
@@ -0,0 +1,10 @@
+package request
+
+// EmailLoginRequest 邮箱登录，Password和EmailCode二选一
+type EmailLoginRequest struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	EmailCode string `json:"email_code"`
+	ClientIp  string `json:"-"` // 由controller写入，用于频率限制
+	DeviceInfo
+}
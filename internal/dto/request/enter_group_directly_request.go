@@ -1,6 +1,6 @@
 package request
 
 type EnterGroupDirectlyRequest struct {
-	OwnerId   string `json:"owner_id"`
-	ContactId string `json:"contact_id"`
+	OwnerId   string `json:"owner_id"` // 群聊id
+	ContactId string `json:"-"`        // 登录用户，由中间件写入
 }
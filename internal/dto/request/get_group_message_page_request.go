@@ -0,0 +1,9 @@
+package request
+
+type GetGroupMessagePageRequest struct {
+	UserId  string `json:"-"` // 登录用户，由中间件写入，必须是群成员
+	GroupId string `json:"group_id"`
+	Before  string `json:"before"` // 消息uuid，加载比它更早的消息
+	After   string `json:"after"`  // 消息uuid，加载比它更新的消息
+	Limit   int    `json:"limit"`
+}
@@ -1,6 +1,6 @@
 package request
 
 type GetMessageListRequest struct {
-	UserOneId string `json:"user_one_id"`
+	UserOneId string `json:"-"` // 登录用户，由中间件写入
 	UserTwoId string `json:"user_two_id"`
 }
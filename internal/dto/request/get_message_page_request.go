@@ -0,0 +1,9 @@
+package request
+
+type GetMessagePageRequest struct {
+	UserOneId string `json:"-"` // 登录用户，由中间件写入
+	UserTwoId string `json:"user_two_id"`
+	Before    string `json:"before"` // 消息uuid，加载比它更早的消息
+	After     string `json:"after"`  // 消息uuid，加载比它更新的消息
+	Limit     int    `json:"limit"`
+}
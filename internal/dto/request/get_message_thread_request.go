@@ -0,0 +1,6 @@
+package request
+
+type GetMessageThreadRequest struct {
+	UserId    string `json:"-"`          // 登录用户，由中间件写入，必须是群成员
+	MessageId string `json:"message_id"` // 话题中的任意一条消息
+}
@@ -0,0 +1,10 @@
+package request
+
+type GetUserInfoListRequest struct {
+	Uuid     string `json:"-"`       // 登录用户，由中间件写入，必须是管理员
+	Keyword  string `json:"keyword"` // 匹配昵称、手机号和邮箱，可以不传
+	Status   *int8  `json:"status"`  // 不传时不限
+	IsAdmin  *int8  `json:"is_admin"`
+	Page     int    `json:"page"` // 从1开始
+	PageSize int    `json:"page_size"`
+}
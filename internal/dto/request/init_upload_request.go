@@ -0,0 +1,9 @@
+package request
+
+type InitUploadRequest struct {
+	UserId   string `json:"-"` // 登录用户，由中间件写入
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"` // 字节数
+	FileHash string `json:"file_hash"` // 整个文件的sha256，十六进制
+	Type     int    `json:"type"`      // 消息类型，语音消息会解析时长
+}
@@ -1,6 +1,6 @@
 package request
 
 type LeaveGroupRequest struct {
-	UserId  string `json:"user_id"`
+	UserId  string `json:"-"` // 登录用户，由中间件写入
 	GroupId string `json:"group_id"`
 }
@@ -3,4 +3,6 @@ package request
 type LoginRequest struct {
 	Telephone string `json:"telephone"`
 	Password  string `json:"password"`
+	ClientIp  string `json:"-"` // 由controller写入，用于频率限制
+	DeviceInfo
 }
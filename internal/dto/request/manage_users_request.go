@@ -0,0 +1,7 @@
+package request
+
+// ManageUsersRequest 启用、禁用、删除用户共用
+type ManageUsersRequest struct {
+	Uuid     string   `json:"-"` // 登录用户，由中间件写入，必须是管理员
+	UuidList []string `json:"uuid_list"`
+}
@@ -0,0 +1,7 @@
+package request
+
+type MarkSessionReadRequest struct {
+	OwnerId   string `json:"-"` // 登录用户，由中间件写入
+	SessionId string `json:"session_id"`
+	MessageId string `json:"message_id"` // 已读到的消息uuid
+}
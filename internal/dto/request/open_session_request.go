@@ -1,6 +1,6 @@
 package request
 
 type OpenSessionRequest struct {
-	SendId    string `json:"send_id"`
+	SendId    string `json:"-"` // 登录用户，由中间件写入
 	ReceiveId string `json:"receive_id"`
 }
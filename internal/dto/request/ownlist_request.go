@@ -1,5 +0,0 @@
-package request
-
-type OwnlistRequest struct {
-	OwnerId string `json:"owner_id"`
-}
@@ -0,0 +1,6 @@
+package request
+
+type RecallMessageRequest struct {
+	OperatorId string `json:"-"` // 登录用户，由中间件写入
+	MessageId  string `json:"message_id"`
+}
@@ -0,0 +1,6 @@
+package request
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	ClientIp     string `json:"-"` // 由controller写入，记录设备最近活跃的ip
+}
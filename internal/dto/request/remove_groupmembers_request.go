@@ -2,6 +2,6 @@ package request
 
 type RemoveGroupMembersRequest struct {
 	GroupId  string   `json:"group_id"`
-	OwnerId  string   `json:"owner_id"`
+	OwnerId  string   `json:"-"` // 登录用户，由中间件写入
 	UuidList []string `json:"uuid_list"`
 }
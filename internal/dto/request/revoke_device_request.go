@@ -0,0 +1,7 @@
+package request
+
+type RevokeDeviceRequest struct {
+	Uuid       string `json:"-"` // 登录用户，由中间件写入
+	CurrentSid string `json:"-"` // 当前登录，由中间件写入
+	Sid        string `json:"sid"`
+}
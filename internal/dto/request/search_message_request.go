@@ -0,0 +1,13 @@
+package request
+
+type SearchMessageRequest struct {
+	UserId    string `json:"-"` // 登录用户，由中间件写入
+	Keyword   string `json:"keyword"`
+	SendId    string `json:"send_id"`    // 发送者uuid，可以不传
+	SessionId string `json:"session_id"` // 限定会话，可以不传
+	Type      *int8  `json:"type"`       // 消息类型，不传时不限
+	StartDate string `json:"start_date"` // 格式2006-01-02，包含当天
+	EndDate   string `json:"end_date"`   // 格式2006-01-02，包含当天
+	Page      int    `json:"page"`       // 从1开始
+	PageSize  int    `json:"page_size"`
+}
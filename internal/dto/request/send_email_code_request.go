@@ -0,0 +1,6 @@
+package request
+
+type SendEmailCodeRequest struct {
+	Email    string `json:"email"`
+	ClientIp string `json:"-"` // 由controller写入，用于频率限制
+}
@@ -2,4 +2,5 @@ package request
 
 type SendSmsCodeRequest struct {
 	Telephone string `json:"telephone"`
+	ClientIp  string `json:"-"` // 由controller写入，用于频率限制
 }
@@ -0,0 +1,7 @@
+package request
+
+type SetAdminRequest struct {
+	Uuid     string   `json:"-"` // 登录用户，由中间件写入，必须是管理员
+	UuidList []string `json:"uuid_list"`
+	IsAdmin  int8     `json:"is_admin"` // 0.取消管理员，1.设为管理员
+}
@@ -3,4 +3,6 @@ package request
 type SmsLoginRequest struct {
 	Telephone string `json:"telephone"`
 	SmsCode   string `json:"sms_code"`
+	ClientIp  string `json:"-"` // 由controller写入，用于频率限制
+	DeviceInfo
 }
@@ -0,0 +1,7 @@
+package request
+
+type ToggleReactionRequest struct {
+	UserId    string `json:"-"` // 登录用户，由中间件写入
+	MessageId string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
@@ -1,7 +1,7 @@
 package request
 
 type UpdateGroupInfoRequest struct {
-	OwnerId string `json:"owner_id"`
+	OwnerId string `json:"-"` // 登录用户，由中间件写入
 	Uuid    string `json:"uuid"`
 	Name    string `json:"name"`
 	Avatar  string `json:"avatar"`
@@ -1,10 +1,11 @@
 package request
 
 type UpdateUserInfoRequest struct {
-	Uuid      string `json:"uuid"`
+	Uuid      string `json:"-"` // 登录用户，由中间件写入
 	Email     string `json:"email"`
 	Nickname  string `json:"nickname"`
 	Birthday  string `json:"birthday"`
 	Signature string `json:"signature"`
 	Avatar    string `json:"avatar"`
+	ClientIp  string `json:"-"` // 由controller写入，修改邮箱时发送验证邮件需要频率限制
 }
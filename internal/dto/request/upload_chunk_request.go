@@ -0,0 +1,9 @@
+package request
+
+// UploadChunkRequest 由multipart表单读取，分片内容在file字段
+type UploadChunkRequest struct {
+	UserId   string // 登录用户，由中间件写入
+	UploadId string // 表单字段upload_id
+	Offset   int64  // 表单字段offset，必须是分片大小的整数倍
+	Checksum string // 表单字段checksum，分片内容的sha256，十六进制
+}
@@ -0,0 +1,6 @@
+package request
+
+type VerifyEmailRequest struct {
+	Uuid string `json:"-"` // 登录用户，由中间件写入
+	Code string `json:"code"`
+}
@@ -0,0 +1,12 @@
+package respond
+
+type DeviceRespond struct {
+	Sid          string `json:"sid"`
+	DeviceId     string `json:"device_id"`
+	Platform     string `json:"platform"`
+	DeviceName   string `json:"device_name"`
+	Ip           string `json:"ip"`
+	LastActiveAt string `json:"last_active_at"`
+	CreatedAt    string `json:"created_at"`
+	IsCurrent    bool   `json:"is_current"` // 是否为发起请求的设备
+}
@@ -1,15 +1,27 @@
 package respond
 
+import "encoding/json"
+
 type GetMessageListRespond struct {
-	SendId     string `json:"send_id"`
-	SendName   string `json:"send_name"`
-	SendAvatar string `json:"send_avatar"`
-	ReceiveId  string `json:"receive_id"`
-	Type       int8   `json:"type"`
-	Content    string `json:"content"`
-	Url        string `json:"url"`
-	FileType   string `json:"file_type"`
-	FileName   string `json:"file_name"`
-	FileSize   string `json:"file_size"`
-	CreatedAt  string `json:"created_at"` // 先用CreatedAt排序，后面考虑改成SentAt
+	Uuid       string                `json:"uuid"`
+	SendId     string                `json:"send_id"`
+	SendName   string                `json:"send_name"`
+	SendAvatar string                `json:"send_avatar"`
+	ReceiveId  string                `json:"receive_id"`
+	Type       int8                  `json:"type"`
+	Content    string                `json:"content"`
+	Url        string                `json:"url"`
+	FileType   string                `json:"file_type"`
+	FileName   string                `json:"file_name"`
+	FileSize   string                `json:"file_size"`
+	Width      int                   `json:"width"` // 图片宽高，非图片为0
+	Height     int                   `json:"height"`
+	Duration   int                   `json:"duration"`             // 语音时长，单位毫秒
+	Thumbnails json.RawMessage       `json:"thumbnails,omitempty"` // []model.Thumbnail，按尺寸升序
+	CreatedAt  string                `json:"created_at"`           // 先用CreatedAt排序，后面考虑改成SentAt
+	IsEdited   int8                  `json:"is_edited"`            // 编辑过的消息前端显示"已编辑"
+	IsRecalled int8                  `json:"is_recalled"`          // 撤回的消息内容为空
+	ReplyTo    *QuotedMessageRespond `json:"reply_to,omitempty"`   // 回复的消息，没有回复或者被回复的消息不存在时不返回
+	ThreadId   string                `json:"thread_id"`
+	Reactions  []ReactionRespond     `json:"reactions,omitempty"` // 按第一次回应的时间升序
 }
@@ -0,0 +1,7 @@
+package respond
+
+type GetMessagePageRespond struct {
+	MessageList []GetMessageListRespond `json:"message_list"` // 按时间升序
+	NextCursor  string                  `json:"next_cursor"`  // 继续翻页时作为before/after传回
+	HasMore     bool                    `json:"has_more"`
+}
@@ -0,0 +1,7 @@
+package respond
+
+// GetMessageThreadRespond 群聊话题，Replies按时间升序
+type GetMessageThreadRespond struct {
+	Root    GetGroupMessageListRespond   `json:"root"`
+	Replies []GetGroupMessageListRespond `json:"replies"`
+}
@@ -0,0 +1,7 @@
+package respond
+
+type GetUserInfoListRespond struct {
+	UserList []GetUserInfoRespond `json:"user_list"` // 按注册时间倒序
+	Total    int64                `json:"total"`
+	HasMore  bool                 `json:"has_more"`
+}
@@ -1,15 +1,16 @@
 package respond
 
 type GetUserInfoRespond struct {
-	Uuid      string `json:"uuid"`
-	Nickname  string `json:"nickname"`
-	Telephone string `json:"telephone"`
-	Avatar    string `json:"avatar"`
-	Email     string `json:"email"`
-	Gender    int8   `json:"gender"`
-	Birthday  string `json:"birthday"`
-	Signature string `json:"signature"`
-	CreatedAt string `json:"created_at"`
-	IsAdmin   int8   `json:"is_admin"`
-	Status    int8   `json:"status"`
+	Uuid          string `json:"uuid"`
+	Nickname      string `json:"nickname"`
+	Telephone     string `json:"telephone"`
+	Avatar        string `json:"avatar"`
+	Email         string `json:"email"`
+	EmailVerified int8   `json:"email_verified"` // 0.未验证，1.已验证，修改邮箱后验证前仍为原邮箱
+	Gender        int8   `json:"gender"`
+	Birthday      string `json:"birthday"`
+	Signature     string `json:"signature"`
+	CreatedAt     string `json:"created_at"`
+	IsAdmin       int8   `json:"is_admin"`
+	Status        int8   `json:"status"`
 }
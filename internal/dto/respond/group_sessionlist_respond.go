@@ -5,4 +5,5 @@ type GroupSessionListRespond struct {
 	GroupName string `json:"group_name"`
 	GroupId   string `json:"group_id"`
 	Avatar    string `json:"avatar"`
+	UnreadCnt int    `json:"unread_cnt"`
 }
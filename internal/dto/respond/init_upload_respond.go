@@ -0,0 +1,10 @@
+package respond
+
+// InitUploadRespond File不为空时说明相同内容的文件已经上传过，不需要再传分片
+type InitUploadRespond struct {
+	UploadId       string             `json:"upload_id"`
+	ChunkSize      int64              `json:"chunk_size"` // 字节数，最后一片可以更小
+	ChunkCount     int                `json:"chunk_count"`
+	UploadedOffset []int64            `json:"uploaded_offset"` // 续传时已经上传的分片，按offset升序
+	File           *UploadFileRespond `json:"file,omitempty"`
+}
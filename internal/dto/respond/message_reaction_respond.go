@@ -0,0 +1,13 @@
+package respond
+
+// MessageReactionRespond 有人回应或取消回应，通过长连接推送给会话中的所有人
+type MessageReactionRespond struct {
+	Event     string            `json:"event"` // 固定为 constants.EVENT_MESSAGE_REACTION
+	MessageId string            `json:"message_id"`
+	SendId    string            `json:"send_id"`
+	ReceiveId string            `json:"receive_id"`
+	UserId    string            `json:"user_id"` // 回应的用户
+	Emoji     string            `json:"emoji"`
+	Added     bool              `json:"added"`     // true为回应，false为取消
+	Reactions []ReactionRespond `json:"reactions"` // 变化后该消息的全部回应
+}
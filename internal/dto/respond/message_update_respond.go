@@ -0,0 +1,12 @@
+package respond
+
+// MessageUpdateRespond 消息被撤回或编辑，通过长连接推送给会话中的所有人，前端原地更新
+type MessageUpdateRespond struct {
+	Event      string `json:"event"` // constants.EVENT_MESSAGE_RECALL 或 constants.EVENT_MESSAGE_EDIT
+	MessageId  string `json:"message_id"`
+	SendId     string `json:"send_id"`
+	ReceiveId  string `json:"receive_id"`
+	OperatorId string `json:"operator_id"` // 撤回人，发送者或群主
+	Content    string `json:"content"`     // 仅编辑，编辑后的内容
+	UpdatedAt  string `json:"updated_at"`
+}
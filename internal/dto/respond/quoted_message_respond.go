@@ -0,0 +1,49 @@
+package respond
+
+import (
+	"go_chat/internal/model"
+	"go_chat/pkg/enum/message/message_type_enum"
+)
+
+// quoteSnippetLen 引用摘要最多保留的字数
+const quoteSnippetLen = 50
+
+// QuotedMessageRespond 被回复消息的摘要，随回复消息一起返回
+type QuotedMessageRespond struct {
+	Uuid       string `json:"uuid"`
+	SendId     string `json:"send_id"`
+	SendName   string `json:"send_name"`
+	Type       int8   `json:"type"`
+	Snippet    string `json:"snippet"`     // 文本取前50个字，文件取文件名，撤回后为空
+	IsRecalled int8   `json:"is_recalled"` // 被回复的消息已撤回
+}
+
+// NewQuotedMessageRespond 生成引用摘要
+func NewQuotedMessageRespond(message *model.Message) *QuotedMessageRespond {
+	quote := &QuotedMessageRespond{
+		Uuid:       message.Uuid,
+		SendId:     message.SendId,
+		SendName:   message.SendName,
+		Type:       message.Type,
+		IsRecalled: message.IsRecalled,
+	}
+	if message.IsRecalled == 1 {
+		return quote
+	}
+	switch message.Type {
+	case message_type_enum.TEXT:
+		snippet := []rune(message.Content)
+		if len(snippet) > quoteSnippetLen {
+			quote.Snippet = string(snippet[:quoteSnippetLen]) + "..."
+		} else {
+			quote.Snippet = message.Content
+		}
+	case message_type_enum.VOICE:
+		quote.Snippet = "[语音]"
+	case message_type_enum.FILE:
+		quote.Snippet = "[文件] " + message.FileName
+	default:
+		quote.Snippet = "[通话]"
+	}
+	return quote
+}
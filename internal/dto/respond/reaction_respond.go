@@ -0,0 +1,8 @@
+package respond
+
+// ReactionRespond 某个表情的回应汇总
+type ReactionRespond struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIds []string `json:"user_ids"` // 按回应时间升序
+}
@@ -0,0 +1,11 @@
+package respond
+
+// ReadReceiptRespond 已读回执，通过长连接推送给消息发送者
+type ReadReceiptRespond struct {
+	Event     string `json:"event"`      // 固定为 constants.EVENT_READ_RECEIPT，用于和聊天消息区分
+	ReaderId  string `json:"reader_id"`  // 已读的用户
+	ContactId string `json:"contact_id"` // 单聊为已读的用户，群聊为群聊id
+	MessageId string `json:"message_id"` // 已读到的消息
+	ReadAt    string `json:"read_at"`
+	ReadCnt   int64  `json:"read_cnt"` // 仅群聊，已读到该消息的成员数，不含接收回执的人
+}
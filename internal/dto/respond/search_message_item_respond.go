@@ -0,0 +1,14 @@
+package respond
+
+type SearchMessageItemRespond struct {
+	Uuid       string `json:"uuid"`
+	ContactId  string `json:"contact_id"` // 单聊为对方uuid，群聊为群uuid，用于跳转到会话
+	SendId     string `json:"send_id"`
+	SendName   string `json:"send_name"`
+	SendAvatar string `json:"send_avatar"`
+	ReceiveId  string `json:"receive_id"`
+	Type       int8   `json:"type"`
+	FileName   string `json:"file_name"`
+	Highlight  string `json:"highlight"` // 匹配位置附近的内容，已做HTML转义，关键词用<em>标出
+	CreatedAt  string `json:"created_at"`
+}
@@ -0,0 +1,7 @@
+package respond
+
+type SearchMessageRespond struct {
+	MessageList []SearchMessageItemRespond `json:"message_list"` // 按时间倒序
+	Total       int64                      `json:"total"`
+	HasMore     bool                       `json:"has_more"`
+}
@@ -0,0 +1,7 @@
+package respond
+
+type TokenRespond struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token有效期，单位秒
+}
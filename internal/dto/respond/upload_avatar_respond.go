@@ -0,0 +1,5 @@
+package respond
+
+type UploadAvatarRespond struct {
+	Url string `json:"url"` // 作为updateUserInfo或updateGroupInfo的avatar传回
+}
@@ -0,0 +1,5 @@
+package respond
+
+type UploadChunkRespond struct {
+	UploadedCount int `json:"uploaded_count"` // 已上传的分片数，等于chunk_count时可以调用completeUpload
+}
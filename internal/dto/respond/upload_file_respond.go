@@ -0,0 +1,15 @@
+package respond
+
+import "go_chat/internal/model"
+
+// UploadFileRespond 字段和 request.ChatMessageRequest 一致，前端发文件消息时原样带上
+type UploadFileRespond struct {
+	Url        string            `json:"url"`
+	FileName   string            `json:"file_name"` // 原始文件名，超长时截断
+	FileType   string            `json:"file_type"` // 扩展名，不带点
+	FileSize   string            `json:"file_size"` // 字节数
+	Width      int               `json:"width"`     // 图片宽高，非图片为0
+	Height     int               `json:"height"`
+	Duration   int               `json:"duration"`             // 语音时长，单位毫秒，无法解析时为0
+	Thumbnails []model.Thumbnail `json:"thumbnails,omitempty"` // 按尺寸升序，原图比最小尺寸还小时为空
+}
@@ -5,4 +5,5 @@ type UserSessionListRespond struct {
 	Avatar    string `json:"avatar"`
 	UserId    string `json:"user_id"`
 	Username  string `json:"user_name"`
+	UnreadCnt int    `json:"unread_cnt"`
 }
@@ -3,14 +3,23 @@ package https_server
 import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	v1 "go_chat/api/v1"
 	"go_chat/internal/config"
+	"go_chat/internal/middleware"
+	"go_chat/pkg/zlog"
+	"strings"
 	//"go_chat/pkg/ssl"
 )
 
 var GE *gin.Engine
 
-func init() {
+// Init 创建gin引擎并注册路由
+func Init() {
 	GE = gin.Default()
+	// 不信任任何代理时ClientIP为连接的IP，避免伪造X-Forwarded-For绕过按IP的频率限制
+	if err := GE.SetTrustedProxies(trustedProxies()); err != nil {
+		zlog.Fatal(err.Error())
+	}
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{"*"}
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
@@ -19,53 +28,103 @@ func init() {
 	//GE.Use(ssl.TlsHandler(config.GetConfig().MainConfig.Host, config.GetConfig().MainConfig.Port))
 	GE.Static("/static/avatars", config.GetConfig().StaticAvatarPath)
 	GE.Static("/static/files", config.GetConfig().StaticFilePath)
-	//GE.POST("/login", v1.Login)
-	//GE.POST("/register", v1.Register)
-	//GE.POST("/user/updateUserInfo", v1.UpdateUserInfo)
-	//GE.POST("/user/getUserInfoList", v1.GetUserInfoList)
-	//GE.POST("/user/ableUsers", v1.AbleUsers)
-	//GE.POST("/user/getUserInfo", v1.GetUserInfo)
-	//GE.POST("/user/disableUsers", v1.DisableUsers)
-	//GE.POST("/user/deleteUsers", v1.DeleteUsers)
-	//GE.POST("/user/setAdmin", v1.SetAdmin)
-	//GE.POST("/user/sendSmsCode", v1.SendSmsCode)
-	//GE.POST("/user/smsLogin", v1.SmsLogin)
-	//GE.POST("/user/wsLogout", v1.WsLogout)
-	//GE.POST("/group/createGroup", v1.CreateGroup)
-	//GE.POST("/group/loadMyGroup", v1.LoadMyGroup)
-	//GE.POST("/group/checkGroupAddMode", v1.CheckGroupAddMode)
-	//GE.POST("/group/enterGroupDirectly", v1.EnterGroupDirectly)
-	//GE.POST("/group/leaveGroup", v1.LeaveGroup)
-	//GE.POST("/group/dismissGroup", v1.DismissGroup)
-	//GE.POST("/group/getGroupInfo", v1.GetGroupInfo)
-	//GE.POST("/group/getGroupInfoList", v1.GetGroupInfoList)
-	//GE.POST("/group/deleteGroups", v1.DeleteGroups)
-	//GE.POST("/group/setGroupsStatus", v1.SetGroupsStatus)
-	//GE.POST("/group/updateGroupInfo", v1.UpdateGroupInfo)
-	//GE.POST("/group/getGroupMemberList", v1.GetGroupMemberList)
-	//GE.POST("/group/removeGroupMembers", v1.RemoveGroupMembers)
-	//GE.POST("/session/openSession", v1.OpenSession)
-	//GE.POST("/session/getUserSessionList", v1.GetUserSessionList)
-	//GE.POST("/session/getGroupSessionList", v1.GetGroupSessionList)
-	//GE.POST("/session/deleteSession", v1.DeleteSession)
-	//GE.POST("/session/checkOpenSessionAllowed", v1.CheckOpenSessionAllowed)
-	//GE.POST("/contact/getUserList", v1.GetUserList)
-	//GE.POST("/contact/loadMyJoinedGroup", v1.LoadMyJoinedGroup)
-	//GE.POST("/contact/getContactInfo", v1.GetContactInfo)
-	//GE.POST("/contact/deleteContact", v1.DeleteContact)
-	//GE.POST("/contact/applyContact", v1.ApplyContact)
-	//GE.POST("/contact/getNewContactList", v1.GetNewContactList)
-	//GE.POST("/contact/passContactApply", v1.PassContactApply)
-	//GE.POST("/contact/blackContact", v1.BlackContact)
-	//GE.POST("/contact/cancelBlackContact", v1.CancelBlackContact)
-	//GE.POST("/contact/getAddGroupList", v1.GetAddGroupList)
-	//GE.POST("/contact/refuseContactApply", v1.RefuseContactApply)
-	//GE.POST("/contact/blackApply", v1.BlackApply)
-	//GE.POST("/message/getMessageList", v1.GetMessageList)
-	//GE.POST("/message/getGroupMessageList", v1.GetGroupMessageList)
-	//GE.POST("/message/uploadAvatar", v1.UploadAvatar)
-	//GE.POST("/message/uploadFile", v1.UploadFile)
-	//GE.POST("/chatroom/getCurContactListInChatRoom", v1.GetCurContactListInChatRoom)
-	//GE.GET("/wss", v1.WsLogin)
 
+	api := GE.Group("/api/v1")
+
+	// 无需登录
+	api.POST("/login", v1.Login)
+	api.POST("/register", v1.Register)
+	api.POST("/user/sendSmsCode", v1.SendSmsCode)
+	api.POST("/user/smsLogin", v1.SmsLogin)
+	api.POST("/user/refreshToken", v1.RefreshToken)
+	api.POST("/user/sendEmailCode", v1.SendEmailCode)
+	api.POST("/user/emailLogin", v1.EmailLogin)
+	api.POST("/user/forgotPassword", v1.ForgotPassword)
+	api.POST("/user/resetPassword", v1.ResetPassword)
+
+	// 需要登录
+	authed := api.Group("", middleware.Auth())
+
+	user := authed.Group("/user")
+	user.POST("/updateUserInfo", v1.UpdateUserInfo)
+	user.POST("/verifyEmail", v1.VerifyEmail)
+	user.POST("/getUserInfoList", v1.GetUserInfoList)
+	user.POST("/ableUsers", v1.AbleUsers)
+	user.POST("/getUserInfo", v1.GetUserInfo)
+	user.POST("/disableUsers", v1.DisableUsers)
+	user.POST("/deleteUsers", v1.DeleteUsers)
+	user.POST("/setAdmin", v1.SetAdmin)
+	user.POST("/logout", v1.Logout)
+	user.POST("/getDevices", v1.GetDevices)
+	user.POST("/revokeDevice", v1.RevokeDevice)
+	user.POST("/revokeOtherDevices", v1.RevokeOtherDevices)
+	user.POST("/changePassword", v1.ChangePassword)
+	user.POST("/wsLogout", v1.WsLogout)
+
+	group := authed.Group("/group")
+	group.POST("/createGroup", v1.CreateGroup)
+	group.POST("/loadMyGroup", v1.LoadMyGroup)
+	group.POST("/checkGroupAddMode", v1.CheckGroupAddMode)
+	group.POST("/enterGroupDirectly", v1.EnterGroupDirectly)
+	group.POST("/leaveGroup", v1.LeaveGroup)
+	group.POST("/dismissGroup", v1.DismissGroup)
+	group.POST("/getGroupInfo", v1.GetGroupInfo)
+	//group.POST("/getGroupInfoList", v1.GetGroupInfoList)
+	//group.POST("/deleteGroups", v1.DeleteGroups)
+	//group.POST("/setGroupsStatus", v1.SetGroupsStatus)
+	group.POST("/updateGroupInfo", v1.UpdateGroupInfo)
+	group.POST("/getGroupMemberList", v1.GetGroupMemberList)
+	group.POST("/removeGroupMembers", v1.RemoveGroupMembers)
+
+	session := authed.Group("/session")
+	session.POST("/openSession", v1.OpenSession)
+	session.POST("/getUserSessionList", v1.GetUserSessionList)
+	session.POST("/getGroupSessionList", v1.GetGroupSessionList)
+	session.POST("/deleteSession", v1.DeleteSession)
+	session.POST("/checkOpenSessionAllowed", v1.CheckOpenSessionAllowed)
+	session.POST("/markSessionRead", v1.MarkSessionRead)
+
+	contact := authed.Group("/contact")
+	contact.POST("/getUserList", v1.GetUserList)
+	contact.POST("/loadMyJoinedGroup", v1.LoadMyJoinedGroup)
+	contact.POST("/getContactInfo", v1.GetContactInfo)
+	contact.POST("/deleteContact", v1.DeleteContact)
+	contact.POST("/applyContact", v1.ApplyContact)
+	contact.POST("/getNewContactList", v1.GetNewContactList)
+	contact.POST("/passContactApply", v1.PassContactApply)
+	contact.POST("/blackContact", v1.BlackContact)
+	contact.POST("/cancelBlackContact", v1.CancelBlackContact)
+	contact.POST("/getAddGroupList", v1.GetAddGroupList)
+	contact.POST("/refuseContactApply", v1.RefuseContactApply)
+	contact.POST("/blackApply", v1.BlackApply)
+
+	message := authed.Group("/message")
+	message.POST("/getMessageList", v1.GetMessageList)
+	message.POST("/getGroupMessageList", v1.GetGroupMessageList)
+	message.POST("/getMessagePage", v1.GetMessagePage)
+	message.POST("/getGroupMessagePage", v1.GetGroupMessagePage)
+	message.POST("/recallMessage", v1.RecallMessage)
+	message.POST("/editMessage", v1.EditMessage)
+	message.POST("/getMessageThread", v1.GetMessageThread)
+	message.POST("/toggleReaction", v1.ToggleReaction)
+	message.POST("/searchMessages", v1.SearchMessages)
+	message.POST("/uploadAvatar", v1.UploadAvatar)
+	message.POST("/uploadFile", v1.UploadFile)
+	message.POST("/initUpload", v1.InitUpload)
+	message.POST("/uploadChunk", v1.UploadChunk)
+	message.POST("/completeUpload", v1.CompleteUpload)
+
+	//authed.POST("/chatroom/getCurContactListInChatRoom", v1.GetCurContactListInChatRoom)
+	authed.GET("/wss", v1.WsLogin)
+}
+
+// trustedProxies 解析 mainConfig.trustedProxies，为空时返回nil
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(config.GetConfig().TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
 }
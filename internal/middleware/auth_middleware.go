@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go_chat/internal/service/auth"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/zlog"
+	"net/http"
+	"strings"
+)
+
+// Auth 校验 Authorization: Bearer <token>，并把登录用户写入上下文
+// websocket握手无法自定义header，允许用 ?token= 传递
+func Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("token")
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusOK, gin.H{
+				"code":    401,
+				"message": "请先登录",
+			})
+			return
+		}
+		claims, err := auth.AuthService.ParseAccessToken(token)
+		if err != nil {
+			if errors.Is(err, auth.ErrTokenInvalid) || errors.Is(err, auth.ErrTokenExpired) || errors.Is(err, auth.ErrTokenRevoked) {
+				zlog.Info(err.Error())
+				c.AbortWithStatusJSON(http.StatusOK, gin.H{
+					"code":    401,
+					"message": err.Error(),
+				})
+				return
+			}
+			zlog.Error(err.Error())
+			c.AbortWithStatusJSON(http.StatusOK, gin.H{
+				"code":    500,
+				"message": constants.SYSTEM_ERROR,
+			})
+			return
+		}
+		c.Set(constants.CTX_UUID, claims.Uuid)
+		c.Set(constants.CTX_SID, claims.Sid)
+		auth.AuthService.TouchSession(claims.Sid, c.ClientIP())
+		c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// DeliveryCursor 每次登录已投递到的最新消息，同一用户的多个设备各自记录，重连后从这里开始补发离线消息
+type DeliveryCursor struct {
+	Id         int64     `gorm:"column:id;primaryKey;comment:自增id"`
+	UserId     string    `gorm:"column:user_id;uniqueIndex:idx_delivery_cursor_user_sid;type:char(20);not null;comment:用户uuid"`
+	Sid        string    `gorm:"column:sid;uniqueIndex:idx_delivery_cursor_user_sid;type:char(20);not null;comment:登录会话id，和device_session.sid一致"`
+	MessageId  string    `gorm:"column:message_id;type:char(20);not null;comment:已投递到的消息uuid"`
+	MessageSeq int64     `gorm:"column:message_seq;not null;comment:已投递到的消息自增id，和message_at一起比较先后"`
+	MessageAt  time.Time `gorm:"column:message_at;type:datetime(3);not null;comment:已投递到的消息的创建时间"`
+	UpdatedAt  time.Time `gorm:"column:updated_at;type:datetime;not null;comment:更新时间"`
+}
+
+func (DeliveryCursor) TableName() string {
+	return "delivery_cursor"
+}
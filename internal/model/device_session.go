@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// DeviceSession 一次登录对应一条记录，Sid和token中的sid一致，刷新token时不变
+// 注销设备时直接删除，access token在自然过期前由黑名单拦截
+type DeviceSession struct {
+	Id           int64     `gorm:"column:id;primaryKey;comment:自增id"`
+	Sid          string    `gorm:"column:sid;uniqueIndex;type:char(20);not null;comment:登录会话id"`
+	UserId       string    `gorm:"column:user_id;index;type:char(20);not null;comment:用户uuid"`
+	DeviceId     string    `gorm:"column:device_id;type:varchar(64);comment:客户端生成的设备id，同一设备重复登录时顶掉旧的登录"`
+	Platform     string    `gorm:"column:platform;type:varchar(20);not null;comment:平台，ios/android/windows/mac/linux/web"`
+	DeviceName   string    `gorm:"column:device_name;type:varchar(64);comment:设备名称，由客户端上报"`
+	Ip           string    `gorm:"column:ip;type:varchar(64);comment:最近一次活跃的ip"`
+	LastActiveAt time.Time `gorm:"column:last_active_at;type:datetime;not null;comment:最近活跃时间"`
+	CreatedAt    time.Time `gorm:"column:created_at;type:datetime;not null;comment:登录时间"`
+}
+
+func (DeviceSession) TableName() string {
+	return "device_session"
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GroupMember 群成员，退群、被踢或解散时直接删除
+type GroupMember struct {
+	Id        int64        `gorm:"column:id;primaryKey;comment:自增id"`
+	GroupId   string       `gorm:"column:group_id;uniqueIndex:idx_group_member,priority:1;type:char(20);not null;comment:群组uuid"`
+	UserId    string       `gorm:"column:user_id;uniqueIndex:idx_group_member,priority:2;index;type:char(20);not null;comment:成员uuid"`
+	Role      int8         `gorm:"column:role;default:0;comment:角色，0.普通成员，1.管理员，2.群主"`
+	InviterId string       `gorm:"column:inviter_id;type:char(20);comment:邀请人uuid，主动加群时为空"`
+	MuteUntil sql.NullTime `gorm:"column:mute_until;type:datetime;comment:禁言截止时间"`
+	JoinedAt  time.Time    `gorm:"column:joined_at;type:datetime;not null;comment:入群时间"`
+}
+
+func (GroupMember) TableName() string {
+	return "group_member"
+}
@@ -2,30 +2,70 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
 type Message struct {
 	Id        int64  `gorm:"column:id;primaryKey;comment:自增id"`
 	Uuid      string `gorm:"column:uuid;uniqueIndex;type:char(20);not null;comment:消息uuid"`
-	SessionId string `gorm:"column:session_id;index;type:char(20);not null;comment:会话uuid"`
+	SessionId string `gorm:"column:session_id;index:idx_message_session_created,priority:1;type:char(20);not null;comment:会话uuid"`
 	Type      int8   `gorm:"column:type;not null;comment:消息类型，0.文本，1.语音，2.文件，3.通话"` // 通话不用存消息内容或者url
-	Content   string `gorm:"column:content;type:TEXT;comment:消息内容"`
+	Content   string `gorm:"column:content;index:idx_message_fulltext,class:FULLTEXT,option:WITH PARSER ngram;type:TEXT;comment:消息内容"`
 	Url       string `gorm:"column:url;type:char(255);comment:消息url"`
 
 	SendId     string `gorm:"column:send_id;index;type:char(20);not null;comment:发送者uuid"`
 	SendName   string `gorm:"column:send_name;type:varchar(20);not null;comment:发送者昵称"`
 	SendAvatar string `gorm:"column:send_avatar;type:varchar(255);not null;comment:发送者头像"`
-	ReceiveId  string `gorm:"column:receive_id;index;type:char(20);not null;comment:接受者uuid"`
+	ReceiveId  string `gorm:"column:receive_id;index:idx_message_receive_created,priority:1;type:char(20);not null;comment:接受者uuid"`
 
 	FileType string `gorm:"column:file_type;type:char(10);comment:文件类型"`
-	FileName string `gorm:"column:file_name;type:varchar(50);comment:文件名"`
+	FileName string `gorm:"column:file_name;index:idx_message_fulltext,class:FULLTEXT,option:WITH PARSER ngram;type:varchar(50);comment:文件名"`
 	FileSize string `gorm:"column:file_size;type:char(20);comment:文件大小"`
 
+	Width      int             `gorm:"column:width;not null;default:0;comment:图片宽度"`
+	Height     int             `gorm:"column:height;not null;default:0;comment:图片高度"`
+	Duration   int             `gorm:"column:duration;not null;default:0;comment:语音时长，单位毫秒"`
+	Thumbnails json.RawMessage `gorm:"column:thumbnails;type:json;comment:缩略图"` // []Thumbnail，按尺寸升序
+
 	Status    int8         `gorm:"column:status;not null;comment:状态，0.未发送，1.已发送"`
-	CreatedAt time.Time    `gorm:"column:created_at;not null;comment:创建时间"`
+	CreatedAt time.Time    `gorm:"column:created_at;index:idx_message_session_created,priority:2;index:idx_message_receive_created,priority:2;not null;comment:创建时间"`
 	SendAt    sql.NullTime `gorm:"column:send_at;comment:发送时间"`
 	AVdata    string       `gorm:"column:av_data;comment:通话传递数据"`
+
+	ReplyToId string `gorm:"column:reply_to_id;type:char(20);comment:回复的消息uuid"`
+	ThreadId  string `gorm:"column:thread_id;index;type:char(20);comment:话题根消息uuid"` // 回复链上的消息都指向最早被回复的那条消息
+
+	IsEdited    int8            `gorm:"column:is_edited;not null;default:0;comment:是否编辑过，0.否，1.是"`
+	EditedAt    sql.NullTime    `gorm:"column:edited_at;comment:最近编辑时间"`
+	EditHistory json.RawMessage `gorm:"column:edit_history;type:json;comment:编辑历史"` // []MessageEdit，按编辑时间升序
+	IsRecalled  int8            `gorm:"column:is_recalled;not null;default:0;comment:是否撤回，0.否，1.是"`
+	RecalledAt  sql.NullTime    `gorm:"column:recalled_at;comment:撤回时间"`
+	RecalledBy  string          `gorm:"column:recalled_by;type:char(20);comment:撤回人uuid，发送者或群主"`
+}
+
+// Thumbnail 图片消息的缩略图
+type Thumbnail struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// MessageEdit 一次编辑之前的内容
+type MessageEdit struct {
+	Content  string    `json:"content"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// ConversationKey 消息所在会话的key，群聊为群uuid，单聊为双方uuid按字典序拼接，两个方向的消息得到同一个key
+func (m *Message) ConversationKey() string {
+	if m.ReceiveId == "" || m.ReceiveId[0] == 'G' {
+		return m.ReceiveId
+	}
+	if m.SendId < m.ReceiveId {
+		return m.SendId + "_" + m.ReceiveId
+	}
+	return m.ReceiveId + "_" + m.SendId
 }
 
 func (Message) TableName() string {
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// MessageReaction 消息的表情回应，同一用户对同一消息的同一表情只有一条，取消时直接删除
+type MessageReaction struct {
+	Id        int64     `gorm:"column:id;primaryKey;comment:自增id"`
+	MessageId string    `gorm:"column:message_id;uniqueIndex:idx_message_reaction,priority:1;type:char(20);not null;comment:消息uuid"`
+	UserId    string    `gorm:"column:user_id;uniqueIndex:idx_message_reaction,priority:2;type:char(20);not null;comment:回应的用户uuid"`
+	Emoji     string    `gorm:"column:emoji;uniqueIndex:idx_message_reaction,priority:3;type:varchar(32);not null;comment:表情"`
+	CreatedAt time.Time `gorm:"column:created_at;type:datetime(3);not null;comment:回应时间"`
+}
+
+func (MessageReaction) TableName() string {
+	return "message_reaction"
+}
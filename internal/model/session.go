@@ -18,6 +18,10 @@ type Session struct {
 
 	LastMessage   string       `gorm:"column:last_message;type:TEXT;comment:最新的消息"`
 	LastMessageAt sql.NullTime `gorm:"column:last_message_at;type:datetime;comment:最近接收时间"`
+
+	UnreadCnt     int          `gorm:"column:unread_cnt;default:0;comment:未读消息数"`
+	ReadMessageId string       `gorm:"column:read_message_id;type:char(20);comment:已读到的消息uuid"`
+	ReadAt        sql.NullTime `gorm:"column:read_at;type:datetime(3);comment:已读到的消息的创建时间"`
 	
 	CreatedAt time.Time      `gorm:"column:created_at;Index;type:datetime;comment:创建时间"`
 	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;Index;type:datetime;comment:删除时间"`
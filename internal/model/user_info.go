@@ -12,11 +12,11 @@ type UserInfo struct {
 	Uuid      string         `gorm:"column:uuid;uniqueIndex;type:char(20);comment:用户唯一id"`
 	Nickname  string         `gorm:"column:nickname;type:varchar(20);not null;comment:昵称"`
 	Telephone string         `gorm:"column:telephone;index;not null;type:char(11);comment:电话"`
-	Email     string         `gorm:"column:email;type:char(30);comment:邮箱"`
+	Email     sql.NullString `gorm:"column:email;uniqueIndex:idx_user_info_email_unique;type:varchar(100);comment:邮箱，未绑定时为NULL"`
 	Avatar    string         `gorm:"column:avatar;type:char(255);default:https://cube.elemecdn.com/0/88/03b0d39583f48206768a7534e55bcpng.png;not null;comment:头像"`
 	Gender    int8           `gorm:"column:gender;comment:性别，0.男，1.女"`
 	Signature string         `gorm:"column:signature;type:varchar(100);comment:个性签名"`
-	Password  string         `gorm:"column:password;type:char(18);not null;comment:密码"`
+	Password  string         `gorm:"column:password;type:varchar(100);not null;comment:密码，bcrypt密文"`
 	Birthday  string         `gorm:"column:birthday;type:char(8);comment:生日"`
 	CreatedAt time.Time      `gorm:"column:created_at;index;type:datetime;not null;comment:创建时间"`
 	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;type:datetime;comment:删除时间"`
@@ -24,6 +24,8 @@ type UserInfo struct {
 	LastOnlineAt  sql.NullTime `gorm:"column:last_online_at;type:datetime;comment:上次登录时间"`
 	LastOfflineAt sql.NullTime `gorm:"column:last_offline_at;type:datetime;comment:最近离线时间"`
 
+	EmailVerified int8 `gorm:"column:email_verified;not null;default:0;comment:邮箱是否已验证，0.未验证，1.已验证，只有验证过的邮箱可以登录和找回密码"`
+
 	IsAdmin int8 `gorm:"column:is_admin;not null;comment:是否是管理员，0.不是，1.是"`
 	Status  int8 `gorm:"column:status;index;not null;comment:状态，0.正常，1.禁用"`
 }
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"go_chat/internal/config"
+	"go_chat/internal/dao"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/model"
+	"go_chat/internal/service/cache"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/util/random"
+	"go_chat/pkg/zlog"
+	"time"
+)
+
+type authService struct {
+	cache  cache.Cache
+	store  dao.Store
+	closer SessionCloser
+}
+
+// SessionCloser 注销登录时断开该设备的长连接，由 chat.ChatServer 实现
+type SessionCloser interface {
+	CloseSession(uuid, sid string) error
+}
+
+// AuthService 由 Init 创建
+var AuthService *authService
+
+// Init 注入依赖，需要在注册路由之前调用
+func Init(c cache.Cache, store dao.Store, closer SessionCloser) {
+	AuthService = NewAuthService(c, store, closer)
+}
+
+// NewAuthService refresh token和注销记录保存在缓存中，登录设备保存在数据库中
+func NewAuthService(c cache.Cache, store dao.Store, closer SessionCloser) *authService {
+	return &authService{cache: c, store: store, closer: closer}
+}
+
+func (a *authService) secret() ([]byte, error) {
+	secret := config.GetConfig().TokenConfig.Secret
+	if secret == "" {
+		return nil, errors.New("tokenConfig.secret 未配置")
+	}
+	return []byte(secret), nil
+}
+
+func (a *authService) accessExpire() time.Duration {
+	return config.GetConfig().TokenConfig.AccessTokenExpire * time.Minute
+}
+
+func (a *authService) refreshExpire() time.Duration {
+	return config.GetConfig().TokenConfig.RefreshTokenExpire * time.Hour
+}
+
+// GenerateTokens 登录成功后登记设备，并签发access token和refresh token
+// device需要填好UserId和客户端上报的设备信息，同一设备重复登录时先注销旧的登录
+func (a *authService) GenerateTokens(device *model.DeviceSession) (*respond.TokenRespond, error) {
+	normalizeDevice(device)
+	if device.DeviceId != "" {
+		old, err := a.store.Devices().GetByDevice(device.UserId, device.DeviceId)
+		if err == nil {
+			if err := a.RevokeSession(old.UserId, old.Sid); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, dao.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	device.Sid = fmt.Sprintf("T%s", random.GetNowAndLenRandomString(11))
+	device.LastActiveAt = now
+	device.CreatedAt = now
+	if err := a.store.Devices().Create(device); err != nil {
+		return nil, err
+	}
+	return a.issueTokens(device.UserId, device.Sid)
+}
+
+// issueTokens 签发一对token，refresh token的jti记录在redis中，删除或被新的jti覆盖即失效
+func (a *authService) issueTokens(uuid, sid string) (*respond.TokenRespond, error) {
+	secret, err := a.secret()
+	if err != nil {
+		return nil, err
+	}
+	accessJti, err := newJti()
+	if err != nil {
+		return nil, err
+	}
+	refreshJti, err := newJti()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	access := &Claims{
+		Uuid:      uuid,
+		Sid:       sid,
+		Jti:       accessJti,
+		Type:      ACCESS_TOKEN,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(a.accessExpire()).Unix(),
+	}
+	refresh := &Claims{
+		Uuid:      uuid,
+		Sid:       sid,
+		Jti:       refreshJti,
+		Type:      REFRESH_TOKEN,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(a.refreshExpire()).Unix(),
+	}
+	accessToken, err := signToken(access, secret)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := signToken(refresh, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.cache.Set("refresh_token_"+sid, refreshJti, a.refreshExpire()); err != nil {
+		return nil, err
+	}
+	return &respond.TokenRespond{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(a.accessExpire().Seconds()),
+	}, nil
+}
+
+// ParseAccessToken 校验access token，已注销的token返回ErrTokenRevoked
+func (a *authService) ParseAccessToken(token string) (*Claims, error) {
+	secret, err := a.secret()
+	if err != nil {
+		return nil, err
+	}
+	claims, err := parseToken(token, secret)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != ACCESS_TOKEN {
+		return nil, ErrTokenInvalid
+	}
+	if _, err := a.cache.Get("revoked_token_" + claims.Sid); err == nil {
+		return nil, ErrTokenRevoked
+	} else if !errors.Is(err, cache.ErrCacheMiss) {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// RefreshToken 用refresh token换取新的token，旧的refresh token随即失效
+// 刷新不改变Sid，旧的access token在自然过期前仍然可用
+func (a *authService) RefreshToken(refreshToken, clientIp string) (string, *respond.TokenRespond, int) {
+	secret, err := a.secret()
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	claims, err := parseToken(refreshToken, secret)
+	if err != nil || claims.Type != REFRESH_TOKEN {
+		message := "登录已过期，请重新登录"
+		zlog.Info(message)
+		return message, nil, -2
+	}
+	jti, err := a.cache.Get("refresh_token_" + claims.Sid)
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if jti == "" || jti != claims.Jti {
+		message := "登录已失效，请重新登录"
+		zlog.Info(message)
+		return message, nil, -2
+	}
+	if err := a.store.Devices().Touch(claims.Sid, clientIp, time.Now()); err != nil {
+		zlog.Error(err.Error())
+	}
+	tokenRsp, err := a.issueTokens(claims.Uuid, claims.Sid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	return "刷新成功", tokenRsp, 0
+}
+
+// Logout 退出登录，同一次登录签发的token全部失效
+func (a *authService) Logout(uuid, sid string) (string, int) {
+	if err := a.RevokeSession(uuid, sid); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	return "退出登录成功", 0
+}
+
+// RevokeSession 注销一次登录：删除refresh token和设备记录，access token加入黑名单直到其自然过期，并断开该设备的长连接
+func (a *authService) RevokeSession(uuid, sid string) error {
+	if err := a.cache.Del("refresh_token_" + sid); err != nil {
+		return err
+	}
+	if err := a.cache.Set("revoked_token_"+sid, "1", a.accessExpire()); err != nil {
+		return err
+	}
+	if _, err := a.store.Devices().Delete(sid); err != nil {
+		return err
+	}
+	// 游标只影响补发，清理失败不影响注销
+	if err := a.store.Deliveries().DeleteStale(uuid); err != nil {
+		zlog.Error(err.Error())
+	}
+	return a.closer.CloseSession(uuid, sid)
+}
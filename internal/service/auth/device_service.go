@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go_chat/internal/dao"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/model"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/zlog"
+	"strings"
+	"time"
+)
+
+const (
+	touchInterval        = 5 * time.Minute // 最近活跃时间的更新间隔，避免每个请求都写数据库
+	sessionCleanInterval = time.Hour       // 清理过期登录的间隔
+	maxDeviceInfoLen     = 64              // 和device_session的device_id、device_name字段长度一致
+)
+
+// platforms 支持的平台，其他值记为other
+var platforms = []string{"ios", "android", "windows", "mac", "linux", "web"}
+
+// newJti 生成token的唯一标识
+func newJti() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// truncate 按字符截断，避免截断半个汉字
+func truncate(s string, n int) string {
+	runes := []rune(strings.TrimSpace(s))
+	if len(runes) > n {
+		runes = runes[:n]
+	}
+	return string(runes)
+}
+
+// normalizeDevice 整理客户端上报的设备信息
+func normalizeDevice(device *model.DeviceSession) {
+	platform := strings.ToLower(strings.TrimSpace(device.Platform))
+	device.Platform = "other"
+	for _, p := range platforms {
+		if platform == p {
+			device.Platform = p
+			break
+		}
+	}
+	device.DeviceId = truncate(device.DeviceId, maxDeviceInfoLen)
+	device.DeviceName = truncate(device.DeviceName, maxDeviceInfoLen)
+}
+
+// TouchSession 鉴权通过后更新设备的最近活跃时间和ip，每个设备touchInterval内只写一次，失败只记录日志
+func (a *authService) TouchSession(sid, ip string) {
+	ok, err := a.cache.SetNX("device_active_"+sid, "1", touchInterval)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	if !ok {
+		return
+	}
+	if err := a.store.Devices().Touch(sid, ip, time.Now()); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// GetDevices 我的登录设备，当前设备排在最前面
+// refresh token已经过期的登录不返回，由 CleanSessions 定时删除
+func (a *authService) GetDevices(uuid, currentSid string) (string, []respond.DeviceRespond, int) {
+	deviceList, err := a.store.Devices().ListByUser(uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp := make([]respond.DeviceRespond, 0, len(deviceList))
+	deadline := time.Now().Add(-a.refreshExpire())
+	for _, device := range deviceList {
+		if device.LastActiveAt.Before(deadline) {
+			continue
+		}
+		item := respond.DeviceRespond{
+			Sid:          device.Sid,
+			DeviceId:     device.DeviceId,
+			Platform:     device.Platform,
+			DeviceName:   device.DeviceName,
+			Ip:           device.Ip,
+			LastActiveAt: device.LastActiveAt.Format("2006-01-02 15:04:05"),
+			CreatedAt:    device.CreatedAt.Format("2006-01-02 15:04:05"),
+			IsCurrent:    device.Sid == currentSid,
+		}
+		if item.IsCurrent {
+			rsp = append([]respond.DeviceRespond{item}, rsp...)
+		} else {
+			rsp = append(rsp, item)
+		}
+	}
+	return "获取登录设备成功", rsp, 0
+}
+
+// RevokeDevice 下线自己的某个设备，下线当前设备等同于退出登录
+func (a *authService) RevokeDevice(req request.RevokeDeviceRequest) (string, int) {
+	device, err := a.store.Devices().GetBySid(req.Sid)
+	if err != nil && !errors.Is(err, dao.ErrRecordNotFound) {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if device == nil || device.UserId != req.Uuid {
+		message := "设备不存在或已下线"
+		zlog.Info(message + "：" + req.Sid)
+		return message, -2
+	}
+	if err := a.RevokeSession(device.UserId, device.Sid); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	return "下线设备成功", 0
+}
+
+// RevokeOtherDevices 下线除当前设备以外的所有设备
+func (a *authService) RevokeOtherDevices(uuid, currentSid string) (string, int) {
+	count, err := a.RevokeAllSessions(uuid, currentSid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	return fmt.Sprintf("已下线%d台设备", count), 0
+}
+
+// RevokeAllSessions 注销用户除exceptSid以外的所有登录，exceptSid为空时全部注销，返回注销的数量
+func (a *authService) RevokeAllSessions(uuid, exceptSid string) (int, error) {
+	deviceList, err := a.store.Devices().ListByUser(uuid)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, device := range deviceList {
+		if device.Sid == exceptSid {
+			continue
+		}
+		if err := a.RevokeSession(uuid, device.Sid); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// CleanSessions 定时删除refresh token已经过期的登录和已经不存在的登录的投递游标，直到ctx结束
+func (a *authService) CleanSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionCleanInterval)
+	defer ticker.Stop()
+	for {
+		a.cleanSessions(time.Now().Add(-a.refreshExpire()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanSessions 最近活跃时间早于deadline的登录已经不能刷新token，失败只记录日志，下次再清理
+func (a *authService) cleanSessions(deadline time.Time) {
+	devices, err := a.store.Devices().DeleteInactive(deadline)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	cursors, err := a.store.Deliveries().DeleteOrphaned()
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	if devices > 0 || cursors > 0 {
+		zlog.Info(fmt.Sprintf("清理过期登录%d个，投递游标%d个", devices, cursors))
+	}
+}
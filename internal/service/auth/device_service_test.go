@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"go_chat/internal/config"
+	"go_chat/internal/dao/memory"
+	"go_chat/internal/model"
+	"go_chat/internal/service/cache"
+	"testing"
+	"time"
+)
+
+// newDeviceFixture U1在S1上活跃，S2和U2的S3已经超过refresh token有效期，S9已经注销只剩游标
+func newDeviceFixture(t *testing.T) (*authService, *memory.Store) {
+	t.Helper()
+	tokenConfig := &config.GetConfig().TokenConfig
+	previous := tokenConfig.RefreshTokenExpire
+	tokenConfig.RefreshTokenExpire = 24
+	t.Cleanup(func() { tokenConfig.RefreshTokenExpire = previous })
+
+	store := memory.NewStore()
+	now := time.Now()
+	for _, device := range []model.DeviceSession{
+		{Sid: "S1", UserId: "U1", LastActiveAt: now, CreatedAt: now},
+		{Sid: "S2", UserId: "U1", LastActiveAt: now.Add(-48 * time.Hour), CreatedAt: now.Add(-48 * time.Hour)},
+		{Sid: "S3", UserId: "U2", LastActiveAt: now.Add(-48 * time.Hour), CreatedAt: now.Add(-48 * time.Hour)},
+	} {
+		if err := store.Devices().Create(&device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	message := &model.Message{Uuid: "M1", SendId: "U2", ReceiveId: "U1", CreatedAt: now}
+	if err := store.Messages().Create(message); err != nil {
+		t.Fatal(err)
+	}
+	for _, cursor := range [][2]string{{"U1", "S1"}, {"U1", "S2"}, {"U1", "S9"}, {"U2", "S3"}} {
+		if err := store.Deliveries().Advance(cursor[0], cursor[1], message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewAuthService(cache.NewMemoryCache(), store, nil), store
+}
+
+// TestGetDevicesReadOnly 查看登录设备不返回过期的登录，也不修改数据
+func TestGetDevicesReadOnly(t *testing.T) {
+	a, store := newDeviceFixture(t)
+	before := store.Clone()
+	_, devices, ret := a.GetDevices("U1", "S1")
+	if ret != 0 || len(devices) != 1 || devices[0].Sid != "S1" || !devices[0].IsCurrent {
+		t.Fatalf("GetDevices = %+v, %d, want only the current session", devices, ret)
+	}
+	if !store.Equal(before) {
+		t.Fatal("GetDevices changed the store")
+	}
+}
+
+// TestCleanSessions 定时任务删除所有用户过期的登录和没有对应登录的游标
+func TestCleanSessions(t *testing.T) {
+	a, store := newDeviceFixture(t)
+	a.cleanSessions(time.Now().Add(-a.refreshExpire()))
+
+	for _, device := range []struct {
+		userId, sid string
+		kept        bool
+	}{{"U1", "S1", true}, {"U1", "S2", false}, {"U1", "S9", false}, {"U2", "S3", false}} {
+		_, deviceErr := store.Devices().GetBySid(device.sid)
+		_, cursorErr := store.Deliveries().GetCursor(device.userId, device.sid)
+		if (deviceErr == nil) != device.kept || (cursorErr == nil) != device.kept {
+			t.Fatalf("%s after clean: device %v, cursor %v, want kept = %v", device.sid, deviceErr, cursorErr, device.kept)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCacheMiss key不存在或已过期
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache service使用的缓存，key的命名与原先redis中保持一致
+type Cache interface {
+	// Get 不存在时返回 ErrCacheMiss
+	Get(key string) (string, error)
+	Set(key string, value string, expiration time.Duration) error
+	// Del key不存在时不报错
+	Del(key string) error
+	// DelByPattern 删除匹配glob模式的key
+	DelByPattern(pattern string) error
+	// DelByPrefix 删除有该前缀的key
+	DelByPrefix(prefix string) error
+	// Incr key不存在时从0开始加一，返回加一后的值，用于版本号
+	Incr(key string) (int64, error)
+	// IncrEx 同Incr，key新建时设置过期时间，用于有有效期的计数
+	IncrEx(key string, expiration time.Duration) (int64, error)
+	// HitWindow 滑动窗口计数，window内已有limit次时不记录并返回false和需要等待的时间
+	HitWindow(key string, limit int, window time.Duration) (bool, time.Duration, error)
+	// SetNX key不存在时才设置，返回是否设置成功，用作简单的锁
+	SetNX(key string, value string, expiration time.Duration) (bool, error)
+	// SAdd 向集合添加成员，并刷新集合的过期时间
+	SAdd(key string, member string, expiration time.Duration) error
+	// SMembers 集合的全部成员，key不存在时返回空
+	SMembers(key string) ([]string, error)
+}
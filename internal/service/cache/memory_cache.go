@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryItem struct {
+	value    string
+	members  map[string]struct{} // 集合类型的成员
+	hits     []time.Time         // 滑动窗口的记录，按时间升序
+	expireAt time.Time           // 零值表示不过期
+}
+
+func (item memoryItem) expired() bool {
+	return !item.expireAt.IsZero() && time.Now().After(item.expireAt)
+}
+
+type memoryCache struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+// NewMemoryCache 进程内缓存，只用于单元测试
+func NewMemoryCache() Cache {
+	return &memoryCache{items: make(map[string]memoryItem)}
+}
+
+func (m *memoryCache) Get(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[key]
+	if !ok {
+		return "", ErrCacheMiss
+	}
+	if !item.expireAt.IsZero() && time.Now().After(item.expireAt) {
+		delete(m.items, key)
+		return "", ErrCacheMiss
+	}
+	return item.value, nil
+}
+
+func (m *memoryCache) Set(key string, value string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := memoryItem{value: value}
+	if expiration > 0 {
+		item.expireAt = time.Now().Add(expiration)
+	}
+	m.items[key] = item
+	return nil
+}
+
+func (m *memoryCache) Del(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
+
+// DelByPattern 用path.Match模拟redis的glob，区别只在*不匹配'/'，现有key中都没有'/'
+func (m *memoryCache) DelByPattern(pattern string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.items {
+		if ok, err := path.Match(pattern, key); err != nil {
+			return err
+		} else if ok {
+			delete(m.items, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryCache) DelByPrefix(prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.items, key)
+		}
+	}
+	return nil
+}
+
+// Incr 和redis一样保留原有的过期时间
+func (m *memoryCache) Incr(key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[key]
+	if ok && !item.expireAt.IsZero() && time.Now().After(item.expireAt) {
+		ok = false
+	}
+	var n int64
+	if ok {
+		var err error
+		if n, err = strconv.ParseInt(item.value, 10, 64); err != nil {
+			return 0, err
+		}
+	} else {
+		item = memoryItem{}
+	}
+	n++
+	item.value = strconv.FormatInt(n, 10)
+	m.items[key] = item
+	return n, nil
+}
+
+func (m *memoryCache) IncrEx(key string, expiration time.Duration) (int64, error) {
+	n, err := m.Incr(key)
+	if err != nil || n != 1 || expiration <= 0 {
+		return n, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := m.items[key]
+	item.expireAt = time.Now().Add(expiration)
+	m.items[key] = item
+	return n, nil
+}
+
+func (m *memoryCache) HitWindow(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	item := m.items[key]
+	hits := item.hits[:0]
+	for _, hit := range item.hits {
+		if hit.After(now.Add(-window)) {
+			hits = append(hits, hit)
+		}
+	}
+	if len(hits) >= limit && len(hits) > 0 {
+		item.hits = hits
+		m.items[key] = item
+		return false, hits[0].Add(window).Sub(now), nil
+	}
+	m.items[key] = memoryItem{hits: append(hits, now), expireAt: now.Add(window)}
+	return true, 0, nil
+}
+
+func (m *memoryCache) SetNX(key string, value string, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if item, ok := m.items[key]; ok && !item.expired() {
+		return false, nil
+	}
+	item := memoryItem{value: value}
+	if expiration > 0 {
+		item.expireAt = time.Now().Add(expiration)
+	}
+	m.items[key] = item
+	return true, nil
+}
+
+func (m *memoryCache) SAdd(key string, member string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[key]
+	if !ok || item.expired() || item.members == nil {
+		item = memoryItem{members: make(map[string]struct{})}
+	}
+	item.members[member] = struct{}{}
+	item.expireAt = time.Time{}
+	if expiration > 0 {
+		item.expireAt = time.Now().Add(expiration)
+	}
+	m.items[key] = item
+	return nil
+}
+
+func (m *memoryCache) SMembers(key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[key]
+	if !ok || item.expired() {
+		return nil, nil
+	}
+	members := make([]string, 0, len(item.members))
+	for member := range item.members {
+		members = append(members, member)
+	}
+	return members, nil
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v8"
+	myredis "go_chat/internal/service/redis"
+	"time"
+)
+
+type redisCache struct{}
+
+// NewRedisCache 基于myredis的实现，使用前需要先调用 myredis.Init
+func NewRedisCache() Cache {
+	return new(redisCache)
+}
+
+func (r *redisCache) Get(key string) (string, error) {
+	value, err := myredis.GetKeyNilIsErr(key)
+	if errors.Is(err, redis.Nil) {
+		return "", ErrCacheMiss
+	}
+	return value, err
+}
+
+func (r *redisCache) Set(key string, value string, expiration time.Duration) error {
+	return myredis.SetKeyEx(key, value, expiration)
+}
+
+func (r *redisCache) Del(key string) error {
+	return myredis.DelKeyIfExists(key)
+}
+
+func (r *redisCache) DelByPattern(pattern string) error {
+	return myredis.DelKeysWithPattern(pattern)
+}
+
+func (r *redisCache) DelByPrefix(prefix string) error {
+	return myredis.DelKeysWithPrefix(prefix)
+}
+
+func (r *redisCache) Incr(key string) (int64, error) {
+	return myredis.Incr(key)
+}
+
+func (r *redisCache) SetNX(key string, value string, expiration time.Duration) (bool, error) {
+	return myredis.SetNX(key, value, expiration)
+}
+
+func (r *redisCache) SAdd(key string, member string, expiration time.Duration) error {
+	return myredis.SAddEx(key, member, expiration)
+}
+
+func (r *redisCache) SMembers(key string) ([]string, error) {
+	return myredis.SMembers(key)
+}
+
+func (r *redisCache) IncrEx(key string, expiration time.Duration) (int64, error) {
+	return myredis.IncrEx(key, expiration)
+}
+
+func (r *redisCache) HitWindow(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	return myredis.HitWindow(key, limit, window)
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"go_chat/pkg/zlog"
+	"golang.org/x/sync/singleflight"
+	"time"
+)
+
+// Versioned 按owner维护版本号的缓存
+// 数据key为 <namespace>:<owner>:v<version>，版本号存在 ver:<namespace>:<owner>
+// 失效时只需INCR版本号，旧版本的数据不会再被读到，等TTL到期自动清掉
+type Versioned struct {
+	cache Cache
+	group singleflight.Group
+}
+
+// NewVersioned 在c之上包一层版本号
+func NewVersioned(c Cache) *Versioned {
+	return &Versioned{cache: c}
+}
+
+func versionKey(namespace, owner string) string {
+	return "ver:" + namespace + ":" + owner
+}
+
+// key 当前版本的数据key，版本号不存在时视为0
+func (v *Versioned) key(namespace, owner string) (string, error) {
+	version, err := v.cache.Get(versionKey(namespace, owner))
+	if err != nil {
+		if !errors.Is(err, ErrCacheMiss) {
+			return "", err
+		}
+		version = "0"
+	}
+	return namespace + ":" + owner + ":v" + version, nil
+}
+
+// Invalidate 使owner在namespace下的缓存失效，O(1)
+func (v *Versioned) Invalidate(namespace, owner string) error {
+	_, err := v.cache.Incr(versionKey(namespace, owner))
+	return err
+}
+
+// InvalidateAll 删除namespace下所有owner的缓存，需要SCAN，只在无法确定owner时使用
+func (v *Versioned) InvalidateAll(namespace string) error {
+	return v.cache.DelByPrefix(namespace + ":")
+}
+
+// GetOrLoad 先查缓存，未命中时调用load并按ttl写回，同一个key的并发未命中只会执行一次load
+// 缓存本身出错只记日志，直接返回load的结果
+func GetOrLoad[T any](v *Versioned, namespace, owner string, ttl time.Duration, load func() (T, error)) (T, error) {
+	key, err := v.key(namespace, owner)
+	if err != nil {
+		zlog.Error(err.Error())
+		return load()
+	}
+	if data, err := v.cache.Get(key); err == nil {
+		var value T
+		if err := json.Unmarshal([]byte(data), &value); err == nil {
+			return value, nil
+		} else {
+			zlog.Error(err.Error())
+		}
+	} else if !errors.Is(err, ErrCacheMiss) {
+		zlog.Error(err.Error())
+	}
+	result, err, _ := v.group.Do(key, func() (interface{}, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if data, err := json.Marshal(value); err != nil {
+			zlog.Error(err.Error())
+		} else if err := v.cache.Set(key, string(data), ttl); err != nil {
+			zlog.Error(err.Error())
+		}
+		return value, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result.(T), nil
+}
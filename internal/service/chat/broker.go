@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"encoding/json"
+	"go_chat/internal/config"
+	"go_chat/internal/service/kafka"
+	"time"
+)
+
+// Envelope 经broker投递的消息
+type Envelope struct {
+	Key       string          `json:"key"`        // 见 model.Message.ConversationKey，kafka按它分区，保证同一会话内有序
+	MessageId string          `json:"message_id"` // 对应的消息uuid，投递成功后更新状态
+	SendId    string          `json:"send_id"`
+	Targets   []string        `json:"targets"` // 需要推送的用户uuid
+	Payload   json.RawMessage `json:"payload"` // 推送给前端的内容
+	// 以下两个字段仅聊天消息有，投递成功后用来推进接收者的投递游标
+	MessageSeq int64     `json:"message_seq"` // 消息自增id
+	CreatedAt  time.Time `json:"created_at"`
+	// CloseSid 不为空时不推送，断开Targets在该次登录上的连接，用于注销设备
+	CloseSid string `json:"close_sid,omitempty"`
+}
+
+// Broker 消息分发的传输层，channel模式在进程内转发，kafka模式可以部署多个实例
+type Broker interface {
+	// Publish 发布消息
+	Publish(envelope *Envelope) error
+	// Start 开始消费，每条消息回调deliver，阻塞直到Close
+	Start(deliver func(envelope *Envelope))
+	// Close 停止消费
+	Close()
+}
+
+// NewBroker 根据 kafkaConfig.messageMode 选择broker，为空时使用channel模式，取值已在加载配置时校验
+func NewBroker() Broker {
+	kafkaConfig := config.GetConfig().KafkaConfig
+	if kafkaConfig.MessageMode == "kafka" {
+		if kafka.KafkaService.ChatWriter == nil {
+			kafka.KafkaService.KafkaInit()
+		}
+		return NewKafkaBroker(kafka.KafkaService.ChatWriter, kafka.KafkaService.ChatReader)
+	}
+	return NewChannelBroker()
+}
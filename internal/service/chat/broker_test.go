@@ -0,0 +1,259 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/kafka-go"
+	"go_chat/internal/dao/memory"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTopic 模拟一个kafka topic，每个reader相当于一个单独的消费组，都能收到全部消息
+type fakeTopic struct {
+	mu      sync.Mutex
+	readers []*fakeReader
+	written []kafka.Message
+	failErr error // 不为nil时WriteMessages返回该错误
+}
+
+type fakeReader struct {
+	messages chan kafka.Message
+}
+
+func (t *fakeTopic) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failErr != nil {
+		return t.failErr
+	}
+	t.written = append(t.written, msgs...)
+	for _, reader := range t.readers {
+		for _, msg := range msgs {
+			reader.messages <- msg
+		}
+	}
+	return nil
+}
+
+func (t *fakeTopic) newReader() *fakeReader {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	reader := &fakeReader{messages: make(chan kafka.Message, 16)}
+	t.readers = append(t.readers, reader)
+	return reader
+}
+
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+// newTestClient 不带websocket连接的client，发送的内容留在SendBack里
+func newTestClient(uuid, sid string) *Client {
+	return &Client{
+		Uuid:     uuid,
+		Sid:      sid,
+		SendBack: make(chan []byte, 4),
+		closed:   make(chan struct{}),
+	}
+}
+
+// startTestServer 只启动broker的消费，client直接放进Clients，不走补发
+func startTestServer(t *testing.T, broker Broker, clients ...*Client) *Server {
+	t.Helper()
+	s := NewServer(memory.NewStore(), broker)
+	for _, client := range clients {
+		s.Clients[client.Uuid] = append(s.Clients[client.Uuid], client)
+	}
+	go broker.Start(s.deliver)
+	t.Cleanup(broker.Close)
+	return s
+}
+
+func expectPayload(t *testing.T, client *Client, want string) {
+	t.Helper()
+	select {
+	case data := <-client.SendBack:
+		if string(data) != want {
+			t.Fatalf("client %s/%s got %s, want %s", client.Uuid, client.Sid, data, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("client %s/%s did not receive %s", client.Uuid, client.Sid, want)
+	}
+}
+
+func expectNothing(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case data := <-client.SendBack:
+		t.Fatalf("client %s/%s got unexpected %s", client.Uuid, client.Sid, data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectKicked(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case <-client.closed:
+	case <-time.After(time.Second):
+		t.Fatalf("client %s/%s was not closed", client.Uuid, client.Sid)
+	}
+	want := websocket.FormatCloseMessage(CloseSessionRevoked, "session revoked")
+	if string(client.closeMsg) != string(want) {
+		t.Fatalf("client %s/%s closed with %q, want code %d", client.Uuid, client.Sid, client.closeMsg, CloseSessionRevoked)
+	}
+}
+
+// expectOnlyClient 断开之后才从Clients中移除，稍等一下再比较
+func expectOnlyClient(t *testing.T, s *Server, want *Client) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		clients := s.GetClients(want.Uuid)
+		if len(clients) == 1 && clients[0] == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s clients = %v, want only %s", want.Uuid, clients, want.Sid)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// brokerModes 两种模式各起一个server，kafka模式下两个server相当于两个实例
+var brokerModes = []struct {
+	name string
+	new  func() (Broker, Broker)
+}{
+	{"channel", func() (Broker, Broker) {
+		// channel模式只在进程内转发，没有第二个实例
+		return NewChannelBroker(), nil
+	}},
+	{"kafka", func() (Broker, Broker) {
+		topic := new(fakeTopic)
+		return NewKafkaBroker(topic, topic.newReader()), NewKafkaBroker(topic, topic.newReader())
+	}},
+}
+
+func TestBrokerTargetsFanOut(t *testing.T) {
+	for _, mode := range brokerModes {
+		t.Run(mode.name, func(t *testing.T) {
+			one, two := mode.new()
+			phone := newTestClient("U1", "s1")
+			web := newTestClient("U1", "s2")
+			friend := newTestClient("U2", "s3")
+			stranger := newTestClient("U3", "s4")
+			s := startTestServer(t, one, phone, web, friend, stranger)
+			var remote *Client
+			if two != nil {
+				// U1的第三个设备连在另一个实例上
+				remote = newTestClient("U1", "s5")
+				startTestServer(t, two, remote)
+			}
+
+			if err := s.Push("S1", []string{"U1", "U2", "U404"}, []byte(`{"n":1}`)); err != nil {
+				t.Fatal(err)
+			}
+			expectPayload(t, phone, `{"n":1}`)
+			expectPayload(t, web, `{"n":1}`)
+			expectPayload(t, friend, `{"n":1}`)
+			if remote != nil {
+				expectPayload(t, remote, `{"n":1}`)
+			}
+			expectNothing(t, stranger)
+		})
+	}
+}
+
+func TestBrokerCloseSid(t *testing.T) {
+	for _, mode := range brokerModes {
+		t.Run(mode.name, func(t *testing.T) {
+			one, two := mode.new()
+			phone := newTestClient("U1", "s1")
+			web := newTestClient("U1", "s2")
+			other := newTestClient("U2", "s1") // 不同用户的sid不会相同，这里用来确认只按Targets断开
+			s := startTestServer(t, one, phone, web, other)
+			var remotePhone, remoteTablet *Client
+			var remoteServer *Server
+			if two != nil {
+				remotePhone = newTestClient("U1", "s1")
+				remoteTablet = newTestClient("U1", "s3")
+				remoteServer = startTestServer(t, two, remotePhone, remoteTablet)
+			}
+
+			if err := s.CloseSession("U1", "s1"); err != nil {
+				t.Fatal(err)
+			}
+			expectKicked(t, phone)
+			if remotePhone != nil {
+				expectKicked(t, remotePhone)
+			}
+			// 其他设备和其他用户的连接不受影响，注销也不会推送内容
+			for _, client := range []*Client{web, other, remoteTablet} {
+				if client == nil {
+					continue
+				}
+				if client.isClosed() {
+					t.Fatalf("client %s/%s should stay connected", client.Uuid, client.Sid)
+				}
+				expectNothing(t, client)
+			}
+			expectOnlyClient(t, s, web)
+			if remoteServer != nil {
+				expectOnlyClient(t, remoteServer, remoteTablet)
+			}
+		})
+	}
+}
+
+func TestKafkaBrokerPublish(t *testing.T) {
+	topic := new(fakeTopic)
+	broker := NewKafkaBroker(topic, topic.newReader())
+	envelope := &Envelope{Key: "S1", Targets: []string{"U1"}, Payload: json.RawMessage(`{}`)}
+	if err := broker.Publish(envelope); err != nil {
+		t.Fatal(err)
+	}
+	// 以会话id为key，保证同一会话落在同一分区
+	if len(topic.written) != 1 || string(topic.written[0].Key) != "S1" {
+		t.Fatalf("written = %+v, want one message keyed S1", topic.written)
+	}
+
+	topic.failErr = errors.New("broker down")
+	if err := broker.Publish(envelope); !errors.Is(err, topic.failErr) {
+		t.Fatalf("Publish error = %v, want %v", err, topic.failErr)
+	}
+
+	broker.Close()
+	if err := broker.Publish(envelope); !errors.Is(err, ErrBrokerClosed) {
+		t.Fatalf("Publish after Close = %v, want ErrBrokerClosed", err)
+	}
+}
+
+func TestKafkaBrokerSkipsBadMessage(t *testing.T) {
+	topic := new(fakeTopic)
+	reader := topic.newReader()
+	client := newTestClient("U1", "s1")
+	startTestServer(t, NewKafkaBroker(topic, reader), client)
+
+	// 无法解析的消息跳过，不影响之后的消息
+	reader.messages <- kafka.Message{Value: []byte("not json")}
+	data, _ := json.Marshal(&Envelope{Key: "S1", Targets: []string{"U1"}, Payload: json.RawMessage(`{"n":2}`)})
+	reader.messages <- kafka.Message{Value: data}
+	expectPayload(t, client, `{"n":2}`)
+}
+
+func TestChannelBrokerPublishAfterClose(t *testing.T) {
+	broker := NewChannelBroker()
+	broker.Close()
+	if err := broker.Publish(&Envelope{}); !errors.Is(err, ErrBrokerClosed) {
+		t.Fatalf("Publish after Close = %v, want ErrBrokerClosed", err)
+	}
+}
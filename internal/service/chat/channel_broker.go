@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"errors"
+	"go_chat/pkg/constants"
+)
+
+var ErrBrokerClosed = errors.New("broker已关闭")
+
+// channelBroker 进程内的broker，用go channel转发
+type channelBroker struct {
+	messages chan *Envelope
+	done     chan struct{}
+}
+
+func NewChannelBroker() Broker {
+	return &channelBroker{
+		messages: make(chan *Envelope, constants.CHANNEL_SIZE),
+		done:     make(chan struct{}),
+	}
+}
+
+func (b *channelBroker) Publish(envelope *Envelope) error {
+	// 两个case都就绪时select随机选择，先检查是否已关闭
+	select {
+	case <-b.done:
+		return ErrBrokerClosed
+	default:
+	}
+	select {
+	case b.messages <- envelope:
+		return nil
+	case <-b.done:
+		return ErrBrokerClosed
+	}
+}
+
+func (b *channelBroker) Start(deliver func(envelope *Envelope)) {
+	for {
+		select {
+		case envelope := <-b.messages:
+			deliver(envelope)
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *channelBroker) Close() {
+	close(b.done)
+}
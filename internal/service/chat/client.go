@@ -0,0 +1,206 @@
+package chat
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/zlog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	writeWait      = 10 * time.Second    // 写超时
+	pongWait       = 60 * time.Second    // 等待pong的最长时间
+	pingPeriod     = (pongWait * 9) / 10 // 发送ping的周期，必须小于pongWait
+	maxMessageSize = 1 << 16             // 单条消息最大字节数
+
+	// CloseSessionRevoked 设备被注销时的关闭码，前端收到后不要重连，应回到登录页
+	CloseSessionRevoked = 4001
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  2048,
+	WriteBufferSize: 2048,
+	// 跨域由cors中间件处理，这里放行
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+type Client struct {
+	Conn          *websocket.Conn
+	Uuid          string
+	Sid           string      // 连接所属的登录，和token中的sid一致，用于注销设备时断开
+	LastMessageId string      // 前端重连时带上的最后一条消息uuid，为空时按服务端的投递游标补发
+	SendBack      chan []byte // 发往前端的消息，容量为 constants.CHANNEL_SIZE，不会被关闭
+	closed        chan struct{}
+	closeMsg      []byte // Write退出前发送的关闭帧，在close之前写入
+	once          sync.Once
+
+	replayMu  sync.Mutex
+	replaying bool        // 正在补发离线消息，期间的实时消息先暂存到pending
+	pending   []*Envelope // 补发完成后按顺序发送
+}
+
+// Read 读取前端发来的消息，转交给server
+func (c *Client) Read() {
+	defer func() {
+		ChatServer.SendClientToLogout(c)
+	}()
+	c.Conn.SetReadLimit(maxMessageSize)
+	_ = c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				zlog.Error(err.Error())
+			}
+			return
+		}
+		ChatServer.SendMessageToTransmit(c.Uuid, data)
+	}
+}
+
+// Write 把server转发过来的消息写回前端，同时定时发送ping
+func (c *Client) Write() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		_ = c.Conn.Close()
+	}()
+	for {
+		select {
+		case <-c.closed:
+			// server关闭了该client
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			_ = c.Conn.WriteMessage(websocket.CloseMessage, c.closeMsg)
+			return
+		case data := <-c.SendBack:
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				zlog.Error(err.Error())
+				return
+			}
+		case <-ticker.C:
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// trySend 非阻塞地投递消息，通道满了说明前端消费太慢，返回false
+func (c *Client) trySend(data []byte) bool {
+	select {
+	case <-c.closed:
+		return false
+	default:
+	}
+	select {
+	case c.SendBack <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendWait 阻塞投递，用于补发离线消息，连接关闭或超时返回false
+func (c *Client) sendWait(data []byte) bool {
+	timer := time.NewTimer(writeWait)
+	defer timer.Stop()
+	select {
+	case c.SendBack <- data:
+		return true
+	case <-c.closed:
+		return false
+	case <-timer.C:
+		return false
+	}
+}
+
+// deferIfReplaying 正在补发时暂存实时消息，返回true表示已暂存
+func (c *Client) deferIfReplaying(envelope *Envelope) bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	if !c.replaying {
+		return false
+	}
+	c.pending = append(c.pending, envelope)
+	return true
+}
+
+// isClosed 是否已经被close
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// close 通知Write协程退出并关闭连接，可重复调用
+func (c *Client) close() {
+	c.closeWith([]byte{})
+}
+
+// kick 登录被注销，带上CloseSessionRevoked关闭码断开连接
+func (c *Client) kick() {
+	c.closeWith(websocket.FormatCloseMessage(CloseSessionRevoked, "session revoked"))
+}
+
+func (c *Client) closeWith(msg []byte) {
+	c.once.Do(func() {
+		c.closeMsg = msg
+		close(c.closed)
+	})
+}
+
+// NewClientInit 升级为websocket连接，并把client注册到server，sid为当前登录
+func NewClientInit(c *gin.Context, clientId, sid string) error {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		zlog.Error(err.Error())
+		return err
+	}
+	client := &Client{
+		Conn:          conn,
+		Uuid:          clientId,
+		Sid:           sid,
+		LastMessageId: c.Query("last_message_id"),
+		SendBack:      make(chan []byte, constants.CHANNEL_SIZE),
+		closed:        make(chan struct{}),
+	}
+	ChatServer.SendClientToLogin(client)
+	go client.Read()
+	go client.Write()
+	zlog.Info("ws连接成功，clientId: " + clientId)
+	return nil
+}
+
+// ClientLogout 主动下线，只断开当前登录的连接，其他设备不受影响
+func ClientLogout(clientId, sid string) (string, int) {
+	found := false
+	for _, client := range ChatServer.GetClients(clientId) {
+		if client.Sid != sid {
+			continue
+		}
+		found = true
+		ChatServer.SendClientToLogout(client)
+		if err := client.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait)); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			zlog.Error(err.Error())
+		}
+	}
+	if !found {
+		zlog.Info("该用户不在线")
+		return "该用户不在线", -2
+	}
+	return "退出成功", 0
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"go_chat/pkg/zlog"
+	"io"
+)
+
+// MessageWriter kafka.Writer 的子集，方便替换
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// MessageReader kafka.Reader 的子集，方便替换
+type MessageReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+}
+
+// kafkaBroker 通过kafka转发，每个实例只推送给本机在线的client
+type kafkaBroker struct {
+	writer MessageWriter
+	reader MessageReader
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewKafkaBroker(writer MessageWriter, reader MessageReader) Broker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &kafkaBroker{
+		writer: writer,
+		reader: reader,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (b *kafkaBroker) Publish(envelope *Envelope) error {
+	if b.ctx.Err() != nil {
+		return ErrBrokerClosed
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	// 以会话id为key，Hash balancer保证同一会话落在同一分区
+	return b.writer.WriteMessages(b.ctx, kafka.Message{
+		Key:   []byte(envelope.Key),
+		Value: data,
+	})
+}
+
+func (b *kafkaBroker) Start(deliver func(envelope *Envelope)) {
+	for {
+		msg, err := b.reader.ReadMessage(b.ctx)
+		if err != nil {
+			// reader被关闭时返回io.EOF
+			if b.ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, io.EOF) {
+				return
+			}
+			zlog.Error(err.Error())
+			continue
+		}
+		var envelope Envelope
+		if err := json.Unmarshal(msg.Value, &envelope); err != nil {
+			zlog.Error(err.Error())
+			continue
+		}
+		deliver(&envelope)
+	}
+}
+
+func (b *kafkaBroker) Close() {
+	b.cancel()
+}
@@ -0,0 +1,648 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_chat/internal/dao"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/model"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/enum/contact_status_enum"
+	"go_chat/pkg/enum/message/message_status_enum"
+	"go_chat/pkg/enum/message/message_type_enum"
+	"go_chat/pkg/util/random"
+	"go_chat/pkg/zlog"
+	"sync"
+	"time"
+)
+
+// TransmitMessage 前端发来的消息，SendId 为连接所属的登录用户
+type TransmitMessage struct {
+	SendId string
+	Data   []byte
+}
+
+type Server struct {
+	Clients  map[string][]*Client // 同一用户可以同时在多个设备上连接
+	mutex    sync.RWMutex
+	Transmit chan *TransmitMessage // 前端发来的消息
+	Login    chan *Client          // 上线
+	Logout   chan *Client          // 下线
+	broker   Broker                // 消息分发
+	store    dao.Store
+	done     chan struct{}
+}
+
+// ChatServer 由 Init 创建
+var ChatServer *Server
+
+// Init 创建ChatServer，需要在Start之前调用
+// broker在这里按配置创建，保证Start之前service就可以通过Push推送事件
+func Init(store dao.Store) {
+	ChatServer = NewServer(store, NewBroker())
+}
+
+// NewServer 创建server，broker为nil时在Start中按配置选择
+func NewServer(store dao.Store, broker Broker) *Server {
+	return &Server{
+		Clients:  make(map[string][]*Client),
+		Transmit: make(chan *TransmitMessage, constants.CHANNEL_SIZE),
+		Login:    make(chan *Client, constants.CHANNEL_SIZE),
+		Logout:   make(chan *Client, constants.CHANNEL_SIZE),
+		broker:   broker,
+		store:    store,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 启动server，处理上线、下线、消息转发
+func (s *Server) Start() {
+	if s.broker == nil {
+		s.broker = NewBroker()
+	}
+	go s.broker.Start(s.deliver)
+	for {
+		select {
+		case client := <-s.Login:
+			s.register(client)
+		case client := <-s.Logout:
+			s.unregister(client)
+		case msg := <-s.Transmit:
+			s.handleMessage(msg)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close 关闭server，断开所有client
+func (s *Server) Close() {
+	close(s.done)
+	if s.broker != nil {
+		s.broker.Close()
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for uuid, clients := range s.Clients {
+		for _, client := range clients {
+			client.close()
+		}
+		delete(s.Clients, uuid)
+	}
+}
+
+func (s *Server) SendClientToLogin(client *Client) {
+	select {
+	case s.Login <- client:
+	case <-s.done:
+		client.close()
+	}
+}
+
+func (s *Server) SendClientToLogout(client *Client) {
+	select {
+	case s.Logout <- client:
+	case <-s.done:
+	}
+}
+
+func (s *Server) SendMessageToTransmit(sendId string, data []byte) {
+	select {
+	case s.Transmit <- &TransmitMessage{SendId: sendId, Data: data}:
+	case <-s.done:
+	}
+}
+
+// GetClients 获取用户在本机的所有连接，不在线返回nil
+func (s *Server) GetClients(uuid string) []*Client {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]*Client(nil), s.Clients[uuid]...)
+}
+
+func (s *Server) register(client *Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// 同一次登录重复连接，踢掉旧连接，其他设备的连接保留
+	clients := s.Clients[client.Uuid][:0:0]
+	for _, old := range s.Clients[client.Uuid] {
+		if old.Sid == client.Sid && old != client {
+			old.close()
+			continue
+		}
+		clients = append(clients, old)
+	}
+	// 加入Clients之前标记补发中，保证之后到达的实时消息排在离线消息后面
+	client.replaying = true
+	s.Clients[client.Uuid] = append(clients, client)
+	zlog.Info(fmt.Sprintf("用户%s在设备%s上线，该用户连接数%d，当前在线人数%d", client.Uuid, client.Sid, len(s.Clients[client.Uuid]), len(s.Clients)))
+	go s.replay(client)
+}
+
+func (s *Server) unregister(client *Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// 可能已经被同一次登录的新连接顶掉，只删除自己
+	clients := s.Clients[client.Uuid]
+	for i, cur := range clients {
+		if cur != client {
+			continue
+		}
+		clients = append(clients[:i:i], clients[i+1:]...)
+		if len(clients) > 0 {
+			s.Clients[client.Uuid] = clients
+			zlog.Info(fmt.Sprintf("用户%s的设备%s下线，该用户剩余连接数%d", client.Uuid, client.Sid, len(clients)))
+			break
+		}
+		// 所有设备都下线了才算离线
+		delete(s.Clients, client.Uuid)
+		zlog.Info(fmt.Sprintf("用户%s下线，当前在线人数%d", client.Uuid, len(s.Clients)))
+		if err := s.store.Users().UpdateLastOfflineAt(client.Uuid, time.Now()); err != nil {
+			zlog.Error(err.Error())
+		}
+		break
+	}
+	client.close()
+}
+
+const replayBatchSize = 200
+
+// replay 补发离线期间错过的消息，补发成功后推进投递游标并标记为已发送
+// 补发期间到达的实时消息暂存在client.pending，补发结束后再按顺序发送
+func (s *Server) replay(client *Client) {
+	replayed := make(map[string]bool)
+	defer s.finishReplay(client, replayed)
+	after, err := s.replayStart(client)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	if after == nil {
+		return
+	}
+	total := 0
+	for {
+		messageList, err := s.store.Messages().ListForUser(client.Uuid, after, replayBatchSize)
+		if err != nil {
+			zlog.Error(err.Error())
+			return
+		}
+		replyTargets, err := s.replyTargets(messageList)
+		if err != nil {
+			zlog.Error(err.Error())
+			return
+		}
+		for i := range messageList {
+			message := &messageList[i]
+			payload, err := messagePayload(message, replyTargets[message.ReplyToId])
+			if err != nil {
+				zlog.Error(err.Error())
+				continue
+			}
+			if !client.sendWait(payload) {
+				// 连接已断开，游标停在上一批，下次上线重新补发这一批
+				zlog.Info(fmt.Sprintf("用户%s的离线消息补发中断", client.Uuid))
+				return
+			}
+			replayed[message.Uuid] = true
+			if message.Status == message_status_enum.UNSENT {
+				s.markSent(message.Uuid)
+			}
+		}
+		total += len(messageList)
+		if len(messageList) > 0 {
+			after = &messageList[len(messageList)-1]
+			if err := s.store.Deliveries().Advance(client.Uuid, client.Sid, after); err != nil {
+				zlog.Error(err.Error())
+			}
+		}
+		if len(messageList) < replayBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		zlog.Info(fmt.Sprintf("用户%s补发离线消息%d条", client.Uuid, total))
+	}
+}
+
+// replayStart 补发的起点：前端带上的最后一条消息 > 这次登录的投递游标 > 登录时间 > 上次下线时间
+// 游标按登录记录，一个设备收到的消息不会让同一用户的其他设备跳过补发
+// 都没有说明是第一次上线，返回nil不补发
+func (s *Server) replayStart(client *Client) (*model.Message, error) {
+	if client.LastMessageId != "" {
+		message, err := s.store.Messages().GetByUuid(client.LastMessageId)
+		if err == nil {
+			return message, nil
+		}
+		if !errors.Is(err, dao.ErrRecordNotFound) {
+			return nil, err
+		}
+		zlog.Info("前端带上的最后一条消息不存在：" + client.LastMessageId)
+	}
+	cursor, err := s.store.Deliveries().GetCursor(client.Uuid, client.Sid)
+	if err == nil {
+		return &model.Message{Id: cursor.MessageSeq, Uuid: cursor.MessageId, CreatedAt: cursor.MessageAt}, nil
+	}
+	if !errors.Is(err, dao.ErrRecordNotFound) {
+		return nil, err
+	}
+	// 这次登录还没有投递过，补发登录之后的消息
+	device, err := s.store.Devices().GetBySid(client.Sid)
+	if err == nil {
+		return &model.Message{CreatedAt: device.CreatedAt}, nil
+	}
+	if !errors.Is(err, dao.ErrRecordNotFound) {
+		return nil, err
+	}
+	user, err := s.store.Users().GetByUuid(client.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	if user.LastOfflineAt.Valid {
+		return &model.Message{CreatedAt: user.LastOfflineAt.Time}, nil
+	}
+	return nil, nil
+}
+
+// finishReplay 发送补发期间暂存的实时消息，跳过已经补发过的
+func (s *Server) finishReplay(client *Client, replayed map[string]bool) {
+	client.replayMu.Lock()
+	defer client.replayMu.Unlock()
+	if !client.isClosed() {
+		for _, envelope := range client.pending {
+			if envelope.MessageId != "" && replayed[envelope.MessageId] {
+				continue
+			}
+			if !s.sendTo(client, envelope) {
+				break
+			}
+			if envelope.MessageId != "" && client.Uuid != envelope.SendId {
+				s.markSent(envelope.MessageId)
+			}
+		}
+	}
+	client.pending = nil
+	client.replaying = false
+}
+
+// maxThumbnails 和上传接口生成的缩略图尺寸数一致
+const maxThumbnails = 3
+
+// setMediaMeta 记录上传接口返回的宽高、时长和缩略图，负数和多余的缩略图丢弃
+func (s *Server) setMediaMeta(message *model.Message, req *request.ChatMessageRequest) {
+	message.Width, message.Height, message.Duration = max(req.Width, 0), max(req.Height, 0), max(req.Duration, 0)
+	thumbnails := req.Thumbnails
+	if len(thumbnails) == 0 {
+		return
+	}
+	if len(thumbnails) > maxThumbnails {
+		thumbnails = thumbnails[:maxThumbnails]
+	}
+	data, err := json.Marshal(thumbnails)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	message.Thumbnails = data
+}
+
+// handleMessage 持久化消息，并转发给接收者
+func (s *Server) handleMessage(msg *TransmitMessage) {
+	var req request.ChatMessageRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	// 发送者以连接的登录用户为准，不信任消息体
+	req.SendId = msg.SendId
+	if req.SendId == "" || req.ReceiveId == "" {
+		zlog.Error("消息缺少发送者或接收者")
+		return
+	}
+	if !s.checkSendAllowed(&req) {
+		return
+	}
+	sessionId, ok := s.senderSession(&req)
+	if !ok {
+		return
+	}
+	message := model.Message{
+		Uuid:       fmt.Sprintf("M%s", random.GetNowAndLenRandomString(11)),
+		SessionId:  sessionId,
+		Type:       req.Type,
+		Content:    req.Content,
+		Url:        req.Url,
+		SendId:     req.SendId,
+		SendName:   req.SendName,
+		SendAvatar: req.SendAvatar,
+		ReceiveId:  req.ReceiveId,
+		FileType:   req.FileType,
+		FileName:   req.FileName,
+		FileSize:   req.FileSize,
+		Status:     message_status_enum.UNSENT,
+		CreatedAt:  time.Now(),
+		AVdata:     req.AVdata,
+	}
+	s.setMediaMeta(&message, &req)
+	replyTo := s.replyTarget(&req)
+	if replyTo != nil {
+		message.ReplyToId = replyTo.Uuid
+		message.ThreadId = replyTo.ThreadId
+		if message.ThreadId == "" {
+			message.ThreadId = replyTo.Uuid
+		}
+	}
+	if err := s.store.Messages().Create(&message); err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	s.updateSessionLastMessage(&message)
+
+	var targets []string
+	if message.ReceiveId[0] == 'U' {
+		// 回显给发送者，方便前端确认发送成功
+		targets = []string{message.SendId, message.ReceiveId}
+	} else if message.ReceiveId[0] == 'G' {
+		memberList, err := s.store.GroupMembers().ListByGroup(message.ReceiveId)
+		if err != nil {
+			zlog.Error(err.Error())
+			return
+		}
+		for _, member := range memberList {
+			targets = append(targets, member.UserId)
+		}
+	} else {
+		zlog.Error("未知的接收者类型：" + message.ReceiveId)
+		return
+	}
+	rspBytes, err := messagePayload(&message, replyTo)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	envelope := &Envelope{
+		Key:        message.ConversationKey(),
+		MessageId:  message.Uuid,
+		SendId:     message.SendId,
+		Targets:    targets,
+		Payload:    rspBytes,
+		MessageSeq: message.Id,
+		CreatedAt:  message.CreatedAt,
+	}
+	if err := s.broker.Publish(envelope); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// checkSendAllowed 检查发送者能否给接收者发消息，并填上发送者的昵称和头像
+// 群聊要求发送者在群里，单聊要求双方是正常的联系人，拉黑或删除之后不能再发
+func (s *Server) checkSendAllowed(req *request.ChatMessageRequest) bool {
+	user, err := s.store.Users().GetByUuid(req.SendId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return false
+	}
+	req.SendName, req.SendAvatar = user.Nickname, user.Avatar
+	switch req.ReceiveId[0] {
+	case 'G':
+		if _, err := s.store.GroupMembers().Get(req.ReceiveId, req.SendId); err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				zlog.Info(fmt.Sprintf("用户%s不是群聊%s的成员，无法发送消息", req.SendId, req.ReceiveId))
+			} else {
+				zlog.Error(err.Error())
+			}
+			return false
+		}
+	case 'U':
+		contact, err := s.store.Contacts().Get(req.SendId, req.ReceiveId)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				zlog.Info(fmt.Sprintf("用户%s不是%s的联系人，无法发送消息", req.ReceiveId, req.SendId))
+			} else {
+				zlog.Error(err.Error())
+			}
+			return false
+		}
+		if contact.Status != contact_status_enum.NORMAL {
+			zlog.Info(fmt.Sprintf("用户%s和%s的联系人状态为%d，无法发送消息", req.SendId, req.ReceiveId, contact.Status))
+			return false
+		}
+	default:
+		zlog.Error("未知的接收者类型：" + req.ReceiveId)
+		return false
+	}
+	return true
+}
+
+// senderSession 发送者和接收者之间的会话uuid，以服务端记录为准，不信任消息体中的session_id
+// 前端发消息前会先打开会话，会话不存在时丢弃消息
+func (s *Server) senderSession(req *request.ChatMessageRequest) (string, bool) {
+	session, err := s.store.Sessions().GetByPair(req.SendId, req.ReceiveId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Info(fmt.Sprintf("用户%s和%s之间没有会话，无法发送消息", req.SendId, req.ReceiveId))
+		} else {
+			zlog.Error(err.Error())
+		}
+		return "", false
+	}
+	if req.SessionId != "" && req.SessionId != session.Uuid {
+		zlog.Info(fmt.Sprintf("消息中的会话%s和服务端记录的%s不一致，以服务端为准", req.SessionId, session.Uuid))
+	}
+	return session.Uuid, true
+}
+
+// replyTarget 查询被回复的消息，消息不存在或不属于同一个会话时忽略回复
+func (s *Server) replyTarget(req *request.ChatMessageRequest) *model.Message {
+	if req.ReplyToId == "" {
+		return nil
+	}
+	replyTo, err := s.store.Messages().GetByUuid(req.ReplyToId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Info("被回复的消息不存在：" + req.ReplyToId)
+		} else {
+			zlog.Error(err.Error())
+		}
+		return nil
+	}
+	if req.ReceiveId[0] == 'G' {
+		if replyTo.ReceiveId == req.ReceiveId {
+			return replyTo
+		}
+	} else if (replyTo.SendId == req.SendId && replyTo.ReceiveId == req.ReceiveId) ||
+		(replyTo.SendId == req.ReceiveId && replyTo.ReceiveId == req.SendId) {
+		return replyTo
+	}
+	zlog.Info("被回复的消息不属于该会话：" + req.ReplyToId)
+	return nil
+}
+
+// replyTargets 批量查询被回复的消息，key为消息uuid
+func (s *Server) replyTargets(messageList []model.Message) (map[string]*model.Message, error) {
+	var uuids []string
+	for _, message := range messageList {
+		if message.ReplyToId != "" {
+			uuids = append(uuids, message.ReplyToId)
+		}
+	}
+	replyTargets := make(map[string]*model.Message, len(uuids))
+	if len(uuids) == 0 {
+		return replyTargets, nil
+	}
+	replyList, err := s.store.Messages().ListByUuids(uuids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range replyList {
+		replyTargets[replyList[i].Uuid] = &replyList[i]
+	}
+	return replyTargets, nil
+}
+
+// messagePayload 把消息转换成推送给前端的格式，单聊和群聊的格式不同，replyTo为被回复的消息
+func messagePayload(message *model.Message, replyTo *model.Message) ([]byte, error) {
+	var quote *respond.QuotedMessageRespond
+	if replyTo != nil {
+		quote = respond.NewQuotedMessageRespond(replyTo)
+	}
+	if message.ReceiveId[0] == 'G' {
+		return json.Marshal(respond.GetGroupMessageListRespond{
+			Uuid:       message.Uuid,
+			SendId:     message.SendId,
+			SendName:   message.SendName,
+			SendAvatar: message.SendAvatar,
+			ReceiveId:  message.ReceiveId,
+			Type:       message.Type,
+			Content:    message.Content,
+			Url:        message.Url,
+			FileType:   message.FileType,
+			FileName:   message.FileName,
+			FileSize:   message.FileSize,
+			Width:      message.Width,
+			Height:     message.Height,
+			Duration:   message.Duration,
+			Thumbnails: message.Thumbnails,
+			CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
+			IsEdited:   message.IsEdited,
+			IsRecalled: message.IsRecalled,
+			ReplyTo:    quote,
+			ThreadId:   message.ThreadId,
+		})
+	}
+	return json.Marshal(respond.GetMessageListRespond{
+		Uuid:       message.Uuid,
+		SendId:     message.SendId,
+		SendName:   message.SendName,
+		SendAvatar: message.SendAvatar,
+		ReceiveId:  message.ReceiveId,
+		Type:       message.Type,
+		Content:    message.Content,
+		Url:        message.Url,
+		FileType:   message.FileType,
+		FileName:   message.FileName,
+		FileSize:   message.FileSize,
+		Width:      message.Width,
+		Height:     message.Height,
+		Duration:   message.Duration,
+		Thumbnails: message.Thumbnails,
+		CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
+		IsEdited:   message.IsEdited,
+		IsRecalled: message.IsRecalled,
+		ReplyTo:    quote,
+		ThreadId:   message.ThreadId,
+	})
+}
+
+// Push 推送消息以外的事件，如已读回执，经broker分发以支持多实例
+func (s *Server) Push(key string, targets []string, payload []byte) error {
+	return s.broker.Publish(&Envelope{
+		Key:     key,
+		Targets: targets,
+		Payload: payload,
+	})
+}
+
+// CloseSession 断开某次登录的长连接，经broker分发，连接在其他实例上也能断开
+func (s *Server) CloseSession(uuid, sid string) error {
+	return s.broker.Publish(&Envelope{
+		Key:      uuid,
+		Targets:  []string{uuid},
+		CloseSid: sid,
+	})
+}
+
+// closeSession 断开本机上该次登录的连接，前端收到关闭码后应回到登录页
+func (s *Server) closeSession(uuid, sid string) {
+	for _, client := range s.GetClients(uuid) {
+		if client.Sid != sid {
+			continue
+		}
+		zlog.Info(fmt.Sprintf("用户%s的设备%s已注销，断开连接", uuid, sid))
+		client.kick()
+		s.unregister(client)
+	}
+}
+
+// deliver broker消费回调，推送给本机在线的目标用户的每个设备
+func (s *Server) deliver(envelope *Envelope) {
+	if envelope.CloseSid != "" {
+		for _, target := range envelope.Targets {
+			s.closeSession(target, envelope.CloseSid)
+		}
+		return
+	}
+	delivered := false
+	for _, target := range envelope.Targets {
+		for _, client := range s.GetClients(target) {
+			// 正在补发离线消息，等补发完再发
+			if client.deferIfReplaying(envelope) {
+				continue
+			}
+			if s.sendTo(client, envelope) && target != envelope.SendId {
+				delivered = true
+			}
+		}
+	}
+	if delivered && envelope.MessageId != "" {
+		s.markSent(envelope.MessageId)
+	}
+}
+
+// sendTo 发送给在线用户，发送通道已满返回false
+// 聊天消息发送成功后推进接收者的投递游标，下次上线从这里开始补发
+func (s *Server) sendTo(client *Client, envelope *Envelope) bool {
+	if !client.trySend(envelope.Payload) {
+		// 通道满了，说明连接已经卡住，直接断开，让前端重连
+		zlog.Error(fmt.Sprintf("用户%s的发送通道已满，断开连接", client.Uuid))
+		s.unregister(client)
+		return false
+	}
+	if envelope.MessageId != "" && client.Uuid != envelope.SendId {
+		message := &model.Message{Id: envelope.MessageSeq, Uuid: envelope.MessageId, CreatedAt: envelope.CreatedAt}
+		if err := s.store.Deliveries().Advance(client.Uuid, client.Sid, message); err != nil {
+			zlog.Error(err.Error())
+		}
+	}
+	return true
+}
+
+// markSent 消息已投递，更新状态
+func (s *Server) markSent(messageId string) {
+	if err := s.store.Messages().MarkSent(messageId, time.Now()); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// updateSessionLastMessage 更新会话的最新消息
+func (s *Server) updateSessionLastMessage(message *model.Message) {
+	lastMessage := message.Content
+	if message.Type != message_type_enum.TEXT && message.FileName != "" {
+		lastMessage = message.FileName
+	}
+	if err := s.store.Sessions().UpdateLastMessage(message.SendId, message.ReceiveId, lastMessage, message.CreatedAt); err != nil {
+		zlog.Error(err.Error())
+	}
+}
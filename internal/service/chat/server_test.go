@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"go_chat/internal/dao/memory"
+	"go_chat/internal/model"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replayFixture U2登录了两台设备S1和S2，U1给U2发消息
+type replayFixture struct {
+	s       *Server
+	store   *memory.Store
+	loginAt time.Time
+}
+
+func newReplayFixture(t *testing.T) *replayFixture {
+	t.Helper()
+	store := memory.NewStore()
+	f := &replayFixture{s: NewServer(store, NewChannelBroker()), store: store, loginAt: time.Now().Add(-time.Hour)}
+	for _, sid := range []string{"S1", "S2"} {
+		f.login(t, sid, f.loginAt)
+	}
+	return f
+}
+
+func (f *replayFixture) login(t *testing.T, sid string, at time.Time) {
+	t.Helper()
+	device := &model.DeviceSession{Sid: sid, UserId: "U2", Platform: "web", LastActiveAt: at, CreatedAt: at}
+	if err := f.store.Devices().Create(device); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *replayFixture) send(t *testing.T, uuid string, at time.Time) *Envelope {
+	t.Helper()
+	message := &model.Message{Uuid: uuid, SessionId: "S", SendId: "U1", ReceiveId: "U2", Content: uuid, CreatedAt: at}
+	if err := f.store.Messages().Create(message); err != nil {
+		t.Fatal(err)
+	}
+	return &Envelope{Targets: []string{"U2"}, SendId: "U1", MessageId: uuid, MessageSeq: message.Id, CreatedAt: at, Payload: []byte(uuid)}
+}
+
+// connect 模拟上线：补发结束后返回收到的消息uuid
+func (f *replayFixture) connect(sid string) []string {
+	client := newTestClient("U2", sid)
+	client.SendBack = make(chan []byte, 16)
+	client.replaying = true
+	f.s.replay(client)
+	var received []string
+	for {
+		select {
+		case data := <-client.SendBack:
+			for _, uuid := range []string{"M1", "M2", "M3"} {
+				if strings.Contains(string(data), `"`+uuid+`"`) {
+					received = append(received, uuid)
+				}
+			}
+		default:
+			return received
+		}
+	}
+}
+
+func expectReplayed(t *testing.T, sid string, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("%s replayed %v, want %v", sid, got, want)
+	}
+}
+
+// TestReplayPerDevice 一台设备在线收到的消息，另一台设备上线时仍然补发
+func TestReplayPerDevice(t *testing.T) {
+	f := newReplayFixture(t)
+	online := newTestClient("U2", "S1")
+	m1 := f.send(t, "M1", f.loginAt.Add(time.Minute))
+	if !f.s.sendTo(online, m1) {
+		t.Fatal("sendTo S1 failed")
+	}
+	expectPayload(t, online, "M1")
+
+	expectReplayed(t, "S2", f.connect("S2"), "M1")
+	expectReplayed(t, "S2 again", f.connect("S2"))
+	expectReplayed(t, "S1", f.connect("S1"))
+
+	// 两台设备的游标各自前进
+	f.send(t, "M2", f.loginAt.Add(2*time.Minute))
+	expectReplayed(t, "S1", f.connect("S1"), "M2")
+	f.send(t, "M3", f.loginAt.Add(3*time.Minute))
+	expectReplayed(t, "S2", f.connect("S2"), "M2", "M3")
+	expectReplayed(t, "S1", f.connect("S1"), "M3")
+
+	// 新登录的设备只补发登录之后的消息
+	f.login(t, "S3", f.loginAt.Add(150*time.Second))
+	expectReplayed(t, "S3", f.connect("S3"), "M3")
+}
+
+// TestDeleteStaleCursors 注销的登录不再保留游标
+func TestDeleteStaleCursors(t *testing.T) {
+	f := newReplayFixture(t)
+	f.send(t, "M1", f.loginAt.Add(time.Minute))
+	f.connect("S1")
+	f.connect("S2")
+	if _, err := f.store.Devices().Delete("S1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.Deliveries().DeleteStale("U2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.store.Deliveries().GetCursor("U2", "S1"); err == nil {
+		t.Fatal("cursor of the signed-out session was kept")
+	}
+	if _, err := f.store.Deliveries().GetCursor("U2", "S2"); err != nil {
+		t.Fatalf("cursor of the live session = %v", err)
+	}
+}
+
+// recordingBroker 只记录发布的消息
+type recordingBroker struct {
+	mu        sync.Mutex
+	envelopes []*Envelope
+}
+
+func (b *recordingBroker) Publish(envelope *Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.envelopes = append(b.envelopes, envelope)
+	return nil
+}
+
+func (b *recordingBroker) Start(deliver func(envelope *Envelope)) {}
+
+func (b *recordingBroker) Close() {}
+
+// TestHandleMessageSession 会话id和分区key由服务端决定，消息体中的session_id不可信
+func TestHandleMessageSession(t *testing.T) {
+	store := memory.NewStore()
+	for _, uuid := range []string{"U1", "U2", "U3"} {
+		if err := store.Users().Create(&model.UserInfo{Uuid: uuid, Nickname: "nick" + uuid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, pair := range [][2]string{{"U1", "U2"}, {"U2", "U1"}, {"U1", "U3"}, {"U3", "U1"}} {
+		if err := store.Contacts().Create(&model.UserContact{UserId: pair[0], ContactId: pair[1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// U2和U1之间有会话，U1和U3之间没有
+	for _, session := range []model.Session{{Uuid: "S12", SendId: "U1", ReceiveId: "U2"}, {Uuid: "S21", SendId: "U2", ReceiveId: "U1"}} {
+		if err := store.Sessions().Create(&session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	broker := new(recordingBroker)
+	s := NewServer(store, broker)
+
+	s.handleMessage(&TransmitMessage{SendId: "U1", Data: []byte(`{"session_id":"S99","receive_id":"U2","content":"hi"}`)})
+	s.handleMessage(&TransmitMessage{SendId: "U2", Data: []byte(`{"receive_id":"U1","content":"hello"}`)})
+	s.handleMessage(&TransmitMessage{SendId: "U1", Data: []byte(`{"session_id":"S12","receive_id":"U3","content":"lost"}`)})
+
+	if len(broker.envelopes) != 2 {
+		t.Fatalf("published %d envelopes, want 2", len(broker.envelopes))
+	}
+	for i, wantSession := range []string{"S12", "S21"} {
+		envelope := broker.envelopes[i]
+		if envelope.Key != "U1_U2" {
+			t.Fatalf("envelope %d key = %q, want U1_U2 for both directions", i, envelope.Key)
+		}
+		message, err := store.Messages().GetByUuid(envelope.MessageId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.SessionId != wantSession {
+			t.Fatalf("message %d session = %q, want %q", i, message.SessionId, wantSession)
+		}
+	}
+}
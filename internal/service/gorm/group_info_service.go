@@ -4,27 +4,31 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"go_chat/internal/dao"
 	"go_chat/internal/dto/request"
 	"go_chat/internal/dto/respond"
 	"go_chat/internal/model"
-	myredis "go_chat/internal/service/redis"
+	"go_chat/internal/service/cache"
 	"go_chat/pkg/constants"
 	"go_chat/pkg/enum/contact_status_enum"
 	"go_chat/pkg/enum/contact_type_enum"
+	"go_chat/pkg/enum/group_info/add_mode_enum"
 	"go_chat/pkg/enum/group_info/group_status_enum"
+	"go_chat/pkg/enum/group_info/member_role_enum"
 	"go_chat/pkg/util/random"
 	"go_chat/pkg/zlog"
-	"gorm.io/gorm"
-	"log"
 	"time"
 )
 
 type groupInfoService struct {
+	store dao.Store
+	cache cache.Cache
+	lists *cache.Versioned
 }
 
-var GroupInfoService = new(groupInfoService)
+func NewGroupInfoService(store dao.Store, c cache.Cache) *groupInfoService {
+	return &groupInfoService{store: store, cache: c, lists: cache.NewVersioned(c)}
+}
 
 func (g *groupInfoService) CreateGroup(groupReq request.CreateGroupRequest) (string, int) {
 	group := model.GroupInfo{
@@ -39,84 +43,70 @@ func (g *groupInfoService) CreateGroup(groupReq request.CreateGroupRequest) (str
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	var members []string
-	members = append(members, groupReq.OwnerId)
-	var err error
-	group.Members, err = json.Marshal(members)
+	err := g.store.Transaction(func(tx dao.Store) error {
+		if err := tx.Groups().Create(&group); err != nil {
+			return err
+		}
+		// 群主本人作为第一个成员，MemberCnt已经算上了
+		owner := model.GroupMember{
+			GroupId:  group.Uuid,
+			UserId:   groupReq.OwnerId,
+			Role:     member_role_enum.OWNER,
+			JoinedAt: group.CreatedAt,
+		}
+		if err := tx.GroupMembers().Create(&owner); err != nil {
+			return err
+		}
+		contact := model.UserContact{
+			UserId:      groupReq.OwnerId, //群员id
+			ContactId:   group.Uuid,       //群组id
+			ContactType: contact_type_enum.GROUP,
+			Status:      contact_status_enum.NORMAL,
+			CreatedAt:   time.Now(),
+			UpdateAt:    time.Now(),
+		}
+		return tx.Contacts().Create(&contact)
+	})
 	if err != nil {
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	if res := dao.GormDB.Create(&group); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-
-	//添加群主本人
-	contact := model.UserContact{
-		UserId:      groupReq.OwnerId, //群员id
-		ContactId:   group.Uuid,       //群组id
-		ContactType: contact_type_enum.GROUP,
-		Status:      contact_status_enum.NORMAL,
-		CreatedAt:   time.Now(),
-		UpdateAt:    time.Now(),
-	}
-	if res := dao.GormDB.Create(&contact); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	if err := myredis.DelKeysWithPattern("contact_mygroup_list_" + groupReq.OwnerId); err != nil {
-		zlog.Error(err.Error())
-	}
+	invalidateLists(g.lists, myGroupListCache, groupReq.OwnerId)
 	return "创建成功", 0
 }
 
 // LoadMyGroup 获取我创建的群聊
 func (g *groupInfoService) LoadMyGroup(ownerId string) (string, []respond.LoadMyGroupRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("contact_mygroup_list_" + ownerId)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var groupList []model.GroupInfo
-			if res := dao.GormDB.Order("created_at desc").Where("owner_id = ? ", ownerId).Find(&groupList); res.Error != nil {
-				zlog.Error(res.Error.Error())
-				return constants.SYSTEM_ERROR, nil, -1
-			}
-			var groupListRsp []respond.LoadMyGroupRespond
-			for _, group := range groupList {
-				groupListRsp = append(groupListRsp, respond.LoadMyGroupRespond{
-					GroupId:   group.Uuid,
-					GroupName: group.Name,
-					Avatar:    group.Avatar,
-				})
-			}
-			rspString, err := json.Marshal(groupListRsp)
-			if err != nil {
-				zlog.Error(err.Error())
-			}
-			if err := myredis.SetKeyEx("contact_mygroup_list_"+ownerId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
-				zlog.Error(err.Error())
-			}
-			return "获取成功", groupListRsp, 0
-		} else {
-			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, nil, -1
+	rsp, err := cache.GetOrLoad(g.lists, myGroupListCache, ownerId, listCacheTTL, func() ([]respond.LoadMyGroupRespond, error) {
+		groupList, err := g.store.Groups().ListByOwner(ownerId)
+		if err != nil {
+			return nil, err
 		}
-	}
-	var groupListRsp []respond.LoadMyGroupRespond
-	if err := json.Unmarshal([]byte(rspString), &groupListRsp); err != nil {
+		var groupListRsp []respond.LoadMyGroupRespond
+		for _, group := range groupList {
+			groupListRsp = append(groupListRsp, respond.LoadMyGroupRespond{
+				GroupId:   group.Uuid,
+				GroupName: group.Name,
+				Avatar:    group.Avatar,
+			})
+		}
+		return groupListRsp, nil
+	})
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
 	}
-	return "获取成功", groupListRsp, 0
+	return "获取成功", rsp, 0
 }
 
 // CheckGroupAddMode 检查群聊加群方式
 func (g *groupInfoService) CheckGroupAddMode(groupId string) (string, int8, int) {
-	rspString, err := myredis.GetKeyNilIsErr("group_info_" + groupId)
+	rspString, err := g.cache.Get("group_info_" + groupId)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var group model.GroupInfo
-			if res := dao.GormDB.First(&group, "uuid = ?", groupId); res.Error != nil {
-				zlog.Error(res.Error.Error())
+		if errors.Is(err, cache.ErrCacheMiss) {
+			group, err := g.store.Groups().GetByUuid(groupId)
+			if err != nil {
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, -1, -1
 			}
 			return "加群方式获取成功", group.AddMode, 0
@@ -132,212 +122,136 @@ func (g *groupInfoService) CheckGroupAddMode(groupId string) (string, int8, int)
 	return "加群方式获取成功", rsp.AddMode, 0
 }
 
-// EnterGroupDirectly 直接进群
+// EnterGroupDirectly 直接进群，只适用于无需审核的群聊，需要审核的群聊走加群申请
 // ownerId 是群聊id
 func (g *groupInfoService) EnterGroupDirectly(ownerId, contactId string) (string, int) {
-	var group model.GroupInfo
-	if res := dao.GormDB.First(&group, "uuid = ?", ownerId); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	var members []string
-	if err := json.Unmarshal(group.Members, &members); err != nil {
-		zlog.Error(err.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	members = append(members, contactId)
-	if data, err := json.Marshal(members); err != nil {
+	group, err := g.store.Groups().GetByUuid(ownerId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Info("群聊不存在")
+			return "群聊不存在", -2
+		}
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
-	} else {
-		group.Members = data
 	}
-	group.MemberCnt += 1
-	if res := dao.GormDB.Save(&group); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
+	if group.Status != group_status_enum.NORMAL {
+		zlog.Info("群聊已被禁用或解散：" + ownerId)
+		return "该群聊已被禁用或解散，无法加入", -2
 	}
-	newContact := model.UserContact{
-		UserId:      contactId,                  //群员id
-		ContactId:   ownerId,                    //群组id
-		ContactType: contact_type_enum.GROUP,    // 用户
-		Status:      contact_status_enum.NORMAL, // 正常
-		CreatedAt:   time.Now(),
-		UpdateAt:    time.Now(),
+	if group.AddMode != add_mode_enum.DIRECT {
+		zlog.Info("群聊需要审核，不能直接进群：" + ownerId)
+		return "该群聊需要群主审核，请发送加群申请", -2
 	}
-	if res := dao.GormDB.Create(&newContact); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	isMember, err := isGroupMember(g.store, ownerId, contactId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	//if err := myredis.DelKeysWithPattern("group_info_" + contactId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	//if err := myredis.DelKeysWithPattern("groupmember_list_" + contactId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	if err := myredis.DelKeysWithPattern("group_session_list_" + ownerId); err != nil {
-		zlog.Error(err.Error())
+	if isMember {
+		zlog.Info("已经是群成员：" + contactId)
+		return "已经在该群聊中", -2
 	}
-	if err := myredis.DelKeysWithPattern("my_joined_group_list_" + ownerId); err != nil {
+	if err := g.store.Transaction(func(tx dao.Store) error {
+		return joinGroup(tx, ownerId, contactId)
+	}); err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
 	}
-	//if err := myredis.DelKeysWithPattern("session_" + ownerId + "_" + contactId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
+	invalidateLists(g.lists, groupSessionListCache, contactId)
+	invalidateLists(g.lists, myJoinedGroupListCache, contactId)
 	return "进群成功", 0
 }
 
 // LeaveGroup 退群
 func (g *groupInfoService) LeaveGroup(userId string, groupId string) (string, int) {
-	// 从群聊中清除该用户
-	var group model.GroupInfo
-	if res := dao.GormDB.First(&group, "uuid = ?", groupId); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	var members []string
-	if err := json.Unmarshal(group.Members, &members); err != nil {
+	group, err := g.store.Groups().GetByUuid(groupId)
+	if err != nil {
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	for i, member := range members {
-		if member == userId {
-			members = append(members[:i], members[i+1:]...)
-			break
-		}
+	if group.OwnerId == userId {
+		return "群主不能退群，请解散群聊", -2
 	}
-	if data, err := json.Marshal(members); err != nil {
+	var left bool
+	err = g.store.Transaction(func(tx dao.Store) error {
+		var err error
+		left, err = quitGroup(tx, groupId, userId, contact_status_enum.QUIT_GROUP)
+		return err
+	})
+	if err != nil {
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
-	} else {
-		group.Members = data
 	}
-	group.MemberCnt -= 1
-	if res := dao.GormDB.Save(&group); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	// 删除会话
-	var deletedAt gorm.DeletedAt
-	deletedAt.Time = time.Now()
-	deletedAt.Valid = true
-	if res := dao.GormDB.Model(&model.Session{}).Where("send_id = ? AND receive_id = ?", userId, groupId).Update("deleted_at", deletedAt); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	// 删除联系人
-	if res := dao.GormDB.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", userId, groupId).Updates(map[string]interface{}{
-		"deleted_at": deletedAt,
-		"status":     contact_status_enum.QUIT_GROUP, // 退群
-	}); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
+	if !left {
+		return "不在该群聊中", -2
 	}
-	// 删除申请记录，后面还可以加
-	if res := dao.GormDB.Model(&model.ContactApply{}).Where("contact_id = ? AND user_id = ?", groupId, userId).Update("deleted_at", deletedAt); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	//if err := myredis.DelKeysWithPattern("group_info_" + groupId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	//if err := myredis.DelKeysWithPattern("groupmember_list_" + groupId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	if err := myredis.DelKeysWithPattern("group_session_list_" + userId); err != nil {
+	invalidateLists(g.lists, groupSessionListCache, userId)
+	invalidateLists(g.lists, myJoinedGroupListCache, userId)
+	return "退群成功", 0
+}
+
+// CheckGroupOwner 检查用户是否是群主
+func (g *groupInfoService) CheckGroupOwner(groupId, userId string) (string, int) {
+	group, err := g.store.Groups().GetByUuid(groupId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Info("群聊不存在")
+			return "群聊不存在", -2
+		}
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
 	}
-	if err := myredis.DelKeysWithPattern("my_joined_group_list_ " + userId); err != nil {
-		zlog.Error(err.Error())
+	if group.OwnerId != userId {
+		zlog.Info("不是群主，无权操作")
+		return "只有群主可以进行该操作", -2
 	}
-	//if err := myredis.DelKeysWithPattern("session_" + userId + "_" + groupId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	return "退群成功", 0
+	return "", 0
 }
 
 // DismissGroup 解散群聊
 func (g *groupInfoService) DismissGroup(ownerId, groupId string) (string, int) {
-	var deletedAt gorm.DeletedAt
-	deletedAt.Time = time.Now()
-	deletedAt.Valid = true
-	if res := dao.GormDB.Model(&model.GroupInfo{}).Where("uuid = ?", groupId).Updates(
-		map[string]interface{}{
-			"deleted_at": deletedAt,
-		}); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
+	if message, ret := g.CheckGroupOwner(groupId, ownerId); ret != 0 {
+		return message, ret
 	}
-
-	var sessionList []model.Session
-	if res := dao.GormDB.Model(&model.Session{}).Where("receive_id = ?", groupId).Find(&sessionList); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	// 成员在事务里会被删掉，先查出来用于清缓存
+	memberIds, err := groupMemberIds(g.store, groupId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	for _, session := range sessionList {
-		if res := dao.GormDB.Model(&session).Updates(
-			map[string]interface{}{
-				"deleted_at": deletedAt,
-			}); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
+	err = g.store.Transaction(func(tx dao.Store) error {
+		if err := tx.Groups().SoftDelete(groupId); err != nil {
+			return err
 		}
-	}
-
-	var userContactList []model.UserContact
-	if res := dao.GormDB.Model(&model.UserContact{}).Where("contact_id = ?", groupId).Find(&userContactList); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-
-	for _, userContact := range userContactList {
-		if res := dao.GormDB.Model(&userContact).Update("deleted_at", deletedAt); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
+		if err := tx.GroupMembers().DeleteByGroup(groupId); err != nil {
+			return err
 		}
-	}
-
-	var contactApplys []model.ContactApply
-	if res := dao.GormDB.Model(&contactApplys).Where("contact_id = ?", groupId).Find(&contactApplys); res.Error != nil {
-		if res.Error != gorm.ErrRecordNotFound {
-			zlog.Info(res.Error.Error())
-			return "无响应的申请记录需要删除", 0
+		if err := tx.Sessions().SoftDeleteByReceiveId(groupId); err != nil {
+			return err
 		}
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	for _, contactApply := range contactApplys {
-		if res := dao.GormDB.Model(&contactApply).Update("deleted_at", deletedAt); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
+		if err := tx.Contacts().SoftDeleteByContact(groupId); err != nil {
+			return err
 		}
-	}
-	//if err := myredis.DelKeysWithPattern("group_info_" + groupId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	//if err := myredis.DelKeysWithPattern("groupmember_list_" + groupId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	if err := myredis.DelKeysWithPattern("contact_mygroup_list_" + ownerId); err != nil {
-		zlog.Error(err.Error())
-	}
-	if err := myredis.DelKeysWithPattern("group_session_list_" + ownerId); err != nil {
-		zlog.Error(err.Error())
-	}
-	if err := myredis.DelKeysWithPrefix("my_joined_group_list"); err != nil {
+		return tx.Applies().SoftDeleteByContact(groupId)
+	})
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
 	}
+	invalidateLists(g.lists, myGroupListCache, ownerId)
+	invalidateLists(g.lists, groupSessionListCache, memberIds...)
+	invalidateLists(g.lists, myJoinedGroupListCache, memberIds...)
 	return "解散群聊成功", 0
 }
 
 // GetGroupInfo 获取群聊详情
 func (g *groupInfoService) GetGroupInfo(groupId string) (string, *respond.GetGroupInfoRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("group_info_" + groupId)
+	rspString, err := g.cache.Get("group_info_" + groupId)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var group model.GroupInfo
-			if res := dao.GormDB.First(&group, "uuid = ?", groupId); res.Error != nil {
-				zlog.Error(res.Error.Error())
+		if errors.Is(err, cache.ErrCacheMiss) {
+			group, err := g.store.Groups().GetByUuid(groupId)
+			if err != nil {
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, nil, -1
 			}
 			rsp := &respond.GetGroupInfoRespond{
@@ -359,7 +273,7 @@ func (g *groupInfoService) GetGroupInfo(groupId string) (string, *respond.GetGro
 			//if err != nil {
 			//	zlog.Error(err.Error())
 			//}
-			//if err := myredis.SetKeyEx("group_info_"+groupId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
+			//if err := g.cache.Set("group_info_"+groupId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
 			//	zlog.Error(err.Error())
 			//}
 			return "获取成功", rsp, 0
@@ -377,11 +291,15 @@ func (g *groupInfoService) GetGroupInfo(groupId string) (string, *respond.GetGro
 
 // UpdateGroupInfo 更新群聊消息
 func (g *groupInfoService) UpdateGroupInfo(req request.UpdateGroupInfoRequest) (string, int) {
-	var group model.GroupInfo
-	if res := dao.GormDB.First(&group, "uuid = ?", req.Uuid); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	group, err := g.store.Groups().GetByUuid(req.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
+	if group.OwnerId != req.OwnerId {
+		zlog.Info("不是群主，无权操作")
+		return "只有群主可以进行该操作", -2
+	}
 	if req.Name != "" {
 		group.Name = req.Name
 	}
@@ -394,30 +312,36 @@ func (g *groupInfoService) UpdateGroupInfo(req request.UpdateGroupInfoRequest) (
 	if req.Avatar != "" {
 		group.Avatar = req.Avatar
 	}
-	if res := dao.GormDB.Save(&group); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	// 修改会话
-	var sessionList []model.Session
-	if res := dao.GormDB.Where("receive_id = ?", req.Uuid).Find(&sessionList); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	err = g.store.Transaction(func(tx dao.Store) error {
+		if err := tx.Groups().Save(group); err != nil {
+			return err
+		}
+		// 修改会话
+		return tx.Sessions().UpdateReceiveInfo(req.Uuid, group.Name, group.Avatar)
+	})
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	for _, session := range sessionList {
-		session.ReceiveName = group.Name
-		session.Avatar = group.Avatar
-		log.Println(session)
-		if res := dao.GormDB.Save(&session); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
+	invalidateLists(g.lists, myGroupListCache, req.OwnerId)
+	// 群名和头像也出现在成员的会话列表和已加入群聊列表里
+	if memberIds, err := groupMemberIds(g.store, req.Uuid); err != nil {
+		zlog.Error(err.Error())
+		if err := g.lists.InvalidateAll(groupSessionListCache); err != nil {
+			zlog.Error(err.Error())
 		}
+		if err := g.lists.InvalidateAll(myJoinedGroupListCache); err != nil {
+			zlog.Error(err.Error())
+		}
+	} else {
+		invalidateLists(g.lists, groupSessionListCache, memberIds...)
+		invalidateLists(g.lists, myJoinedGroupListCache, memberIds...)
 	}
 
-	//if err := myredis.DelKeysWithPattern("group_info_" + req.Uuid); err != nil {
+	//if err := g.cache.DelByPattern("group_info_" + req.Uuid); err != nil {
 	//	zlog.Error(err.Error())
 	//}
-	//if err := myredis.SetKeyEx("contact_mygroup_list_"+ req.OwnerId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
+	//if err := g.cache.Set("contact_mygroup_list_"+ req.OwnerId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
 	//	zlog.Error(err.Error())
 	//}
 	return "更新成功", 0
@@ -425,37 +349,33 @@ func (g *groupInfoService) UpdateGroupInfo(req request.UpdateGroupInfoRequest) (
 
 // GetGroupMemberList 获取群聊成员列表
 func (g *groupInfoService) GetGroupMemberList(groupId string) (string, []respond.GetGroupMemberListRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("group_memberlist_" + groupId)
+	rspString, err := g.cache.Get("group_memberlist_" + groupId)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var group model.GroupInfo
-			if res := dao.GormDB.First(&group, "uuid = ?", groupId); res.Error != nil {
-				zlog.Error(res.Error.Error())
-				return constants.SYSTEM_ERROR, nil, -1
-			}
-			var members []string
-			if err := json.Unmarshal(group.Members, &members); err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			memberList, err := g.store.GroupMembers().ListByGroup(groupId)
+			if err != nil {
 				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, nil, -1
 			}
 			var rspList []respond.GetGroupMemberListRespond
-			for _, member := range members {
-				var user model.UserInfo
-				if res := dao.GormDB.First(&user, "uuid = ?", member); res.Error != nil {
-					zlog.Error(res.Error.Error())
+			for _, member := range memberList {
+				user, err := g.store.Users().GetByUuid(member.UserId)
+				if err != nil {
+					zlog.Error(err.Error())
 					return constants.SYSTEM_ERROR, nil, -1
 				}
 				rspList = append(rspList, respond.GetGroupMemberListRespond{
 					UserId:   user.Uuid,
 					Nickname: user.Nickname,
 					Avatar:   user.Avatar,
+					Role:     member.Role,
 				})
 			}
 			//rspString, err := json.Marshal(rspList)
 			//if err != nil {
 			//	zlog.Error(err.Error())
 			//}
-			//if err := myredis.SetKeyEx("group_memberlist_"+groupId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
+			//if err := g.cache.Set("group_memberlist_"+groupId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
 			//	zlog.Error(err.Error())
 			//}
 			return "获取群聊成员列表成功", rspList, 0
@@ -473,63 +393,34 @@ func (g *groupInfoService) GetGroupMemberList(groupId string) (string, []respond
 
 // RemoveGroupMembers 移除群聊成员
 func (g *groupInfoService) RemoveGroupMembers(req request.RemoveGroupMembersRequest) (string, int) {
-	var group model.GroupInfo
-	if res := dao.GormDB.First(&group, "uuid = ?", req.GroupId); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	var members []string
-	if err := json.Unmarshal(group.Members, &members); err != nil {
+	group, err := g.store.Groups().GetByUuid(req.GroupId)
+	if err != nil {
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	var deletedAt gorm.DeletedAt
-	deletedAt.Time = time.Now()
-	deletedAt.Valid = true
-	log.Println(req.UuidList, req.OwnerId)
+	if group.OwnerId != req.OwnerId {
+		zlog.Info("不是群主，无权操作")
+		return "只有群主可以进行该操作", -2
+	}
 	for _, uuid := range req.UuidList {
 		if req.OwnerId == uuid {
 			return "不能移除群主", -2
 		}
-		// 从members中找到uuid，移除
-		for i, member := range members {
-			if member == uuid {
-				members = append(members[:i], members[i+1:]...)
+	}
+	err = g.store.Transaction(func(tx dao.Store) error {
+		for _, uuid := range req.UuidList {
+			// 不在群里的直接跳过，不影响群人数
+			if _, err := quitGroup(tx, req.GroupId, uuid, contact_status_enum.KICK_OUT_GROUP); err != nil {
+				return err
 			}
 		}
-		group.MemberCnt -= 1
-		// 删除会话
-		if res := dao.GormDB.Model(&model.Session{}).Where("send_id = ? AND receive_id = ?", uuid, req.GroupId).Update("deleted_at", deletedAt); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		// 删除联系人
-		if res := dao.GormDB.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", uuid, req.GroupId).Update("deleted_at", deletedAt); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		// 删除申请记录
-		if res := dao.GormDB.Model(&model.ContactApply{}).Where("user_id = ? AND contact_id = ?", uuid, req.GroupId).Update("deleted_at", deletedAt); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-	}
-	group.Members, _ = json.Marshal(members)
-	if res := dao.GormDB.Save(&group); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	//if err := myredis.DelKeysWithPattern("group_info_" + req.GroupId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	//if err := myredis.DelKeysWithPattern("groupmember_list_" + req.GroupId); err != nil {
-	//	zlog.Error(err.Error())
-	//}
-	if err := myredis.DelKeysWithPrefix("group_session_list"); err != nil {
-		zlog.Error(err.Error())
-	}
-	if err := myredis.DelKeysWithPrefix("my_joined_group_list"); err != nil {
+		return nil
+	})
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
 	}
+	invalidateLists(g.lists, groupSessionListCache, req.UuidList...)
+	invalidateLists(g.lists, myJoinedGroupListCache, req.UuidList...)
 	return "移除群聊成员成功", 0
 }
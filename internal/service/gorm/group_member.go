@@ -0,0 +1,83 @@
+package gorm
+
+import (
+	"errors"
+	"go_chat/internal/dao"
+	"go_chat/internal/model"
+	"go_chat/pkg/enum/contact_status_enum"
+	"go_chat/pkg/enum/contact_type_enum"
+	"go_chat/pkg/enum/group_info/member_role_enum"
+	"time"
+)
+
+// joinGroup 添加普通群成员和对应的UserContact，群人数加一，需在事务中调用
+func joinGroup(tx dao.Store, groupId, userId string) error {
+	member := model.GroupMember{
+		GroupId:  groupId,
+		UserId:   userId,
+		Role:     member_role_enum.MEMBER,
+		JoinedAt: time.Now(),
+	}
+	if err := tx.GroupMembers().Create(&member); err != nil {
+		return err
+	}
+	if err := tx.Groups().AddMemberCnt(groupId, 1); err != nil {
+		return err
+	}
+	// 群聊只用创建一个UserContact，一条记录足以表达双方的状态
+	contact := model.UserContact{
+		UserId:      userId,
+		ContactId:   groupId,
+		ContactType: contact_type_enum.GROUP,
+		Status:      contact_status_enum.NORMAL,
+		CreatedAt:   time.Now(),
+		UpdateAt:    time.Now(),
+	}
+	return tx.Contacts().Create(&contact)
+}
+
+// quitGroup 移除群成员，群人数减一，并删除该成员的会话、联系人和申请记录，需在事务中调用
+// 返回false表示该用户本就不是群成员，此时不做任何修改
+func quitGroup(tx dao.Store, groupId, userId string, status int8) (bool, error) {
+	affected, err := tx.GroupMembers().Delete(groupId, userId)
+	if err != nil || affected == 0 {
+		return false, err
+	}
+	if err := tx.Groups().AddMemberCnt(groupId, -1); err != nil {
+		return false, err
+	}
+	if err := tx.Sessions().SoftDeleteByPair(userId, groupId); err != nil {
+		return false, err
+	}
+	if err := tx.Contacts().SoftDelete(userId, groupId, &status); err != nil {
+		return false, err
+	}
+	if err := tx.Applies().SoftDelete(userId, groupId); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isGroupMember 查询用户是否在群聊中
+func isGroupMember(store dao.Store, groupId, userId string) (bool, error) {
+	if _, err := store.GroupMembers().Get(groupId, userId); err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// groupMemberIds 群成员uuid，按入群时间升序
+func groupMemberIds(store dao.Store, groupId string) ([]string, error) {
+	memberList, err := store.GroupMembers().ListByGroup(groupId)
+	if err != nil {
+		return nil, err
+	}
+	userIds := make([]string, 0, len(memberList))
+	for _, member := range memberList {
+		userIds = append(userIds, member.UserId)
+	}
+	return userIds, nil
+}
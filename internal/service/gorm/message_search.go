@@ -0,0 +1,189 @@
+package gorm
+
+import (
+	"errors"
+	"go_chat/internal/dao"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/dto/respond"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/zlog"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxSearchKeywordLen = 50 // 关键词最多的字数
+	highlightBefore     = 20 // 匹配位置之前保留的字数
+	highlightAfter      = 60 // 匹配位置之后保留的字数
+	highlightPreTag     = "<em>"
+	highlightPostTag    = "</em>"
+)
+
+// SearchMessages 在登录用户参与的所有单聊和群聊中搜索消息内容和文件名
+func (m *messageService) SearchMessages(req request.SearchMessageRequest) (string, *respond.SearchMessageRespond, int) {
+	keyword := strings.TrimSpace(req.Keyword)
+	if keyword == "" {
+		return "搜索关键词不能为空", nil, -2
+	}
+	if utf8.RuneCountInString(keyword) > maxSearchKeywordLen {
+		return "搜索关键词过长", nil, -2
+	}
+	query := dao.MessageSearchQuery{
+		UserId:  req.UserId,
+		Keyword: keyword,
+		SendId:  req.SendId,
+		Type:    req.Type,
+	}
+	if req.SessionId != "" {
+		session, err := m.store.Sessions().GetByUuid(req.SessionId)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				return "会话不存在", nil, -2
+			}
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, -1
+		}
+		if session.SendId != req.UserId {
+			zlog.Info("会话不属于该用户")
+			return "会话不存在", nil, -2
+		}
+		query.ContactId = session.ReceiveId
+	}
+	if req.StartDate != "" {
+		since, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+		if err != nil {
+			return "开始日期格式错误", nil, -2
+		}
+		query.Since = since
+	}
+	if req.EndDate != "" {
+		until, err := time.ParseInLocation("2006-01-02", req.EndDate, time.Local)
+		if err != nil {
+			return "结束日期格式错误", nil, -2
+		}
+		query.Until = until.AddDate(0, 0, 1)
+	}
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultMessagePageSize
+	} else if pageSize > maxMessagePageSize {
+		pageSize = maxMessagePageSize
+	}
+	page := req.Page
+	if page <= 0 {
+		page = 1
+	}
+	query.Offset = (page - 1) * pageSize
+	query.Limit = pageSize
+	messageList, total, err := m.store.Searcher().Search(query)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp := &respond.SearchMessageRespond{
+		MessageList: make([]respond.SearchMessageItemRespond, 0, len(messageList)),
+		Total:       total,
+		HasMore:     int64(query.Offset+len(messageList)) < total,
+	}
+	for _, message := range messageList {
+		contactId := message.ReceiveId
+		if contactId == req.UserId {
+			contactId = message.SendId
+		}
+		text := message.Content
+		if !containsFold(text, keyword) {
+			text = message.FileName
+		}
+		rsp.MessageList = append(rsp.MessageList, respond.SearchMessageItemRespond{
+			Uuid:       message.Uuid,
+			ContactId:  contactId,
+			SendId:     message.SendId,
+			SendName:   message.SendName,
+			SendAvatar: message.SendAvatar,
+			ReceiveId:  message.ReceiveId,
+			Type:       message.Type,
+			FileName:   message.FileName,
+			Highlight:  highlight(text, keyword),
+			CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return "搜索成功", rsp, 0
+}
+
+// highlight 截取第一个匹配位置附近的内容并做HTML转义，匹配的关键词用<em>标出，不区分大小写
+func highlight(text, keyword string) string {
+	textRunes := []rune(text)
+	lowerText := lowerRunes(textRunes)
+	lowerKeyword := lowerRunes([]rune(keyword))
+	first := indexRunes(lowerText, lowerKeyword, 0)
+	if first < 0 {
+		first = 0
+	}
+	start := first - highlightBefore
+	if start < 0 {
+		start = 0
+	}
+	end := first + len(lowerKeyword) + highlightAfter
+	if end > len(textRunes) {
+		end = len(textRunes)
+	}
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("...")
+	}
+	for i := start; i < end; {
+		if i+len(lowerKeyword) <= end && hasRunesAt(lowerText, lowerKeyword, i) {
+			sb.WriteString(highlightPreTag)
+			sb.WriteString(html.EscapeString(string(textRunes[i : i+len(lowerKeyword)])))
+			sb.WriteString(highlightPostTag)
+			i += len(lowerKeyword)
+			continue
+		}
+		sb.WriteString(html.EscapeString(string(textRunes[i])))
+		i++
+	}
+	if end < len(textRunes) {
+		sb.WriteString("...")
+	}
+	return sb.String()
+}
+
+// containsFold 不区分大小写判断是否包含
+func containsFold(text, keyword string) bool {
+	return indexRunes(lowerRunes([]rune(text)), lowerRunes([]rune(keyword)), 0) >= 0
+}
+
+// lowerRunes 逐个字符转小写，保证和原文的下标一一对应
+func lowerRunes(runes []rune) []rune {
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	return lower
+}
+
+// indexRunes 从from开始查找sub第一次出现的位置，没有时返回-1
+func indexRunes(runes, sub []rune, from int) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := from; i+len(sub) <= len(runes); i++ {
+		if hasRunesAt(runes, sub, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasRunesAt runes从i开始是否是sub，调用方保证不越界
+func hasRunesAt(runes, sub []rune, i int) bool {
+	for j := range sub {
+		if runes[i+j] != sub[j] {
+			return false
+		}
+	}
+	return true
+}
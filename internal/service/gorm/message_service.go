@@ -4,53 +4,55 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis/v8"
+	"go_chat/internal/config"
 	"go_chat/internal/dao"
+	"go_chat/internal/dto/request"
 	"go_chat/internal/dto/respond"
 	"go_chat/internal/model"
-	myredis "go_chat/internal/service/redis"
+	"go_chat/internal/service/cache"
 	"go_chat/pkg/constants"
+	"go_chat/pkg/enum/message/message_type_enum"
 	"go_chat/pkg/zlog"
+	"time"
 )
 
 type messageService struct {
+	store    dao.Store
+	cache    cache.Cache
+	notifier Notifier
 }
 
-var MessageService = new(messageService)
+// NewMessageService notifier为nil时不推送撤回和编辑事件
+func NewMessageService(store dao.Store, c cache.Cache, notifier Notifier) *messageService {
+	return &messageService{store: store, cache: c, notifier: notifier}
+}
 
 // GetMessageList 获取聊天记录
 func (m *messageService) GetMessageList(userOneId, userTwoId string) (string, []respond.GetMessageListRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("message_list_" + userOneId + "_" + userTwoId)
+	rspString, err := m.cache.Get("message_list_" + userOneId + "_" + userTwoId)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
+		if errors.Is(err, cache.ErrCacheMiss) {
 			zlog.Info(err.Error())
 			zlog.Info(fmt.Sprintf("%s %s", userTwoId, userTwoId))
-			var messageList []model.Message
-			if res := dao.GormDB.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", userOneId, userTwoId, userTwoId, userOneId).Order("created_at ASC").Find(&messageList); res.Error != nil {
-				zlog.Error(res.Error.Error())
+			messageList, err := m.store.Messages().ListBetween(userOneId, userTwoId)
+			if err != nil {
+				zlog.Error(err.Error())
+				return constants.SYSTEM_ERROR, nil, -1
+			}
+			relations, err := m.loadRelations(messageList)
+			if err != nil {
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, nil, -1
 			}
 			var rspList []respond.GetMessageListRespond
 			for _, message := range messageList {
-				rspList = append(rspList, respond.GetMessageListRespond{
-					SendId:     message.SendId,
-					SendName:   message.SendName,
-					SendAvatar: message.SendAvatar,
-					ReceiveId:  message.ReceiveId,
-					Content:    message.Content,
-					Url:        message.Url,
-					Type:       message.Type,
-					FileType:   message.FileType,
-					FileName:   message.FileName,
-					FileSize:   message.FileSize,
-					CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-				})
+				rspList = append(rspList, messageRespond(&message, relations))
 			}
 			//rspString, err := json.Marshal(rspList)
 			//if err != nil {
 			//	zlog.Error(err.Error())
 			//}
-			//if err := myredis.SetKeyEx("message_list_"+userOneId+"_"+userTwoId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
+			//if err := m.cache.Set("message_list_"+userOneId+"_"+userTwoId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
 			//	zlog.Error(err.Error())
 			//}
 			return "获取聊天记录成功", rspList, 0
@@ -66,38 +68,49 @@ func (m *messageService) GetMessageList(userOneId, userTwoId string) (string, []
 	return "获取聊天记录成功", rsp, 0
 }
 
-// GetGroupMessageList 获取群聊消息记录
-func (m *messageService) GetGroupMessageList(groupId string) (string, []respond.GetGroupMessageListRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("group_messagelist_" + groupId)
+// checkGroupReader 只有群成员可以查看群聊记录
+func (m *messageService) checkGroupReader(groupId, userId string) (string, int) {
+	isMember, err := isGroupMember(m.store, groupId, userId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if !isMember {
+		message := "不是群成员，无法查看聊天记录"
+		zlog.Info(message + "：" + userId + " " + groupId)
+		return message, -2
+	}
+	return "", 0
+}
+
+// GetGroupMessageList 获取群聊消息记录，userId必须是群成员
+func (m *messageService) GetGroupMessageList(userId, groupId string) (string, []respond.GetGroupMessageListRespond, int) {
+	if message, ret := m.checkGroupReader(groupId, userId); ret != 0 {
+		return message, nil, ret
+	}
+	rspString, err := m.cache.Get("group_messagelist_" + groupId)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var messageList []model.Message
-			if res := dao.GormDB.Where("receive_id = ?", groupId).Order("created_at ASC").Find(&messageList); res.Error != nil {
-				zlog.Error(res.Error.Error())
+		if errors.Is(err, cache.ErrCacheMiss) {
+			messageList, err := m.store.Messages().ListByReceiveId(groupId)
+			if err != nil {
+				zlog.Error(err.Error())
+				return constants.SYSTEM_ERROR, nil, -1
+			}
+			relations, err := m.loadRelations(messageList)
+			if err != nil {
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, nil, -1
 			}
 			var rspList []respond.GetGroupMessageListRespond
 			for _, message := range messageList {
-				rsp := respond.GetGroupMessageListRespond{
-					SendId:     message.SendId,
-					SendName:   message.SendName,
-					SendAvatar: message.SendAvatar,
-					ReceiveId:  message.ReceiveId,
-					Content:    message.Content,
-					Url:        message.Url,
-					Type:       message.Type,
-					FileType:   message.FileType,
-					FileName:   message.FileName,
-					FileSize:   message.FileSize,
-					CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-				}
+				rsp := groupMessageRespond(&message, relations)
 				rspList = append(rspList, rsp)
 			}
 			//rspString, err := json.Marshal(rspList)
 			//if err != nil {
 			//	zlog.Error(err.Error())
 			//}
-			//if err := myredis.SetKeyEx("group_messagelist_"+groupId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
+			//if err := m.cache.Set("group_messagelist_"+groupId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
 			//	zlog.Error(err.Error())
 			//}
 			return "获取聊天记录成功", rspList, 0
@@ -112,3 +125,555 @@ func (m *messageService) GetGroupMessageList(groupId string) (string, []respond.
 	}
 	return "获取聊天记录成功", rsp, 0
 }
+
+const (
+	defaultMessagePageSize = 20
+	maxMessagePageSize     = 100
+)
+
+// GetMessagePage 分页获取聊天记录
+// before/after为消息uuid，都不传时返回最新的一页
+func (m *messageService) GetMessagePage(req request.GetMessagePageRequest) (string, *respond.GetMessagePageRespond, int) {
+	query := dao.MessagePageQuery{UserOneId: req.UserOneId, UserTwoId: req.UserTwoId}
+	message, messageList, nextCursor, hasMore, ret := m.queryMessagePage(query, req.Before, req.After, req.Limit)
+	if ret != 0 {
+		return message, nil, ret
+	}
+	relations, err := m.loadRelations(messageList)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp := &respond.GetMessagePageRespond{
+		MessageList: make([]respond.GetMessageListRespond, 0, len(messageList)),
+		NextCursor:  nextCursor,
+		HasMore:     hasMore,
+	}
+	for _, message := range messageList {
+		rsp.MessageList = append(rsp.MessageList, messageRespond(&message, relations))
+	}
+	return "获取聊天记录成功", rsp, 0
+}
+
+// GetGroupMessagePage 分页获取群聊消息记录
+func (m *messageService) GetGroupMessagePage(req request.GetGroupMessagePageRequest) (string, *respond.GetGroupMessagePageRespond, int) {
+	if message, ret := m.checkGroupReader(req.GroupId, req.UserId); ret != 0 {
+		return message, nil, ret
+	}
+	query := dao.MessagePageQuery{GroupId: req.GroupId}
+	message, messageList, nextCursor, hasMore, ret := m.queryMessagePage(query, req.Before, req.After, req.Limit)
+	if ret != 0 {
+		return message, nil, ret
+	}
+	relations, err := m.loadRelations(messageList)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp := &respond.GetGroupMessagePageRespond{
+		MessageList: make([]respond.GetGroupMessageListRespond, 0, len(messageList)),
+		NextCursor:  nextCursor,
+		HasMore:     hasMore,
+	}
+	for _, message := range messageList {
+		rsp.MessageList = append(rsp.MessageList, groupMessageRespond(&message, relations))
+	}
+	return "获取聊天记录成功", rsp, 0
+}
+
+// GetMessageThread 获取群聊中某条消息所在的话题，传入话题中任意一条消息都返回整个话题
+func (m *messageService) GetMessageThread(req request.GetMessageThreadRequest) (string, *respond.GetMessageThreadRespond, int) {
+	message, err := m.store.Messages().GetByUuid(req.MessageId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return "消息不存在", nil, -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if message.ReceiveId[0] != 'G' {
+		return "只有群聊消息支持话题", nil, -2
+	}
+	isMember, err := isGroupMember(m.store, message.ReceiveId, req.UserId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if !isMember {
+		return "不是群成员，无法查看话题", nil, -2
+	}
+	root := message
+	if message.ThreadId != "" {
+		if root, err = m.store.Messages().GetByUuid(message.ThreadId); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, -1
+		}
+	}
+	replyList, err := m.store.Messages().ListByThread(root.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	relations, err := m.loadRelations(append(replyList, *root))
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp := &respond.GetMessageThreadRespond{
+		Root:    groupMessageRespond(root, relations),
+		Replies: make([]respond.GetGroupMessageListRespond, 0, len(replyList)),
+	}
+	for _, reply := range replyList {
+		rsp.Replies = append(rsp.Replies, groupMessageRespond(&reply, relations))
+	}
+	return "获取话题成功", rsp, 0
+}
+
+// messageRelations 消息列表关联的数据，批量查询避免逐条查库
+type messageRelations struct {
+	quotes    map[string]*respond.QuotedMessageRespond // key为被回复消息的uuid
+	reactions map[string][]respond.ReactionRespond     // key为消息uuid
+}
+
+// loadRelations 批量查询被回复的消息和表情回应
+func (m *messageService) loadRelations(messageList []model.Message) (*messageRelations, error) {
+	relations := &messageRelations{quotes: make(map[string]*respond.QuotedMessageRespond)}
+	if len(messageList) == 0 {
+		return relations, nil
+	}
+	var replyIds []string
+	messageIds := make([]string, 0, len(messageList))
+	for _, message := range messageList {
+		messageIds = append(messageIds, message.Uuid)
+		if message.ReplyToId != "" {
+			replyIds = append(replyIds, message.ReplyToId)
+		}
+	}
+	quotedList, err := m.store.Messages().ListByUuids(replyIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range quotedList {
+		relations.quotes[quotedList[i].Uuid] = respond.NewQuotedMessageRespond(&quotedList[i])
+	}
+	reactionList, err := m.store.Reactions().ListByMessages(messageIds)
+	if err != nil {
+		return nil, err
+	}
+	relations.reactions = groupReactions(reactionList)
+	return relations, nil
+}
+
+// groupReactions 按消息和表情汇总，reactionList需按回应时间升序
+func groupReactions(reactionList []model.MessageReaction) map[string][]respond.ReactionRespond {
+	reactions := make(map[string][]respond.ReactionRespond)
+	for _, reaction := range reactionList {
+		emojiList := reactions[reaction.MessageId]
+		i := 0
+		for i < len(emojiList) && emojiList[i].Emoji != reaction.Emoji {
+			i++
+		}
+		if i == len(emojiList) {
+			emojiList = append(emojiList, respond.ReactionRespond{Emoji: reaction.Emoji})
+		}
+		emojiList[i].Count++
+		emojiList[i].UserIds = append(emojiList[i].UserIds, reaction.UserId)
+		reactions[reaction.MessageId] = emojiList
+	}
+	return reactions
+}
+
+func messageRespond(message *model.Message, relations *messageRelations) respond.GetMessageListRespond {
+	return respond.GetMessageListRespond{
+		Uuid:       message.Uuid,
+		SendId:     message.SendId,
+		SendName:   message.SendName,
+		SendAvatar: message.SendAvatar,
+		ReceiveId:  message.ReceiveId,
+		Content:    message.Content,
+		Url:        message.Url,
+		Type:       message.Type,
+		FileType:   message.FileType,
+		FileName:   message.FileName,
+		FileSize:   message.FileSize,
+		Width:      message.Width,
+		Height:     message.Height,
+		Duration:   message.Duration,
+		Thumbnails: message.Thumbnails,
+		CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
+		IsEdited:   message.IsEdited,
+		IsRecalled: message.IsRecalled,
+		ReplyTo:    relations.quotes[message.ReplyToId],
+		ThreadId:   message.ThreadId,
+		Reactions:  relations.reactions[message.Uuid],
+	}
+}
+
+func groupMessageRespond(message *model.Message, relations *messageRelations) respond.GetGroupMessageListRespond {
+	return respond.GetGroupMessageListRespond{
+		Uuid:       message.Uuid,
+		SendId:     message.SendId,
+		SendName:   message.SendName,
+		SendAvatar: message.SendAvatar,
+		ReceiveId:  message.ReceiveId,
+		Content:    message.Content,
+		Url:        message.Url,
+		Type:       message.Type,
+		FileType:   message.FileType,
+		FileName:   message.FileName,
+		FileSize:   message.FileSize,
+		Width:      message.Width,
+		Height:     message.Height,
+		Duration:   message.Duration,
+		Thumbnails: message.Thumbnails,
+		CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
+		IsEdited:   message.IsEdited,
+		IsRecalled: message.IsRecalled,
+		ReplyTo:    relations.quotes[message.ReplyToId],
+		ThreadId:   message.ThreadId,
+		Reactions:  relations.reactions[message.Uuid],
+	}
+}
+
+// queryMessagePage 按(created_at, id)做keyset分页，返回的消息按时间升序
+func (m *messageService) queryMessagePage(query dao.MessagePageQuery, before, after string, limit int) (string, []model.Message, string, bool, int) {
+	if before != "" && after != "" {
+		return "before和after不能同时传", nil, "", false, -2
+	}
+	if limit <= 0 {
+		limit = defaultMessagePageSize
+	} else if limit > maxMessagePageSize {
+		limit = maxMessagePageSize
+	}
+	query.Older = after == ""
+	cursorUuid := before
+	if !query.Older {
+		cursorUuid = after
+	}
+	if cursorUuid != "" {
+		cursor, err := m.store.Messages().GetByUuid(cursorUuid)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				zlog.Info("消息游标不存在：" + cursorUuid)
+				return "消息游标无效", nil, "", false, -2
+			}
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, "", false, -1
+		}
+		query.Cursor = cursor
+	}
+	// 多取一条用来判断是否还有下一页
+	query.Limit = limit + 1
+	messageList, err := m.store.Messages().Page(query)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, "", false, -1
+	}
+	hasMore := len(messageList) > limit
+	if hasMore {
+		messageList = messageList[:limit]
+	}
+	if query.Older {
+		for i, j := 0, len(messageList)-1; i < j; i, j = i+1, j-1 {
+			messageList[i], messageList[j] = messageList[j], messageList[i]
+		}
+	}
+	nextCursor := ""
+	if len(messageList) > 0 {
+		if query.Older {
+			nextCursor = messageList[0].Uuid
+		} else {
+			nextCursor = messageList[len(messageList)-1].Uuid
+		}
+	}
+	return "", messageList, nextCursor, hasMore, 0
+}
+
+const (
+	defaultRecallWindow = 2 * time.Minute
+	defaultEditWindow   = 15 * time.Minute
+	recalledLastMessage = "[消息已撤回]"
+)
+
+// recallWindow 发送后多久内可以撤回，配置单位为分钟，未配置时使用默认值
+func recallWindow() time.Duration {
+	if window := config.GetConfig().RecallWindow; window > 0 {
+		return window * time.Minute
+	}
+	return defaultRecallWindow
+}
+
+// editWindow 发送后多久内可以编辑，配置单位为分钟，未配置时使用默认值
+func editWindow() time.Duration {
+	if window := config.GetConfig().EditWindow; window > 0 {
+		return window * time.Minute
+	}
+	return defaultEditWindow
+}
+
+// RecallMessage 撤回消息，发送者可以撤回自己的消息，群主可以撤回群里任何人的消息，都受撤回时限限制
+func (m *messageService) RecallMessage(req request.RecallMessageRequest) (string, int) {
+	message, err := m.store.Messages().GetByUuid(req.MessageId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return "消息不存在", -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if message.IsRecalled == 1 {
+		return "消息已撤回", -2
+	}
+	if message.SendId != req.OperatorId {
+		if message.ReceiveId[0] != 'G' {
+			return "只能撤回自己发送的消息", -2
+		}
+		group, err := m.store.Groups().GetByUuid(message.ReceiveId)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				return "群聊不存在", -2
+			}
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		if group.OwnerId != req.OperatorId {
+			return "只能撤回自己发送的消息", -2
+		}
+	}
+	if time.Since(message.CreatedAt) > recallWindow() {
+		return "消息发送时间过久，无法撤回", -2
+	}
+	now := time.Now()
+	recalled := false
+	err = m.store.Transaction(func(tx dao.Store) error {
+		var err error
+		if recalled, err = tx.Messages().Recall(message.Uuid, req.OperatorId, now); err != nil || !recalled {
+			return err
+		}
+		if err := tx.Reactions().DeleteByMessage(message.Uuid); err != nil {
+			return err
+		}
+		return refreshLastMessage(tx, message, recalledLastMessage)
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if !recalled {
+		return "消息已撤回", -2
+	}
+	m.pushUpdate(message, respond.MessageUpdateRespond{
+		Event:      constants.EVENT_MESSAGE_RECALL,
+		MessageId:  message.Uuid,
+		SendId:     message.SendId,
+		ReceiveId:  message.ReceiveId,
+		OperatorId: req.OperatorId,
+		UpdatedAt:  now.Format("2006-01-02 15:04:05"),
+	})
+	return "撤回成功", 0
+}
+
+// rejectError 事务中发现请求不能执行时返回，回滚事务并把提示带回给调用方
+type rejectError string
+
+func (e rejectError) Error() string {
+	return string(e)
+}
+
+// EditMessage 编辑文本消息，只有发送者可以编辑，受编辑时限限制，编辑前的内容记录在编辑历史中
+func (m *messageService) EditMessage(req request.EditMessageRequest) (string, int) {
+	if req.Content == "" {
+		return "消息内容不能为空", -2
+	}
+	// 在事务中锁住消息后再检查和追加编辑历史，并发编辑时后一次基于前一次的结果，不会丢失历史
+	var message *model.Message
+	now := time.Now()
+	unchanged := false
+	err := m.store.Transaction(func(tx dao.Store) error {
+		var err error
+		if message, err = tx.Messages().GetForUpdate(req.MessageId); err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				return rejectError("消息不存在")
+			}
+			return err
+		}
+		if message.SendId != req.SendId {
+			return rejectError("只能编辑自己发送的消息")
+		}
+		if message.IsRecalled == 1 {
+			return rejectError("消息已撤回")
+		}
+		if message.Type != message_type_enum.TEXT {
+			return rejectError("只能编辑文本消息")
+		}
+		if time.Since(message.CreatedAt) > editWindow() {
+			return rejectError("消息发送时间过久，无法编辑")
+		}
+		if message.Content == req.Content {
+			unchanged = true
+			return nil
+		}
+		var history []model.MessageEdit
+		if len(message.EditHistory) > 0 {
+			if err := json.Unmarshal(message.EditHistory, &history); err != nil {
+				return err
+			}
+		}
+		history = append(history, model.MessageEdit{Content: message.Content, EditedAt: now})
+		historyBytes, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+		edited, err := tx.Messages().Edit(message.Uuid, req.Content, historyBytes, now)
+		if err != nil {
+			return err
+		}
+		if !edited {
+			return rejectError("消息已撤回")
+		}
+		return refreshLastMessage(tx, message, req.Content)
+	})
+	var reject rejectError
+	if errors.As(err, &reject) {
+		return string(reject), -2
+	}
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if unchanged {
+		return "编辑成功", 0
+	}
+	m.pushUpdate(message, respond.MessageUpdateRespond{
+		Event:      constants.EVENT_MESSAGE_EDIT,
+		MessageId:  message.Uuid,
+		SendId:     message.SendId,
+		ReceiveId:  message.ReceiveId,
+		OperatorId: req.SendId,
+		Content:    req.Content,
+		UpdatedAt:  now.Format("2006-01-02 15:04:05"),
+	})
+	return "编辑成功", 0
+}
+
+// maxEmojiLen 和 model.MessageReaction.Emoji 的列宽一致
+const maxEmojiLen = 32
+
+// ToggleReaction 回应消息，已经用同一个表情回应过时取消回应，返回变化后该消息的全部回应
+func (m *messageService) ToggleReaction(req request.ToggleReactionRequest) (string, []respond.ReactionRespond, int) {
+	if req.Emoji == "" || len(req.Emoji) > maxEmojiLen {
+		return "表情不合法", nil, -2
+	}
+	message, err := m.store.Messages().GetByUuid(req.MessageId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return "消息不存在", nil, -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if message.IsRecalled == 1 {
+		return "消息已撤回", nil, -2
+	}
+	if message.ReceiveId[0] == 'G' {
+		isMember, err := isGroupMember(m.store, message.ReceiveId, req.UserId)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, -1
+		}
+		if !isMember {
+			return "不是群成员，无法回应", nil, -2
+		}
+	} else if req.UserId != message.SendId && req.UserId != message.ReceiveId {
+		return "只能回应自己会话中的消息", nil, -2
+	}
+	added := false
+	var reactions []respond.ReactionRespond
+	err = m.store.Transaction(func(tx dao.Store) error {
+		removed, err := tx.Reactions().Delete(message.Uuid, req.UserId, req.Emoji)
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			added = true
+			reaction := model.MessageReaction{
+				MessageId: message.Uuid,
+				UserId:    req.UserId,
+				Emoji:     req.Emoji,
+				CreatedAt: time.Now(),
+			}
+			if err := tx.Reactions().Create(&reaction); err != nil {
+				return err
+			}
+		}
+		reactionList, err := tx.Reactions().ListByMessages([]string{message.Uuid})
+		if err != nil {
+			return err
+		}
+		reactions = groupReactions(reactionList)[message.Uuid]
+		return nil
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if reactions == nil {
+		reactions = []respond.ReactionRespond{}
+	}
+	m.pushUpdate(message, respond.MessageReactionRespond{
+		Event:     constants.EVENT_MESSAGE_REACTION,
+		MessageId: message.Uuid,
+		SendId:    message.SendId,
+		ReceiveId: message.ReceiveId,
+		UserId:    req.UserId,
+		Emoji:     req.Emoji,
+		Added:     added,
+		Reactions: reactions,
+	})
+	if added {
+		return "回应成功", reactions, 0
+	}
+	return "已取消回应", reactions, 0
+}
+
+// refreshLastMessage 被修改的消息是会话的最新消息时，同步改写会话的最新消息
+func refreshLastMessage(tx dao.Store, message *model.Message, lastMessage string) error {
+	query := dao.MessagePageQuery{Older: true, Limit: 1}
+	if message.ReceiveId[0] == 'G' {
+		query.GroupId = message.ReceiveId
+	} else {
+		query.UserOneId = message.SendId
+		query.UserTwoId = message.ReceiveId
+	}
+	latest, err := tx.Messages().Page(query)
+	if err != nil {
+		return err
+	}
+	if len(latest) == 0 || latest[0].Uuid != message.Uuid {
+		return nil
+	}
+	return tx.Sessions().SetLastMessage(message.SendId, message.ReceiveId, lastMessage)
+}
+
+// pushUpdate 推送消息的撤回、编辑、回应事件，单聊推给双方，群聊推给所有群成员，多端登录时发送者的其他连接也能同步
+func (m *messageService) pushUpdate(message *model.Message, event interface{}) {
+	if m.notifier == nil {
+		return
+	}
+	targets := []string{message.SendId, message.ReceiveId}
+	if message.ReceiveId[0] == 'G' {
+		var err error
+		if targets, err = groupMemberIds(m.store, message.ReceiveId); err != nil {
+			zlog.Error(err.Error())
+			return
+		}
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	if err := m.notifier.Push(message.ConversationKey(), targets, payload); err != nil {
+		zlog.Error(err.Error())
+	}
+}
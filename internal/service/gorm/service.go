@@ -0,0 +1,61 @@
+package gorm
+
+import (
+	"go_chat/internal/dao"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/model"
+	"go_chat/internal/service/cache"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/zlog"
+	"time"
+)
+
+// TokenIssuer 登录成功后登记设备并签发token，由 auth.AuthService 实现
+type TokenIssuer interface {
+	GenerateTokens(device *model.DeviceSession) (*respond.TokenRespond, error)
+	// RevokeAllSessions 注销用户除exceptSid以外的所有登录，exceptSid为空时全部注销
+	RevokeAllSessions(uuid, exceptSid string) (int, error)
+}
+
+// Notifier 通过长连接给在线用户推送事件，由 chat.ChatServer 实现
+type Notifier interface {
+	Push(key string, targets []string, payload []byte) error
+}
+
+// 按用户缓存的列表，owner都是用户uuid，失效时调用 invalidateLists
+const (
+	contactUserListCache   = "contact_user_list"
+	myJoinedGroupListCache = "my_joined_group_list"
+	myGroupListCache       = "contact_mygroup_list"
+	sessionListCache       = "session_list"
+	groupSessionListCache  = "group_session_list"
+
+	listCacheTTL = time.Minute * constants.REDIS_TIMEOUT
+)
+
+// invalidateLists 使owners在namespace下的列表缓存失效，出错只记日志
+func invalidateLists(lists *cache.Versioned, namespace string, owners ...string) {
+	for _, owner := range owners {
+		if err := lists.Invalidate(namespace, owner); err != nil {
+			zlog.Error(err.Error())
+		}
+	}
+}
+
+// 以下service由 Init 创建
+var (
+	UserInfoService    *userInfoService
+	UserContactService *userContactService
+	GroupInfoService   *groupInfoService
+	SessionService     *sessionService
+	MessageService     *messageService
+)
+
+// Init 注入依赖，需要在注册路由之前调用
+func Init(store dao.Store, c cache.Cache, tokens TokenIssuer, notifier Notifier) {
+	UserInfoService = NewUserInfoService(store, c, tokens)
+	UserContactService = NewUserContactService(store, c)
+	GroupInfoService = NewGroupInfoService(store, c)
+	SessionService = NewSessionService(store, c, notifier)
+	MessageService = NewMessageService(store, c, notifier)
+}
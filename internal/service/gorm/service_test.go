@@ -0,0 +1,393 @@
+package gorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_chat/internal/dao"
+	"go_chat/internal/dao/memory"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/model"
+	"go_chat/internal/service/cache"
+	"go_chat/pkg/enum/group_info/add_mode_enum"
+	"go_chat/pkg/enum/user_info/user_status_enum"
+	passwordutil "go_chat/pkg/util/password"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTokens 只记录签发和注销，不生成真正的jwt
+type fakeTokens struct {
+	mu      sync.Mutex
+	issued  []model.DeviceSession
+	revoked []string // 被注销全部登录的用户
+}
+
+func (f *fakeTokens) GenerateTokens(device *model.DeviceSession) (*respond.TokenRespond, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.issued = append(f.issued, *device)
+	return &respond.TokenRespond{AccessToken: "access-" + device.UserId, RefreshToken: "refresh-" + device.UserId}, nil
+}
+
+func (f *fakeTokens) RevokeAllSessions(uuid, exceptSid string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked = append(f.revoked, uuid)
+	return 1, nil
+}
+
+// fakeNotifier 记录推送的目标用户
+type fakeNotifier struct {
+	mu     sync.Mutex
+	pushed [][]string
+}
+
+func (f *fakeNotifier) Push(key string, targets []string, payload []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushed = append(f.pushed, targets)
+	return nil
+}
+
+// testServices 用内存Store和内存缓存组装的service，不依赖MySQL和Redis
+type testServices struct {
+	tokens   *fakeTokens
+	notifier *fakeNotifier
+	user     *userInfoService
+	contact  *userContactService
+	group    *groupInfoService
+	session  *sessionService
+	message  *messageService
+}
+
+func newTestServices(store dao.Store, c cache.Cache) *testServices {
+	tokens, notifier := new(fakeTokens), new(fakeNotifier)
+	return &testServices{
+		tokens:   tokens,
+		notifier: notifier,
+		user:     NewUserInfoService(store, c, tokens),
+		contact:  NewUserContactService(store, c),
+		group:    NewGroupInfoService(store, c),
+		session:  NewSessionService(store, c, notifier),
+		message:  NewMessageService(store, c, notifier),
+	}
+}
+
+const testPassword = "Passw0rd!"
+
+var testPasswordHash = func() string {
+	hash, err := passwordutil.Hash(testPassword)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}()
+
+// seedUser 直接写入一个用户，手机号取uuid的最后一位，uuid形如U1
+func seedUser(t *testing.T, store dao.Store, uuid string) *model.UserInfo {
+	t.Helper()
+	user := &model.UserInfo{
+		Uuid:      uuid,
+		Nickname:  "nick" + uuid,
+		Telephone: "1380000000" + uuid[len(uuid)-1:],
+		Password:  testPasswordHash,
+		Status:    user_status_enum.NORMAL,
+		CreatedAt: time.Now(),
+	}
+	if err := store.Users().Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// mustOK 断言service调用成功，用法 mustOK(t)(service.Xxx(...))
+func mustOK(t *testing.T) func(message string, ret int) {
+	return func(message string, ret int) {
+		t.Helper()
+		if ret != 0 {
+			t.Fatalf("ret = %d (%s), want 0", ret, message)
+		}
+	}
+}
+
+// makeFriends 走申请和通过的流程让两个用户成为联系人
+func makeFriends(t *testing.T, s *testServices, a, b string) {
+	t.Helper()
+	mustOK(t)(s.contact.ApplyContact(request.ApplyContactRequest{OwnerId: a, ContactId: b}))
+	mustOK(t)(s.contact.PassContactApply(b, a))
+}
+
+// createGroup 创建群聊并让members直接进群，返回群uuid
+func createGroup(t *testing.T, s *testServices, store dao.Store, owner string, members ...string) string {
+	t.Helper()
+	mustOK(t)(s.group.CreateGroup(request.CreateGroupRequest{OwnerId: owner, Name: "group"}))
+	groupList, err := store.Groups().ListByOwner(owner)
+	if err != nil || len(groupList) == 0 {
+		t.Fatalf("ListByOwner = %v, %v", groupList, err)
+	}
+	groupId := groupList[0].Uuid
+	for _, member := range members {
+		mustOK(t)(s.group.EnterGroupDirectly(groupId, member))
+	}
+	return groupId
+}
+
+func TestLogin(t *testing.T) {
+	store := memory.NewStore()
+	s := newTestServices(store, cache.NewMemoryCache())
+	user := seedUser(t, store, "U1")
+
+	message, rsp, ret := s.user.Login(request.LoginRequest{
+		Telephone:  user.Telephone,
+		Password:   testPassword,
+		DeviceInfo: request.DeviceInfo{DeviceId: "d1", Platform: "ios"},
+	})
+	mustOK(t)(message, ret)
+	if rsp.Uuid != "U1" || rsp.TokenRespond == nil || rsp.AccessToken != "access-U1" {
+		t.Fatalf("login respond = %+v", rsp)
+	}
+	if len(s.tokens.issued) != 1 || s.tokens.issued[0].DeviceId != "d1" {
+		t.Fatalf("issued = %+v, want one session for d1", s.tokens.issued)
+	}
+
+	if _, _, ret := s.user.Login(request.LoginRequest{Telephone: user.Telephone, Password: "wrong"}); ret != -2 {
+		t.Fatalf("wrong password ret = %d, want -2", ret)
+	}
+	if err := store.Users().UpdateStatus("U1", user_status_enum.DISABLE); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ret := s.user.Login(request.LoginRequest{Telephone: user.Telephone, Password: testPassword}); ret != -2 {
+		t.Fatalf("disabled user ret = %d, want -2", ret)
+	}
+}
+
+// untilLimited 重复调用attempt直到返回-3，超过limit次仍未被限制时失败，返回调用次数
+func untilLimited(t *testing.T, limit int, attempt func() int) int {
+	t.Helper()
+	for i := 1; i <= limit; i++ {
+		if ret := attempt(); ret == -3 {
+			return i
+		} else if ret != -2 {
+			t.Fatalf("attempt %d ret = %d, want -2 before being limited", i, ret)
+		}
+	}
+	t.Fatalf("not limited after %d attempts", limit)
+	return 0
+}
+
+// TestLoginRateLimit 被频率限制或锁定时返回-3
+func TestLoginRateLimit(t *testing.T) {
+	store := memory.NewStore()
+	s := newTestServices(store, cache.NewMemoryCache())
+	user := seedUser(t, store, "U1")
+
+	// 连续输错密码后锁定，锁定期间正确的密码也不能登录
+	untilLimited(t, 10, func() int {
+		_, _, ret := s.user.Login(request.LoginRequest{Telephone: user.Telephone, Password: "wrong", ClientIp: "10.0.0.1"})
+		return ret
+	})
+	if _, _, ret := s.user.Login(request.LoginRequest{Telephone: user.Telephone, Password: testPassword, ClientIp: "10.0.0.1"}); ret != -3 {
+		t.Fatalf("locked login ret = %d, want -3", ret)
+	}
+	if len(s.tokens.issued) != 0 {
+		t.Fatalf("issued %d sessions while locked", len(s.tokens.issued))
+	}
+
+	// 同一手机号登录过于频繁时，密码登录和验证码登录都受限
+	untilLimited(t, 100, func() int {
+		_, _, ret := s.user.SmsLogin(request.SmsLoginRequest{Telephone: "13900000000", SmsCode: "123456", ClientIp: "10.0.0.2"})
+		return ret
+	})
+	if _, _, ret := s.user.Login(request.LoginRequest{Telephone: "13900000000", Password: testPassword, ClientIp: "10.0.0.3"}); ret != -3 {
+		t.Fatalf("password login after too many attempts ret = %d, want -3", ret)
+	}
+}
+
+// TestSmsLoginAttempts 验证码输错次数用完后作废，正确的验证码也不能再用
+func TestSmsLoginAttempts(t *testing.T) {
+	store := memory.NewStore()
+	c := cache.NewMemoryCache()
+	s := newTestServices(store, c)
+	user := seedUser(t, store, "U1")
+	codeKey := "auth_code_" + user.Telephone
+	if err := c.Set(codeKey, "123456", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	login := func(code string) int {
+		_, _, ret := s.user.SmsLogin(request.SmsLoginRequest{Telephone: user.Telephone, SmsCode: code, DeviceInfo: request.DeviceInfo{DeviceId: "d1"}})
+		return ret
+	}
+
+	untilLimited(t, 5, func() int { return login("000000") })
+	if _, err := c.Get(codeKey); err == nil {
+		t.Fatal("code kept after too many wrong attempts")
+	}
+	if ret := login("123456"); ret != -2 {
+		t.Fatalf("invalidated code ret = %d, want -2", ret)
+	}
+
+	// 新的验证码重新计数
+	if err := c.Set(codeKey, "654321", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ret := login("000000"); ret != -2 {
+		t.Fatalf("wrong new code ret = %d, want -2", ret)
+	}
+	if ret := login("654321"); ret != 0 {
+		t.Fatalf("new code ret = %d, want 0", ret)
+	}
+}
+
+func TestContactListCache(t *testing.T) {
+	store := memory.NewStore()
+	s := newTestServices(store, cache.NewMemoryCache())
+	seedUser(t, store, "U1")
+	seedUser(t, store, "U2")
+
+	message, list, ret := s.contact.GetUserList("U1")
+	mustOK(t)(message, ret)
+	if len(list) != 0 {
+		t.Fatalf("contacts before apply = %+v", list)
+	}
+	// 通过申请会让双方的缓存失效
+	makeFriends(t, s, "U1", "U2")
+	for _, pair := range [][2]string{{"U1", "U2"}, {"U2", "U1"}} {
+		message, list, ret := s.contact.GetUserList(pair[0])
+		mustOK(t)(message, ret)
+		if len(list) != 1 || list[0].UserId != pair[1] {
+			t.Fatalf("%s contacts = %+v, want %s", pair[0], list, pair[1])
+		}
+	}
+
+	// 缓存命中时不再读Store，直接改Store不会反映出来
+	friend, err := store.Users().GetByUuid("U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	friend.Nickname = "renamed"
+	if err := store.Users().Save(friend); err != nil {
+		t.Fatal(err)
+	}
+	if _, list, _ := s.contact.GetUserList("U1"); list[0].UserName == "renamed" {
+		t.Fatal("GetUserList should be served from cache")
+	}
+
+	mustOK(t)(s.contact.DeleteContact("U1", "U2"))
+	for _, owner := range []string{"U1", "U2"} {
+		message, list, ret := s.contact.GetUserList(owner)
+		mustOK(t)(message, ret)
+		if len(list) != 0 {
+			t.Fatalf("%s contacts after delete = %+v", owner, list)
+		}
+	}
+	if contact, err := store.Contacts().Get("U1", "U2"); err == nil {
+		t.Fatalf("contact after delete = %+v, want soft deleted", contact)
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	store := memory.NewStore()
+	s := newTestServices(store, cache.NewMemoryCache())
+	for _, uuid := range []string{"U1", "U2", "U3"} {
+		seedUser(t, store, uuid)
+	}
+	groupId := createGroup(t, s, store, "U1", "U2")
+
+	group, err := store.Groups().GetByUuid(groupId)
+	if err != nil || group.MemberCnt != 2 {
+		t.Fatalf("group = %+v, %v, want 2 members", group, err)
+	}
+	if _, ret := s.group.EnterGroupDirectly(groupId, "U2"); ret != -2 {
+		t.Fatalf("enter twice ret = %d, want -2", ret)
+	}
+
+	// 需要审核的群聊不能直接进群
+	mustOK(t)(s.group.CreateGroup(request.CreateGroupRequest{OwnerId: "U3", Name: "audit", AddMode: add_mode_enum.AUDIT}))
+	auditGroups, err := store.Groups().ListByOwner("U3")
+	if err != nil || len(auditGroups) != 1 {
+		t.Fatalf("ListByOwner = %v, %v", auditGroups, err)
+	}
+	if _, ret := s.group.EnterGroupDirectly(auditGroups[0].Uuid, "U2"); ret != -2 {
+		t.Fatalf("enter audit group ret = %d, want -2", ret)
+	}
+	if isMember, err := isGroupMember(store, auditGroups[0].Uuid, "U2"); err != nil || isMember {
+		t.Fatalf("U2 in audit group = %v, %v, want not a member", isMember, err)
+	}
+
+	// 群聊记录只有成员能看
+	if _, _, ret := s.message.GetGroupMessagePage(request.GetGroupMessagePageRequest{UserId: "U2", GroupId: groupId}); ret != 0 {
+		t.Fatalf("member page ret = %d, want 0", ret)
+	}
+	if _, _, ret := s.message.GetGroupMessagePage(request.GetGroupMessagePageRequest{UserId: "U3", GroupId: groupId}); ret != -2 {
+		t.Fatalf("outsider page ret = %d, want -2", ret)
+	}
+	if _, _, ret := s.message.GetGroupMessageList("U3", groupId); ret != -2 {
+		t.Fatalf("outsider list ret = %d, want -2", ret)
+	}
+
+	mustOK(t)(s.group.LeaveGroup("U2", groupId))
+	if _, _, ret := s.message.GetGroupMessagePage(request.GetGroupMessagePageRequest{UserId: "U2", GroupId: groupId}); ret != -2 {
+		t.Fatalf("page after leave ret = %d, want -2", ret)
+	}
+	if _, ret := s.group.LeaveGroup("U1", groupId); ret != -2 {
+		t.Fatalf("owner leave ret = %d, want -2", ret)
+	}
+	if group, _ := store.Groups().GetByUuid(groupId); group.MemberCnt != 1 {
+		t.Fatalf("member count after leave = %d, want 1", group.MemberCnt)
+	}
+}
+
+// TestEditMessageConcurrent 并发编辑同一条消息，每次编辑前的内容都记录在编辑历史中
+func TestEditMessageConcurrent(t *testing.T) {
+	store := memory.NewStore()
+	s := newTestServices(store, cache.NewMemoryCache())
+	seedUser(t, store, "U1")
+	seedUser(t, store, "U2")
+	message := &model.Message{Uuid: "M1", SendId: "U1", ReceiveId: "U2", Content: "v0", CreatedAt: time.Now()}
+	if err := store.Messages().Create(message); err != nil {
+		t.Fatal(err)
+	}
+
+	const edits = 8
+	var wg sync.WaitGroup
+	for i := 1; i <= edits; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mustOK(t)(s.message.EditMessage(request.EditMessageRequest{SendId: "U1", MessageId: "M1", Content: fmt.Sprintf("v%d", i)}))
+		}(i)
+	}
+	wg.Wait()
+
+	edited, err := store.Messages().GetByUuid("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history []model.MessageEdit
+	if err := json.Unmarshal(edited.EditHistory, &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != edits {
+		t.Fatalf("history has %d entries, want %d", len(history), edits)
+	}
+	// 历史中的内容首尾相接：第一条是原内容，每条编辑都基于前一次的结果
+	seen := map[string]bool{}
+	for _, edit := range append(history, model.MessageEdit{Content: edited.Content}) {
+		if seen[edit.Content] {
+			t.Fatalf("content %q recorded twice in %+v", edit.Content, history)
+		}
+		seen[edit.Content] = true
+	}
+	if history[0].Content != "v0" {
+		t.Fatalf("first history entry = %q, want the original content", history[0].Content)
+	}
+
+	if _, ret := s.message.EditMessage(request.EditMessageRequest{SendId: "U2", MessageId: "M1", Content: "x"}); ret != -2 {
+		t.Fatalf("edit by another user ret = %d, want -2", ret)
+	}
+	if _, ret := s.message.EditMessage(request.EditMessageRequest{SendId: "U1", MessageId: "M9", Content: "x"}); ret != -2 {
+		t.Fatalf("edit a missing message ret = %d, want -2", ret)
+	}
+}
@@ -4,35 +4,40 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"go_chat/internal/dao"
 	"go_chat/internal/dto/request"
 	"go_chat/internal/dto/respond"
 	"go_chat/internal/model"
-	myredis "go_chat/internal/service/redis"
+	"go_chat/internal/service/cache"
 	"go_chat/pkg/constants"
 	"go_chat/pkg/enum/contact_status_enum"
 	"go_chat/pkg/enum/group_info/group_status_enum"
 	"go_chat/pkg/enum/user_info/user_status_enum"
 	"go_chat/pkg/util/random"
 	"go_chat/pkg/zlog"
-	"gorm.io/gorm"
 	"time"
 )
 
 type sessionService struct {
+	store    dao.Store
+	cache    cache.Cache
+	lists    *cache.Versioned
+	notifier Notifier
 }
 
-var SessionService = new(sessionService)
+// NewSessionService notifier为nil时不推送已读回执
+func NewSessionService(store dao.Store, c cache.Cache, notifier Notifier) *sessionService {
+	return &sessionService{store: store, cache: c, lists: cache.NewVersioned(c), notifier: notifier}
+}
 
-// OpenSession 打开会话
+// OpenSession 打开会话，不存在时新建
 func (s *sessionService) OpenSession(req request.OpenSessionRequest) (string, string, int) {
-	rspString, err := myredis.GetKeyWithPrefixNilIsErr("session_" + req.SendId + "_" + req.ReceiveId)
+	rspString, err := s.cache.Get("session_" + req.SendId + "_" + req.ReceiveId)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var session model.Session
-			if res := dao.GormDB.Where("send_id = ? and receive_id = ?", req.SendId, req.ReceiveId).First(&session); res.Error != nil {
-				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			session, err := s.store.Sessions().GetByPair(req.SendId, req.ReceiveId)
+			if err != nil {
+				if errors.Is(err, dao.ErrRecordNotFound) {
 					zlog.Info("会话没有找到，将新建会话")
 					createReq := request.CreateSessionRequest{
 						SendId:    req.SendId,
@@ -40,12 +45,14 @@ func (s *sessionService) OpenSession(req request.OpenSessionRequest) (string, st
 					}
 					return s.CreateSession(createReq)
 				}
+				zlog.Error(err.Error())
+				return constants.SYSTEM_ERROR, "", -1
 			}
 			//rspString, err := json.Marshal(session)
 			//if err != nil {
 			//	zlog.Error(err.Error())
 			//}
-			//if err := myredis.SetKeyEx("session_"+req.SendId+"_"+req.ReceiveId+"_"+session.Uuid, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
+			//if err := s.cache.Set("session_"+req.SendId+"_"+req.ReceiveId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
 			//	zlog.Error(err.Error())
 			//}
 			return "会话创建成功", session.Uuid, 0
@@ -63,127 +70,112 @@ func (s *sessionService) OpenSession(req request.OpenSessionRequest) (string, st
 
 // GetUserSessionList 获取用户会话列表
 func (s *sessionService) GetUserSessionList(ownerId string) (string, []respond.UserSessionListRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("session_list_" + ownerId)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var sessionList []model.Session
-			if res := dao.GormDB.Order("created_at DESC").Where("send_id = ?", ownerId).Find(&sessionList); res.Error != nil {
-				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-					zlog.Info("未创建用户会话")
-					return "未创建用户会话", nil, 0
-				} else {
-					zlog.Error(res.Error.Error())
-					return constants.SYSTEM_ERROR, nil, -1
-				}
-			}
-			var sessionListRsp []respond.UserSessionListRespond
-			for i := 0; i < len(sessionList); i++ {
-				if sessionList[i].ReceiveId[0] == 'U' {
-					sessionListRsp = append(sessionListRsp, respond.UserSessionListRespond{
-						SessionId: sessionList[i].Uuid,
-						Avatar:    sessionList[i].Avatar,
-						UserId:    sessionList[i].ReceiveId,
-						Username:  sessionList[i].ReceiveName,
-					})
-				}
-			}
-			rspString, err := json.Marshal(sessionListRsp)
-			if err != nil {
-				zlog.Error(err.Error())
-			}
-			if err := myredis.SetKeyEx("session_list_"+ownerId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
-				zlog.Error(err.Error())
+	rsp, err := cache.GetOrLoad(s.lists, sessionListCache, ownerId, listCacheTTL, func() ([]respond.UserSessionListRespond, error) {
+		sessionList, err := s.store.Sessions().ListBySendId(ownerId)
+		if err != nil {
+			return nil, err
+		}
+		var sessionListRsp []respond.UserSessionListRespond
+		for i := 0; i < len(sessionList); i++ {
+			if sessionList[i].ReceiveId[0] == 'U' {
+				sessionListRsp = append(sessionListRsp, respond.UserSessionListRespond{
+					SessionId: sessionList[i].Uuid,
+					Avatar:    sessionList[i].Avatar,
+					UserId:    sessionList[i].ReceiveId,
+					Username:  sessionList[i].ReceiveName,
+				})
 			}
-			return "获取成功", sessionListRsp, 0
-		} else {
-			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, nil, -1
 		}
+		return sessionListRsp, nil
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
 	}
-	var rsp []respond.UserSessionListRespond
-	if err := json.Unmarshal([]byte(rspString), &rsp); err != nil {
+	// 未读数变化太频繁，不进缓存，每次单独查
+	unreadCounts, err := s.store.Sessions().UnreadCounts(ownerId)
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	// rsp可能和其他请求共享，复制一份再填未读数
+	rsp = append([]respond.UserSessionListRespond(nil), rsp...)
+	for i := range rsp {
+		rsp[i].UnreadCnt = unreadCounts[rsp[i].SessionId]
 	}
 	return "获取成功", rsp, 0
 }
 
 // GetGroupSessionList 获取群聊会话列表
 func (s *sessionService) GetGroupSessionList(ownerId string) (string, []respond.GroupSessionListRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("group_session_list_" + ownerId)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var sessionList []model.Session
-			if res := dao.GormDB.Order("created_at DESC").Where("send_id = ?", ownerId).Find(&sessionList); res.Error != nil {
-				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-					zlog.Info("未创建群聊会话")
-					return "未创建群聊会话", nil, 0
-				} else {
-					zlog.Error(res.Error.Error())
-					return constants.SYSTEM_ERROR, nil, -1
-				}
-			}
-			var sessionListRsp []respond.GroupSessionListRespond
-			for i := 0; i < len(sessionList); i++ {
-				if sessionList[i].ReceiveId[0] == 'G' {
-					sessionListRsp = append(sessionListRsp, respond.GroupSessionListRespond{
-						SessionId: sessionList[i].Uuid,
-						Avatar:    sessionList[i].Avatar,
-						GroupId:   sessionList[i].ReceiveId,
-						GroupName: sessionList[i].ReceiveName,
-					})
-				}
-			}
-			rspString, err := json.Marshal(sessionListRsp)
-			if err != nil {
-				zlog.Error(err.Error())
-			}
-			if err := myredis.SetKeyEx("group_session_list_"+ownerId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
-				zlog.Error(err.Error())
+	rsp, err := cache.GetOrLoad(s.lists, groupSessionListCache, ownerId, listCacheTTL, func() ([]respond.GroupSessionListRespond, error) {
+		sessionList, err := s.store.Sessions().ListBySendId(ownerId)
+		if err != nil {
+			return nil, err
+		}
+		var sessionListRsp []respond.GroupSessionListRespond
+		for i := 0; i < len(sessionList); i++ {
+			if sessionList[i].ReceiveId[0] == 'G' {
+				sessionListRsp = append(sessionListRsp, respond.GroupSessionListRespond{
+					SessionId: sessionList[i].Uuid,
+					Avatar:    sessionList[i].Avatar,
+					GroupId:   sessionList[i].ReceiveId,
+					GroupName: sessionList[i].ReceiveName,
+				})
 			}
-			return "获取成功", sessionListRsp, 0
-		} else {
-			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, nil, -1
 		}
+		return sessionListRsp, nil
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
 	}
-	var rsp []respond.GroupSessionListRespond
-	if err := json.Unmarshal([]byte(rspString), &rsp); err != nil {
+	unreadCounts, err := s.store.Sessions().UnreadCounts(ownerId)
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp = append([]respond.GroupSessionListRespond(nil), rsp...)
+	for i := range rsp {
+		rsp[i].UnreadCnt = unreadCounts[rsp[i].SessionId]
 	}
 	return "获取成功", rsp, 0
 }
 
 // DeleteSession 删除会话
 func (s *sessionService) DeleteSession(ownerId, sessionId string) (string, int) {
-
-	var session model.Session
-	if res := dao.GormDB.Where("uuid = ?", sessionId).Find(&session); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	session, err := s.store.Sessions().GetByUuid(sessionId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Info("会话不存在")
+			return "会话不存在", -2
+		}
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
+	if session.SendId != ownerId {
+		zlog.Info("会话不属于该用户")
+		return "会话不存在", -2
+	}
 	session.DeletedAt.Valid = true
 	session.DeletedAt.Time = time.Now()
-	if res := dao.GormDB.Save(&session); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	if err := s.store.Sessions().Save(session); err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	//if err := myredis.DelKeysWithSuffix(sessionId); err != nil {
+	//if err := s.cache.DelByPattern("*" + sessionId); err != nil {
 	//	zlog.Error(err.Error())
 	//}
-	if err := myredis.DelKeysWithPattern("group_session_list_" + ownerId); err != nil {
-		zlog.Error(err.Error())
-	}
-	if err := myredis.DelKeysWithPattern("session_list_" + ownerId); err != nil {
-		zlog.Error(err.Error())
-	}
+	invalidateLists(s.lists, groupSessionListCache, ownerId)
+	invalidateLists(s.lists, sessionListCache, ownerId)
 	return "删除成功", 0
 }
 
 // CheckOpenSessionAllowed 检查是否允许发起会话
 func (s *sessionService) CheckOpenSessionAllowed(sendId, receiveId string) (string, bool, int) {
-	var contact model.UserContact
-	if res := dao.GormDB.Where("user_id = ? and contact_id = ?", sendId, receiveId).First(&contact); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	contact, err := s.store.Contacts().Get(sendId, receiveId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, false, -1
 	}
 	if contact.Status == contact_status_enum.BE_BLACK {
@@ -192,9 +184,9 @@ func (s *sessionService) CheckOpenSessionAllowed(sendId, receiveId string) (stri
 		return "已拉黑对方，先解除拉黑状态才能发起会话", false, -2
 	}
 	if receiveId[0] == 'U' {
-		var user model.UserInfo
-		if res := dao.GormDB.Where("uuid = ?", receiveId).First(&user); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		user, err := s.store.Users().GetByUuid(receiveId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, false, -1
 		}
 		if user.Status == user_status_enum.DISABLE {
@@ -202,9 +194,9 @@ func (s *sessionService) CheckOpenSessionAllowed(sendId, receiveId string) (stri
 			return "对方已被禁用，无法发起会话", false, -2
 		}
 	} else {
-		var group model.GroupInfo
-		if res := dao.GormDB.Where("uuid = ?", receiveId).First(&group); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		group, err := s.store.Groups().GetByUuid(receiveId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, false, -1
 		}
 		if group.Status == group_status_enum.DISABLE {
@@ -217,9 +209,8 @@ func (s *sessionService) CheckOpenSessionAllowed(sendId, receiveId string) (stri
 
 // CreateSession 创建会话
 func (s *sessionService) CreateSession(req request.CreateSessionRequest) (string, string, int) {
-	var user model.UserInfo
-	if res := dao.GormDB.Where("uuid = ?", req.SendId).First(&user); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	if _, err := s.store.Users().GetByUuid(req.SendId); err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, "", -1
 	}
 	var session model.Session
@@ -228,9 +219,9 @@ func (s *sessionService) CreateSession(req request.CreateSessionRequest) (string
 	session.ReceiveId = req.ReceiveId
 	session.CreatedAt = time.Now()
 	if req.ReceiveId[0] == 'U' {
-		var receiveUser model.UserInfo
-		if res := dao.GormDB.Where("uuid = ?", req.ReceiveId).First(&receiveUser); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		receiveUser, err := s.store.Users().GetByUuid(req.ReceiveId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, "", -1
 		}
 		if receiveUser.Status == user_status_enum.DISABLE {
@@ -241,9 +232,9 @@ func (s *sessionService) CreateSession(req request.CreateSessionRequest) (string
 			session.Avatar = receiveUser.Avatar
 		}
 	} else {
-		var receiveGroup model.GroupInfo
-		if res := dao.GormDB.Where("uuid = ?", req.ReceiveId).First(&receiveGroup); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		receiveGroup, err := s.store.Groups().GetByUuid(req.ReceiveId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, "", -1
 		}
 		if receiveGroup.Status == group_status_enum.DISABLE {
@@ -255,15 +246,130 @@ func (s *sessionService) CreateSession(req request.CreateSessionRequest) (string
 		}
 	}
 
-	if res := dao.GormDB.Create(&session); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	if err := s.store.Sessions().Create(&session); err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, "", -1
 	}
-	if err := myredis.DelKeysWithPattern("group_session_list_" + req.SendId); err != nil {
+	invalidateLists(s.lists, groupSessionListCache, req.SendId)
+	invalidateLists(s.lists, sessionListCache, req.SendId)
+	return "会话创建成功", session.Uuid, 0
+}
+
+// MarkSessionRead 把会话标记为已读到messageId，重新计算未读数，并给消息发送者推送已读回执
+// 已读游标只能前进，传入更早的消息直接返回成功
+func (s *sessionService) MarkSessionRead(req request.MarkSessionReadRequest) (string, int) {
+	session, err := s.store.Sessions().GetByUuid(req.SessionId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return "会话不存在", -2
+		}
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if session.SendId != req.OwnerId {
+		zlog.Info("会话不属于该用户")
+		return "会话不存在", -2
 	}
-	if err := myredis.DelKeysWithPattern("session_list_" + req.SendId); err != nil {
+	message, err := s.store.Messages().GetByUuid(req.MessageId)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return "消息不存在", -2
+		}
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
 	}
-	return "会话创建成功", session.Uuid, 0
+	query := dao.MessageRangeQuery{ExcludeSendId: session.SendId}
+	if session.ReceiveId[0] == 'G' {
+		if message.ReceiveId != session.ReceiveId {
+			return "消息不属于该会话", -2
+		}
+		query.GroupId = session.ReceiveId
+	} else {
+		if !(message.SendId == session.SendId && message.ReceiveId == session.ReceiveId) &&
+			!(message.SendId == session.ReceiveId && message.ReceiveId == session.SendId) {
+			return "消息不属于该会话", -2
+		}
+		query.UserOneId = session.SendId
+		query.UserTwoId = session.ReceiveId
+	}
+	var lastRead *model.Message
+	if session.ReadMessageId != "" {
+		lastRead, err = s.store.Messages().GetByUuid(session.ReadMessageId)
+		if err != nil && !errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		if lastRead != nil && !messageBefore(lastRead, message) {
+			return "已读成功", 0
+		}
+	}
+	query.After = message
+	unreadCnt, err := s.store.Messages().CountRange(query)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	moved, err := s.store.Sessions().UpdateReadCursor(session.Uuid, message.Uuid, message.CreatedAt, int(unreadCnt))
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if moved {
+		query.After = lastRead
+		query.Until = message
+		s.pushReadReceipt(session, message, query)
+	}
+	return "已读成功", 0
+}
+
+// pushReadReceipt 单聊推给对方，群聊推给本次新读到的消息的发送者，附带已读人数
+func (s *sessionService) pushReadReceipt(session *model.Session, message *model.Message, readRange dao.MessageRangeQuery) {
+	if s.notifier == nil {
+		return
+	}
+	receipt := respond.ReadReceiptRespond{
+		Event:     constants.EVENT_READ_RECEIPT,
+		ReaderId:  session.SendId,
+		ContactId: session.SendId,
+		MessageId: message.Uuid,
+		ReadAt:    time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if session.ReceiveId[0] != 'G' {
+		s.push(message.ConversationKey(), session.ReceiveId, receipt)
+		return
+	}
+	receipt.ContactId = session.ReceiveId
+	sendIds, err := s.store.Messages().SendIdsInRange(readRange)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	for _, sendId := range sendIds {
+		readCnt, err := s.store.Sessions().CountReaders(session.ReceiveId, message.CreatedAt, sendId)
+		if err != nil {
+			zlog.Error(err.Error())
+			continue
+		}
+		receipt.ReadCnt = readCnt
+		s.push(message.ConversationKey(), sendId, receipt)
+	}
+}
+
+func (s *sessionService) push(key, target string, receipt respond.ReadReceiptRespond) {
+	payload, err := json.Marshal(receipt)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	if err := s.notifier.Push(key, []string{target}, payload); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// messageBefore 按(created_at, id)比较
+func messageBefore(a, b *model.Message) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.Id < b.Id
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
 }
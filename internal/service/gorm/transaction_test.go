@@ -0,0 +1,288 @@
+package gorm
+
+import (
+	"errors"
+	"go_chat/internal/dao"
+	"go_chat/internal/dao/memory"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/model"
+	"go_chat/internal/service/cache"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errInjected = errors.New("injected failure")
+
+// faultStore 在指定的写操作上返回errInjected，用来模拟事务进行到一半时数据库出错
+// method形如"Applies.SoftDelete"，前skip次调用正常执行
+type faultStore struct {
+	dao.Store
+	mu     sync.Mutex
+	method string
+	skip   int
+}
+
+func (f *faultStore) fail(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if method != f.method {
+		return nil
+	}
+	if f.skip > 0 {
+		f.skip--
+		return nil
+	}
+	return errInjected
+}
+
+// injectAt 设置故障点，method为空时不再注入
+func (f *faultStore) injectAt(method string, skip int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.method, f.skip = method, skip
+}
+
+func (f *faultStore) Transaction(fn func(tx dao.Store) error) error {
+	return f.Store.Transaction(func(tx dao.Store) error {
+		return fn(&faultTx{Store: tx, fault: f})
+	})
+}
+
+func (f *faultStore) Users() dao.UserRepository {
+	return faultUsers{f.Store.Users(), f}
+}
+
+func (f *faultStore) Contacts() dao.ContactRepository {
+	return faultContacts{f.Store.Contacts(), f}
+}
+
+func (f *faultStore) Applies() dao.ApplyRepository {
+	return faultApplies{f.Store.Applies(), f}
+}
+
+// faultTx 事务内的Store，和faultStore共用故障点
+type faultTx struct {
+	dao.Store
+	fault *faultStore
+}
+
+func (t *faultTx) Users() dao.UserRepository {
+	return faultUsers{t.Store.Users(), t.fault}
+}
+
+func (t *faultTx) Contacts() dao.ContactRepository {
+	return faultContacts{t.Store.Contacts(), t.fault}
+}
+
+func (t *faultTx) Applies() dao.ApplyRepository {
+	return faultApplies{t.Store.Applies(), t.fault}
+}
+
+type faultUsers struct {
+	dao.UserRepository
+	fault *faultStore
+}
+
+func (r faultUsers) SoftDelete(uuid string) error {
+	if err := r.fault.fail("Users.SoftDelete"); err != nil {
+		return err
+	}
+	return r.UserRepository.SoftDelete(uuid)
+}
+
+type faultContacts struct {
+	dao.ContactRepository
+	fault *faultStore
+}
+
+func (r faultContacts) Create(contact *model.UserContact) error {
+	if err := r.fault.fail("Contacts.Create"); err != nil {
+		return err
+	}
+	return r.ContactRepository.Create(contact)
+}
+
+type faultApplies struct {
+	dao.ApplyRepository
+	fault *faultStore
+}
+
+func (r faultApplies) SoftDelete(userId, contactId string) error {
+	if err := r.fault.fail("Applies.SoftDelete"); err != nil {
+		return err
+	}
+	return r.ApplyRepository.SoftDelete(userId, contactId)
+}
+
+func (r faultApplies) SoftDeleteByContact(contactId string) error {
+	if err := r.fault.fail("Applies.SoftDeleteByContact"); err != nil {
+		return err
+	}
+	return r.ApplyRepository.SoftDeleteByContact(contactId)
+}
+
+// recordingCache 记录使缓存失效的操作
+type recordingCache struct {
+	cache.Cache
+	mu          sync.Mutex
+	invalidated []string
+}
+
+func (c *recordingCache) record(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidated = append(c.invalidated, key)
+}
+
+// take 返回并清空已记录的key，按字典序
+func (c *recordingCache) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := c.invalidated
+	c.invalidated = nil
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *recordingCache) Del(key string) error {
+	c.record(key)
+	return c.Cache.Del(key)
+}
+
+func (c *recordingCache) DelByPattern(pattern string) error {
+	c.record(pattern)
+	return c.Cache.DelByPattern(pattern)
+}
+
+func (c *recordingCache) DelByPrefix(prefix string) error {
+	c.record(prefix)
+	return c.Cache.DelByPrefix(prefix)
+}
+
+func (c *recordingCache) Incr(key string) (int64, error) {
+	c.record(key)
+	return c.Cache.Incr(key)
+}
+
+// txFixture 一组共用故障点的service，data为底层的内存Store，用来比较数据
+type txFixture struct {
+	*testServices
+	data  *memory.Store
+	fault *faultStore
+	cache *recordingCache
+}
+
+func newTxFixture(t *testing.T, users ...string) *txFixture {
+	t.Helper()
+	data := memory.NewStore()
+	for _, uuid := range users {
+		seedUser(t, data, uuid)
+	}
+	fault := &faultStore{Store: data}
+	c := &recordingCache{Cache: cache.NewMemoryCache()}
+	return &txFixture{testServices: newTestServices(fault, c), data: data, fault: fault, cache: c}
+}
+
+// expectRolledBack 在method的第skip+1次调用时注入故障执行op，断言返回-1、数据没有变化、缓存没有失效
+// 之后去掉故障重新执行op，返回失效的缓存key，确认故障注入在真正会失效缓存的路径上
+func (f *txFixture) expectRolledBack(t *testing.T, method string, skip int, op func() (string, int)) []string {
+	t.Helper()
+	f.cache.take()
+	before := f.data.Clone()
+	f.fault.injectAt(method, skip)
+	if message, ret := op(); ret != -1 {
+		t.Fatalf("%s: ret = %d (%s), want -1", method, ret, message)
+	}
+	if !f.data.Equal(before) {
+		t.Fatalf("%s: data changed after a failed transaction", method)
+	}
+	if keys := f.cache.take(); len(keys) != 0 {
+		t.Fatalf("%s: cache invalidated after a failed transaction: %v", method, keys)
+	}
+
+	f.fault.injectAt("", 0)
+	mustOK(t)(op())
+	if f.data.Equal(before) {
+		t.Fatalf("%s: op changed nothing without the injected failure", method)
+	}
+	keys := f.cache.take()
+	if len(keys) == 0 {
+		t.Fatalf("%s: op invalidated no cache without the injected failure", method)
+	}
+	return keys
+}
+
+// listVersion 列表缓存的版本号key，和cache.Versioned保持一致
+func listVersion(namespace, owner string) string {
+	return "ver:" + namespace + ":" + owner
+}
+
+func expectInvalidated(t *testing.T, keys []string, want ...string) {
+	t.Helper()
+	all := " " + strings.Join(keys, " ") + " "
+	for _, key := range want {
+		if !strings.Contains(all, " "+key+" ") {
+			t.Fatalf("invalidated %v, want %s", keys, key)
+		}
+	}
+}
+
+func TestPassContactApplyRollback(t *testing.T) {
+	f := newTxFixture(t, "U1", "U2")
+	mustOK(t)(f.contact.ApplyContact(request.ApplyContactRequest{OwnerId: "U1", ContactId: "U2"}))
+	// 第一条联系人记录已经写入，第二条失败
+	keys := f.expectRolledBack(t, "Contacts.Create", 1, func() (string, int) {
+		return f.contact.PassContactApply("U2", "U1")
+	})
+	expectInvalidated(t, keys, listVersion(contactUserListCache, "U1"), listVersion(contactUserListCache, "U2"))
+}
+
+func TestDeleteContactRollback(t *testing.T) {
+	f := newTxFixture(t, "U1", "U2")
+	makeFriends(t, f.testServices, "U1", "U2")
+	// 联系人和会话已经删除，最后一条申请记录失败
+	keys := f.expectRolledBack(t, "Applies.SoftDelete", 1, func() (string, int) {
+		return f.contact.DeleteContact("U1", "U2")
+	})
+	expectInvalidated(t, keys, listVersion(contactUserListCache, "U1"), listVersion(sessionListCache, "U2"))
+}
+
+func TestDismissGroupRollback(t *testing.T) {
+	f := newTxFixture(t, "U1", "U2", "U3")
+	groupId := createGroup(t, f.testServices, f.fault, "U1", "U2", "U3")
+	// 群、成员、会话和联系人已经删除，最后清理申请时失败
+	keys := f.expectRolledBack(t, "Applies.SoftDeleteByContact", 0, func() (string, int) {
+		return f.group.DismissGroup("U1", groupId)
+	})
+	expectInvalidated(t, keys, listVersion(myGroupListCache, "U1"), listVersion(myJoinedGroupListCache, "U3"))
+}
+
+func TestRemoveGroupMembersRollback(t *testing.T) {
+	f := newTxFixture(t, "U1", "U2", "U3")
+	groupId := createGroup(t, f.testServices, f.fault, "U1", "U2", "U3")
+	// 第一个成员已经移除，第二个成员的申请记录失败
+	keys := f.expectRolledBack(t, "Applies.SoftDelete", 1, func() (string, int) {
+		return f.group.RemoveGroupMembers(request.RemoveGroupMembersRequest{GroupId: groupId, OwnerId: "U1", UuidList: []string{"U2", "U3"}})
+	})
+	expectInvalidated(t, keys, listVersion(groupSessionListCache, "U2"), listVersion(myJoinedGroupListCache, "U3"))
+}
+
+func TestDeleteUserRollback(t *testing.T) {
+	f := newTxFixture(t, "U1", "U2", "U3", "U9")
+	if err := f.data.Users().UpdateIsAdmin("U9", 1); err != nil {
+		t.Fatal(err)
+	}
+	makeFriends(t, f.testServices, "U1", "U2")
+	createGroup(t, f.testServices, f.fault, "U1", "U3")
+	// 关联数据都已经删除，最后删除用户本身时失败
+	keys := f.expectRolledBack(t, "Users.SoftDelete", 0, func() (string, int) {
+		return f.user.DeleteUsers(request.ManageUsersRequest{Uuid: "U9", UuidList: []string{"U1"}})
+	})
+	expectInvalidated(t, keys, listVersion(contactUserListCache, "U2"), listVersion(myJoinedGroupListCache, "U3"))
+	// 失败的那次不能注销登录，只有成功的那次注销
+	if len(f.tokens.revoked) != 1 || f.tokens.revoked[0] != "U1" {
+		t.Fatalf("revoked = %v, want U1 once", f.tokens.revoked)
+	}
+}
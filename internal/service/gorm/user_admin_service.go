@@ -0,0 +1,274 @@
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"go_chat/internal/dao"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/model"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/enum/contact_status_enum"
+	"go_chat/pkg/enum/user_info/user_status_enum"
+	"go_chat/pkg/zlog"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+	maxManageUsers      = 100 // 一次最多操作的用户数
+)
+
+// checkAdmin 管理员接口先检查操作者身份
+func (u *userInfoService) checkAdmin(uuid string) (string, int) {
+	user, err := u.store.Users().GetByUuid(uuid)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return "用户不存在", -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if user.IsAdmin != 1 {
+		message := "没有管理员权限"
+		zlog.Info(message + "：" + uuid)
+		return message, -2
+	}
+	return "", 0
+}
+
+// manageTargets 检查操作者是管理员，并加载要操作的用户，不存在的uuid直接跳过
+// 不能操作自己；allowAdmin为false时也不能操作其他管理员，需要先取消其管理员身份
+func (u *userInfoService) manageTargets(operatorId string, uuidList []string, allowAdmin bool) ([]*model.UserInfo, string, int) {
+	if message, ret := u.checkAdmin(operatorId); ret != 0 {
+		return nil, message, ret
+	}
+	if len(uuidList) == 0 {
+		return nil, "请选择用户", -2
+	}
+	if len(uuidList) > maxManageUsers {
+		return nil, fmt.Sprintf("一次最多操作%d个用户", maxManageUsers), -2
+	}
+	seen := make(map[string]bool, len(uuidList))
+	var userList []*model.UserInfo
+	for _, uuid := range uuidList {
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+		if uuid == operatorId {
+			return nil, "不能对自己进行该操作", -2
+		}
+		user, err := u.store.Users().GetByUuid(uuid)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				zlog.Info("用户不存在：" + uuid)
+				continue
+			}
+			zlog.Error(err.Error())
+			return nil, constants.SYSTEM_ERROR, -1
+		}
+		if !allowAdmin && user.IsAdmin == 1 {
+			return nil, "不能对管理员进行该操作，请先取消其管理员身份", -2
+		}
+		userList = append(userList, user)
+	}
+	return userList, "", 0
+}
+
+// GetUserInfoList 管理员分页查看用户
+func (u *userInfoService) GetUserInfoList(req request.GetUserInfoListRequest) (string, *respond.GetUserInfoListRespond, int) {
+	if message, ret := u.checkAdmin(req.Uuid); ret != 0 {
+		return message, nil, ret
+	}
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultUserPageSize
+	} else if pageSize > maxUserPageSize {
+		pageSize = maxUserPageSize
+	}
+	page := req.Page
+	if page <= 0 {
+		page = 1
+	}
+	query := dao.UserPageQuery{
+		Keyword: req.Keyword,
+		Status:  req.Status,
+		IsAdmin: req.IsAdmin,
+		Offset:  (page - 1) * pageSize,
+		Limit:   pageSize,
+	}
+	userList, total, err := u.store.Users().Page(query)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp := &respond.GetUserInfoListRespond{
+		UserList: make([]respond.GetUserInfoRespond, 0, len(userList)),
+		Total:    total,
+		HasMore:  int64(query.Offset+len(userList)) < total,
+	}
+	for i := range userList {
+		rsp.UserList = append(rsp.UserList, userInfoRespond(&userList[i]))
+	}
+	return "获取用户列表成功", rsp, 0
+}
+
+// AbleUsers 启用用户，之后可以重新登录
+func (u *userInfoService) AbleUsers(req request.ManageUsersRequest) (string, int) {
+	userList, message, ret := u.manageTargets(req.Uuid, req.UuidList, true)
+	if ret != 0 {
+		return message, ret
+	}
+	for _, user := range userList {
+		if err := u.store.Users().UpdateStatus(user.Uuid, user_status_enum.NORMAL); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+	}
+	return fmt.Sprintf("已启用%d个用户", len(userList)), 0
+}
+
+// DisableUsers 禁用用户，立即下线所有设备，之后无法登录
+func (u *userInfoService) DisableUsers(req request.ManageUsersRequest) (string, int) {
+	userList, message, ret := u.manageTargets(req.Uuid, req.UuidList, false)
+	if ret != 0 {
+		return message, ret
+	}
+	for _, user := range userList {
+		// 先改状态再注销登录，避免注销之后又登录进来
+		if err := u.store.Users().UpdateStatus(user.Uuid, user_status_enum.DISABLE); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		if _, err := u.tokens.RevokeAllSessions(user.Uuid, ""); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		zlog.Info(fmt.Sprintf("管理员%s禁用了用户%s", req.Uuid, user.Uuid))
+	}
+	return fmt.Sprintf("已禁用%d个用户", len(userList)), 0
+}
+
+// DeleteUsers 删除用户，立即下线所有设备
+// 双方的联系人、会话和申请一并删除，退出加入的群聊，创建的群聊解散，聊天记录保留
+func (u *userInfoService) DeleteUsers(req request.ManageUsersRequest) (string, int) {
+	userList, message, ret := u.manageTargets(req.Uuid, req.UuidList, false)
+	if ret != 0 {
+		return message, ret
+	}
+	for _, user := range userList {
+		if err := u.deleteUser(user.Uuid); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		zlog.Info(fmt.Sprintf("管理员%s删除了用户%s", req.Uuid, user.Uuid))
+	}
+	return fmt.Sprintf("已删除%d个用户", len(userList)), 0
+}
+
+// deleteUser 在一个事务里删除用户及其关联数据，提交后注销登录并清缓存
+func (u *userInfoService) deleteUser(uuid string) error {
+	contactList, err := u.store.Contacts().ListByUser(uuid)
+	if err != nil {
+		return err
+	}
+	ownedGroups, err := u.store.Groups().ListByOwner(uuid)
+	if err != nil {
+		return err
+	}
+	owned := make(map[string]bool, len(ownedGroups))
+	// 解散的群聊的成员，事务里会被删掉，先查出来用于清缓存
+	var groupMemberIdList []string
+	for _, group := range ownedGroups {
+		owned[group.Uuid] = true
+		memberIds, err := groupMemberIds(u.store, group.Uuid)
+		if err != nil {
+			return err
+		}
+		groupMemberIdList = append(groupMemberIdList, memberIds...)
+	}
+	var contactUserIds []string
+	err = u.store.Transaction(func(tx dao.Store) error {
+		for _, group := range ownedGroups {
+			if err := tx.Groups().SoftDelete(group.Uuid); err != nil {
+				return err
+			}
+			if err := tx.GroupMembers().DeleteByGroup(group.Uuid); err != nil {
+				return err
+			}
+			if err := tx.Sessions().SoftDeleteByReceiveId(group.Uuid); err != nil {
+				return err
+			}
+			if err := tx.Contacts().SoftDeleteByContact(group.Uuid); err != nil {
+				return err
+			}
+			if err := tx.Applies().SoftDeleteByContact(group.Uuid); err != nil {
+				return err
+			}
+		}
+		for _, contact := range contactList {
+			if contact.ContactId[0] == 'U' {
+				contactUserIds = append(contactUserIds, contact.ContactId)
+				continue
+			}
+			if owned[contact.ContactId] {
+				continue
+			}
+			if _, err := quitGroup(tx, contact.ContactId, uuid, contact_status_enum.QUIT_GROUP); err != nil {
+				return err
+			}
+		}
+		if err := tx.Contacts().SoftDeleteByUser(uuid); err != nil {
+			return err
+		}
+		if err := tx.Contacts().SoftDeleteByContact(uuid); err != nil {
+			return err
+		}
+		if err := tx.Sessions().SoftDeleteBySendId(uuid); err != nil {
+			return err
+		}
+		if err := tx.Sessions().SoftDeleteByReceiveId(uuid); err != nil {
+			return err
+		}
+		if err := tx.Applies().SoftDeleteByUser(uuid); err != nil {
+			return err
+		}
+		if err := tx.Applies().SoftDeleteByContact(uuid); err != nil {
+			return err
+		}
+		return tx.Users().SoftDelete(uuid)
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := u.tokens.RevokeAllSessions(uuid, ""); err != nil {
+		return err
+	}
+	invalidateLists(u.lists, contactUserListCache, contactUserIds...)
+	invalidateLists(u.lists, sessionListCache, contactUserIds...)
+	invalidateLists(u.lists, groupSessionListCache, groupMemberIdList...)
+	invalidateLists(u.lists, myJoinedGroupListCache, groupMemberIdList...)
+	return nil
+}
+
+// SetAdmin 设置或取消管理员，不能修改自己
+func (u *userInfoService) SetAdmin(req request.SetAdminRequest) (string, int) {
+	if req.IsAdmin != 0 && req.IsAdmin != 1 {
+		return "is_admin只能为0或1", -2
+	}
+	userList, message, ret := u.manageTargets(req.Uuid, req.UuidList, true)
+	if ret != 0 {
+		return message, ret
+	}
+	for _, user := range userList {
+		if err := u.store.Users().UpdateIsAdmin(user.Uuid, req.IsAdmin); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+	}
+	if req.IsAdmin == 1 {
+		return fmt.Sprintf("已将%d个用户设为管理员", len(userList)), 0
+	}
+	return fmt.Sprintf("已取消%d个用户的管理员身份", len(userList)), 0
+}
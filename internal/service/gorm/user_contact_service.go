@@ -1,15 +1,13 @@
 package gorm
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"go_chat/internal/dao"
 	"go_chat/internal/dto/request"
 	"go_chat/internal/dto/respond"
 	"go_chat/internal/model"
-	myredis "go_chat/internal/service/redis"
+	"go_chat/internal/service/cache"
 	"go_chat/pkg/constants"
 	"go_chat/pkg/enum/contact_apply/contact_apply_status_enum"
 	"go_chat/pkg/enum/contact_status_enum"
@@ -18,133 +16,83 @@ import (
 	"go_chat/pkg/enum/user_info/user_status_enum"
 	"go_chat/pkg/util/random"
 	"go_chat/pkg/zlog"
-	"gorm.io/gorm"
-	"log"
 	"time"
 )
 
 type userContactService struct {
+	store dao.Store
+	lists *cache.Versioned
 }
 
-var UserContactService = new(userContactService)
+func NewUserContactService(store dao.Store, c cache.Cache) *userContactService {
+	return &userContactService{store: store, lists: cache.NewVersioned(c)}
+}
 
 // GetUserList 获取用户列表
 // 关于用户被禁用的问题，这里查到的是所有联系人，如果被禁用或被拉黑会以弹窗的形式提醒，无法打开会话框；如果被删除，是搜索不到该联系人的。
 func (u *userContactService) GetUserList(ownerId string) (string, []respond.MyUserListRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("contact_user_list_" + ownerId)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-
-			// dao
-			var contactList []model.UserContact
-			// 没有被删除
-			if res := dao.GormDB.Order("created_at DESC").Where("user_id = ? AND status != 4", ownerId).Find(&contactList); res.Error != nil {
-				// 不存在不是业务问题，用Info，return 0
-				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-					message := "目前不存在联系人"
-					zlog.Info(message)
-					return message, nil, 0
-				} else {
-					zlog.Error(res.Error.Error())
-					return constants.SYSTEM_ERROR, nil, -1
-				}
-			}
-			// dto
-			var userListRsp []respond.MyUserListRespond
-			for _, contact := range contactList {
-				// 联系人中是用户的
-				if contact.ContactType == contact_type_enum.USER {
-					// 获取用户信息
-					var user model.UserInfo
-					if res := dao.GormDB.First(&user, "uuid = ?", contact.ContactId); res.Error != nil {
-						// 肯定是存在的，不可能无缘无故删掉，目前不用加notfound的判断
-						zlog.Error(res.Error.Error())
-						return constants.SYSTEM_ERROR, nil, -1
-					}
-					userListRsp = append(userListRsp, respond.MyUserListRespond{
-						UserId:   user.Uuid,
-						UserName: user.Nickname,
-						Avatar:   user.Avatar,
-					})
+	rsp, err := cache.GetOrLoad(u.lists, contactUserListCache, ownerId, listCacheTTL, func() ([]respond.MyUserListRespond, error) {
+		// 没有被删除
+		contactList, err := u.store.Contacts().ListByUser(ownerId, contact_status_enum.DELETE)
+		if err != nil {
+			return nil, err
+		}
+		var userListRsp []respond.MyUserListRespond
+		for _, contact := range contactList {
+			// 联系人中是用户的
+			if contact.ContactType == contact_type_enum.USER {
+				// 肯定是存在的，不可能无缘无故删掉，目前不用加notfound的判断
+				user, err := u.store.Users().GetByUuid(contact.ContactId)
+				if err != nil {
+					return nil, err
 				}
+				userListRsp = append(userListRsp, respond.MyUserListRespond{
+					UserId:   user.Uuid,
+					UserName: user.Nickname,
+					Avatar:   user.Avatar,
+				})
 			}
-			rspString, err := json.Marshal(userListRsp)
-			if err != nil {
-				zlog.Error(err.Error())
-			}
-			if err := myredis.SetKeyEx("contact_user_list_"+ownerId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
-				zlog.Error(err.Error())
-			}
-			return "获取用户列表成功", userListRsp, 0
-		} else {
-			zlog.Error(err.Error())
 		}
-	}
-	var rsp []respond.MyUserListRespond
-	if err := json.Unmarshal([]byte(rspString), &rsp); err != nil {
+		return userListRsp, nil
+	})
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
 	}
 	return "获取用户列表成功", rsp, 0
 }
 
 // LoadMyJoinedGroup 获取我加入的群聊
 func (u *userContactService) LoadMyJoinedGroup(ownerId string) (string, []respond.LoadMyJoinedGroupRespond, int) {
-	rspString, err := myredis.GetKeyNilIsErr("my_joined_group_list_" + ownerId)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			var contactList []model.UserContact
-			// 没有退群，也没有被踢出群聊
-			if res := dao.GormDB.Order("created_at DESC").Where("user_id = ? AND status != 6 AND status != 7", ownerId).Find(&contactList); res.Error != nil {
-				// 不存在不是业务问题，用Info，return 0
-				if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-					message := "目前不存在加入的群聊"
-					zlog.Info(message)
-					return message, nil, 0
-				} else {
-					zlog.Error(res.Error.Error())
-					return constants.SYSTEM_ERROR, nil, -1
-				}
+	rsp, err := cache.GetOrLoad(u.lists, myJoinedGroupListCache, ownerId, listCacheTTL, func() ([]respond.LoadMyJoinedGroupRespond, error) {
+		// 没有退群，也没有被踢出群聊
+		contactList, err := u.store.Contacts().ListByUser(ownerId, contact_status_enum.QUIT_GROUP, contact_status_enum.KICK_OUT_GROUP)
+		if err != nil {
+			return nil, err
+		}
+		var groupListRsp []respond.LoadMyJoinedGroupRespond
+		for _, contact := range contactList {
+			if contact.ContactId[0] != 'G' {
+				continue
 			}
-			var groupList []model.GroupInfo
-			for _, contact := range contactList {
-				if contact.ContactId[0] == 'G' {
-					// 获取群聊信息
-					var group model.GroupInfo
-					if res := dao.GormDB.First(&group, "uuid = ?", contact.ContactId); res.Error != nil {
-						zlog.Error(res.Error.Error())
-						return constants.SYSTEM_ERROR, nil, -1
-					}
-					// 群没被删除，同时群主不是自己
-					// 群主删除或admin删除群聊，status为7，即被踢出群聊，所以不用判断群是否被删除，删除了到不了这步
-					if group.OwnerId != ownerId {
-						groupList = append(groupList, group)
-					}
-				}
+			group, err := u.store.Groups().GetByUuid(contact.ContactId)
+			if err != nil {
+				return nil, err
 			}
-			var groupListRsp []respond.LoadMyJoinedGroupRespond
-			for _, group := range groupList {
+			// 群主不是自己，群被解散时联系人也一起删除了，到不了这步
+			if group.OwnerId != ownerId {
 				groupListRsp = append(groupListRsp, respond.LoadMyJoinedGroupRespond{
 					GroupId:   group.Uuid,
 					GroupName: group.Name,
 					Avatar:    group.Avatar,
 				})
 			}
-			rspString, err := json.Marshal(groupListRsp)
-			if err != nil {
-				zlog.Error(err.Error())
-			}
-			if err := myredis.SetKeyEx("my_joined_group_list_"+ownerId, string(rspString), time.Minute*constants.REDIS_TIMEOUT); err != nil {
-				zlog.Error(err.Error())
-			}
-			return "获取加入群成功", groupListRsp, 0
-		} else {
-			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, nil, -1
 		}
-	}
-	var rsp []respond.LoadMyJoinedGroupRespond
-	if err := json.Unmarshal([]byte(rspString), &rsp); err != nil {
+		return groupListRsp, nil
+	})
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
 	}
 	return "获取加入群成功", rsp, 0
 }
@@ -154,9 +102,14 @@ func (u *userContactService) LoadMyJoinedGroup(ownerId string) (string, []respon
 // redis todo
 func (u *userContactService) GetContactInfo(contactId string) (string, respond.GetContactInfoRespond, int) {
 	if contactId[0] == 'G' {
-		var group model.GroupInfo
-		if res := dao.GormDB.First(&group, "uuid = ?", contactId); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		group, err := u.store.Groups().GetByUuid(contactId)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, respond.GetContactInfoRespond{}, -1
+		}
+		members, err := groupMemberIds(u.store, contactId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, respond.GetContactInfoRespond{}, -1
 		}
 		// 没被禁用
@@ -167,7 +120,7 @@ func (u *userContactService) GetContactInfo(contactId string) (string, respond.G
 				ContactAvatar:    group.Avatar,
 				ContactNotice:    group.Notice,
 				ContactAddMode:   group.AddMode,
-				ContactMembers:   group.Members,
+				ContactMembers:   members,
 				ContactMemberCnt: group.MemberCnt,
 				ContactOwnerId:   group.OwnerId,
 			}, 0
@@ -176,19 +129,18 @@ func (u *userContactService) GetContactInfo(contactId string) (string, respond.G
 			return "该群聊处于禁用状态", respond.GetContactInfoRespond{}, -2
 		}
 	} else {
-		var user model.UserInfo
-		if res := dao.GormDB.First(&user, "uuid = ?", contactId); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		user, err := u.store.Users().GetByUuid(contactId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, respond.GetContactInfoRespond{}, -1
 		}
-		log.Println(user)
 		if user.Status != user_status_enum.DISABLE {
 			return "获取联系人信息成功", respond.GetContactInfoRespond{
 				ContactId:        user.Uuid,
 				ContactName:      user.Nickname,
 				ContactAvatar:    user.Avatar,
 				ContactBirthday:  user.Birthday,
-				ContactEmail:     user.Email,
+				ContactEmail:     user.Email.String,
 				ContactPhone:     user.Telephone,
 				ContactGender:    user.Gender,
 				ContactSignature: user.Signature,
@@ -202,60 +154,48 @@ func (u *userContactService) GetContactInfo(contactId string) (string, respond.G
 
 // DeleteContact 删除联系人（只包含用户）
 func (u *userContactService) DeleteContact(ownerId, contactId string) (string, int) {
-	// status改变为删除
-	var deletedAt gorm.DeletedAt
-	deletedAt.Time = time.Now()
-	deletedAt.Valid = true
-	if res := dao.GormDB.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", ownerId, contactId).Updates(map[string]interface{}{
-		"deleted_at": deletedAt,
-		"status":     contact_status_enum.DELETE,
-	}); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-
-	if res := dao.GormDB.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", contactId, ownerId).Updates(map[string]interface{}{
-		"deleted_at": deletedAt,
-		"status":     contact_status_enum.BE_DELETE,
-	}); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-
-	if res := dao.GormDB.Model(&model.Session{}).Where("send_id = ? AND receive_id = ?", ownerId, contactId).Update("deleted_at", deletedAt); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-
-	if res := dao.GormDB.Model(&model.Session{}).Where("send_id = ? AND receive_id = ?", contactId, ownerId).Update("deleted_at", deletedAt); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	// 联系人添加的记录得删，这样之后再添加就看新的申请记录，如果申请记录结果是拉黑就没法再添加，如果是拒绝可以再添加
-	if res := dao.GormDB.Model(&model.ContactApply{}).Where("contact_id = ? AND user_id = ?", ownerId, contactId).Update("deleted_at", deletedAt); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	if res := dao.GormDB.Model(&model.ContactApply{}).Where("contact_id = ? AND user_id = ?", contactId, ownerId).Update("deleted_at", deletedAt); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	if err := myredis.DelKeysWithPattern("contact_user_list_" + ownerId); err != nil {
+	err := u.store.Transaction(func(tx dao.Store) error {
+		// status改变为删除
+		deleteStatus := int8(contact_status_enum.DELETE)
+		if err := tx.Contacts().SoftDelete(ownerId, contactId, &deleteStatus); err != nil {
+			return err
+		}
+		beDeleteStatus := int8(contact_status_enum.BE_DELETE)
+		if err := tx.Contacts().SoftDelete(contactId, ownerId, &beDeleteStatus); err != nil {
+			return err
+		}
+		if err := tx.Sessions().SoftDeleteByPair(ownerId, contactId); err != nil {
+			return err
+		}
+		if err := tx.Sessions().SoftDeleteByPair(contactId, ownerId); err != nil {
+			return err
+		}
+		// 联系人添加的记录得删，这样之后再添加就看新的申请记录，如果申请记录结果是拉黑就没法再添加，如果是拒绝可以再添加
+		if err := tx.Applies().SoftDelete(contactId, ownerId); err != nil {
+			return err
+		}
+		return tx.Applies().SoftDelete(ownerId, contactId)
+	})
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
 	}
+	// 事务提交后再清缓存，避免并发读把旧数据写回缓存
+	invalidateLists(u.lists, contactUserListCache, ownerId, contactId)
+	invalidateLists(u.lists, sessionListCache, ownerId, contactId)
 	return "删除联系人成功", 0
 }
 
 // ApplyContact 申请添加联系人
 func (u *userContactService) ApplyContact(req request.ApplyContactRequest) (string, int) {
 	if req.ContactId[0] == 'U' {
-		var user model.UserInfo
-		if res := dao.GormDB.First(&user, "uuid = ?", req.ContactId); res.Error != nil {
-			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		user, err := u.store.Users().GetByUuid(req.ContactId)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
 				zlog.Error("用户不存在")
 				return "用户不存在", -2
 			} else {
-				zlog.Error(res.Error.Error())
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, -1
 			}
 		}
@@ -264,10 +204,10 @@ func (u *userContactService) ApplyContact(req request.ApplyContactRequest) (stri
 			zlog.Info("用户已被禁用")
 			return "用户已被禁用", -2
 		}
-		var contactApply model.ContactApply
-		if res := dao.GormDB.Where("user_id = ? AND contact_id = ?", req.OwnerId, req.ContactId).First(&contactApply); res.Error != nil {
-			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-				contactApply = model.ContactApply{
+		contactApply, err := u.store.Applies().Get(req.OwnerId, req.ContactId)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				contactApply = &model.ContactApply{
 					Uuid:        fmt.Sprintf("A%s", random.GetNowAndLenRandomString(11)),
 					UserId:      req.OwnerId,
 					ContactId:   req.ContactId,
@@ -276,12 +216,12 @@ func (u *userContactService) ApplyContact(req request.ApplyContactRequest) (stri
 					Message:     req.Message,
 					LastApplyAt: time.Now(),
 				}
-				if res := dao.GormDB.Create(&contactApply); res.Error != nil {
-					zlog.Error(res.Error.Error())
+				if err := u.store.Applies().Create(contactApply); err != nil {
+					zlog.Error(err.Error())
 					return constants.SYSTEM_ERROR, -1
 				}
 			} else {
-				zlog.Error(res.Error.Error())
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, -1
 			}
 		}
@@ -292,19 +232,19 @@ func (u *userContactService) ApplyContact(req request.ApplyContactRequest) (stri
 		contactApply.LastApplyAt = time.Now()
 		contactApply.Status = contact_apply_status_enum.PENDING
 
-		if res := dao.GormDB.Save(&contactApply); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		if err := u.store.Applies().Save(contactApply); err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, -1
 		}
 		return "申请成功", 0
 	} else if req.ContactId[0] == 'G' {
-		var group model.GroupInfo
-		if res := dao.GormDB.First(&group, "uuid = ?", req.ContactId); res.Error != nil {
-			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		group, err := u.store.Groups().GetByUuid(req.ContactId)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
 				zlog.Error("群聊不存在")
 				return "群聊不存在", -2
 			} else {
-				zlog.Error(res.Error.Error())
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, -1
 			}
 		}
@@ -312,10 +252,10 @@ func (u *userContactService) ApplyContact(req request.ApplyContactRequest) (stri
 			zlog.Info("群聊已被禁用")
 			return "群聊已被禁用", -2
 		}
-		var contactApply model.ContactApply
-		if res := dao.GormDB.Where("user_id = ? AND contact_id = ?", req.OwnerId, req.ContactId).First(&contactApply); res.Error != nil {
-			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-				contactApply = model.ContactApply{
+		contactApply, err := u.store.Applies().Get(req.OwnerId, req.ContactId)
+		if err != nil {
+			if errors.Is(err, dao.ErrRecordNotFound) {
+				contactApply = &model.ContactApply{
 					Uuid:        fmt.Sprintf("A%s", random.GetNowAndLenRandomString(11)),
 					UserId:      req.OwnerId,
 					ContactId:   req.ContactId,
@@ -324,19 +264,19 @@ func (u *userContactService) ApplyContact(req request.ApplyContactRequest) (stri
 					Message:     req.Message,
 					LastApplyAt: time.Now(),
 				}
-				if res := dao.GormDB.Create(&contactApply); res.Error != nil {
-					zlog.Error(res.Error.Error())
+				if err := u.store.Applies().Create(contactApply); err != nil {
+					zlog.Error(err.Error())
 					return constants.SYSTEM_ERROR, -1
 				}
 			} else {
-				zlog.Error(res.Error.Error())
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, -1
 			}
 		}
 		contactApply.LastApplyAt = time.Now()
 
-		if res := dao.GormDB.Save(&contactApply); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		if err := u.store.Applies().Save(contactApply); err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, -1
 		}
 		return "申请成功", 0
@@ -347,15 +287,10 @@ func (u *userContactService) ApplyContact(req request.ApplyContactRequest) (stri
 
 // GetNewContactList 获取新的联系人申请列表
 func (u *userContactService) GetNewContactList(ownerId string) (string, []respond.NewContactListRespond, int) {
-	var contactApplyList []model.ContactApply
-	if res := dao.GormDB.Where("contact_id = ? AND status = ?", ownerId, contact_apply_status_enum.PENDING).Find(&contactApplyList); res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			zlog.Info("没有在申请的联系人")
-			return "没有在申请的联系人", nil, 0
-		} else {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, nil, -1
-		}
+	contactApplyList, err := u.store.Applies().ListPendingByContact(ownerId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
 	}
 	var rsp []respond.NewContactListRespond
 	// 所有contact都没被删除
@@ -370,8 +305,9 @@ func (u *userContactService) GetNewContactList(ownerId string) (string, []respon
 			ContactId: contactApply.Uuid,
 			Message:   message,
 		}
-		var user model.UserInfo
-		if res := dao.GormDB.First(&user, "uuid = ?", contactApply.UserId); res.Error != nil {
+		user, err := u.store.Users().GetByUuid(contactApply.UserId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, nil, -1
 		}
 		newContact.ContactId = user.Uuid
@@ -385,142 +321,124 @@ func (u *userContactService) GetNewContactList(ownerId string) (string, []respon
 // PassContactApply 通过联系人申请
 func (u *userContactService) PassContactApply(ownerId string, contactId string) (string, int) {
 	// ownerId 如果是用户的话就是登录用户，如果是群聊的话就是群聊id
-	var contactApply model.ContactApply
-	if res := dao.GormDB.Where("contact_id = ? AND user_id = ?", ownerId, contactId).First(&contactApply); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	contactApply, err := u.store.Applies().Get(contactId, ownerId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	if ownerId[0] == 'U' {
-		var user model.UserInfo
-		if res := dao.GormDB.Where("uuid = ?", contactId).Find(&user); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		user, err := u.store.Users().GetByUuid(contactId)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
 		}
 		if user.Status == user_status_enum.DISABLE {
 			zlog.Error("用户已被禁用")
 			return "用户已被禁用", -2
 		}
 		contactApply.Status = contact_apply_status_enum.AGREE
-		if res := dao.GormDB.Save(&contactApply); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		newContact := model.UserContact{
-			UserId:      ownerId,
-			ContactId:   contactId,
-			ContactType: contact_type_enum.USER,     // 用户
-			Status:      contact_status_enum.NORMAL, // 正常
-			CreatedAt:   time.Now(),
-			UpdateAt:    time.Now(),
-		}
-		if res := dao.GormDB.Create(&newContact); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		anotherContact := model.UserContact{
-			UserId:      contactId,
-			ContactId:   ownerId,
-			ContactType: contact_type_enum.USER,     // 用户
-			Status:      contact_status_enum.NORMAL, // 正常
-			CreatedAt:   newContact.CreatedAt,
-			UpdateAt:    newContact.UpdateAt,
-		}
-		if res := dao.GormDB.Create(&anotherContact); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		if err := myredis.DelKeysWithPattern("contact_user_list_" + ownerId); err != nil {
+		err = u.store.Transaction(func(tx dao.Store) error {
+			if err := tx.Applies().Save(contactApply); err != nil {
+				return err
+			}
+			newContact := model.UserContact{
+				UserId:      ownerId,
+				ContactId:   contactId,
+				ContactType: contact_type_enum.USER,     // 用户
+				Status:      contact_status_enum.NORMAL, // 正常
+				CreatedAt:   time.Now(),
+				UpdateAt:    time.Now(),
+			}
+			if err := tx.Contacts().Create(&newContact); err != nil {
+				return err
+			}
+			anotherContact := model.UserContact{
+				UserId:      contactId,
+				ContactId:   ownerId,
+				ContactType: contact_type_enum.USER,     // 用户
+				Status:      contact_status_enum.NORMAL, // 正常
+				CreatedAt:   newContact.CreatedAt,
+				UpdateAt:    newContact.UpdateAt,
+			}
+			return tx.Contacts().Create(&anotherContact)
+		})
+		if err != nil {
 			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
 		}
+		invalidateLists(u.lists, contactUserListCache, ownerId, contactId)
 		return "已添加该联系人", 0
 	} else {
-		var group model.GroupInfo
-		if res := dao.GormDB.Where("uuid = ?", ownerId).Find(&group); res.Error != nil {
-			zlog.Error(res.Error.Error())
+		group, err := u.store.Groups().GetByUuid(ownerId)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
 		}
 		if group.Status == group_status_enum.DISABLE {
 			zlog.Error("群聊已被禁用")
 			return "群聊已被禁用", -2
 		}
-		contactApply.Status = contact_apply_status_enum.AGREE
-		if res := dao.GormDB.Save(&contactApply); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		// 群聊就只用创建一个UserContact，因为一个UserContact足以表达双方的状态
-		newContact := model.UserContact{
-			UserId:      contactId,
-			ContactId:   ownerId,
-			ContactType: contact_type_enum.GROUP,    // 用户
-			Status:      contact_status_enum.NORMAL, // 正常
-			CreatedAt:   time.Now(),
-			UpdateAt:    time.Now(),
-		}
-		if res := dao.GormDB.Create(&newContact); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		var members []string
-		if err := json.Unmarshal(group.Members, &members); err != nil {
+		isMember, err := isGroupMember(u.store, ownerId, contactId)
+		if err != nil {
 			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, -1
 		}
-		members = append(members, contactId)
-		group.MemberCnt = len(members)
-		group.Members, _ = json.Marshal(members)
-		if res := dao.GormDB.Save(&group); res.Error != nil {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, -1
-		}
-		if err := myredis.DelKeysWithPattern("my_joined_group_list_" + ownerId); err != nil {
+		contactApply.Status = contact_apply_status_enum.AGREE
+		err = u.store.Transaction(func(tx dao.Store) error {
+			if err := tx.Applies().Save(contactApply); err != nil {
+				return err
+			}
+			// 已经在群里的只更新申请状态
+			if isMember {
+				return nil
+			}
+			return joinGroup(tx, ownerId, contactId)
+		})
+		if err != nil {
 			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
 		}
+		invalidateLists(u.lists, myJoinedGroupListCache, contactId)
 		return "已通过加群申请", 0
 	}
 }
 
 // BlackContact 拉黑联系人
 func (u *userContactService) BlackContact(ownerId string, contactId string) (string, int) {
-	// 拉黑
-	if res := dao.GormDB.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", ownerId, contactId).Updates(map[string]interface{}{
-		"status":    contact_status_enum.BLACK,
-		"update_at": time.Now(),
-	}); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	// 被拉黑
-	if res := dao.GormDB.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", contactId, ownerId).Updates(map[string]interface{}{
-		"status":    contact_status_enum.BE_BLACK,
-		"update_at": time.Now(),
-	}); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	// 删除会话
-	var deletedAt gorm.DeletedAt
-	deletedAt.Time = time.Now()
-	deletedAt.Valid = true
-	if res := dao.GormDB.Model(&model.Session{}).Where("send_id = ? AND receive_id = ?", ownerId, contactId).Update("deleted_at", deletedAt); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	err := u.store.Transaction(func(tx dao.Store) error {
+		// 拉黑
+		if err := tx.Contacts().UpdateStatus(ownerId, contactId, contact_status_enum.BLACK); err != nil {
+			return err
+		}
+		// 被拉黑
+		if err := tx.Contacts().UpdateStatus(contactId, ownerId, contact_status_enum.BE_BLACK); err != nil {
+			return err
+		}
+		// 删除会话
+		return tx.Sessions().SoftDeleteByPair(ownerId, contactId)
+	})
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
+	invalidateLists(u.lists, sessionListCache, ownerId)
 	return "已拉黑该联系人", 0
 }
 
 // CancelBlackContact 取消拉黑联系人
 func (u *userContactService) CancelBlackContact(ownerId string, contactId string) (string, int) {
 	// 因为前端的设定，这里需要判断一下ownerId和contactId是不是有拉黑和被拉黑的状态
-	var blackContact model.UserContact
-	if res := dao.GormDB.Where("user_id = ? AND contact_id = ?", ownerId, contactId).First(&blackContact); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	blackContact, err := u.store.Contacts().Get(ownerId, contactId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	if blackContact.Status != contact_status_enum.BLACK {
 		return "未拉黑该联系人，无需解除拉黑", -2
 	}
-	var beBlackContact model.UserContact
-	if res := dao.GormDB.Where("user_id = ? AND contact_id = ?", contactId, ownerId).First(&beBlackContact); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	beBlackContact, err := u.store.Contacts().Get(contactId, ownerId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	if beBlackContact.Status != contact_status_enum.BE_BLACK {
@@ -530,12 +448,14 @@ func (u *userContactService) CancelBlackContact(ownerId string, contactId string
 	// 取消拉黑
 	blackContact.Status = contact_status_enum.NORMAL
 	beBlackContact.Status = contact_status_enum.NORMAL
-	if res := dao.GormDB.Save(&blackContact); res.Error != nil {
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
-	if res := dao.GormDB.Save(&beBlackContact); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	err = u.store.Transaction(func(tx dao.Store) error {
+		if err := tx.Contacts().Save(blackContact); err != nil {
+			return err
+		}
+		return tx.Contacts().Save(beBlackContact)
+	})
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	return "已解除拉黑该联系人", 0
@@ -544,15 +464,10 @@ func (u *userContactService) CancelBlackContact(ownerId string, contactId string
 // GetAddGroupList 获取新的加群列表
 // 前端已经判断调用接口的用户是群主，也只有群主才能调用这个接口
 func (u *userContactService) GetAddGroupList(groupId string) (string, []respond.AddGroupListRespond, int) {
-	var contactApplyList []model.ContactApply
-	if res := dao.GormDB.Where("contact_id = ? AND status = ?", groupId, contact_apply_status_enum.PENDING).Find(&contactApplyList); res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			zlog.Info("没有在申请的联系人")
-			return "没有在申请的联系人", nil, 0
-		} else {
-			zlog.Error(res.Error.Error())
-			return constants.SYSTEM_ERROR, nil, -1
-		}
+	contactApplyList, err := u.store.Applies().ListPendingByContact(groupId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
 	}
 	var rsp []respond.AddGroupListRespond
 	for _, contactApply := range contactApplyList {
@@ -566,8 +481,9 @@ func (u *userContactService) GetAddGroupList(groupId string) (string, []respond.
 			ContactId: contactApply.Uuid,
 			Message:   message,
 		}
-		var user model.UserInfo
-		if res := dao.GormDB.First(&user, "uuid = ?", contactApply.UserId); res.Error != nil {
+		user, err := u.store.Users().GetByUuid(contactApply.UserId)
+		if err != nil {
+			zlog.Error(err.Error())
 			return constants.SYSTEM_ERROR, nil, -1
 		}
 		newContact.ContactId = user.Uuid
@@ -581,14 +497,14 @@ func (u *userContactService) GetAddGroupList(groupId string) (string, []respond.
 // RefuseContactApply 拒绝联系人申请
 func (u *userContactService) RefuseContactApply(ownerId string, contactId string) (string, int) {
 	// ownerId 如果是用户的话就是登录用户，如果是群聊的话就是群聊id
-	var contactApply model.ContactApply
-	if res := dao.GormDB.Where("contact_id = ? AND user_id = ?", ownerId, contactId).First(&contactApply); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	contactApply, err := u.store.Applies().Get(contactId, ownerId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	contactApply.Status = contact_apply_status_enum.REFUSE
-	if res := dao.GormDB.Save(&contactApply); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	if err := u.store.Applies().Save(contactApply); err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	if ownerId[0] == 'U' {
@@ -601,14 +517,14 @@ func (u *userContactService) RefuseContactApply(ownerId string, contactId string
 
 // BlackApply 拉黑申请
 func (u *userContactService) BlackApply(ownerId string, contactId string) (string, int) {
-	var contactApply model.ContactApply
-	if res := dao.GormDB.Where("contact_id = ? AND user_id = ?", ownerId, contactId).First(&contactApply); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	contactApply, err := u.store.Applies().Get(contactId, ownerId)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	contactApply.Status = contact_apply_status_enum.BLACK
-	if res := dao.GormDB.Save(&contactApply); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	if err := u.store.Applies().Save(contactApply); err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	return "已拉黑该申请", 0
@@ -0,0 +1,413 @@
+package gorm
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go_chat/internal/config"
+	"go_chat/internal/dao"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/model"
+	"go_chat/internal/service/cache"
+	"go_chat/internal/service/mail"
+	"go_chat/pkg/constants"
+	passwordutil "go_chat/pkg/util/password"
+	"go_chat/pkg/util/random"
+	"go_chat/pkg/zlog"
+	netmail "net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	emailCodeExpire     = 10 * time.Minute
+	passwordResetExpire = 30 * time.Minute
+	maxEmailLen         = 100 // 和user_info.email字段长度一致
+)
+
+// emailVerify 待验证的新邮箱，验证通过前user_info中仍为原邮箱
+type emailVerify struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+// normalizeEmail 邮箱统一小写，避免大小写不同被当成两个邮箱
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkEmailFormat 只接受纯地址，不接受"名字 <地址>"的形式
+func (u *userInfoService) checkEmailFormat(email string) (string, int) {
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > maxEmailLen {
+		message := "邮箱格式不正确"
+		zlog.Info(message + "：" + email)
+		return message, -2
+	}
+	return "", 0
+}
+
+// emailTakenMessage 邮箱已被其他账号使用时的提示
+const emailTakenMessage = "该邮箱已被其他账号绑定"
+
+// checkEmailBound 邮箱已被其他账号验证过时不能再绑定
+func (u *userInfoService) checkEmailBound(email, uuid string) (string, int) {
+	user, err := u.store.Users().GetByVerifiedEmail(email)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return "", 0
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if user.Uuid != uuid {
+		zlog.Info(emailTakenMessage + "：" + email)
+		return emailTakenMessage, -2
+	}
+	return "", 0
+}
+
+// sendEmailVerify 生成验证码并发送到新邮箱，新验证码会覆盖之前未验证的邮箱
+func (u *userInfoService) sendEmailVerify(uuid, email, clientIp string) (string, int) {
+	if message, ret := u.guard.AllowEmailSend(email, clientIp); ret != 0 {
+		return message, ret
+	}
+	key := "email_verify_" + uuid
+	pending := emailVerify{Email: email, Code: strconv.Itoa(random.GetRandomInt(6))}
+	value, err := json.Marshal(pending)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.cache.Set(key, string(value), emailCodeExpire); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.guard.ResetCodeAttempts(key); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := mail.MailService.SendVerifyCode(email, pending.Code, emailCodeExpire); err != nil {
+		zlog.Error(err.Error())
+		if err := u.cache.Del(key); err != nil {
+			zlog.Error(err.Error())
+		}
+		return "验证邮件发送失败，请稍后重试", -1
+	}
+	return "", 0
+}
+
+// checkEmailCode 校验缓存中的验证码，错误次数用完后验证码作废
+// 返回-2时验证码不存在或不正确，调用方统一提示
+func (u *userInfoService) checkEmailCode(key, code, input string) (string, int) {
+	if code == "" || input == "" {
+		message := "验证码不正确，请重试"
+		zlog.Info(message)
+		return message, -2
+	}
+	if code != input {
+		exhausted, err := u.guard.CodeFailed(key, emailCodeExpire)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		if !exhausted {
+			message := "验证码不正确，请重试"
+			zlog.Info(message)
+			return message, -2
+		}
+		if err := u.cache.Del(key); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		message := "验证码错误次数过多，请重新获取"
+		zlog.Info(message + "：" + key)
+		return message, -3
+	}
+	if err := u.cache.Del(key); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.guard.ResetCodeAttempts(key); err != nil {
+		zlog.Error(err.Error())
+	}
+	return "", 0
+}
+
+// VerifyEmail 输入新邮箱收到的验证码，通过后才真正修改邮箱
+func (u *userInfoService) VerifyEmail(req request.VerifyEmailRequest) (string, int) {
+	key := "email_verify_" + req.Uuid
+	value, err := u.cache.Get(key)
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	var pending emailVerify
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &pending); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+	}
+	if message, ret := u.checkEmailCode(key, pending.Code, req.Code); ret != 0 {
+		return message, ret
+	}
+	// 发送验证码之后邮箱可能已被其他账号抢先验证
+	if message, ret := u.checkEmailBound(pending.Email, req.Uuid); ret != 0 {
+		return message, ret
+	}
+	user, err := u.store.Users().GetByUuid(req.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	user.Email = sql.NullString{String: pending.Email, Valid: true}
+	user.EmailVerified = 1
+	if err := u.store.Users().Save(user); err != nil {
+		// 检查之后仍可能被其他账号抢先写入，由唯一索引兜底
+		if errors.Is(err, dao.ErrDuplicatedKey) {
+			zlog.Info(emailTakenMessage + "：" + pending.Email)
+			return emailTakenMessage, -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.cache.Del("user_info_" + req.Uuid); err != nil {
+		zlog.Error(err.Error())
+	}
+	return "邮箱验证成功", 0
+}
+
+// SendEmailCode 发送邮箱登录验证码
+// 邮箱未绑定时也返回相同的提示，避免被用来探测邮箱是否注册
+func (u *userInfoService) SendEmailCode(req request.SendEmailCodeRequest) (string, int) {
+	email := normalizeEmail(req.Email)
+	if message, ret := u.checkEmailFormat(email); ret != 0 {
+		return message, ret
+	}
+	if message, ret := u.guard.AllowEmailSend(email, req.ClientIp); ret != 0 {
+		return message, ret
+	}
+	message := "如果该邮箱已绑定账号，验证码将发送至该邮箱，请注意查收"
+	if _, err := u.store.Users().GetByVerifiedEmail(email); err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Info("邮箱未绑定账号：" + email)
+			return message, 0
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	key := "email_code_" + email
+	code := strconv.Itoa(random.GetRandomInt(6))
+	if err := u.cache.Set(key, code, emailCodeExpire); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.guard.ResetCodeAttempts(key); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := mail.MailService.SendLoginCode(email, code, emailCodeExpire); err != nil {
+		zlog.Error(err.Error())
+		if err := u.cache.Del(key); err != nil {
+			zlog.Error(err.Error())
+		}
+		return "邮件发送失败，请稍后重试", -1
+	}
+	return message, 0
+}
+
+// EmailLogin 邮箱登录，支持密码或验证码，只有验证过的邮箱可以登录
+// 密码错误次数和手机号登录共用，按账号的手机号计数
+func (u *userInfoService) EmailLogin(req request.EmailLoginRequest) (string, *respond.LoginRespond, int) {
+	email := normalizeEmail(req.Email)
+	if (req.Password == "") == (req.EmailCode == "") {
+		message := "请输入密码或验证码"
+		zlog.Info(message)
+		return message, nil, -2
+	}
+	if message, ret := u.guard.AllowLogin(email, req.ClientIp); ret != 0 {
+		return message, nil, ret
+	}
+	if req.EmailCode != "" {
+		return u.emailCodeLogin(email, req)
+	}
+	user, err := u.store.Users().GetByVerifiedEmail(email)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			message := "邮箱或密码不正确"
+			zlog.Info(message + "：" + email)
+			return message, nil, -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if message, ret := u.guard.CheckLockout(user.Telephone); ret != 0 {
+		return message, nil, ret
+	}
+	ok, needRehash := passwordutil.Verify(user.Password, req.Password)
+	if !ok {
+		message, ret := u.guard.PasswordFailed(user.Telephone)
+		zlog.Info(message)
+		if ret == -2 {
+			message = "邮箱或密码不正确"
+		}
+		return message, nil, ret
+	}
+	u.guard.PasswordSucceeded(user.Telephone)
+	if needRehash {
+		u.rehashPassword(user, req.Password)
+	}
+	return u.loginRespond(user, req.DeviceInfo, req.ClientIp)
+}
+
+// emailCodeLogin 先校验验证码，邮箱未绑定时不会有验证码，提示和验证码错误相同
+func (u *userInfoService) emailCodeLogin(email string, req request.EmailLoginRequest) (string, *respond.LoginRespond, int) {
+	key := "email_code_" + email
+	code, err := u.cache.Get(key)
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if message, ret := u.checkEmailCode(key, code, req.EmailCode); ret != 0 {
+		return message, nil, ret
+	}
+	user, err := u.store.Users().GetByVerifiedEmail(email)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			message := "验证码不正确，请重试"
+			zlog.Info("邮箱已解绑：" + email)
+			return message, nil, -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	return u.loginRespond(user, req.DeviceInfo, req.ClientIp)
+}
+
+// resetTokenKey 缓存中只保存token的哈希，缓存泄露时token不能直接使用
+func resetTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "password_reset_" + hex.EncodeToString(sum[:])
+}
+
+// ForgotPassword 发送重置密码链接到已验证的邮箱
+// 邮箱未绑定时也返回相同的提示
+func (u *userInfoService) ForgotPassword(req request.ForgotPasswordRequest) (string, int) {
+	email := normalizeEmail(req.Email)
+	if message, ret := u.checkEmailFormat(email); ret != 0 {
+		return message, ret
+	}
+	if message, ret := u.guard.AllowEmailSend(email, req.ClientIp); ret != 0 {
+		return message, ret
+	}
+	message := "如果该邮箱已绑定账号，重置密码的链接将发送至该邮箱，请注意查收"
+	user, err := u.store.Users().GetByVerifiedEmail(email)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			zlog.Info("邮箱未绑定账号：" + email)
+			return message, 0
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	token := hex.EncodeToString(buf)
+	key := resetTokenKey(token)
+	if err := u.cache.Set(key, user.Uuid, passwordResetExpire); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	link := config.GetConfig().PasswordResetURL + token
+	if err := mail.MailService.SendPasswordReset(email, link, passwordResetExpire); err != nil {
+		zlog.Error(err.Error())
+		if err := u.cache.Del(key); err != nil {
+			zlog.Error(err.Error())
+		}
+		return "邮件发送失败，请稍后重试", -1
+	}
+	return message, 0
+}
+
+// ResetPassword 通过邮件中的链接重置密码，token只能使用一次
+// 重置后解除密码错误导致的锁定，并下线所有设备
+func (u *userInfoService) ResetPassword(req request.ResetPasswordRequest) (string, int) {
+	if message, ret := u.checkPasswordFormat(req.NewPassword); ret != 0 {
+		return message, ret
+	}
+	invalid := "链接无效或已过期，请重新找回密码"
+	if req.Token == "" {
+		zlog.Info(invalid)
+		return invalid, -2
+	}
+	key := resetTokenKey(req.Token)
+	uuid, err := u.cache.Get(key)
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			zlog.Info(invalid)
+			return invalid, -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	// 并发使用同一个token时只有一个请求能拿到
+	ok, err := u.cache.SetNX(key+"_used", "1", passwordResetExpire)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if !ok {
+		zlog.Info(invalid)
+		return invalid, -2
+	}
+	if err := u.cache.Del(key); err != nil {
+		zlog.Error(err.Error())
+	}
+	user, err := u.store.Users().GetByUuid(uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	hashed, err := passwordutil.Hash(req.NewPassword)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.store.Users().UpdatePassword(user.Uuid, hashed); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	u.guard.ResetLockout(user.Telephone)
+	if _, err := u.tokens.RevokeAllSessions(user.Uuid, ""); err != nil {
+		zlog.Error(err.Error())
+	}
+	return "重置密码成功，请重新登录", 0
+}
+
+// updateEmail UpdateUserInfo中修改邮箱，邮箱不变且已验证时不处理
+// 返回的bool表示是否发送了验证邮件
+func (u *userInfoService) updateEmail(user *model.UserInfo, email, clientIp string) (bool, string, int) {
+	email = normalizeEmail(email)
+	if email == "" || (email == user.Email.String && user.EmailVerified == 1) {
+		return false, "", 0
+	}
+	if message, ret := u.checkEmailFormat(email); ret != 0 {
+		return false, message, ret
+	}
+	if message, ret := u.checkEmailBound(email, user.Uuid); ret != 0 {
+		return false, message, ret
+	}
+	if message, ret := u.sendEmailVerify(user.Uuid, email, clientIp); ret != 0 {
+		return false, message, ret
+	}
+	return true, "", 0
+}
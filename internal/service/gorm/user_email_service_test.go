@@ -0,0 +1,236 @@
+package gorm
+
+import (
+	"database/sql"
+	"go_chat/internal/dao/memory"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/service/cache"
+	"go_chat/internal/service/mail"
+	"go_chat/internal/service/mail/mailtest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ttlCache 记录每个key的过期时间，expire模拟key到期
+type ttlCache struct {
+	cache.Cache
+	mu      sync.Mutex
+	expires map[string]time.Duration
+}
+
+func (c *ttlCache) Set(key string, value string, expiration time.Duration) error {
+	c.mu.Lock()
+	c.expires[key] = expiration
+	c.mu.Unlock()
+	return c.Cache.Set(key, value, expiration)
+}
+
+// expire 断言key按want过期，然后删除它
+func (c *ttlCache) expire(t *testing.T, key string, want time.Duration) {
+	t.Helper()
+	c.mu.Lock()
+	got, ok := c.expires[key]
+	c.mu.Unlock()
+	if !ok || got != want {
+		t.Fatalf("%s expires in %v (set %v), want %v", key, got, ok, want)
+	}
+	if err := c.Cache.Del(key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type emailFixture struct {
+	*testServices
+	store  *memory.Store
+	cache  *ttlCache
+	server *mailtest.Server
+}
+
+// newEmailFixture 邮件经由SMTP发到进程内的mailtest服务
+func newEmailFixture(t *testing.T, users ...string) *emailFixture {
+	t.Helper()
+	server := mailtest.NewServer(t)
+	mailer, err := mail.NewSMTPMailer(server.Host(), server.Port(), "", "", "none", "noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := mail.MailService
+	mail.Init(mailer)
+	t.Cleanup(func() { mail.MailService = previous })
+
+	store := memory.NewStore()
+	for _, uuid := range users {
+		seedUser(t, store, uuid)
+	}
+	c := &ttlCache{Cache: cache.NewMemoryCache(), expires: make(map[string]time.Duration)}
+	return &emailFixture{testServices: newTestServices(store, c), store: store, cache: c, server: server}
+}
+
+// bindEmail 直接写入已验证的邮箱
+func (f *emailFixture) bindEmail(t *testing.T, uuid, email string) {
+	t.Helper()
+	f.writeEmail(t, uuid, email, 1)
+}
+
+// writeEmail 绕过验证直接写入邮箱
+func (f *emailFixture) writeEmail(t *testing.T, uuid, email string, verified int8) {
+	t.Helper()
+	user, err := f.store.Users().GetByUuid(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Email, user.EmailVerified = sql.NullString{String: email, Valid: true}, verified
+	if err := f.store.Users().Save(user); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var (
+	mailCodePattern  = regexp.MustCompile(`验证码为 (\d+) `)
+	mailTokenPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+)
+
+// lastMail 发给to的最后一封邮件中匹配pattern的部分，有分组时返回第一个分组
+func (f *emailFixture) lastMail(t *testing.T, to string, pattern *regexp.Regexp) string {
+	t.Helper()
+	message, ok := f.server.Last(to)
+	if !ok {
+		t.Fatalf("no mail for %s", to)
+	}
+	match := pattern.FindStringSubmatch(message.Body)
+	if match == nil {
+		t.Fatalf("mail for %s does not match %s: %s", to, pattern, message.Body)
+	}
+	return match[len(match)-1]
+}
+
+func TestVerifyEmail(t *testing.T) {
+	f := newEmailFixture(t, "U1", "U2")
+	mustOK(t)(f.user.UpdateUserInfo(request.UpdateUserInfoRequest{Uuid: "U1", Email: " Alice@Example.com "}))
+	// 验证前不修改邮箱
+	if user, _ := f.store.Users().GetByUuid("U1"); user.Email.Valid || user.EmailVerified != 0 {
+		t.Fatalf("email changed before verification: %s %d", user.Email.String, user.EmailVerified)
+	}
+	code := f.lastMail(t, "alice@example.com", mailCodePattern)
+
+	if _, ret := f.user.VerifyEmail(request.VerifyEmailRequest{Uuid: "U1", Code: code + "0"}); ret != -2 {
+		t.Fatalf("wrong code ret = %d, want -2", ret)
+	}
+	mustOK(t)(f.user.VerifyEmail(request.VerifyEmailRequest{Uuid: "U1", Code: code}))
+	if user, _ := f.store.Users().GetByUuid("U1"); user.Email.String != "alice@example.com" || user.EmailVerified != 1 {
+		t.Fatalf("email after verification = %s %d", user.Email.String, user.EmailVerified)
+	}
+	if _, ret := f.user.VerifyEmail(request.VerifyEmailRequest{Uuid: "U1", Code: code}); ret != -2 {
+		t.Fatalf("reused code ret = %d, want -2", ret)
+	}
+
+	// 已被验证的邮箱不能再绑定到其他账号，也不发邮件
+	sent := len(f.server.Messages())
+	if _, ret := f.user.UpdateUserInfo(request.UpdateUserInfoRequest{Uuid: "U2", Email: "alice@example.com"}); ret != -2 {
+		t.Fatalf("bind a taken email ret = %d, want -2", ret)
+	}
+	if len(f.server.Messages()) != sent {
+		t.Fatal("verification mail sent for a taken email")
+	}
+
+	// 验证码过期后不能再使用
+	mustOK(t)(f.user.UpdateUserInfo(request.UpdateUserInfoRequest{Uuid: "U2", Email: "bob@example.com"}))
+	code = f.lastMail(t, "bob@example.com", mailCodePattern)
+	f.cache.expire(t, "email_verify_U2", emailCodeExpire)
+	if _, ret := f.user.VerifyEmail(request.VerifyEmailRequest{Uuid: "U2", Code: code}); ret != -2 {
+		t.Fatalf("expired code ret = %d, want -2", ret)
+	}
+}
+
+// TestVerifyEmailTaken 邮箱已被其他账号写入但未验证时，检查放行，由唯一索引拒绝
+func TestVerifyEmailTaken(t *testing.T) {
+	f := newEmailFixture(t, "U1", "U2")
+	f.writeEmail(t, "U1", "carol@example.com", 0)
+
+	mustOK(t)(f.user.UpdateUserInfo(request.UpdateUserInfoRequest{Uuid: "U2", Email: "carol@example.com"}))
+	code := f.lastMail(t, "carol@example.com", mailCodePattern)
+	if message, ret := f.user.VerifyEmail(request.VerifyEmailRequest{Uuid: "U2", Code: code}); ret != -2 || message != emailTakenMessage {
+		t.Fatalf("verify a taken email = %s, %d, want -2 %s", message, ret, emailTakenMessage)
+	}
+	if user, _ := f.store.Users().GetByUuid("U2"); user.Email.Valid || user.EmailVerified != 0 {
+		t.Fatalf("U2 email = %s %d, want unchanged", user.Email.String, user.EmailVerified)
+	}
+
+	// 注销的账号解绑邮箱，邮箱可以被其他账号绑定
+	if err := f.store.Users().SoftDelete("U1"); err != nil {
+		t.Fatal(err)
+	}
+	mustOK(t)(f.user.UpdateUserInfo(request.UpdateUserInfoRequest{Uuid: "U2", Email: "carol@example.com"}))
+	mustOK(t)(f.user.VerifyEmail(request.VerifyEmailRequest{Uuid: "U2", Code: f.lastMail(t, "carol@example.com", mailCodePattern)}))
+}
+
+func TestEmailCodeLogin(t *testing.T) {
+	f := newEmailFixture(t, "U1")
+	f.bindEmail(t, "U1", "alice@example.com")
+
+	// 未绑定的邮箱返回相同的提示，但不发邮件
+	mustOK(t)(f.user.SendEmailCode(request.SendEmailCodeRequest{Email: "nobody@example.com"}))
+	if messages := f.server.Messages(); len(messages) != 0 {
+		t.Fatalf("mail sent to an unbound email: %+v", messages)
+	}
+
+	mustOK(t)(f.user.SendEmailCode(request.SendEmailCodeRequest{Email: "Alice@example.com"}))
+	code := f.lastMail(t, "alice@example.com", mailCodePattern)
+	login := request.EmailLoginRequest{Email: "alice@example.com", EmailCode: code, DeviceInfo: request.DeviceInfo{DeviceId: "d1", Platform: "web"}}
+	message, rsp, ret := f.user.EmailLogin(login)
+	mustOK(t)(message, ret)
+	if rsp.Uuid != "U1" || rsp.AccessToken != "access-U1" {
+		t.Fatalf("login respond = %+v", rsp)
+	}
+	// 验证码只能使用一次
+	if _, _, ret := f.user.EmailLogin(login); ret != -2 {
+		t.Fatalf("reused code ret = %d, want -2", ret)
+	}
+
+	mustOK(t)(f.user.SendEmailCode(request.SendEmailCodeRequest{Email: "alice@example.com"}))
+	login.EmailCode = f.lastMail(t, "alice@example.com", mailCodePattern)
+	f.cache.expire(t, "email_code_alice@example.com", emailCodeExpire)
+	if _, _, ret := f.user.EmailLogin(login); ret != -2 {
+		t.Fatalf("expired code ret = %d, want -2", ret)
+	}
+	if len(f.tokens.issued) != 1 {
+		t.Fatalf("issued %d sessions, want 1", len(f.tokens.issued))
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	f := newEmailFixture(t, "U1")
+	f.bindEmail(t, "U1", "alice@example.com")
+	user, _ := f.store.Users().GetByUuid("U1")
+
+	mustOK(t)(f.user.ForgotPassword(request.ForgotPasswordRequest{Email: "alice@example.com"}))
+	token := f.lastMail(t, "alice@example.com", mailTokenPattern)
+	mustOK(t)(f.user.ResetPassword(request.ResetPasswordRequest{Token: token, NewPassword: "NewPassw0rd!"}))
+	if len(f.tokens.revoked) != 1 || f.tokens.revoked[0] != "U1" {
+		t.Fatalf("revoked = %v, want U1", f.tokens.revoked)
+	}
+	if message, _, ret := f.user.Login(request.LoginRequest{Telephone: user.Telephone, Password: "NewPassw0rd!"}); ret != 0 {
+		t.Fatalf("login with the new password = %s, %d", message, ret)
+	}
+
+	// 同一个链接只能使用一次
+	if _, ret := f.user.ResetPassword(request.ResetPasswordRequest{Token: token, NewPassword: "Other0ne!"}); ret != -2 {
+		t.Fatalf("reused token ret = %d, want -2", ret)
+	}
+
+	// 过期的链接不能使用，密码保持不变
+	mustOK(t)(f.user.ForgotPassword(request.ForgotPasswordRequest{Email: "alice@example.com"}))
+	token = f.lastMail(t, "alice@example.com", mailTokenPattern)
+	f.cache.expire(t, resetTokenKey(token), passwordResetExpire)
+	if _, ret := f.user.ResetPassword(request.ResetPasswordRequest{Token: token, NewPassword: "Other0ne!"}); ret != -2 {
+		t.Fatalf("expired token ret = %d, want -2", ret)
+	}
+	if _, _, ret := f.user.Login(request.LoginRequest{Telephone: user.Telephone, Password: "Other0ne!"}); ret != -2 {
+		t.Fatalf("login with the rejected password ret = %d, want -2", ret)
+	}
+	if len(f.tokens.revoked) != 1 {
+		t.Fatalf("revoked = %v, want only the successful reset", f.tokens.revoked)
+	}
+}
@@ -4,85 +4,114 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"go_chat/internal/dao"
 	"go_chat/internal/dto/request"
 	"go_chat/internal/dto/respond"
 	"go_chat/internal/model"
-	myredis "go_chat/internal/service/redis"
+	"go_chat/internal/service/cache"
+	"go_chat/internal/service/ratelimit"
 	"go_chat/internal/service/sms"
 	"go_chat/pkg/constants"
 	"go_chat/pkg/enum/user_info/user_status_enum"
+	passwordutil "go_chat/pkg/util/password"
 	"go_chat/pkg/util/random"
 	"go_chat/pkg/zlog"
-	"gorm.io/gorm"
 	"time"
 )
 
-type userInfoService struct{}
+type userInfoService struct {
+	store  dao.Store
+	cache  cache.Cache
+	lists  *cache.Versioned
+	tokens TokenIssuer
+	guard  *ratelimit.Guard
+}
 
-var UserInfoService = new(userInfoService)
+func NewUserInfoService(store dao.Store, c cache.Cache, tokens TokenIssuer) *userInfoService {
+	return &userInfoService{store: store, cache: c, lists: cache.NewVersioned(c), tokens: tokens, guard: ratelimit.NewGuard(c)}
+}
 
 // Login 登录
 func (u *userInfoService) Login(loginReq request.LoginRequest) (string, *respond.LoginRespond, int) {
+	if message, ret := u.guard.AllowLogin(loginReq.Telephone, loginReq.ClientIp); ret != 0 {
+		return message, nil, ret
+	}
+	if message, ret := u.guard.CheckLockout(loginReq.Telephone); ret != 0 {
+		return message, nil, ret
+	}
 	password := loginReq.Password
-	var user model.UserInfo
-	res := dao.GormDB.First(&user, "telephone = ?", loginReq.Telephone)
-	if res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+	user, err := u.store.Users().GetByTelephone(loginReq.Telephone)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
 			message := "用户不存在，请注册"
 			zlog.Error(message)
 			return message, nil, -2
 		}
-		zlog.Error(res.Error.Error())
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, nil, -1
 	}
-	if user.Password != password {
-		message := "密码不正确，请重试"
-		zlog.Error(message)
+	ok, needRehash := passwordutil.Verify(user.Password, password)
+	if !ok {
+		message, ret := u.guard.PasswordFailed(loginReq.Telephone)
+		zlog.Info(message)
+		return message, nil, ret
+	}
+	u.guard.PasswordSucceeded(loginReq.Telephone)
+	if needRehash {
+		// 历史明文密码或过低的cost，登录成功时顺便升级
+		u.rehashPassword(user, password)
+	}
+	return u.loginRespond(user, loginReq.DeviceInfo, loginReq.ClientIp)
+}
+
+// loginRespond 登录成功后登记设备并签发token，各种登录方式共用
+// 被禁用的用户在校验密码或验证码之后才拒绝，避免暴露账号状态
+func (u *userInfoService) loginRespond(user *model.UserInfo, device request.DeviceInfo, clientIp string) (string, *respond.LoginRespond, int) {
+	if user.Status == user_status_enum.DISABLE {
+		message := "该账号已被禁用"
+		zlog.Info(message + "：" + user.Uuid)
 		return message, nil, -2
 	}
-	loginRsq := &respond.LoginRespond{
-		Uuid:      user.Uuid,
-		Telephone: user.Telephone,
-		Nickname:  user.Nickname,
-		Email:     user.Email,
-		Avatar:    user.Avatar,
-		Gender:    user.Gender,
-		Birthday:  user.Birthday,
-		Signature: user.Signature,
-		IsAdmin:   user.IsAdmin,
-		Status:    user.Status,
+	loginRsp := &respond.LoginRespond{
+		Uuid:          user.Uuid,
+		Telephone:     user.Telephone,
+		Nickname:      user.Nickname,
+		Email:         user.Email.String,
+		EmailVerified: user.EmailVerified,
+		Avatar:        user.Avatar,
+		Gender:        user.Gender,
+		Birthday:      user.Birthday,
+		Signature:     user.Signature,
+		IsAdmin:       user.IsAdmin,
+		Status:        user.Status,
 	}
 	year, month, day := user.CreatedAt.Date()
-	loginRsq.CreatedAt = fmt.Sprintf("%d.%d.%d", year, month, day)
+	loginRsp.CreatedAt = fmt.Sprintf("%d.%d.%d", year, month, day)
+	tokenRsp, err := u.tokens.GenerateTokens(&model.DeviceSession{
+		UserId:     user.Uuid,
+		DeviceId:   device.DeviceId,
+		Platform:   device.Platform,
+		DeviceName: device.DeviceName,
+		Ip:         clientIp,
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	loginRsp.TokenRespond = tokenRsp
 
-	return "登陆成功", loginRsq, 0
+	return "登陆成功", loginRsp, 0
 }
 
 // SendSmsCode 发送短信验证码 - 验证码登录
-func (u *userInfoService) SendSmsCode(telephone string) (string, int) {
-	return sms.VerificationCode(telephone)
+func (u *userInfoService) SendSmsCode(req request.SendSmsCodeRequest) (string, int) {
+	return sms.AuthCodeService.VerificationCode(req.Telephone, req.ClientIp)
 }
 
 // Register 注册，返回(message, register_respond_string, error)
 func (u *userInfoService) Register(req request.RegisterRequest) (string, *respond.RegisterRespond, int) {
-	//设置检查key
-	key := "auth_code_" + req.Telephone
-	code, err := myredis.GetKey(key)
-	if err != nil {
-		zlog.Error(err.Error())
-		return constants.SYSTEM_ERROR, nil, -1
-	}
-	if code != req.Telephone {
-		message := "验证码不正确，请重试"
-		zlog.Info(message)
-		return message, nil, -2
-	} else {
-		if err := myredis.DelKeyIfExists(key); err != nil {
-			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, nil, -1
-		}
+	if message, ret := u.checkSmsCode(req.Telephone, req.SmsCode); ret != 0 {
+		return message, nil, ret
 	}
 
 	//校验手机号交给前端，这里校验手机号是否已经注册过
@@ -90,10 +119,18 @@ func (u *userInfoService) Register(req request.RegisterRequest) (string, *respon
 	if ret != 0 {
 		return message, nil, ret
 	}
+	if message, ret := u.checkPasswordFormat(req.Password); ret != 0 {
+		return message, nil, ret
+	}
+	hashed, err := passwordutil.Hash(req.Password)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
 	var newUser model.UserInfo
 	newUser.Uuid = "U" + random.GetNowAndLenRandomString(11)
 	newUser.Telephone = req.Telephone
-	newUser.Password = req.Password
+	newUser.Password = hashed
 	newUser.Nickname = req.Nickname
 	newUser.Avatar = "https://cube.elemecdn.com/0/88/03b0d39583f48206768a7534e55bcpng.png"
 	newUser.CreatedAt = time.Now()
@@ -101,15 +138,14 @@ func (u *userInfoService) Register(req request.RegisterRequest) (string, *respon
 	newUser.Status = user_status_enum.NORMAL
 
 	// 手机号验证，最后一步才调用api，省钱hhh
-	//err := sms.VerificationCode(registerReq.Telephone)
+	//err := sms.AuthCodeService.VerificationCode(registerReq.Telephone)
 	//if err != nil {
 	//	zlog.Error(err.Error())
 	//	return "", err
 	//}
 
-	res := dao.GormDB.Create(&newUser)
-	if res.Error != nil {
-		zlog.Error(res.Error.Error())
+	if err := u.store.Users().Create(&newUser); err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, nil, -1
 	}
 
@@ -122,7 +158,7 @@ func (u *userInfoService) Register(req request.RegisterRequest) (string, *respon
 		Uuid:      newUser.Uuid,
 		Telephone: newUser.Telephone,
 		Nickname:  newUser.Nickname,
-		Email:     newUser.Email,
+		Email:     newUser.Email.String,
 		Avatar:    newUser.Avatar,
 		Gender:    newUser.Gender,
 		Birthday:  newUser.Birthday,
@@ -137,13 +173,12 @@ func (u *userInfoService) Register(req request.RegisterRequest) (string, *respon
 }
 
 func (u *userInfoService) checkTelephoneExist(telephone string) (string, int) {
-	var user model.UserInfo
-	if res := dao.GormDB.First(&user, "telephone = ?", telephone); res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+	if _, err := u.store.Users().GetByTelephone(telephone); err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
 			zlog.Info("该电话不存在，可以注册")
 			return "", 0
 		}
-		zlog.Error(res.Error.Error())
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
 	zlog.Info("该电话已经存在，注册失败")
@@ -151,6 +186,98 @@ func (u *userInfoService) checkTelephoneExist(telephone string) (string, int) {
 	return message, -2
 }
 
+// checkPasswordFormat 检验密码长度，bcrypt最多只取前72字节
+func (u *userInfoService) checkPasswordFormat(password string) (string, int) {
+	if len(password) < 6 || len(password) > 32 {
+		message := "密码长度应为6-32位"
+		zlog.Info(message)
+		return message, -2
+	}
+	return "", 0
+}
+
+// checkSmsCode 校验短信验证码，校验通过后删除，避免重复使用
+func (u *userInfoService) checkSmsCode(telephone, smsCode string) (string, int) {
+	key := "auth_code_" + telephone
+	code, err := u.cache.Get(key)
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if code == "" {
+		message := "验证码不正确，请重试"
+		zlog.Info(message)
+		return message, -2
+	}
+	if code != smsCode {
+		exhausted, err := u.guard.CodeFailed(key, sms.AuthCodeExpire)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		if !exhausted {
+			message := "验证码不正确，请重试"
+			zlog.Info(message)
+			return message, -2
+		}
+		// 错误次数用完，验证码作废，防止穷举
+		if err := u.cache.Del(key); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		message := "验证码错误次数过多，请重新获取"
+		zlog.Info(message + "：" + telephone)
+		return message, -3
+	}
+	if err := u.cache.Del(key); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.guard.ResetCodeAttempts(key); err != nil {
+		zlog.Error(err.Error())
+	}
+	return "", 0
+}
+
+// rehashPassword 用当前算法重新加密密码，失败不影响登录
+func (u *userInfoService) rehashPassword(user *model.UserInfo, plain string) {
+	hashed, err := passwordutil.Hash(plain)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	if err := u.store.Users().UpdatePassword(user.Uuid, hashed); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// ChangePassword 修改密码，需要校验旧密码
+func (u *userInfoService) ChangePassword(req request.ChangePasswordRequest) (string, int) {
+	user, err := u.store.Users().GetByUuid(req.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if ok, _ := passwordutil.Verify(user.Password, req.OldPassword); !ok {
+		message := "原密码不正确，请重试"
+		zlog.Info(message)
+		return message, -2
+	}
+	if message, ret := u.checkPasswordFormat(req.NewPassword); ret != 0 {
+		return message, ret
+	}
+	hashed, err := passwordutil.Hash(req.NewPassword)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if err := u.store.Users().UpdatePassword(user.Uuid, hashed); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	return "修改密码成功", 0
+}
+
 // checkUserIsAdminOrNot 检验用户是否为管理员
 func (u *userInfoService) checkUserIsAdminOrNot(user model.UserInfo) int8 {
 	return user.IsAdmin
@@ -158,64 +285,40 @@ func (u *userInfoService) checkUserIsAdminOrNot(user model.UserInfo) int8 {
 
 // SmsLogin 验证码登录
 func (u *userInfoService) SmsLogin(req request.SmsLoginRequest) (string, *respond.LoginRespond, int) {
-	var user model.UserInfo
-	res := dao.GormDB.First(&user, "telephone = ?", req.Telephone)
-	if res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+	if message, ret := u.guard.AllowLogin(req.Telephone, req.ClientIp); ret != 0 {
+		return message, nil, ret
+	}
+	user, err := u.store.Users().GetByTelephone(req.Telephone)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
 			message := "用户不存在，请注册"
 			zlog.Error(message)
 			return message, nil, -2
 		}
-		zlog.Error(res.Error.Error())
-		return constants.SYSTEM_ERROR, nil, -1
-	}
-
-	key := "auth_code_" + req.Telephone
-	code, err := myredis.GetKey(key)
-	if err != nil {
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, nil, -1
 	}
-	if code != req.SmsCode {
-		message := "验证码不正确，请重试"
-		zlog.Info(message)
-		return message, nil, -2
-	} else {
-		if err := myredis.DelKeyIfExists(key); err != nil {
-			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, nil, -1
-		}
-	}
 
-	loginRsp := &respond.LoginRespond{
-		Uuid:      user.Uuid,
-		Telephone: user.Telephone,
-		Nickname:  user.Nickname,
-		Email:     user.Email,
-		Avatar:    user.Avatar,
-		Gender:    user.Gender,
-		Birthday:  user.Birthday,
-		Signature: user.Signature,
-		IsAdmin:   user.IsAdmin,
-		Status:    user.Status,
+	if message, ret := u.checkSmsCode(req.Telephone, req.SmsCode); ret != 0 {
+		return message, nil, ret
 	}
-	year, month, day := user.CreatedAt.Date()
-	loginRsp.CreatedAt = fmt.Sprintf("%d.%d.%d", year, month, day)
 
-	return "登陆成功", loginRsp, 0
+	return u.loginRespond(user, req.DeviceInfo, req.ClientIp)
 }
 
 // UpdateUserInfo 修改用户信息
 // 某用户修改了信息，可能会影响contact_user_list，不需要删除redis的contact_user_list，timeout之后会自己更新
 // 但是需要更新redis的user_info，因为可能影响用户搜索
 func (u *userInfoService) UpdateUserInfo(updateReq request.UpdateUserInfoRequest) (string, int) {
-	var user model.UserInfo
-	if res := dao.GormDB.First(&user, "uuid = ?", updateReq.Uuid); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	user, err := u.store.Users().GetByUuid(updateReq.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	if updateReq.Email != "" {
-		user.Email = updateReq.Email
+	// 新邮箱验证通过后才会写入，见VerifyEmail
+	emailSent, message, ret := u.updateEmail(user, updateReq.Email, updateReq.ClientIp)
+	if ret != 0 {
+		return message, ret
 	}
 	if updateReq.Nickname != "" {
 		user.Nickname = updateReq.Nickname
@@ -229,13 +332,16 @@ func (u *userInfoService) UpdateUserInfo(updateReq request.UpdateUserInfoRequest
 	if updateReq.Avatar != "" {
 		user.Avatar = updateReq.Avatar
 	}
-	if res := dao.GormDB.Save(&user); res.Error != nil {
-		zlog.Error(res.Error.Error())
+	if err := u.store.Users().Save(user); err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	//if err := myredis.DelKeysWithPattern("user_info_" + updateReq.Uuid); err != nil {
+	//if err := u.cache.DelByPattern("user_info_" + updateReq.Uuid); err != nil {
 	//	zlog.Error(err.Error())
 	//}
+	if emailSent {
+		return "修改成功，验证邮件已发送至新邮箱，验证后生效", 0
+	}
 	return "修改用户信息成功", 0
 }
 
@@ -243,33 +349,25 @@ func (u *userInfoService) UpdateUserInfo(updateReq request.UpdateUserInfoRequest
 func (u *userInfoService) GetUserInfo(uuid string) (string, *respond.GetUserInfoRespond, int) {
 	// redis
 	zlog.Info(uuid)
-	rspString, err := myredis.GetKeyNilIsErr("user_info_" + uuid)
+	rspString, err := u.cache.Get("user_info_" + uuid)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
+		if errors.Is(err, cache.ErrCacheMiss) {
 			zlog.Info(err.Error())
-			var user model.UserInfo
-			if res := dao.GormDB.Where("uuid = ?", uuid).Find(&user); res.Error != nil {
-				zlog.Error(res.Error.Error())
+			user, err := u.store.Users().GetByUuid(uuid)
+			if err != nil {
+				if errors.Is(err, dao.ErrRecordNotFound) {
+					zlog.Info("用户不存在")
+					return "用户不存在", nil, -2
+				}
+				zlog.Error(err.Error())
 				return constants.SYSTEM_ERROR, nil, -1
 			}
-			rsp := respond.GetUserInfoRespond{
-				Uuid:      user.Uuid,
-				Telephone: user.Telephone,
-				Nickname:  user.Nickname,
-				Avatar:    user.Avatar,
-				Birthday:  user.Birthday,
-				Email:     user.Email,
-				Gender:    user.Gender,
-				Signature: user.Signature,
-				CreatedAt: user.CreatedAt.Format("2006-01-02 15:04:05"),
-				IsAdmin:   user.IsAdmin,
-				Status:    user.Status,
-			}
+			rsp := userInfoRespond(user)
 			//rspString, err := json.Marshal(rsp)
 			//if err != nil {
 			//	zlog.Error(err.Error())
 			//}
-			//if err := myredis.SetKeyEx("user_info_"+uuid, string(rspString), constants.REDIS_TIMEOUT*time.Minute); err != nil {
+			//if err := u.cache.Set("user_info_"+uuid, string(rspString), constants.REDIS_TIMEOUT*time.Minute); err != nil {
 			//	zlog.Error(err.Error())
 			//}
 			return "获取用户信息成功", &rsp, 0
@@ -284,3 +382,21 @@ func (u *userInfoService) GetUserInfo(uuid string) (string, *respond.GetUserInfo
 	}
 	return "获取用户信息成功", &rsp, 0
 }
+
+// userInfoRespond 用户详情，查看用户信息和管理员查看用户列表共用
+func userInfoRespond(user *model.UserInfo) respond.GetUserInfoRespond {
+	return respond.GetUserInfoRespond{
+		Uuid:          user.Uuid,
+		Telephone:     user.Telephone,
+		Nickname:      user.Nickname,
+		Avatar:        user.Avatar,
+		Birthday:      user.Birthday,
+		Email:         user.Email.String,
+		EmailVerified: user.EmailVerified,
+		Gender:        user.Gender,
+		Signature:     user.Signature,
+		CreatedAt:     user.CreatedAt.Format("2006-01-02 15:04:05"),
+		IsAdmin:       user.IsAdmin,
+		Status:        user.Status,
+	}
+}
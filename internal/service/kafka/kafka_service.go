@@ -2,9 +2,11 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 	"github.com/segmentio/kafka-go"
 	myconfig "go_chat/internal/config"
 	"go_chat/pkg/zlog"
+	"os"
 	"time"
 )
 
@@ -22,6 +24,13 @@ var KafkaService = new(kafkaService)
 func (k *kafkaService) KafkaInit() {
 	//k.CreateTopic()
 	kafkaConfig := myconfig.GetConfig().KafkaConfig
+	// 每个实例都需要推送给自己本机在线的用户，所以每个实例单独一个消费组
+	hostname, err := os.Hostname()
+	if err != nil {
+		zlog.Error(err.Error())
+		hostname = "localhost"
+	}
+	groupId := fmt.Sprintf("chat_%s_%d", hostname, myconfig.GetConfig().MainConfig.Port)
 	k.ChatWriter = &kafka.Writer{
 		Addr:                   kafka.TCP(kafkaConfig.HostPort),
 		Topic:                  kafkaConfig.ChatTopic,
@@ -34,7 +43,7 @@ func (k *kafkaService) KafkaInit() {
 		Brokers:        []string{kafkaConfig.HostPort},
 		Topic:          kafkaConfig.ChatTopic,
 		CommitInterval: kafkaConfig.Timeout * time.Second,
-		GroupID:        "chat",
+		GroupID:        groupId,
 		StartOffset:    kafka.LastOffset,
 	})
 }
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"go_chat/pkg/zlog"
+	"sync"
+)
+
+// LocalMail LocalMailer记录的一封邮件
+type LocalMail struct {
+	Subject string
+	Body    string
+}
+
+// LocalMailer 不发送邮件，只记录每个收件人最近的一封，用于本地开发和测试
+type LocalMailer struct {
+	mu    sync.Mutex
+	mails map[string]LocalMail
+}
+
+func NewLocalMailer() *LocalMailer {
+	return &LocalMailer{mails: make(map[string]LocalMail)}
+}
+
+// Send 记录邮件并写入日志，方便开发时查看
+func (m *LocalMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mails[to] = LocalMail{Subject: subject, Body: body}
+	zlog.Info("本地邮件，收件人" + to + "，标题" + subject + "：" + body)
+	return nil
+}
+
+// LastMail 该收件人最近收到的邮件
+func (m *LocalMailer) LastMail(to string) (LocalMail, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mail, ok := m.mails[to]
+	return mail, ok
+}
@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const mailTimeout = 15 * time.Second
+
+type mailService struct {
+	mailer Mailer
+}
+
+// MailService 由 Init 创建
+var MailService *mailService
+
+// Init 注入依赖，需要在注册路由之前调用
+func Init(mailer Mailer) {
+	MailService = NewMailService(mailer)
+}
+
+func NewMailService(mailer Mailer) *mailService {
+	return &mailService{mailer: mailer}
+}
+
+func (s *mailService) send(to, subject, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+	return s.mailer.Send(ctx, to, subject, body)
+}
+
+// SendVerifyCode 修改邮箱后发送验证码到新邮箱
+func (s *mailService) SendVerifyCode(to, code string, expire time.Duration) error {
+	return s.send(to, "验证您的邮箱", fmt.Sprintf(
+		"您正在绑定邮箱，验证码为 %s ，%d分钟内有效。\n\n如果不是您本人操作，请忽略这封邮件。", code, int(expire.Minutes())))
+}
+
+// SendLoginCode 邮箱验证码登录
+func (s *mailService) SendLoginCode(to, code string, expire time.Duration) error {
+	return s.send(to, "登录验证码", fmt.Sprintf(
+		"您正在登录，验证码为 %s ，%d分钟内有效。\n\n如果不是您本人操作，请忽略这封邮件，并考虑修改密码。", code, int(expire.Minutes())))
+}
+
+// SendPasswordReset 找回密码，链接只能使用一次
+func (s *mailService) SendPasswordReset(to, link string, expire time.Duration) error {
+	return s.send(to, "重置密码", fmt.Sprintf(
+		"您正在重置密码，请在%d分钟内打开以下链接设置新密码，链接只能使用一次：\n\n%s\n\n如果不是您本人操作，请忽略这封邮件，您的密码不会被修改。", int(expire.Minutes()), link))
+}
@@ -0,0 +1,25 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"go_chat/internal/config"
+)
+
+// Mailer 发送纯文本邮件，按 mailConfig.provider 选择实现
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// NewFromConfig 按配置创建Mailer，provider为空时使用smtp
+func NewFromConfig(conf *config.Config) (Mailer, error) {
+	c := conf.MailConfig
+	switch c.MailProvider {
+	case "", "smtp":
+		return NewSMTPMailer(c.SmtpHost, c.SmtpPort, c.SmtpUsername, c.SmtpPassword, c.SmtpTLS, c.MailFrom)
+	case "local":
+		return NewLocalMailer(), nil
+	default:
+		return nil, fmt.Errorf("不支持的邮件服务：%s", c.MailProvider)
+	}
+}
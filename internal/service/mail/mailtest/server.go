@@ -0,0 +1,201 @@
+// Package mailtest 进程内的SMTP服务，用于测试发邮件的流程
+package mailtest
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Message 收到的一封邮件，标题和正文已解码
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Server 只支持明文连接，不支持STARTTLS和AUTH，对应 smtpTLS = "none" 且不配置用户名
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+	rejected map[string]bool // RCPT时返回550的收件人
+}
+
+// NewServer 监听本地随机端口，测试结束时关闭
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{listener: listener, rejected: make(map[string]bool)}
+	s.wg.Add(1)
+	go s.serve(t)
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Reject 之后发给addr的邮件在RCPT时被拒绝
+func (s *Server) Reject(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[addr] = true
+}
+
+// Messages 按收到的顺序返回所有邮件
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Last 发给to的最后一封邮件
+func (s *Server) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		for _, rcpt := range s.messages[i].To {
+			if rcpt == to {
+				return s.messages[i], true
+			}
+		}
+	}
+	return Message{}, false
+}
+
+func (s *Server) serve(t testing.TB) {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			if err := s.session(textproto.NewConn(conn)); err != nil && err != io.EOF {
+				t.Logf("mailtest: %v", err)
+			}
+		}()
+	}
+}
+
+// session 处理一个连接上的SMTP对话，直到QUIT或连接断开
+func (s *Server) session(conn *textproto.Conn) error {
+	if err := conn.PrintfLine("220 mailtest ESMTP"); err != nil {
+		return err
+	}
+	var from string
+	var to []string
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return err
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			err = conn.PrintfLine("250 mailtest")
+		case "MAIL":
+			from, to = address(arg), nil
+			err = conn.PrintfLine("250 OK")
+		case "RCPT":
+			rcpt := address(arg)
+			s.mu.Lock()
+			rejected := s.rejected[rcpt]
+			s.mu.Unlock()
+			if rejected {
+				err = conn.PrintfLine("550 mailbox unavailable")
+				break
+			}
+			to = append(to, rcpt)
+			err = conn.PrintfLine("250 OK")
+		case "DATA":
+			if from == "" || len(to) == 0 {
+				err = conn.PrintfLine("503 need MAIL and RCPT")
+				break
+			}
+			if err = conn.PrintfLine("354 end with <CRLF>.<CRLF>"); err != nil {
+				return err
+			}
+			data, readErr := conn.ReadDotBytes()
+			if readErr != nil {
+				return readErr
+			}
+			message, parseErr := parse(from, to, data)
+			if parseErr != nil {
+				err = conn.PrintfLine("554 %s", parseErr)
+				break
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			from, to = "", nil
+			err = conn.PrintfLine("250 OK")
+		case "RSET":
+			from, to = "", nil
+			err = conn.PrintfLine("250 OK")
+		case "NOOP":
+			err = conn.PrintfLine("250 OK")
+		case "QUIT":
+			_ = conn.PrintfLine("221 bye")
+			return nil
+		default:
+			err = conn.PrintfLine("502 command not implemented")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// address 取出FROM:<a@b> BODY=8BITMIME中的地址
+func address(arg string) string {
+	start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+// parse 解码RFC 2047编码的标题，正文为base64时一并解码
+func parse(from string, to []string, data []byte) (Message, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		return Message{}, err
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return Message{}, err
+	}
+	var body io.Reader = msg.Body
+	if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "base64") {
+		body = base64.NewDecoder(base64.StdEncoding, msg.Body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{From: from, To: to, Subject: subject, Body: string(content)}, nil
+}
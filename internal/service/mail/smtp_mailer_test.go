@@ -0,0 +1,62 @@
+package mail
+
+import (
+	"context"
+	"go_chat/internal/service/mail/mailtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSMTPMailer(t *testing.T, server *mailtest.Server) Mailer {
+	t.Helper()
+	mailer, err := NewSMTPMailer(server.Host(), server.Port(), "", "", "none", "go_chat <noreply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mailer
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := mailtest.NewServer(t)
+	mailer := newTestSMTPMailer(t, server)
+	// 正文超过76个字符，base64编码后会折行
+	body := strings.Repeat("您好，这是一封测试邮件。\n", 10)
+	if err := mailer.Send(context.Background(), "Alice <alice@example.com>", "测试标题", body); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := server.Last("alice@example.com")
+	if !ok {
+		t.Fatalf("no mail for alice, got %+v", server.Messages())
+	}
+	if got.From != "noreply@example.com" || got.Subject != "测试标题" || got.Body != body {
+		t.Fatalf("mail = %+v", got)
+	}
+}
+
+func TestSMTPMailerRejected(t *testing.T) {
+	server := mailtest.NewServer(t)
+	server.Reject("bob@example.com")
+	mailer := newTestSMTPMailer(t, server)
+	if err := mailer.Send(context.Background(), "bob@example.com", "标题", "正文"); err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("Send error = %v, want 550", err)
+	}
+	if messages := server.Messages(); len(messages) != 0 {
+		t.Fatalf("rejected mail was delivered: %+v", messages)
+	}
+	if err := mailer.Send(context.Background(), "not an address", "标题", "正文"); err == nil {
+		t.Fatal("Send should fail for an invalid recipient")
+	}
+}
+
+func TestMailService(t *testing.T) {
+	server := mailtest.NewServer(t)
+	s := NewMailService(newTestSMTPMailer(t, server))
+	if err := s.SendPasswordReset("alice@example.com", "https://chat.example.com/reset?token=abc", 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := server.Last("alice@example.com")
+	if got.Subject != "重置密码" || !strings.Contains(got.Body, "https://chat.example.com/reset?token=abc") || !strings.Contains(got.Body, "30分钟") {
+		t.Fatalf("mail = %+v", got)
+	}
+}
@@ -0,0 +1,218 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"go_chat/internal/config"
+	"go_chat/internal/service/cache"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/zlog"
+	"strconv"
+	"time"
+)
+
+// 未配置时的默认值，和configs/config.toml中保持一致
+const (
+	defaultLoginWindow        = 15 * time.Minute
+	defaultLoginPhoneLimit    = 10
+	defaultLoginIpLimit       = 50
+	defaultPasswordFailLimit  = 5
+	defaultLockoutBase        = 5 * time.Minute
+	defaultLockoutMax         = 24 * time.Hour
+	defaultSmsWindow          = time.Hour
+	defaultSmsPhoneLimit      = 5
+	defaultSmsIpLimit         = 20
+	defaultSmsPhoneDailyQuota = 10
+	defaultSmsIpDailyQuota    = 50
+	defaultSmsCodeMaxAttempts = 5
+
+	passwordFailExpire = 24 * time.Hour // 输错密码的次数从第一次输错起保留多久
+)
+
+// Guard 登录和短信验证码的频率限制，计数都保存在缓存中，多实例共享
+// 返回值和service一致，被限制时ret为-3，由controller返回429
+type Guard struct {
+	cache cache.Cache
+}
+
+func NewGuard(c cache.Cache) *Guard {
+	return &Guard{cache: c}
+}
+
+// intOr 配置为0时使用默认值
+func intOr(value, def int) int {
+	if value > 0 {
+		return value
+	}
+	return def
+}
+
+// minutesOr 配置单位为分钟，为0时使用默认值
+func minutesOr(value, def time.Duration) time.Duration {
+	if value > 0 {
+		return value * time.Minute
+	}
+	return def
+}
+
+// limit 一个计数key及其上限
+type limit struct {
+	key   string
+	limit int
+}
+
+// waitText 等待时间向上取整到分钟
+func waitText(wait time.Duration) string {
+	minutes := int((wait + time.Minute - 1) / time.Minute)
+	if minutes >= 60 {
+		return strconv.Itoa((minutes+59)/60) + "小时"
+	}
+	return strconv.Itoa(max(minutes, 1)) + "分钟"
+}
+
+// hitWindows 依次检查各个窗口，被任一窗口限制时返回提示
+func (g *Guard) hitWindows(action string, window time.Duration, limits ...limit) (string, int) {
+	for _, l := range limits {
+		ok, wait, err := g.cache.HitWindow(l.key, l.limit, window)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		if !ok {
+			message := action + "过于频繁，请" + waitText(wait) + "后再试"
+			zlog.Info(message + "：" + l.key)
+			return message, -3
+		}
+	}
+	return "", 0
+}
+
+// AllowLogin 密码登录和验证码登录共用，按手机号和IP分别限制
+func (g *Guard) AllowLogin(telephone, ip string) (string, int) {
+	conf := config.GetConfig().RateLimitConfig
+	return g.hitWindows("登录", minutesOr(conf.LoginWindow, defaultLoginWindow),
+		limit{"rate_login_phone_" + telephone, intOr(conf.LoginPhoneLimit, defaultLoginPhoneLimit)},
+		limit{"rate_login_ip_" + ip, intOr(conf.LoginIpLimit, defaultLoginIpLimit)},
+	)
+}
+
+// CheckLockout 校验密码前调用，锁定期间不校验密码
+func (g *Guard) CheckLockout(telephone string) (string, int) {
+	until, err := g.cache.Get("login_lock_" + telephone)
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return "", 0
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	unix, err := strconv.ParseInt(until, 10, 64)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	if wait := time.Until(time.Unix(unix, 0)); wait > 0 {
+		return "密码错误次数过多，账号已锁定，请" + waitText(wait) + "后再试", -3
+	}
+	return "", 0
+}
+
+// PasswordFailed 记录一次密码错误，达到次数后锁定，之后每多错一次锁定时长加倍
+func (g *Guard) PasswordFailed(telephone string) (string, int) {
+	conf := config.GetConfig().RateLimitConfig
+	failures, err := g.cache.IncrEx("login_fail_"+telephone, passwordFailExpire)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	failLimit := int64(intOr(conf.PasswordFailLimit, defaultPasswordFailLimit))
+	if failures < failLimit {
+		return "密码不正确，还可以尝试" + strconv.FormatInt(failLimit-failures, 10) + "次", -2
+	}
+	lockoutMax := minutesOr(conf.LockoutMax, defaultLockoutMax)
+	lockout := minutesOr(conf.LockoutBase, defaultLockoutBase)
+	for i := failLimit; i < failures && lockout < lockoutMax; i++ {
+		lockout *= 2
+	}
+	lockout = min(lockout, lockoutMax)
+	until := time.Now().Add(lockout).Unix()
+	if err := g.cache.Set("login_lock_"+telephone, strconv.FormatInt(until, 10), lockout); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
+	}
+	zlog.Info(fmt.Sprintf("手机号%s连续%d次密码错误，锁定%s", telephone, failures, lockout))
+	return "密码错误次数过多，账号已锁定，请" + waitText(lockout) + "后再试", -3
+}
+
+// PasswordSucceeded 登录成功后清空错误次数，失败只记录日志
+func (g *Guard) PasswordSucceeded(telephone string) {
+	if err := g.cache.Del("login_fail_" + telephone); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// ResetLockout 重置密码后解除锁定并清空错误次数，失败只记录日志
+func (g *Guard) ResetLockout(telephone string) {
+	g.PasswordSucceeded(telephone)
+	if err := g.cache.Del("login_lock_" + telephone); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// AllowSmsSend 发送短信验证码前调用，先检查滑动窗口再检查每日配额
+func (g *Guard) AllowSmsSend(telephone, ip string) (string, int) {
+	return g.allowCodeSend("sms", telephone, ip)
+}
+
+// AllowEmailSend 发送邮件前调用，和短信使用相同的限制，分别计数
+func (g *Guard) AllowEmailSend(email, ip string) (string, int) {
+	return g.allowCodeSend("email", email, ip)
+}
+
+// allowCodeSend channel区分短信和邮件，target为手机号或邮箱
+func (g *Guard) allowCodeSend(channel, target, ip string) (string, int) {
+	conf := config.GetConfig().RateLimitConfig
+	if message, ret := g.hitWindows("发送验证码", minutesOr(conf.SmsWindow, defaultSmsWindow),
+		limit{"rate_" + channel + "_target_" + target, intOr(conf.SmsPhoneLimit, defaultSmsPhoneLimit)},
+		limit{"rate_" + channel + "_ip_" + ip, intOr(conf.SmsIpLimit, defaultSmsIpLimit)},
+	); ret != 0 {
+		return message, ret
+	}
+	// 按自然日计数，key带日期，过期时间多留一天即可
+	today := time.Now().Format("20060102")
+	for _, quota := range []limit{
+		{channel + "_quota_target_" + target + "_" + today, intOr(conf.SmsPhoneDailyQuota, defaultSmsPhoneDailyQuota)},
+		{channel + "_quota_ip_" + ip + "_" + today, intOr(conf.SmsIpDailyQuota, defaultSmsIpDailyQuota)},
+	} {
+		count, err := g.cache.IncrEx(quota.key, 48*time.Hour)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, -1
+		}
+		if count > int64(quota.limit) {
+			message := "今日发送验证码次数已达上限，请明天再试"
+			zlog.Info(message + "：" + quota.key)
+			return message, -3
+		}
+	}
+	return "", 0
+}
+
+// CodeFailed 记录一次验证码错误，codeKey为验证码在缓存中的key，短信和邮件验证码共用
+// 达到次数时返回true，调用方需要让验证码失效
+func (g *Guard) CodeFailed(codeKey string, expire time.Duration) (bool, error) {
+	attempts, err := g.cache.IncrEx(codeKey+"_attempts", expire)
+	if err != nil {
+		return false, err
+	}
+	maxAttempts := int64(intOr(config.GetConfig().SmsCodeMaxAttempts, defaultSmsCodeMaxAttempts))
+	if attempts < maxAttempts {
+		return false, nil
+	}
+	return true, g.ResetCodeAttempts(codeKey)
+}
+
+// ResetCodeAttempts 发送新验证码或校验通过后清空错误次数
+func (g *Guard) ResetCodeAttempts(codeKey string) error {
+	return g.cache.Del(codeKey + "_attempts")
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"go_chat/internal/service/cache"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ttlCache 记录每个key写入时的过期时间，配置为空，所有限制使用默认值
+type ttlCache struct {
+	cache.Cache
+	mu      sync.Mutex
+	expires map[string]time.Duration
+}
+
+func (c *ttlCache) Set(key string, value string, expiration time.Duration) error {
+	c.mu.Lock()
+	c.expires[key] = expiration
+	c.mu.Unlock()
+	return c.Cache.Set(key, value, expiration)
+}
+
+func newTestGuard() (*Guard, *ttlCache) {
+	c := &ttlCache{Cache: cache.NewMemoryCache(), expires: make(map[string]time.Duration)}
+	return NewGuard(c), c
+}
+
+func TestPasswordLockoutEscalation(t *testing.T) {
+	g, c := newTestGuard()
+	const telephone = "13800000001"
+	for i := 1; i < defaultPasswordFailLimit; i++ {
+		message, ret := g.PasswordFailed(telephone)
+		if ret != -2 || !strings.Contains(message, strconv.Itoa(defaultPasswordFailLimit-i)+"次") {
+			t.Fatalf("failure %d = %s, %d, want -2 with %d attempts left", i, message, ret, defaultPasswordFailLimit-i)
+		}
+		if _, ret := g.CheckLockout(telephone); ret != 0 {
+			t.Fatalf("locked after %d failures", i)
+		}
+	}
+
+	// 达到次数后锁定，之后每多错一次锁定时长加倍，直到上限
+	lockout := defaultLockoutBase
+	for i := defaultPasswordFailLimit; lockout < 2*defaultLockoutMax; i++ {
+		if _, ret := g.PasswordFailed(telephone); ret != -3 {
+			t.Fatalf("failure %d ret = %d, want -3", i, ret)
+		}
+		want := min(lockout, defaultLockoutMax)
+		if got := c.expires["login_lock_"+telephone]; got != want {
+			t.Fatalf("failure %d locks for %v, want %v", i, got, want)
+		}
+		if message, ret := g.CheckLockout(telephone); ret != -3 || !strings.Contains(message, waitText(want)) {
+			t.Fatalf("CheckLockout after failure %d = %s, %d, want -3 for %s", i, message, ret, waitText(want))
+		}
+		lockout *= 2
+	}
+
+	// 登录成功只清空错误次数，不解除锁定；重置密码才解除
+	g.PasswordSucceeded(telephone)
+	if _, ret := g.CheckLockout(telephone); ret != -3 {
+		t.Fatalf("CheckLockout after success ret = %d, want -3", ret)
+	}
+	g.ResetLockout(telephone)
+	if _, ret := g.CheckLockout(telephone); ret != 0 {
+		t.Fatalf("CheckLockout after reset ret = %d, want 0", ret)
+	}
+	if _, ret := g.PasswordFailed(telephone); ret != -2 {
+		t.Fatalf("first failure after reset ret = %d, want -2", ret)
+	}
+}
+
+func TestCodeFailed(t *testing.T) {
+	g, _ := newTestGuard()
+	const codeKey = "auth_code_13800000001"
+	for round := 0; round < 2; round++ {
+		for i := 1; i < defaultSmsCodeMaxAttempts; i++ {
+			if exhausted, err := g.CodeFailed(codeKey, time.Minute); err != nil || exhausted {
+				t.Fatalf("round %d failure %d = %v, %v, want not exhausted", round, i, exhausted, err)
+			}
+		}
+		// 用完次数后计数清零，新验证码重新计数
+		if exhausted, err := g.CodeFailed(codeKey, time.Minute); err != nil || !exhausted {
+			t.Fatalf("round %d failure %d = %v, %v, want exhausted", round, defaultSmsCodeMaxAttempts, exhausted, err)
+		}
+	}
+
+	for i := 1; i < defaultSmsCodeMaxAttempts; i++ {
+		if _, err := g.CodeFailed(codeKey, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.ResetCodeAttempts(codeKey); err != nil {
+		t.Fatal(err)
+	}
+	if exhausted, err := g.CodeFailed(codeKey, time.Minute); err != nil || exhausted {
+		t.Fatalf("failure after reset = %v, %v, want not exhausted", exhausted, err)
+	}
+}
+
+func TestAllowLogin(t *testing.T) {
+	g, _ := newTestGuard()
+	for i := 0; i < defaultLoginPhoneLimit; i++ {
+		if _, ret := g.AllowLogin("13800000001", "10.0.0.1"); ret != 0 {
+			t.Fatalf("attempt %d ret = %d, want 0", i+1, ret)
+		}
+	}
+	if _, ret := g.AllowLogin("13800000001", "10.0.0.2"); ret != -3 {
+		t.Fatalf("phone over limit ret = %d, want -3", ret)
+	}
+
+	// 同一个IP换手机号也受限
+	for i := defaultLoginPhoneLimit; i < defaultLoginIpLimit; i++ {
+		if _, ret := g.AllowLogin("139"+strconv.Itoa(10000000+i), "10.0.0.1"); ret != 0 {
+			t.Fatalf("attempt %d ret = %d, want 0", i+1, ret)
+		}
+	}
+	if _, ret := g.AllowLogin("13700000000", "10.0.0.1"); ret != -3 {
+		t.Fatalf("ip over limit ret = %d, want -3", ret)
+	}
+}
+
+func TestAllowCodeSend(t *testing.T) {
+	g, c := newTestGuard()
+	for i := 0; i < defaultSmsPhoneLimit; i++ {
+		if _, ret := g.AllowSmsSend("13800000001", "10.0.0.1"); ret != 0 {
+			t.Fatalf("send %d ret = %d, want 0", i+1, ret)
+		}
+	}
+	if _, ret := g.AllowSmsSend("13800000001", "10.0.0.1"); ret != -3 {
+		t.Fatalf("phone over limit ret = %d, want -3", ret)
+	}
+	// 短信和邮件分别计数
+	if _, ret := g.AllowEmailSend("13800000001", "10.0.0.1"); ret != 0 {
+		t.Fatalf("email ret = %d, want 0", ret)
+	}
+
+	// 窗口内没有超限，但当天的配额已经用完
+	today := time.Now().Format("20060102")
+	for i := 0; i < defaultSmsPhoneDailyQuota; i++ {
+		if _, err := c.IncrEx("sms_quota_target_13800000002_"+today, 48*time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if message, ret := g.AllowSmsSend("13800000002", "10.0.0.2"); ret != -3 || !strings.Contains(message, "明天") {
+		t.Fatalf("over daily quota = %s, %d, want -3", message, ret)
+	}
+}
+
+func TestWaitText(t *testing.T) {
+	cases := []struct {
+		wait time.Duration
+		want string
+	}{
+		{0, "1分钟"},
+		{time.Second, "1分钟"},
+		{5 * time.Minute, "5分钟"},
+		{5*time.Minute + time.Second, "6分钟"},
+		{59 * time.Minute, "59分钟"},
+		{time.Hour, "1小时"},
+		{90 * time.Minute, "2小时"},
+		{24 * time.Hour, "24小时"},
+	}
+	for _, tc := range cases {
+		if got := waitText(tc.wait); got != tc.want {
+			t.Fatalf("waitText(%v) = %s, want %s", tc.wait, got, tc.want)
+		}
+	}
+}
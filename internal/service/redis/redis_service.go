@@ -7,14 +7,16 @@ import (
 	"github.com/go-redis/redis/v8"
 	"go_chat/internal/config"
 	"go_chat/pkg/zlog"
-	"log"
+	"math/rand"
+	"strconv"
 	"time"
 )
 
 var redisClient *redis.Client
 var ctx = context.Background()
 
-func init() {
+// Init 初始化redis客户端并检查连接
+func Init() error {
 	conf := config.GetConfig()
 	host := conf.RedisConfig.Host
 	port := conf.RedisConfig.Port
@@ -27,6 +29,12 @@ func init() {
 		Password: password,
 		DB:       db,
 	})
+	return redisClient.Ping(ctx).Err()
+}
+
+// Close 关闭redis客户端
+func Close() error {
+	return redisClient.Close()
 }
 
 // SetKeyEx 设置 Ex 形数据
@@ -62,52 +70,30 @@ func GetKeyNilIsErr(key string) (string, error) {
 
 // GetKeyWithPrefixNilIsErr	获取有prefix前缀的key，如果不存在，err ≠ nil
 func GetKeyWithPrefixNilIsErr(prefix string) (string, error) {
-	var keys []string
-	var err error
-
-	for {
-		// 使用 Keys 命令迭代匹配的键
-		keys, err = redisClient.Keys(ctx, prefix+"*").Result()
-		if err != nil {
-			return "", err
-		}
-		if len(keys) == 0 {
-			zlog.Info("没有找到相关前缀的key")
-			return "", nil
-		}
-		if len(keys) == 1 {
-			zlog.Info(fmt.Sprintln("成功找到了相关前缀的key", keys))
-			return keys[0], nil
-		} else {
-			zlog.Error("找到了数量大于1的key，查找异常")
-			return "", errors.New("找到了数量大于1的key，查找异常")
-		}
-	}
+	return getOnlyKey(prefix+"*", "前缀")
 }
 
 // GetKeyWithSuffixNilIsErr 获取有suffix后缀的key，如果不存在，err ≠ nil
 func GetKeyWithSuffixNilIsErr(suffix string) (string, error) {
-	var keys []string
-	var err error
+	return getOnlyKey("*"+suffix, "后缀")
+}
 
-	for {
-		// 使用 Keys 命令迭代匹配的键
-		keys, err = redisClient.Keys(ctx, "*"+suffix).Result()
-		if err != nil {
-			return "", err
-		}
-		if len(keys) == 0 {
-			zlog.Info("没有找到相关后缀的key")
-			return "", nil
-		}
-		if len(keys) == 1 {
-			zlog.Info(fmt.Sprintln("成功找到了相关后缀的key", keys))
-			return keys[0], nil
-		} else {
-			zlog.Error("找到了数量大于1的key，查找异常")
-			return "", errors.New("找到了数量大于1的key，查找异常")
-		}
+// getOnlyKey 返回唯一匹配match的key，没有时返回空，多于一个时报错
+func getOnlyKey(match, desc string) (string, error) {
+	keys, err := scanKeys(match)
+	if err != nil {
+		return "", err
 	}
+	if len(keys) == 0 {
+		zlog.Info("没有找到相关" + desc + "的key")
+		return "", nil
+	}
+	if len(keys) == 1 {
+		zlog.Info(fmt.Sprintln("成功找到了相关"+desc+"的key", keys))
+		return keys[0], nil
+	}
+	zlog.Error("找到了数量大于1的key，查找异常")
+	return "", errors.New("找到了数量大于1的key，查找异常")
 }
 
 // DelKeyIfExists 如果key存在，删除该key
@@ -127,56 +113,12 @@ func DelKeyIfExists(key string) error {
 
 // DelKeysWithPrefix 如果有该前缀的key，则删除
 func DelKeysWithPrefix(prefix string) error {
-	var keys []string
-	var err error
-
-	for {
-		keys, err = redisClient.Keys(ctx, prefix+"*").Result()
-		if err != nil {
-			return err
-		}
-
-		if len(keys) == 0 {
-			log.Println("没有找到对应的key")
-			break
-		}
-
-		if len(keys) > 0 {
-			_, err = redisClient.Del(ctx, keys...).Result()
-			if err != nil {
-				return err
-			}
-			log.Println("成功删除相应key", keys)
-		}
-	}
-	return nil
+	return delKeysWithMatch(prefix + "*")
 }
 
-// DelKeysWithSuffix 如果有该前缀的key，则删除
+// DelKeysWithSuffix 如果有该后缀的key，则删除
 func DelKeysWithSuffix(suffix string) error {
-	var keys []string
-	var err error
-
-	for {
-		keys, err = redisClient.Keys(ctx, suffix+"*").Result()
-		if err != nil {
-			return err
-		}
-
-		if len(keys) == 0 {
-			log.Println("没有找到对应的key")
-			break
-		}
-
-		if len(keys) > 0 {
-			_, err = redisClient.Del(ctx, keys...).Result()
-			if err != nil {
-				return err
-			}
-			log.Println("成功删除相应key", keys)
-		}
-	}
-	return nil
+	return delKeysWithMatch("*" + suffix)
 }
 
 // DeleteAllRedisKeys 删除所有的key
@@ -202,32 +144,122 @@ func DeleteAllRedisKeys() error {
 	return nil
 }
 
+// DelKeysWithPattern 删除匹配glob模式的key
 func DelKeysWithPattern(pattern string) error {
-	var keys []string
-	var err error
+	return delKeysWithMatch(pattern)
+}
+
+// Incr key不存在时从0开始加一，返回加一后的值
+func Incr(key string) (int64, error) {
+	return redisClient.Incr(ctx, key).Result()
+}
+
+// SetNX key不存在时才设置，返回是否设置成功
+func SetNX(key string, value string, expiration time.Duration) (bool, error) {
+	return redisClient.SetNX(ctx, key, value, expiration).Result()
+}
+
+// SAddEx 向集合添加成员，并刷新整个集合的过期时间
+func SAddEx(key string, member string, expiration time.Duration) error {
+	pipe := redisClient.TxPipeline()
+	pipe.SAdd(ctx, key, member)
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SMembers 集合的全部成员，key不存在时返回空
+func SMembers(key string) ([]string, error) {
+	return redisClient.SMembers(ctx, key).Result()
+}
+
+// incrExScript 加一后如果是新建的key则设置过期时间，不依赖redis 7的EXPIRE NX
+var incrExScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// IncrEx 加一，key新建时设置过期时间，之后的加一不改变过期时间
+func IncrEx(key string, expiration time.Duration) (int64, error) {
+	return incrExScript.Run(ctx, redisClient, []string{key}, expiration.Milliseconds()).Int64()
+}
+
+// slidingWindowScript 清掉窗口外的记录后计数，未超过limit时记录本次并返回-1，否则返回最早一条离开窗口还需的毫秒数
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	return tonumber(oldest[2]) + window - now
+end
+redis.call('ZADD', KEYS[1], now, ARGV[4])
+redis.call('PEXPIRE', KEYS[1], window)
+return -1
+`)
+
+// HitWindow 滑动窗口计数，window内已有limit次时不记录，返回需要等待的时间
+func HitWindow(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 10) + strconv.Itoa(rand.Intn(1000))
+	wait, err := slidingWindowScript.Run(ctx, redisClient, []string{key},
+		now.UnixMilli(), window.Milliseconds(), limit, member).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	if wait < 0 {
+		return true, 0, nil
+	}
+	return false, time.Duration(wait) * time.Millisecond, nil
+}
+
+// scanBatch 每次SCAN建议返回的数量
+const scanBatch = 500
 
+// scanKeys 用SCAN遍历匹配的key，不会像KEYS一样阻塞redis
+func scanKeys(match string) ([]string, error) {
+	var keys []string
+	var cursor uint64
 	for {
-		// 使用 Keys 命令迭代匹配的键
-		keys, err = redisClient.Keys(ctx, pattern).Result()
+		batch, nextCursor, err := redisClient.Scan(ctx, cursor, match, scanBatch).Result()
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		// 如果没有更多的键，则跳出循环
-		if len(keys) == 0 {
-			log.Println("没有找到对应key")
-			break
+		keys = append(keys, batch...)
+		cursor = nextCursor
+		if cursor == 0 {
+			return keys, nil
 		}
+	}
+}
 
-		// 删除找到的键
+// delKeysWithMatch 边SCAN边删除，每批单独DEL
+func delKeysWithMatch(match string) error {
+	var cursor uint64
+	var deleted int
+	for {
+		keys, nextCursor, err := redisClient.Scan(ctx, cursor, match, scanBatch).Result()
+		if err != nil {
+			return err
+		}
 		if len(keys) > 0 {
-			_, err = redisClient.Del(ctx, keys...).Result()
-			if err != nil {
+			if err := redisClient.Del(ctx, keys...).Err(); err != nil {
 				return err
 			}
-			log.Println("成功删除相关对应key", keys)
+			deleted += len(keys)
+		}
+		cursor = nextCursor
+		if cursor == 0 {
+			break
 		}
 	}
-
+	if deleted == 0 {
+		zlog.Info("没有找到对应的key：" + match)
+	} else {
+		zlog.Info(fmt.Sprintf("成功删除%d个匹配%s的key", deleted, match))
+	}
 	return nil
 }
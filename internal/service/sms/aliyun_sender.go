@@ -0,0 +1,64 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v4/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"go_chat/pkg/zlog"
+)
+
+// aliyunSender 阿里云短信服务
+type aliyunSender struct {
+	client       *dysmsapi20170525.Client
+	signName     string
+	templateCode string
+}
+
+// NewAliyunSender 使用AK&SK初始化账号Client，模板需要有名为code的变量
+func NewAliyunSender(accessKeyID, accessKeySecret, signName, templateCode string) (SMSSender, error) {
+	// 工程代码泄露可能会导致 AccessKey 泄露，并威胁账号下所有资源的安全性。
+	// 建议使用更安全的 STS 方式，更多鉴权访问方式请参见：https://help.aliyun.com/document_detail/378661.html。
+	conf := &openapi.Config{
+		AccessKeyId:     tea.String(accessKeyID),
+		AccessKeySecret: tea.String(accessKeySecret),
+	}
+	// Endpoint 请参考 https://api.aliyun.com/product/Dysmsapi
+	conf.Endpoint = tea.String("dysmsapi.aliyuncs.com")
+	client, err := dysmsapi20170525.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &aliyunSender{client: client, signName: signName, templateCode: templateCode}, nil
+}
+
+// Send SDK不支持ctx，超时由SDK的默认配置控制
+func (s *aliyunSender) Send(ctx context.Context, telephone, code string) error {
+	param, err := json.Marshal(map[string]string{"code": code})
+	if err != nil {
+		return err
+	}
+	sendSmsRequest := &dysmsapi20170525.SendSmsRequest{
+		SignName:      tea.String(s.signName),
+		TemplateCode:  tea.String(s.templateCode),
+		PhoneNumbers:  tea.String(telephone),
+		TemplateParam: tea.String(string(param)),
+	}
+	rsp, err := s.client.SendSmsWithOptions(sendSmsRequest, &util.RuntimeOptions{})
+	if err != nil {
+		return err
+	}
+	zlog.Info(*util.ToJSONString(rsp))
+	// 请求成功但业务失败时Code不为OK，例如签名不存在、手机号格式错误
+	if rsp.Body == nil || tea.StringValue(rsp.Body.Code) != "OK" {
+		message := "阿里云短信发送失败"
+		if rsp.Body != nil {
+			message += "：" + tea.StringValue(rsp.Body.Code) + " " + tea.StringValue(rsp.Body.Message)
+		}
+		return errors.New(message)
+	}
+	return nil
+}
@@ -1,13 +1,10 @@
 package sms
 
 import (
-	"fmt"
-	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
-	dysmsapi20170525 "github.com/alibabacloud-go/dysmsapi-20170525/v4/client"
-	util "github.com/alibabacloud-go/tea-utils/v2/service"
-	"github.com/alibabacloud-go/tea/tea"
-	"go_chat/internal/config"
-	"go_chat/internal/service/redis"
+	"context"
+	"errors"
+	"go_chat/internal/service/cache"
+	"go_chat/internal/service/ratelimit"
 	"go_chat/pkg/constants"
 	"go_chat/pkg/util/random"
 	"go_chat/pkg/zlog"
@@ -15,37 +12,36 @@ import (
 	"time"
 )
 
-var smsClient *dysmsapi20170525.Client
+const (
+	AuthCodeExpire  = time.Minute      // 验证码有效期
+	authCodeTimeout = 10 * time.Second // 等待服务商受理的最长时间
+)
 
-// createClient 使用AK&SK初始化账号Client
-func createClient() (result *dysmsapi20170525.Client, err error) {
-	// 工程代码泄露可能会导致 AccessKey 泄露，并威胁账号下所有资源的安全性。以下代码示例仅供参考。
-	// 建议使用更安全的 STS 方式，更多鉴权访问方式请参见：https://help.aliyun.com/document_detail/378661.html。
-	accessKeyID := config.GetConfig().AccessKeyID
-	accessKeySecret := config.GetConfig().AccessKeySecret
-	if smsClient == nil {
-		config := &openapi.Config{
-			// 必填，请确保代码运行环境设置了环境变量 ALIBABA_CLOUD_ACCESS_KEY_ID。
-			AccessKeyId: tea.String(accessKeyID),
-			// 必填，请确保代码运行环境设置了环境变量 ALIBABA_CLOUD_ACCESS_KEY_SECRET。
-			AccessKeySecret: tea.String(accessKeySecret),
-		}
-		// Endpoint 请参考 https://api.aliyun.com/product/Dysmsapi
-		config.Endpoint = tea.String("dysmsapi.aliyuncs.com")
-		smsClient, err = dysmsapi20170525.NewClient(config)
-	}
-	return smsClient, err
+type authCodeService struct {
+	cache  cache.Cache
+	sender SMSSender
+	guard  *ratelimit.Guard
 }
 
-func VerificationCode(telephone string) (string, int) {
-	client, err := createClient()
-	if err != nil {
-		zlog.Error(err.Error())
-		return constants.SYSTEM_ERROR, -1
-	}
+// AuthCodeService 由 Init 创建
+var AuthCodeService *authCodeService
+
+// Init 注入依赖，需要在注册路由之前调用
+func Init(c cache.Cache, sender SMSSender) {
+	AuthCodeService = NewAuthCodeService(c, sender)
+}
+
+// NewAuthCodeService 验证码保存在缓存中，key为auth_code_加手机号
+func NewAuthCodeService(c cache.Cache, sender SMSSender) *authCodeService {
+	return &authCodeService{cache: c, sender: sender, guard: ratelimit.NewGuard(c)}
+}
+
+// VerificationCode 生成验证码并发送，上一个验证码未过期时不重新发送
+// 只有真正发送时才计入频率限制和每日配额
+func (a *authCodeService) VerificationCode(telephone, clientIp string) (string, int) {
 	key := "auth_code_" + telephone
-	code, err := redis.GetKey(key)
-	if err != nil {
+	code, err := a.cache.Get(key)
+	if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
@@ -56,27 +52,30 @@ func VerificationCode(telephone string) (string, int) {
 		return message, -2
 	}
 
+	if message, ret := a.guard.AllowSmsSend(telephone, clientIp); ret != 0 {
+		return message, ret
+	}
+
 	//验证码过期，重新生成
 	code = strconv.Itoa(random.GetRandomInt(6))
-	fmt.Println(code)
-	err = redis.SetKeyEx(key, code, time.Minute)
-	if err != nil {
+	if err := a.cache.Set(key, code, AuthCodeExpire); err != nil {
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, -1
 	}
-	sendSmsRequest := &dysmsapi20170525.SendSmsRequest{
-		SignName:      tea.String("阿里云短信测试"),
-		TemplateCode:  tea.String("SMS_154950909"), // 短信模板
-		PhoneNumbers:  tea.String(telephone),
-		TemplateParam: tea.String("{\"code\":\"" + code + "\"}"),
+	// 新验证码重新计算输错次数
+	if err := a.guard.ResetCodeAttempts(key); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, -1
 	}
-	runtime := &util.RuntimeOptions{}
-	// 目前使用的是测试专用签名，签名必须是“阿里云短信测试”，模板code为“SMS_154950909”
-	rsp, err := client.SendSmsWithOptions(sendSmsRequest, runtime)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), authCodeTimeout)
+	defer cancel()
+	if err := a.sender.Send(ctx, telephone, code); err != nil {
 		zlog.Error(err.Error())
+		// 发送失败时允许立即重试
+		if err := a.cache.Del(key); err != nil {
+			zlog.Error(err.Error())
+		}
 		return constants.SYSTEM_ERROR, -1
 	}
-	zlog.Info(*util.ToJSONString(rsp))
 	return "验证码发送成功，请及时在对应电话查收短信", 0
 }
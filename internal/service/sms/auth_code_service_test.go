@@ -0,0 +1,74 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"go_chat/internal/service/cache"
+	"testing"
+)
+
+// failingSender 服务商拒绝受理
+type failingSender struct {
+	calls int
+}
+
+func (s *failingSender) Send(ctx context.Context, telephone, code string) error {
+	s.calls++
+	return errors.New("服务商不可用")
+}
+
+const testTelephone = "13800000000"
+
+func TestVerificationCode(t *testing.T) {
+	c := cache.NewMemoryCache()
+	sender := NewLocalSender()
+	a := NewAuthCodeService(c, sender)
+
+	if message, ret := a.VerificationCode(testTelephone, "127.0.0.1"); ret != 0 {
+		t.Fatalf("VerificationCode = %s, %d", message, ret)
+	}
+	code, ok := sender.LastCode(testTelephone)
+	if !ok || len(code) != 6 {
+		t.Fatalf("LastCode = %q, %v", code, ok)
+	}
+	if stored, err := c.Get("auth_code_" + testTelephone); err != nil || stored != code {
+		t.Fatalf("stored code = %q, %v, want %q", stored, err, code)
+	}
+
+	// 验证码未过期时不重新发送，已发送的验证码保持不变
+	if message, ret := a.VerificationCode(testTelephone, "127.0.0.1"); ret != -2 {
+		t.Fatalf("resend = %s, %d, want -2", message, ret)
+	}
+	if again, _ := sender.LastCode(testTelephone); again != code {
+		t.Fatalf("code changed to %q after a refused resend", again)
+	}
+	if stored, _ := c.Get("auth_code_" + testTelephone); stored != code {
+		t.Fatalf("stored code changed to %q after a refused resend", stored)
+	}
+}
+
+func TestVerificationCodeSendFailure(t *testing.T) {
+	c := cache.NewMemoryCache()
+	failing := &failingSender{}
+	a := NewAuthCodeService(c, failing)
+
+	if message, ret := a.VerificationCode(testTelephone, "127.0.0.1"); ret != -1 {
+		t.Fatalf("VerificationCode = %s, %d, want -1", message, ret)
+	}
+	if failing.calls != 1 {
+		t.Fatalf("Send called %d times, want 1", failing.calls)
+	}
+	// 发送失败时删除验证码，否则用户要等验证码过期才能重试
+	if _, err := c.Get("auth_code_" + testTelephone); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Fatalf("code left in cache after a failed send: %v", err)
+	}
+
+	sender := NewLocalSender()
+	a.sender = sender
+	if message, ret := a.VerificationCode(testTelephone, "127.0.0.1"); ret != 0 {
+		t.Fatalf("retry = %s, %d, want 0", message, ret)
+	}
+	if _, ok := sender.LastCode(testTelephone); !ok {
+		t.Fatal("retry did not send a code")
+	}
+}
@@ -0,0 +1,71 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const httpSenderTimeout = 10 * time.Second
+
+// httpSender 通用短信网关，POST json到gatewayURL，2xx视为成功
+type httpSender struct {
+	client       *http.Client
+	url          string
+	token        string
+	signName     string
+	templateCode string
+}
+
+// httpSendRequest 网关收到的请求体
+type httpSendRequest struct {
+	Telephone    string `json:"telephone"`
+	Code         string `json:"code"`
+	SignName     string `json:"sign_name"`
+	TemplateCode string `json:"template_code"`
+}
+
+// NewHTTPSender token不为空时放在Authorization: Bearer中
+func NewHTTPSender(url, token, signName, templateCode string) SMSSender {
+	return &httpSender{
+		client:       &http.Client{Timeout: httpSenderTimeout},
+		url:          url,
+		token:        token,
+		signName:     signName,
+		templateCode: templateCode,
+	}
+}
+
+func (s *httpSender) Send(ctx context.Context, telephone, code string) error {
+	body, err := json.Marshal(httpSendRequest{
+		Telephone:    telephone,
+		Code:         code,
+		SignName:     s.signName,
+		TemplateCode: s.templateCode,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(rsp.Body, 512))
+		return fmt.Errorf("短信网关返回%d：%s", rsp.StatusCode, detail)
+	}
+	return nil
+}
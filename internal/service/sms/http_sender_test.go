@@ -0,0 +1,66 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go_chat/internal/service/cache"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestGateway 返回status的短信网关，记录收到的请求
+func newTestGateway(t *testing.T, status int, received *[]httpSendRequest) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req httpSendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*received = append(*received, req)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("gateway says " + http.StatusText(status)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPSender(t *testing.T) {
+	var received []httpSendRequest
+	server := newTestGateway(t, http.StatusOK, &received)
+	sender := NewHTTPSender(server.URL, "secret", "go_chat", "SMS_1")
+	if err := sender.Send(context.Background(), testTelephone, "123456"); err != nil {
+		t.Fatal(err)
+	}
+	want := httpSendRequest{Telephone: testTelephone, Code: "123456", SignName: "go_chat", TemplateCode: "SMS_1"}
+	if len(received) != 1 || received[0] != want {
+		t.Fatalf("received = %+v, want %+v", received, want)
+	}
+}
+
+func TestHTTPSenderNon2xx(t *testing.T) {
+	var received []httpSendRequest
+	server := newTestGateway(t, http.StatusBadGateway, &received)
+	sender := NewHTTPSender(server.URL, "secret", "go_chat", "SMS_1")
+	err := sender.Send(context.Background(), testTelephone, "123456")
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "Bad Gateway") {
+		t.Fatalf("Send error = %v, want the status and body", err)
+	}
+
+	// 网关拒绝时验证服务返回系统错误并删除验证码
+	c := cache.NewMemoryCache()
+	a := NewAuthCodeService(c, sender)
+	if message, ret := a.VerificationCode(testTelephone, "127.0.0.1"); ret != -1 {
+		t.Fatalf("VerificationCode = %s, %d, want -1", message, ret)
+	}
+	if _, err := c.Get("auth_code_" + testTelephone); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Fatalf("code left in cache after the gateway refused: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package sms
+
+import (
+	"context"
+	"go_chat/pkg/zlog"
+	"sync"
+)
+
+// LocalSender 不发送短信，只记录验证码，用于本地开发和无法访问短信服务的测试环境
+type LocalSender struct {
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+func NewLocalSender() *LocalSender {
+	return &LocalSender{codes: make(map[string]string)}
+}
+
+// Send 记录验证码并写入日志，方便开发时查看
+func (s *LocalSender) Send(ctx context.Context, telephone, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[telephone] = code
+	zlog.Info("本地短信，手机号" + telephone + "的验证码为" + code)
+	return nil
+}
+
+// LastCode 该手机号最近一次收到的验证码
+func (s *LocalSender) LastCode(telephone string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[telephone]
+	return code, ok
+}
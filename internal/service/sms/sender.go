@@ -0,0 +1,28 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"go_chat/internal/config"
+)
+
+// SMSSender 发送验证码短信，按 authCodeConfig.provider 选择实现
+type SMSSender interface {
+	// Send 发送验证码，返回nil只表示服务商已受理
+	Send(ctx context.Context, telephone, code string) error
+}
+
+// NewFromConfig 按配置创建发送者，provider为空时使用阿里云
+func NewFromConfig(conf *config.Config) (SMSSender, error) {
+	c := conf.AuthCodeConfig
+	switch c.Provider {
+	case "", "aliyun":
+		return NewAliyunSender(c.AccessKeyID, c.AccessKeySecret, c.SignName, c.TemplateCode)
+	case "http":
+		return NewHTTPSender(c.GatewayURL, c.GatewayToken, c.SignName, c.TemplateCode), nil
+	case "local":
+		return NewLocalSender(), nil
+	default:
+		return nil, fmt.Errorf("不支持的短信服务商：%s", c.Provider)
+	}
+}
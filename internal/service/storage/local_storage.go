@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// localStorage 保存在本地目录，url为urlPrefix/key
+type localStorage struct {
+	dir       string
+	urlPrefix string
+}
+
+// NewLocalStorage dir不存在时在第一次写入时创建
+func NewLocalStorage(dir, urlPrefix string) Storage {
+	return &localStorage{dir: dir, urlPrefix: urlPrefix}
+}
+
+// Put 先写临时文件再重命名，避免读到写了一半的文件
+func (s *localStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, key)); err != nil {
+		return "", err
+	}
+	return path.Join(s.urlPrefix, key), nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
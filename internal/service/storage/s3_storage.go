@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go_chat/internal/config"
+	"io"
+	"strings"
+)
+
+// s3Storage 保存在S3兼容的对象存储（MinIO、OSS、COS等），对象名为prefix+key
+type s3Storage struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	publicURL string
+}
+
+// newS3Client 创建客户端并检查bucket是否存在，启动时尽早发现配置错误
+func newS3Client(ctx context.Context, conf config.StorageConfig) (*s3Storage, error) {
+	client, err := minio.New(conf.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""),
+		Secure: conf.UseSSL,
+		Region: conf.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists, err := client.BucketExists(ctx, conf.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("检查bucket %s失败: %w", conf.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s不存在", conf.Bucket)
+	}
+	publicURL := conf.PublicURL
+	if publicURL == "" {
+		scheme := "http"
+		if conf.UseSSL {
+			scheme = "https"
+		}
+		publicURL = fmt.Sprintf("%s://%s/%s", scheme, conf.Endpoint, conf.Bucket)
+	}
+	return &s3Storage{client: client, bucket: conf.Bucket, publicURL: strings.TrimRight(publicURL, "/")}, nil
+}
+
+// withPrefix 共用同一个客户端，对象名加上前缀
+func (s *s3Storage) withPrefix(prefix string) Storage {
+	return &s3Storage{client: s.client, bucket: s.bucket, prefix: prefix, publicURL: s.publicURL}
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", err
+	}
+	return s.publicURL + "/" + s.prefix + key, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,59 @@
+// Package storage 上传文件的存储，支持本地磁盘和S3兼容的对象存储
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_chat/internal/config"
+	"io"
+	"strings"
+)
+
+// Storage 按key保存文件，key由调用方生成，只能包含文件名，不能带路径
+type Storage interface {
+	// Put 保存文件，返回前端访问用的url
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (string, error)
+	// Delete 删除文件，文件不存在时不报错
+	Delete(ctx context.Context, key string) error
+}
+
+const (
+	BACKEND_LOCAL = "local"
+	BACKEND_S3    = "s3"
+
+	avatarDir = "avatars"
+	fileDir   = "files"
+)
+
+// ErrInvalidKey key为空或者带了路径
+var ErrInvalidKey = errors.New("文件名不合法")
+
+// NewFromConfig 按配置创建头像和文件的存储
+// 本地存储分别写入staticAvatarPath和staticFilePath，由/static路由对外提供访问
+// S3存储写入同一个bucket，用avatars/和files/前缀区分
+func NewFromConfig(ctx context.Context, conf *config.Config) (avatars Storage, files Storage, err error) {
+	switch conf.StorageConfig.Backend {
+	case "", BACKEND_LOCAL:
+		avatars = NewLocalStorage(conf.StaticAvatarPath, "/static/avatars")
+		files = NewLocalStorage(conf.StaticFilePath, "/static/files")
+		return avatars, files, nil
+	case BACKEND_S3:
+		client, err := newS3Client(ctx, conf.StorageConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		avatars = client.withPrefix(avatarDir + "/")
+		files = client.withPrefix(fileDir + "/")
+		return avatars, files, nil
+	default:
+		return nil, nil, fmt.Errorf("不支持的存储类型%q", conf.StorageConfig.Backend)
+	}
+}
+
+func checkKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go_chat/internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 只实现了存储用到的几个S3接口：检查bucket、上传和删除对象，不校验签名
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]fakeObject // key为bucket内的对象名
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, string) {
+	t.Helper()
+	s := &fakeS3{bucket: bucket, objects: make(map[string]fakeObject)}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, strings.TrimPrefix(server.URL, "http://")
+}
+
+// ServeHTTP 路径风格的请求，/bucket/object
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		if r.Method != http.MethodHead {
+			_, _ = io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`)
+		}
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case object == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case object != "" && r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err == nil && strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data, err = decodeAWSChunked(data)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[object] = fakeObject{data: data, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"fake-etag"`)
+		w.WriteHeader(http.StatusOK)
+	case object != "" && r.Method == http.MethodDelete:
+		delete(s.objects, object)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// decodeAWSChunked 去掉流式签名的分块格式：<十六进制长度>;chunk-signature=...\r\n<数据>\r\n，长度为0时结束
+func decodeAWSChunked(body []byte) ([]byte, error) {
+	var data []byte
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return nil, errors.New("bad chunk header")
+		}
+		sizeHex, _, _ := strings.Cut(string(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size > int64(len(rest)) {
+			return nil, errors.New("bad chunk size")
+		}
+		if size == 0 {
+			return data, nil
+		}
+		data = append(data, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+}
+
+func (s *fakeS3) object(name string) (fakeObject, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[name]
+	return object, ok
+}
+
+func s3Config(endpoint, bucket, publicURL string) *config.Config {
+	conf := new(config.Config)
+	conf.StorageConfig = config.StorageConfig{
+		Backend:   BACKEND_S3,
+		Endpoint:  endpoint,
+		Bucket:    bucket,
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+		Region:    "us-east-1",
+		PublicURL: publicURL,
+	}
+	return conf
+}
+
+func TestS3Storage(t *testing.T) {
+	fake, endpoint := newFakeS3(t, "chat")
+	ctx := context.Background()
+	avatars, files, err := NewFromConfig(ctx, s3Config(endpoint, "chat", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := avatars.Put(ctx, "a.png", bytes.NewReader([]byte("png")), 3, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://" + endpoint + "/chat/avatars/a.png"; url != want {
+		t.Fatalf("url = %s, want %s", url, want)
+	}
+	object, ok := fake.object("avatars/a.png")
+	if !ok || string(object.data) != "png" || object.contentType != "image/png" {
+		t.Fatalf("stored object = %+v, %v", object, ok)
+	}
+
+	if _, err := files.Put(ctx, "b.txt", bytes.NewReader([]byte("hello")), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.object("files/b.txt"); !ok {
+		t.Fatal("file should be stored under files/")
+	}
+	if err := files.Delete(ctx, "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.object("files/b.txt"); ok {
+		t.Fatal("file should be deleted")
+	}
+	// 对象不存在时删除不报错
+	if err := files.Delete(ctx, "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "..", "../a.png", "dir/a.png", `dir\a.png`} {
+		if _, err := avatars.Put(ctx, key, bytes.NewReader(nil), 0, "image/png"); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestS3StoragePublicURL(t *testing.T) {
+	_, endpoint := newFakeS3(t, "chat")
+	avatars, _, err := NewFromConfig(context.Background(), s3Config(endpoint, "chat", "https://cdn.example.com/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := avatars.Put(context.Background(), "a.png", bytes.NewReader([]byte("png")), 3, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://cdn.example.com/avatars/a.png" {
+		t.Fatalf("url = %s", url)
+	}
+}
+
+func TestS3StorageMissingBucket(t *testing.T) {
+	_, endpoint := newFakeS3(t, "chat")
+	if _, _, err := NewFromConfig(context.Background(), s3Config(endpoint, "missing", "")); err == nil {
+		t.Fatal("NewFromConfig should fail when the bucket does not exist")
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "files")
+	s := NewLocalStorage(dir, "/static/files")
+	ctx := context.Background()
+
+	url, err := s.Put(ctx, "a.txt", strings.NewReader("hello"), 5, "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/static/files/a.txt" {
+		t.Fatalf("url = %s", url)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("stored = %q, %v", data, err)
+	}
+	// 写入成功后不留下临时文件
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("dir entries = %v, %v", entries, err)
+	}
+
+	// 取消的上传不落盘
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.Put(canceled, "b.txt", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Fatal("Put with canceled context should fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Fatalf("canceled upload left b.txt: %v", err)
+	}
+
+	if err := s.Delete(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "a.txt"); err != nil {
+		t.Fatalf("Delete missing file = %v, want nil", err)
+	}
+	if _, err := s.Put(ctx, "../escape.txt", strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Put outside dir error = %v, want ErrInvalidKey", err)
+	}
+}
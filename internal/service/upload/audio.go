@@ -0,0 +1,326 @@
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// errUnknownAudio 不支持解析时长的格式，例如webm
+var errUnknownAudio = errors.New("不支持解析该音频格式的时长")
+
+// errBadAudio 文件头和格式不符
+var errBadAudio = errors.New("音频文件已损坏")
+
+// maxAudioDuration 解析出的时长超过它说明文件头被篡改
+const maxAudioDuration = 24 * time.Hour
+
+// scaleDuration 把count个单位换算为时长，unitsPerSecond为每秒的单位数
+// 用128位中间结果避免溢出，结果超过maxAudioDuration时返回errBadAudio
+func scaleDuration(count, unitsPerSecond uint64) (time.Duration, error) {
+	if unitsPerSecond == 0 {
+		return 0, errBadAudio
+	}
+	hi, lo := bits.Mul64(count, uint64(time.Second))
+	if hi >= unitsPerSecond {
+		return 0, errBadAudio
+	}
+	quo, _ := bits.Div64(hi, lo, unitsPerSecond)
+	if quo > uint64(maxAudioDuration) {
+		return 0, errBadAudio
+	}
+	return time.Duration(quo), nil
+}
+
+// audioDuration 按文件头判断格式并解析时长，支持wav、mp3、m4a(mp4容器)、ogg(opus/vorbis)、amr
+func audioDuration(r io.ReadSeeker, size int64) (time.Duration, error) {
+	head := make([]byte, 12)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+	head = head[:n]
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	switch {
+	case n == 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return wavDuration(r)
+	case n >= 8 && string(head[4:8]) == "ftyp":
+		return mp4Duration(r, size)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return oggDuration(r, size)
+	case bytes.HasPrefix(head, []byte("#!AMR")):
+		return amrDuration(r)
+	case bytes.HasPrefix(head, []byte("ID3")) || (n >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0):
+		return mp3Duration(r, size)
+	}
+	return 0, errUnknownAudio
+}
+
+// wavDuration data块大小除以fmt块中的每秒字节数
+func wavDuration(r io.ReadSeeker) (time.Duration, error) {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var byteRate uint32
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0, errBadAudio
+		}
+		id, chunkSize := string(chunk[:4]), binary.LittleEndian.Uint32(chunk[4:])
+		switch id {
+		case "fmt ":
+			fmtChunk := make([]byte, 16)
+			if chunkSize < 16 {
+				return 0, errBadAudio
+			}
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return 0, errBadAudio
+			}
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+			chunkSize -= 16
+		case "data":
+			return scaleDuration(uint64(chunkSize), uint64(byteRate))
+		}
+		// 块按偶数字节对齐，chunkSize可能是0xFFFFFFFF，先转成int64再加
+		if _, err := r.Seek(int64(chunkSize)+int64(chunkSize&1), io.SeekCurrent); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// mp4Duration 读取moov/mvhd中的时长和时间单位
+func mp4Duration(r io.ReadSeeker, size int64) (time.Duration, error) {
+	moovStart, moovEnd, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhdStart, _, err := findBox(r, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(mvhdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+	mvhd := make([]byte, 32)
+	if _, err := io.ReadFull(r, mvhd); err != nil {
+		return 0, errBadAudio
+	}
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	return scaleDuration(duration, timescale)
+}
+
+// findBox 在[start, end)中查找名为name的box，返回box内容的起止位置
+func findBox(r io.ReadSeeker, start, end int64, name string) (int64, int64, error) {
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return 0, 0, errBadAudio
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header[:4])), int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = end - pos
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return 0, 0, errBadAudio
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		// 64位的box大小可能是负数，和剩余长度比较避免相加溢出
+		if boxSize < headerSize || boxSize > end-pos {
+			return 0, 0, errBadAudio
+		}
+		if string(header[4:8]) == name {
+			return pos + headerSize, pos + boxSize, nil
+		}
+		pos += boxSize
+	}
+	return 0, 0, errBadAudio
+}
+
+// oggDuration 最后一页的granule position除以采样率，opus固定按48kHz计算并减去pre-skip
+func oggDuration(r io.ReadSeeker, size int64) (time.Duration, error) {
+	page := make([]byte, 27+255)
+	if _, err := io.ReadFull(r, page[:27]); err != nil {
+		return 0, errBadAudio
+	}
+	segments := int(page[26])
+	if _, err := io.ReadFull(r, page[27:27+segments]); err != nil {
+		return 0, errBadAudio
+	}
+	packet := make([]byte, 19)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, errBadAudio
+	}
+	var sampleRate, preSkip uint64
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		sampleRate, preSkip = 48000, uint64(binary.LittleEndian.Uint16(packet[10:12]))
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		sampleRate = uint64(binary.LittleEndian.Uint32(packet[12:16]))
+	default:
+		return 0, errUnknownAudio
+	}
+	tailSize := min(size, 64<<10)
+	if _, err := r.Seek(size-tailSize, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail := make([]byte, tailSize)
+	if _, err := io.ReadFull(r, tail); err != nil {
+		return 0, errBadAudio
+	}
+	last := bytes.LastIndex(tail, []byte("OggS"))
+	if last < 0 || last+14 > len(tail) {
+		return 0, errBadAudio
+	}
+	granule := binary.LittleEndian.Uint64(tail[last+6 : last+14])
+	if granule < preSkip {
+		return 0, nil
+	}
+	return scaleDuration(granule-preSkip, sampleRate)
+}
+
+// amr每帧20ms，帧长由帧头的mode决定，不含帧头本身
+var (
+	amrNbFrameSizes = [16]int{12, 13, 15, 17, 19, 20, 26, 31, 5, 0, 0, 0, 0, 0, 0, 0}
+	amrWbFrameSizes = [16]int{17, 23, 32, 36, 40, 46, 50, 58, 60, 5, 0, 0, 0, 0, 0, 0}
+)
+
+const amrFrameDuration = 20 * time.Millisecond
+
+// amrDuration 逐帧累加，支持AMR-NB和AMR-WB
+func amrDuration(r io.Reader) (time.Duration, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.ReadString('\n')
+	if err != nil {
+		return 0, errBadAudio
+	}
+	frameSizes := &amrNbFrameSizes
+	switch magic {
+	case "#!AMR\n":
+	case "#!AMR-WB\n":
+		frameSizes = &amrWbFrameSizes
+	default:
+		return 0, errUnknownAudio
+	}
+	var frames int64
+	for {
+		toc, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, err := br.Discard(frameSizes[toc>>3&0x0F]); err != nil {
+			break
+		}
+		frames++
+		if time.Duration(frames)*amrFrameDuration > maxAudioDuration {
+			return 0, errBadAudio
+		}
+	}
+	return time.Duration(frames) * amrFrameDuration, nil
+}
+
+// mp3只解析Layer III，语音消息没有其他Layer
+var (
+	mp3Bitrates1    = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3Bitrates2    = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3SampleRates1 = [3]int{44100, 48000, 32000}
+)
+
+// mp3Duration 有Xing/Info/VBRI头时按总帧数计算，否则按第一帧的码率当作CBR估算
+func mp3Duration(r io.ReadSeeker, size int64) (time.Duration, error) {
+	var audioStart int64
+	id3 := make([]byte, 10)
+	if _, err := io.ReadFull(r, id3); err != nil {
+		return 0, errBadAudio
+	}
+	if string(id3[:3]) == "ID3" {
+		tagSize := int64(id3[6]&0x7F)<<21 | int64(id3[7]&0x7F)<<14 | int64(id3[8]&0x7F)<<7 | int64(id3[9]&0x7F)
+		audioStart = 10 + tagSize
+		if id3[5]&0x10 != 0 {
+			audioStart += 10
+		}
+	}
+	if _, err := r.Seek(audioStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 4096)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, errBadAudio
+	}
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version, layer := buf[i+1]>>3&0x03, buf[i+1]>>1&0x03
+		bitrateIndex, sampleRateIndex := buf[i+2]>>4, buf[i+2]>>2&0x03
+		if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+			continue
+		}
+		mono := buf[i+3]>>6 == 3
+		bitrate, sampleRate, samplesPerFrame := mp3Bitrates1[bitrateIndex], mp3SampleRates1[sampleRateIndex], 1152
+		sideInfo := 32
+		if mono {
+			sideInfo = 17
+		}
+		if version != 3 {
+			// MPEG2和MPEG2.5
+			bitrate, samplesPerFrame = mp3Bitrates2[bitrateIndex], 576
+			sampleRate /= 2
+			if version == 0 {
+				sampleRate /= 2
+			}
+			sideInfo = 17
+			if mono {
+				sideInfo = 9
+			}
+		}
+		frame := buf[i:]
+		if frames, ok := mp3FrameCount(frame, 4+sideInfo); ok {
+			return scaleDuration(uint64(frames)*uint64(samplesPerFrame), uint64(sampleRate))
+		}
+		audioSize := size - audioStart - int64(i)
+		if audioSize <= 0 {
+			return 0, errBadAudio
+		}
+		return scaleDuration(uint64(audioSize)*8, uint64(bitrate)*1000)
+	}
+	return 0, errBadAudio
+}
+
+// mp3FrameCount 从第一帧的Xing/Info或VBRI头读取总帧数
+func mp3FrameCount(frame []byte, xingOffset int) (uint32, bool) {
+	if len(frame) >= xingOffset+12 {
+		tag := string(frame[xingOffset : xingOffset+4])
+		flags := binary.BigEndian.Uint32(frame[xingOffset+4 : xingOffset+8])
+		if (tag == "Xing" || tag == "Info") && flags&0x01 != 0 {
+			return binary.BigEndian.Uint32(frame[xingOffset+8 : xingOffset+12]), true
+		}
+	}
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		return binary.BigEndian.Uint32(frame[36+14 : 36+18]), true
+	}
+	return 0, false
+}
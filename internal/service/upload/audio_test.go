@@ -0,0 +1,235 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func le16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+func le32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func be64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+func join(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+// riffChunk 块头中的大小可以和实际内容不一致，用来构造损坏的文件
+func riffChunk(id string, size uint32, payload []byte) []byte {
+	chunk := join([]byte(id), le32(size), payload)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func wavFmt(byteRate uint32) []byte {
+	// PCM，单声道，采样率和每秒字节数相同，16位
+	return riffChunk("fmt ", 16, join(le16(1), le16(1), le32(byteRate), le32(byteRate), le16(2), le16(16)))
+}
+
+func wavFile(chunks ...[]byte) []byte {
+	body := join(append([][]byte{[]byte("WAVE")}, chunks...)...)
+	return join([]byte("RIFF"), le32(uint32(len(body))), body)
+}
+
+func mp4Box(name string, payload ...[]byte) []byte {
+	content := join(payload...)
+	return join(be32(uint32(8+len(content))), []byte(name), content)
+}
+
+func mvhdV0(timescale, duration uint32) []byte {
+	return mp4Box("mvhd", []byte{0, 0, 0, 0}, be32(0), be32(0), be32(timescale), be32(duration), make([]byte, 80))
+}
+
+func mvhdV1(timescale uint32, duration uint64) []byte {
+	return mp4Box("mvhd", []byte{1, 0, 0, 0}, be64(0), be64(0), be32(timescale), be64(duration), make([]byte, 80))
+}
+
+func m4aFile(boxes ...[]byte) []byte {
+	return join(append([][]byte{mp4Box("ftyp", []byte("M4A "), be32(0))}, boxes...)...)
+}
+
+func oggPage(granule uint64, payload []byte) []byte {
+	header := join([]byte("OggS"), []byte{0, 0}, binary.LittleEndian.AppendUint64(nil, granule), le32(1), le32(0), le32(0), []byte{1, byte(len(payload))})
+	return join(header, payload)
+}
+
+func opusHead(preSkip uint16) []byte {
+	return join([]byte("OpusHead"), []byte{1, 1}, le16(preSkip), le32(48000), le16(0), []byte{0})
+}
+
+func vorbisHead(sampleRate uint32) []byte {
+	return join([]byte("\x01vorbis"), le32(0), []byte{1}, le32(sampleRate), make([]byte, 13))
+}
+
+func amrFile(magic string, toc byte, frameSize, frames int) []byte {
+	data := []byte(magic)
+	for i := 0; i < frames; i++ {
+		data = append(data, toc)
+		data = append(data, make([]byte, frameSize)...)
+	}
+	return data
+}
+
+// mp3Header MPEG1 Layer III，128kbps，44100Hz，联合立体声
+var mp3Header = []byte{0xFF, 0xFB, 0x90, 0x64}
+
+func mp3CBR(size int) []byte {
+	return join(mp3Header, make([]byte, size-len(mp3Header)))
+}
+
+func mp3Xing(frames uint32) []byte {
+	return join(mp3Header, make([]byte, 32), []byte("Xing"), be32(1), be32(frames), make([]byte, 400))
+}
+
+// id3Tag tagSize按syncsafe整数编码
+func id3Tag(tagSize int) []byte {
+	size := []byte{byte(tagSize >> 21 & 0x7F), byte(tagSize >> 14 & 0x7F), byte(tagSize >> 7 & 0x7F), byte(tagSize & 0x7F)}
+	return join([]byte("ID3"), []byte{4, 0, 0}, size, make([]byte, tagSize))
+}
+
+var audioCases = []struct {
+	name string
+	data []byte
+	want time.Duration
+	err  error
+}{
+	{"wav", wavFile(wavFmt(16000), riffChunk("data", 32000, make([]byte, 32000))), 2 * time.Second, nil},
+	{"wav odd chunk before data", wavFile(wavFmt(16000), riffChunk("LIST", 3, []byte("abc")), riffChunk("data", 8000, nil)), 500 * time.Millisecond, nil},
+	{"wav data before fmt", wavFile(riffChunk("data", 8000, nil), wavFmt(16000)), 0, errBadAudio},
+	{"wav short fmt", wavFile(riffChunk("fmt ", 8, make([]byte, 8)), riffChunk("data", 8000, nil)), 0, errBadAudio},
+	{"wav oversized chunk", wavFile(wavFmt(16000), riffChunk("LIST", 0xFFFFFFFF, nil), riffChunk("data", 8000, nil)), 0, errBadAudio},
+	{"wav no data", wavFile(wavFmt(16000)), 0, errBadAudio},
+	{"wav huge data", wavFile(wavFmt(1), riffChunk("data", 0xFFFFFFFE, nil)), 0, errBadAudio},
+
+	{"m4a", m4aFile(mp4Box("free", make([]byte, 10)), mp4Box("moov", mvhdV0(1000, 3500))), 3500 * time.Millisecond, nil},
+	{"m4a mvhd v1", m4aFile(mp4Box("moov", mp4Box("trak"), mvhdV1(44100, 88200))), 2 * time.Second, nil},
+	{"m4a zero timescale", m4aFile(mp4Box("moov", mvhdV0(0, 3500))), 0, errBadAudio},
+	{"m4a no moov", m4aFile(mp4Box("mdat", make([]byte, 16))), 0, errBadAudio},
+	{"m4a box bigger than file", m4aFile(join(be32(1<<20), []byte("moov"), mvhdV0(1000, 3500))), 0, errBadAudio},
+	{"m4a box smaller than header", m4aFile(join(be32(4), []byte("free")), mp4Box("moov", mvhdV0(1000, 3500))), 0, errBadAudio},
+	{"m4a negative 64-bit size", m4aFile(join(be32(1), []byte("free"), be64(1<<63))), 0, errBadAudio},
+	{"m4a huge 64-bit size", m4aFile(join(be32(1), []byte("free"), be64(1<<62))), 0, errBadAudio},
+	{"m4a huge duration", m4aFile(mp4Box("moov", mvhdV1(1, 1<<62))), 0, errBadAudio},
+
+	{"opus", join(oggPage(0, opusHead(312)), oggPage(0, make([]byte, 40)), oggPage(2*48000+312, make([]byte, 40))), 2 * time.Second, nil},
+	{"opus granule before pre-skip", join(oggPage(0, opusHead(312)), oggPage(100, nil)), 0, nil},
+	{"vorbis", join(oggPage(0, vorbisHead(44100)), oggPage(44100*3, make([]byte, 20))), 3 * time.Second, nil},
+	{"vorbis zero sample rate", join(oggPage(0, vorbisHead(0)), oggPage(44100, nil)), 0, errBadAudio},
+	{"ogg unknown codec", join(oggPage(0, []byte("\x80theora"+string(make([]byte, 12)))), oggPage(10, nil)), 0, errUnknownAudio},
+	{"ogg huge granule", join(oggPage(0, opusHead(0)), oggPage(1<<63, nil)), 0, errBadAudio},
+
+	{"amr-nb", amrFile("#!AMR\n", 0x3C, 31, 50), time.Second, nil},
+	{"amr-wb", amrFile("#!AMR-WB\n", 0x44, 60, 25), 500 * time.Millisecond, nil},
+	{"amr truncated last frame", amrFile("#!AMR\n", 0x3C, 31, 10)[:6+32*10-5], 9 * amrFrameDuration, nil},
+	{"amr unknown magic", []byte("#!AMR-XX\n\x3C"), 0, errUnknownAudio},
+
+	{"mp3 cbr", mp3CBR(1600), 100 * time.Millisecond, nil},
+	{"mp3 cbr with id3", join(id3Tag(100), mp3CBR(16000)), time.Second, nil},
+	{"mp3 xing", mp3Xing(100), time.Duration(100 * 1152 * int64(time.Second) / 44100), nil},
+	{"mp3 xing after garbage", join(id3Tag(10), []byte{0xFF, 0x00, 0x12}, mp3Xing(100)), time.Duration(100 * 1152 * int64(time.Second) / 44100), nil},
+	{"mp3 huge xing frames", mp3Xing(0xFFFFFFFF), 0, errBadAudio},
+	{"mp3 no frame", join(id3Tag(10), make([]byte, 100)), 0, errBadAudio},
+	{"mp3 id3 bigger than file", id3Tag(10)[:10], 0, errBadAudio},
+	{"mp3 bad bitrate", join([]byte{0xFF, 0xFB, 0xF0, 0x64}, make([]byte, 100)), 0, errBadAudio},
+
+	{"webm", join([]byte{0x1A, 0x45, 0xDF, 0xA3}, make([]byte, 20)), 0, errUnknownAudio},
+	{"empty", nil, 0, errUnknownAudio},
+}
+
+func TestAudioDuration(t *testing.T) {
+	for _, tc := range audioCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := audioDuration(bytes.NewReader(tc.data), int64(len(tc.data)))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("error = %v, want %v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Fatalf("duration = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// runAudioDuration 解析不能panic、不能卡住，出错时时长为0，成功时不能为负数或超过上限
+func runAudioDuration(data []byte, size int64) error {
+	type result struct {
+		duration time.Duration
+		err      error
+		panicked interface{}
+	}
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() {
+			res.panicked = recover()
+			done <- res
+		}()
+		res.duration, res.err = audioDuration(bytes.NewReader(data), size)
+	}()
+	select {
+	case res := <-done:
+		switch {
+		case res.panicked != nil:
+			return fmt.Errorf("panic: %v", res.panicked)
+		case res.err != nil && res.duration != 0:
+			return fmt.Errorf("duration %v with error %v", res.duration, res.err)
+		case res.duration < 0 || res.duration > maxAudioDuration:
+			return fmt.Errorf("duration %v out of range", res.duration)
+		}
+		return nil
+	case <-time.After(time.Second):
+		return errors.New("did not return within 1s")
+	}
+}
+
+// TestAudioDurationHostileInput 每个样本截断到任意长度、逐字节改写、声明的大小和实际不符时都要安全返回
+func TestAudioDurationHostileInput(t *testing.T) {
+	for _, tc := range audioCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for n := 0; n <= len(tc.data); n++ {
+				if err := runAudioDuration(tc.data[:n], int64(n)); err != nil {
+					t.Fatalf("truncated to %d: %v", n, err)
+				}
+			}
+			for i := range tc.data {
+				for _, b := range []byte{0x00, 0xFF} {
+					data := bytes.Clone(tc.data)
+					data[i] = b
+					if err := runAudioDuration(data, int64(len(data))); err != nil {
+						t.Fatalf("byte %d set to %#x: %v", i, b, err)
+					}
+				}
+			}
+			for _, size := range []int64{0, 1, int64(len(tc.data)) * 2, 1 << 40} {
+				if err := runAudioDuration(tc.data, size); err != nil {
+					t.Fatalf("declared size %d: %v", size, err)
+				}
+			}
+		})
+	}
+}
+
+func TestScaleDuration(t *testing.T) {
+	cases := []struct {
+		count, perSecond uint64
+		want             time.Duration
+		err              error
+	}{
+		{48000, 48000, time.Second, nil},
+		{1, 3, 333333333, nil},
+		{0, 1, 0, nil},
+		{1, 0, 0, errBadAudio},
+		{1 << 63, 1, 0, errBadAudio},
+		{uint64(maxAudioDuration/time.Second) + 1, 1, 0, errBadAudio},
+	}
+	for _, tc := range cases {
+		got, err := scaleDuration(tc.count, tc.perSecond)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Fatalf("scaleDuration(%d, %d) = %v, %v, want %v, %v", tc.count, tc.perSecond, got, err, tc.want, tc.err)
+		}
+	}
+}
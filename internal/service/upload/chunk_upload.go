@@ -0,0 +1,468 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_chat/internal/config"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/service/cache"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/util/random"
+	"go_chat/pkg/zlog"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultChunkExpire  = 24 * time.Hour
+	completeLockExpire  = 10 * time.Minute // 合并大文件需要的最长时间
+	chunkCleanInterval  = time.Hour
+	chunkDirName        = "go_chat_chunks"
+	uploadSessionPrefix = "upload:session:"  // 分片上传的元数据，json
+	uploadChunksPrefix  = "upload:chunks:"   // 已上传分片的序号，集合
+	uploadResumePrefix  = "upload:resume:"   // 用户+文件哈希对应的upload_id，用于续传
+	uploadLockPrefix    = "upload:lock:"     // 合并分片时加锁，防止重复提交
+	uploadedFilePrefix  = "upload:file:"     // 用户+文件哈希对应的已上传文件，用于秒传
+	uploadedFileExpire  = 7 * 24 * time.Hour // 秒传记录的有效期，过期后需要重新上传
+)
+
+// chunkUpload 一次分片上传，保存在缓存中，过期即视为放弃
+type chunkUpload struct {
+	UploadId    string `json:"upload_id"`
+	UserId      string `json:"user_id"`
+	FileName    string `json:"file_name"`
+	FileSize    int64  `json:"file_size"`
+	FileHash    string `json:"file_hash"`
+	ChunkSize   int64  `json:"chunk_size"`
+	ChunkCount  int    `json:"chunk_count"`
+	MessageType int    `json:"message_type"`
+	Instance    string `json:"instance"` // 开始上传的实例，分片只保存在它的本机磁盘上
+}
+
+// chunkLen 第index片的字节数，只有最后一片可能小于ChunkSize
+func (cu *chunkUpload) chunkLen(index int) int64 {
+	return min(cu.ChunkSize, cu.FileSize-int64(index)*cu.ChunkSize)
+}
+
+// chunkDir 分片暂存目录，未配置时使用系统临时目录
+func chunkDir() string {
+	if dir := config.GetConfig().ChunkDir; dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), chunkDirName)
+}
+
+// localInstance 本实例的标识，和kafka消费组一样由主机名和端口组成
+func localInstance() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		zlog.Error(err.Error())
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("%s_%d", hostname, config.GetConfig().MainConfig.Port)
+}
+
+// chunkExpire 分片上传多久未完成视为放弃，配置单位为小时，未配置时使用默认值
+func chunkExpire() time.Duration {
+	if expire := config.GetConfig().ChunkExpire; expire > 0 {
+		return expire * time.Hour
+	}
+	return defaultChunkExpire
+}
+
+// validHash 小写十六进制的sha256
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range hash {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// InitUpload 开始分片上传
+// 同一用户上传过相同内容的文件时直接返回该文件；同一用户上传同一文件未完成时返回之前的upload_id和已上传的分片
+// 秒传只在同一用户内生效，否则知道哈希就能拿到别人上传的文件
+// 未完成的上传由其他实例开始时无法续传，分片不在本机上，重新开始上传
+func (u *uploadService) InitUpload(req request.InitUploadRequest) (string, *respond.InitUploadRespond, int) {
+	if req.FileSize <= 0 {
+		return "文件不能为空", nil, -2
+	}
+	if req.FileSize > constants.CHUNK_FILE_MAX_SIZE*1024 {
+		return "文件不能超过" + strconv.Itoa(constants.CHUNK_FILE_MAX_SIZE/1024/1024) + "GB", nil, -2
+	}
+	if !validHash(req.FileHash) {
+		return "文件哈希必须是小写十六进制的sha256", nil, -2
+	}
+	fileName := cleanFileName(req.FileName)
+	if blockedFileExts[fileExt(fileName)] {
+		return "不支持上传该类型的文件", nil, -2
+	}
+
+	if file, err := u.uploadedFile(req.UserId, req.FileHash); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	} else if file != nil {
+		file.FileName = fileName
+		return "文件已存在", &respond.InitUploadRespond{File: file}, 0
+	}
+
+	resumeKey := uploadResumePrefix + req.UserId + ":" + req.FileHash
+	if uploadId, err := u.cache.Get(resumeKey); err == nil {
+		cu, err := u.getChunkUpload(uploadId)
+		if err == nil && cu.FileSize == req.FileSize && cu.Instance == u.instance {
+			uploaded, err := u.uploadedChunks(uploadId)
+			if err != nil {
+				zlog.Error(err.Error())
+				return constants.SYSTEM_ERROR, nil, -1
+			}
+			rsp := &respond.InitUploadRespond{
+				UploadId:       cu.UploadId,
+				ChunkSize:      cu.ChunkSize,
+				ChunkCount:     cu.ChunkCount,
+				UploadedOffset: make([]int64, 0, len(uploaded)),
+			}
+			for _, index := range uploaded {
+				rsp.UploadedOffset = append(rsp.UploadedOffset, int64(index)*cu.ChunkSize)
+			}
+			return "继续上传", rsp, 0
+		}
+		if err != nil && !errors.Is(err, cache.ErrCacheMiss) {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, -1
+		}
+	} else if !errors.Is(err, cache.ErrCacheMiss) {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+
+	chunkSize := int64(constants.CHUNK_SIZE * 1024)
+	cu := &chunkUpload{
+		UploadId:    fmt.Sprintf("F%s", random.GetNowAndLenRandomString(11)),
+		UserId:      req.UserId,
+		FileName:    fileName,
+		FileSize:    req.FileSize,
+		FileHash:    req.FileHash,
+		ChunkSize:   chunkSize,
+		ChunkCount:  int((req.FileSize + chunkSize - 1) / chunkSize),
+		MessageType: req.Type,
+		Instance:    u.instance,
+	}
+	if err := u.saveChunkUpload(cu); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	return "开始上传", &respond.InitUploadRespond{
+		UploadId:       cu.UploadId,
+		ChunkSize:      cu.ChunkSize,
+		ChunkCount:     cu.ChunkCount,
+		UploadedOffset: []int64{},
+	}, 0
+}
+
+// UploadChunk 上传一个分片，重复上传同一个分片会覆盖
+func (u *uploadService) UploadChunk(req request.UploadChunkRequest, fileHeader *multipart.FileHeader) (string, *respond.UploadChunkRespond, int) {
+	cu, message, ret := u.ownChunkUpload(req.UserId, req.UploadId)
+	if ret != 0 {
+		return message, nil, ret
+	}
+	if req.Offset < 0 || req.Offset%cu.ChunkSize != 0 || req.Offset >= cu.FileSize {
+		return "分片偏移量不合法", nil, -2
+	}
+	index := int(req.Offset / cu.ChunkSize)
+	if fileHeader.Size != cu.chunkLen(index) {
+		return "分片大小应为" + strconv.FormatInt(cu.chunkLen(index), 10) + "字节", nil, -2
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	defer file.Close()
+	if err := writeChunk(cu.UploadId, index, file, req.Checksum); err != nil {
+		if errors.Is(err, errChecksumMismatch) {
+			return "分片校验失败，请重新上传该分片", nil, -2
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if err := u.cache.SAdd(uploadChunksPrefix+cu.UploadId, strconv.Itoa(index), chunkExpire()); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	// 有进度时顺延过期时间
+	if err := u.saveChunkUpload(cu); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	uploaded, err := u.uploadedChunks(cu.UploadId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	return "上传成功", &respond.UploadChunkRespond{UploadedCount: len(uploaded)}, 0
+}
+
+// CompleteUpload 合并分片，校验整个文件的哈希后写入文件存储
+func (u *uploadService) CompleteUpload(ctx context.Context, req request.CompleteUploadRequest) (string, *respond.UploadFileRespond, int) {
+	cu, message, ret := u.ownChunkUpload(req.UserId, req.UploadId)
+	if ret != 0 {
+		return message, nil, ret
+	}
+	locked, err := u.cache.SetNX(uploadLockPrefix+cu.UploadId, req.UserId, completeLockExpire)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if !locked {
+		return "文件正在合并，请稍后", nil, -2
+	}
+	defer func() {
+		if err := u.cache.Del(uploadLockPrefix + cu.UploadId); err != nil {
+			zlog.Error(err.Error())
+		}
+	}()
+	uploaded, err := u.uploadedChunks(cu.UploadId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if len(uploaded) != cu.ChunkCount {
+		return "还有" + strconv.Itoa(cu.ChunkCount-len(uploaded)) + "个分片未上传", nil, -2
+	}
+
+	merged, hash, err := mergeChunks(cu)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	defer func() {
+		_ = merged.Close()
+		_ = os.Remove(merged.Name())
+	}()
+	if hash != cu.FileHash {
+		zlog.Info("分片上传" + cu.UploadId + "的文件哈希不一致：" + hash)
+		u.discardChunkUpload(cu)
+		return "文件校验失败，请重新上传", nil, -2
+	}
+	message, rsp, ret := u.putFile(ctx, merged, cu.FileSize, cu.FileName, cu.MessageType)
+	if ret != 0 {
+		if ret == -2 {
+			u.discardChunkUpload(cu)
+		}
+		return message, nil, ret
+	}
+	if data, err := json.Marshal(rsp); err != nil {
+		zlog.Error(err.Error())
+	} else if err := u.cache.Set(uploadedFilePrefix+cu.UserId+":"+cu.FileHash, string(data), uploadedFileExpire); err != nil {
+		zlog.Error(err.Error())
+	}
+	u.discardChunkUpload(cu)
+	return message, rsp, 0
+}
+
+// ownChunkUpload 读取分片上传，只有发起人可以操作
+// 分片暂存在开始上传的实例的本机磁盘上，请求到了其他实例时拒绝，多实例部署时需要负载均衡按upload_id把请求转到同一个实例
+func (u *uploadService) ownChunkUpload(userId, uploadId string) (*chunkUpload, string, int) {
+	cu, err := u.getChunkUpload(uploadId)
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return nil, "上传不存在或已过期，请重新上传", -2
+		}
+		zlog.Error(err.Error())
+		return nil, constants.SYSTEM_ERROR, -1
+	}
+	if cu.UserId != userId {
+		return nil, "上传不存在或已过期，请重新上传", -2
+	}
+	if cu.Instance != u.instance {
+		zlog.Info("分片上传" + uploadId + "属于实例" + cu.Instance + "，当前实例为" + u.instance)
+		return nil, "上传由其他服务器处理，请重新上传", -2
+	}
+	return cu, "", 0
+}
+
+func (u *uploadService) getChunkUpload(uploadId string) (*chunkUpload, error) {
+	data, err := u.cache.Get(uploadSessionPrefix + uploadId)
+	if err != nil {
+		return nil, err
+	}
+	var cu chunkUpload
+	if err := json.Unmarshal([]byte(data), &cu); err != nil {
+		return nil, err
+	}
+	return &cu, nil
+}
+
+// saveChunkUpload 保存元数据和续传索引，每次保存都重新计算过期时间
+func (u *uploadService) saveChunkUpload(cu *chunkUpload) error {
+	data, err := json.Marshal(cu)
+	if err != nil {
+		return err
+	}
+	if err := u.cache.Set(uploadSessionPrefix+cu.UploadId, string(data), chunkExpire()); err != nil {
+		return err
+	}
+	return u.cache.Set(uploadResumePrefix+cu.UserId+":"+cu.FileHash, cu.UploadId, chunkExpire())
+}
+
+// uploadedChunks 已上传分片的序号，升序
+func (u *uploadService) uploadedChunks(uploadId string) ([]int, error) {
+	members, err := u.cache.SMembers(uploadChunksPrefix + uploadId)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]int, 0, len(members))
+	for _, member := range members {
+		index, err := strconv.Atoi(member)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// uploadedFile 按哈希查找该用户已上传的文件，没有时返回nil
+func (u *uploadService) uploadedFile(userId, hash string) (*respond.UploadFileRespond, error) {
+	data, err := u.cache.Get(uploadedFilePrefix + userId + ":" + hash)
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var file respond.UploadFileRespond
+	if err := json.Unmarshal([]byte(data), &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// discardChunkUpload 删除分片和缓存中的记录，失败只记录日志，残留的数据会过期或被定时清理
+func (u *uploadService) discardChunkUpload(cu *chunkUpload) {
+	for _, key := range []string{
+		uploadSessionPrefix + cu.UploadId,
+		uploadChunksPrefix + cu.UploadId,
+		uploadResumePrefix + cu.UserId + ":" + cu.FileHash,
+	} {
+		if err := u.cache.Del(key); err != nil {
+			zlog.Error(err.Error())
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(chunkDir(), cu.UploadId)); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// errChecksumMismatch 分片内容和客户端给出的哈希不一致
+var errChecksumMismatch = errors.New("分片校验失败")
+
+// writeChunk 边写临时文件边计算哈希，校验通过后重命名为分片序号
+func writeChunk(uploadId string, index int, r io.Reader, checksum string) error {
+	dir := filepath.Join(chunkDir(), uploadId)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".chunk-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != checksum {
+		return errChecksumMismatch
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(index)))
+}
+
+// mergeChunks 按顺序拼接分片到临时文件，返回定位到开头的文件和整个文件的sha256
+func mergeChunks(cu *chunkUpload) (*os.File, string, error) {
+	dir := filepath.Join(chunkDir(), cu.UploadId)
+	merged, err := os.CreateTemp(dir, ".merged-*")
+	if err != nil {
+		return nil, "", err
+	}
+	fail := func(err error) (*os.File, string, error) {
+		_ = merged.Close()
+		_ = os.Remove(merged.Name())
+		return nil, "", err
+	}
+	hasher := sha256.New()
+	w := io.MultiWriter(merged, hasher)
+	for index := 0; index < cu.ChunkCount; index++ {
+		chunk, err := os.Open(filepath.Join(dir, strconv.Itoa(index)))
+		if err != nil {
+			return fail(err)
+		}
+		_, err = io.Copy(w, chunk)
+		_ = chunk.Close()
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := merged.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return merged, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// CleanChunks 定时删除过期未完成的分片目录，直到ctx结束
+func CleanChunks(ctx context.Context) {
+	ticker := time.NewTicker(chunkCleanInterval)
+	defer ticker.Stop()
+	for {
+		cleanExpiredChunks(time.Now().Add(-chunkExpire()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanExpiredChunks 目录的修改时间在每次写入分片时更新，早于deadline说明已经放弃
+func cleanExpiredChunks(deadline time.Time) {
+	entries, err := os.ReadDir(chunkDir())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			zlog.Error(err.Error())
+		}
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(deadline) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(chunkDir(), entry.Name())); err != nil {
+			zlog.Error(err.Error())
+			continue
+		}
+		zlog.Info("删除过期的分片目录：" + entry.Name())
+	}
+}
@@ -0,0 +1,144 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"go_chat/internal/dto/request"
+	"go_chat/internal/service/cache"
+	"go_chat/internal/service/storage"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// expiryCache 记录每个key写入时的过期时间
+type expiryCache struct {
+	cache.Cache
+	mu      sync.Mutex
+	expires map[string]time.Duration
+}
+
+func (c *expiryCache) Set(key string, value string, expiration time.Duration) error {
+	c.mu.Lock()
+	c.expires[key] = expiration
+	c.mu.Unlock()
+	return c.Cache.Set(key, value, expiration)
+}
+
+func newTestUploadService(t *testing.T) (*uploadService, *expiryCache) {
+	t.Helper()
+	dir := t.TempDir()
+	c := &expiryCache{Cache: cache.NewMemoryCache(), expires: make(map[string]time.Duration)}
+	return NewUploadService(storage.NewLocalStorage(dir, "/static/avatars"), storage.NewLocalStorage(dir, "/static/files"), c), c
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// chunkFileHeader 用multipart表单构造上传的分片
+func chunkFileHeader(t *testing.T, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", "chunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(int64(len(data)) + 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = form.RemoveAll() })
+	return form.File["file"][0]
+}
+
+// uploadWhole 单个分片完成整个上传，返回文件地址
+func uploadWhole(t *testing.T, u *uploadService, userId string, data []byte) string {
+	t.Helper()
+	message, init, ret := u.InitUpload(request.InitUploadRequest{UserId: userId, FileName: "a.txt", FileSize: int64(len(data)), FileHash: sha256Hex(data)})
+	if ret != 0 || init.File != nil {
+		t.Fatalf("InitUpload = %s, %+v, %d, want a new upload", message, init, ret)
+	}
+	chunk := request.UploadChunkRequest{UserId: userId, UploadId: init.UploadId, Checksum: sha256Hex(data)}
+	if message, _, ret := u.UploadChunk(chunk, chunkFileHeader(t, data)); ret != 0 {
+		t.Fatalf("UploadChunk = %s, %d", message, ret)
+	}
+	message, file, ret := u.CompleteUpload(context.Background(), request.CompleteUploadRequest{UserId: userId, UploadId: init.UploadId})
+	if ret != 0 {
+		t.Fatalf("CompleteUpload = %s, %d", message, ret)
+	}
+	return file.Url
+}
+
+func TestInitUploadReusesOnlyOwnFiles(t *testing.T) {
+	u, c := newTestUploadService(t)
+	data := []byte("hello chunk upload")
+	hash := sha256Hex(data)
+	url := uploadWhole(t, u, "U1", data)
+
+	// 同一用户再次上传直接返回之前的文件
+	_, rsp, ret := u.InitUpload(request.InitUploadRequest{UserId: "U1", FileName: "b.txt", FileSize: int64(len(data)), FileHash: hash})
+	if ret != 0 || rsp.File == nil || rsp.File.Url != url || rsp.File.FileName != "b.txt" {
+		t.Fatalf("InitUpload for the owner = %+v, %d, want the uploaded file", rsp, ret)
+	}
+
+	// 其他用户只知道哈希时拿不到文件，需要自己上传
+	_, rsp, ret = u.InitUpload(request.InitUploadRequest{UserId: "U2", FileName: "a.txt", FileSize: int64(len(data)), FileHash: hash})
+	if ret != 0 || rsp.File != nil || rsp.UploadId == "" {
+		t.Fatalf("InitUpload for another user = %+v, %d, want a new upload", rsp, ret)
+	}
+
+	// 秒传记录有过期时间
+	for key, expire := range c.expires {
+		if strings.HasPrefix(key, uploadedFilePrefix) && (expire <= 0 || expire > uploadedFileExpire) {
+			t.Fatalf("%s expires in %v, want (0, %v]", key, expire, uploadedFileExpire)
+		}
+	}
+	if _, ok := c.expires[uploadedFilePrefix+"U1:"+hash]; !ok {
+		t.Fatalf("no dedup entry for U1, keys = %v", c.expires)
+	}
+}
+
+// TestChunkUploadOtherInstance 分片保存在开始上传的实例上，其他实例不能继续这次上传
+func TestChunkUploadOtherInstance(t *testing.T) {
+	u, _ := newTestUploadService(t)
+	other := *u
+	other.instance = u.instance + "-other"
+	data := []byte("chunks stay on one instance")
+	initReq := request.InitUploadRequest{UserId: "U1", FileName: "a.txt", FileSize: int64(len(data)), FileHash: sha256Hex(data)}
+	_, init, ret := u.InitUpload(initReq)
+	if ret != 0 {
+		t.Fatalf("InitUpload ret = %d", ret)
+	}
+
+	chunk := request.UploadChunkRequest{UserId: "U1", UploadId: init.UploadId, Checksum: sha256Hex(data)}
+	if _, _, ret := other.UploadChunk(chunk, chunkFileHeader(t, data)); ret != -2 {
+		t.Fatalf("UploadChunk on another instance ret = %d, want -2", ret)
+	}
+	if _, _, ret := other.CompleteUpload(context.Background(), request.CompleteUploadRequest{UserId: "U1", UploadId: init.UploadId}); ret != -2 {
+		t.Fatalf("CompleteUpload on another instance ret = %d, want -2", ret)
+	}
+	// 在其他实例上续传时重新开始
+	if _, rsp, ret := other.InitUpload(initReq); ret != 0 || rsp.UploadId == "" || rsp.UploadId == init.UploadId {
+		t.Fatalf("InitUpload on another instance = %+v, %d, want a new upload", rsp, ret)
+	}
+
+	if message, _, ret := u.UploadChunk(chunk, chunkFileHeader(t, data)); ret != 0 {
+		t.Fatalf("UploadChunk on the owner = %s, %d", message, ret)
+	}
+	if message, _, ret := u.CompleteUpload(context.Background(), request.CompleteUploadRequest{UserId: "U1", UploadId: init.UploadId}); ret != 0 {
+		t.Fatalf("CompleteUpload on the owner = %s, %d", message, ret)
+	}
+}
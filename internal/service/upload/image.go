@@ -0,0 +1,99 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go_chat/internal/model"
+	"go_chat/internal/service/storage"
+	"image"
+	_ "image/gif" // 注册解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册解码器
+)
+
+const (
+	maxImagePixels       = 40_000_000 // 超过时只记录宽高不生成缩略图，防止解压炸弹占满内存
+	thumbnailJpegQuality = 80
+)
+
+// thumbnailSizes 缩略图最长边，原图不比它大时跳过
+var thumbnailSizes = []int{160, 480, 960}
+
+// errImageTooLarge 像素数超过 maxImagePixels
+var errImageTooLarge = errors.New("图片像素过多")
+
+// imageMeta 图片的宽高和缩略图
+type imageMeta struct {
+	width      int
+	height     int
+	thumbnails []model.Thumbnail
+}
+
+// processImage 读取宽高并生成缩略图写入store，缩略图的key为原图key去掉扩展名加上尺寸
+// 宽高读取失败返回error，缩略图生成失败时只返回宽高
+func processImage(ctx context.Context, store storage.Storage, r io.ReadSeeker, objectName string) (*imageMeta, error) {
+	conf, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	meta := &imageMeta{width: conf.Width, height: conf.Height}
+	if conf.Width*conf.Height > maxImagePixels {
+		return meta, errImageTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return meta, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return meta, err
+	}
+	baseName := strings.TrimSuffix(objectName, "."+fileExt(objectName))
+	longest := max(conf.Width, conf.Height)
+	for _, size := range thumbnailSizes {
+		if size >= longest {
+			break
+		}
+		thumbnail, err := putThumbnail(ctx, store, src, size, baseName)
+		if err != nil {
+			return meta, err
+		}
+		meta.thumbnails = append(meta.thumbnails, *thumbnail)
+	}
+	return meta, nil
+}
+
+// putThumbnail 按最长边为size等比缩放，不透明的图片用jpeg，有透明通道的用png
+func putThumbnail(ctx context.Context, store storage.Storage, src image.Image, size int, baseName string) (*model.Thumbnail, error) {
+	bounds := src.Bounds()
+	width, height := size, bounds.Dy()*size/bounds.Dx()
+	if bounds.Dy() > bounds.Dx() {
+		width, height = bounds.Dx()*size/bounds.Dy(), size
+	}
+	width, height = max(width, 1), max(height, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	ext, contentType := "jpg", "image/jpeg"
+	if opaque, ok := src.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		ext, contentType = "png", "image/png"
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, err
+		}
+	} else if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailJpegQuality}); err != nil {
+		return nil, err
+	}
+	key := baseName + "_" + strconv.Itoa(size) + "." + ext
+	url, err := store.Put(ctx, key, &buf, int64(buf.Len()), contentType)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Thumbnail{Url: url, Width: width, Height: height}, nil
+}
@@ -0,0 +1,219 @@
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go_chat/internal/dto/respond"
+	"go_chat/internal/service/cache"
+	"go_chat/internal/service/storage"
+	"go_chat/pkg/constants"
+	"go_chat/pkg/enum/message/message_type_enum"
+	"go_chat/pkg/zlog"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	sniffLen       = 512 // http.DetectContentType 最多读取的字节数
+	maxFileNameLen = 50  // 和 model.Message.FileName 的列宽一致
+	maxFileTypeLen = 10  // 和 model.Message.FileType 的列宽一致
+)
+
+// avatarTypes 允许的头像类型，扩展名按嗅探出的类型决定，不信任原文件名
+var avatarTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// blockedFileExts 浏览器会直接执行的类型，和页面同源访问时有XSS风险
+var blockedFileExts = map[string]bool{
+	"html":  true,
+	"htm":   true,
+	"xhtml": true,
+	"svg":   true,
+	"js":    true,
+	"mjs":   true,
+}
+
+type uploadService struct {
+	avatars  storage.Storage
+	files    storage.Storage
+	cache    cache.Cache // 分片上传的进度和已上传文件的哈希
+	instance string      // 本实例的标识，记录在分片上传中
+}
+
+// UploadService 由 Init 创建
+var UploadService *uploadService
+
+// Init 注入头像和文件的存储
+func Init(avatars, files storage.Storage, c cache.Cache) {
+	UploadService = NewUploadService(avatars, files, c)
+}
+
+func NewUploadService(avatars, files storage.Storage, c cache.Cache) *uploadService {
+	return &uploadService{avatars: avatars, files: files, cache: c, instance: localInstance()}
+}
+
+// UploadAvatar 上传头像，只接受常见图片格式
+func (u *uploadService) UploadAvatar(ctx context.Context, fileHeader *multipart.FileHeader) (string, *respond.UploadAvatarRespond, int) {
+	if fileHeader.Size > constants.AVATAR_MAX_SIZE*1024 {
+		return "头像不能超过" + strconv.Itoa(constants.AVATAR_MAX_SIZE/1024) + "MB", nil, -2
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	defer file.Close()
+	contentType, err := sniff(file)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	ext, ok := avatarTypes[contentType]
+	if !ok {
+		zlog.Info("不支持的头像类型：" + contentType)
+		return "头像只支持jpg、png、gif、webp格式", nil, -2
+	}
+	url, err := u.avatars.Put(ctx, newObjectName(ext), file, fileHeader.Size, contentType)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	return "上传成功", &respond.UploadAvatarRespond{Url: url}, 0
+}
+
+// UploadFile 上传聊天文件，返回的字段用于填充文件消息
+func (u *uploadService) UploadFile(ctx context.Context, fileHeader *multipart.FileHeader, messageType int) (string, *respond.UploadFileRespond, int) {
+	if fileHeader.Size <= 0 {
+		return "文件不能为空", nil, -2
+	}
+	if fileHeader.Size > constants.UPLOAD_MAX_SIZE*1024 {
+		return "文件不能超过" + strconv.Itoa(constants.UPLOAD_MAX_SIZE/1024) + "MB，请使用分片上传", nil, -2
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	defer file.Close()
+	return u.putFile(ctx, file, fileHeader.Size, cleanFileName(fileHeader.Filename), messageType)
+}
+
+// putFile 校验类型后写入文件存储
+// 图片额外返回宽高和缩略图，messageType为语音时返回时长，解析失败不影响上传
+func (u *uploadService) putFile(ctx context.Context, file io.ReadSeeker, size int64, fileName string, messageType int) (string, *respond.UploadFileRespond, int) {
+	ext := fileExt(fileName)
+	contentType, err := sniff(file)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	if blockedFileExts[ext] || strings.HasPrefix(contentType, "text/html") {
+		zlog.Info("不支持的文件类型：" + ext + " " + contentType)
+		return "不支持上传该类型的文件", nil, -2
+	}
+	objectName := newObjectName(ext)
+	rsp := &respond.UploadFileRespond{
+		FileName: fileName,
+		FileType: ext,
+		FileSize: strconv.FormatInt(size, 10),
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		meta, err := processImage(ctx, u.files, file, objectName)
+		if err != nil {
+			zlog.Info("图片处理失败：" + err.Error())
+		}
+		if meta != nil {
+			rsp.Width, rsp.Height, rsp.Thumbnails = meta.width, meta.height, meta.thumbnails
+		}
+	} else if messageType == message_type_enum.VOICE {
+		duration, err := audioDuration(file, size)
+		if err != nil {
+			zlog.Info("语音时长解析失败：" + err.Error())
+		}
+		rsp.Duration = int(duration.Milliseconds())
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	url, err := u.files.Put(ctx, objectName, file, size, contentType)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, -1
+	}
+	rsp.Url = url
+	return "上传成功", rsp, 0
+}
+
+// sniff 按文件内容判断类型，读完后回到文件开头
+func sniff(file io.ReadSeeker) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// newObjectName 日期加随机串，不使用用户传的文件名，避免覆盖和路径穿越
+func newObjectName(ext string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	name := time.Now().Format("20060102") + hex.EncodeToString(b)
+	if ext != "" {
+		name += "." + ext
+	}
+	return name
+}
+
+// cleanFileName 去掉路径和控制字符，超长时保留扩展名截断
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	runes := []rune(name)
+	if len(runes) <= maxFileNameLen {
+		return name
+	}
+	ext := []rune(filepath.Ext(name))
+	if len(ext) >= maxFileNameLen {
+		return string(runes[:maxFileNameLen])
+	}
+	return string(runes[:maxFileNameLen-len(ext)]) + string(ext)
+}
+
+// fileExt 小写扩展名，只保留字母和数字
+func fileExt(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	ext = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, ext)
+	if len(ext) > maxFileTypeLen {
+		ext = ext[:maxFileTypeLen]
+	}
+	return ext
+}
@@ -1,8 +1,19 @@
 package constants
 
 const (
-	CHANNEL_SIZE  = 100            // 通道大小
-	SYSTEM_ERROR  = "系统错误，请联系工作人员" // 系统错误
-	FILE_MAX_SIZE = 50000          // 文件最大大小
-	REDIS_TIMEOUT = 1              // redis timeout
+	CHANNEL_SIZE        = 100             // 通道大小
+	SYSTEM_ERROR        = "系统错误，请联系工作人员"  // 系统错误
+	FILE_MAX_SIZE       = 50000           // 文件最大大小
+	UPLOAD_MAX_SIZE     = 10 * 1024       // 单次上传的文件最大大小，单位KB，更大的文件使用分片上传
+	AVATAR_MAX_SIZE     = 2048            // 头像最大大小，单位KB
+	CHUNK_SIZE          = 4096            // 分片上传的分片大小，单位KB
+	CHUNK_FILE_MAX_SIZE = 4 * 1024 * 1024 // 分片上传的文件最大大小，单位KB
+	REDIS_TIMEOUT       = 1               // redis timeout
+	CTX_UUID            = "uuid"          // gin上下文中登录用户的uuid
+	CTX_SID             = "sid"           // gin上下文中登录会话的id
+
+	EVENT_READ_RECEIPT     = "read_receipt"     // 长连接推送的已读回执
+	EVENT_MESSAGE_RECALL   = "message_recall"   // 长连接推送的消息撤回
+	EVENT_MESSAGE_EDIT     = "message_edit"     // 长连接推送的消息编辑
+	EVENT_MESSAGE_REACTION = "message_reaction" // 长连接推送的表情回应
 )
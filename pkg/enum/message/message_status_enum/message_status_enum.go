@@ -0,0 +1,6 @@
+package message_status_enum
+
+const (
+	UNSENT = iota
+	SENT
+)
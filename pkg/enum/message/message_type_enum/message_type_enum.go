@@ -0,0 +1,8 @@
+package message_type_enum
+
+const (
+	TEXT = iota
+	VOICE
+	FILE
+	AUDIO_OR_VIDEO
+)
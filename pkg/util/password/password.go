@@ -0,0 +1,35 @@
+package password
+
+import (
+	"crypto/subtle"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Hash 使用bcrypt加密密码
+func Hash(plain string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// IsHashed 判断是否已经是bcrypt密文，历史数据是明文存储的
+func IsHashed(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// Verify 校验密码，needRehash为true表示应该用当前算法重新加密后保存
+func Verify(stored, plain string) (ok bool, needRehash bool) {
+	if !IsHashed(stored) {
+		// 明文的历史数据，常量时间比较，通过后升级为密文
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1
+		return ok, ok
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err == nil && cost < bcrypt.DefaultCost
+}
@@ -4,9 +4,9 @@ import (
 	"github.com/natefinch/lumberjack"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"go_chat/internal/config"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
 )
 
@@ -14,24 +14,44 @@ var logger *zap.Logger
 var logPath string
 
 func init() {
+	// 加载配置前先只输出到控制台，Init 之后再写入文件
+	logger = zap.New(newCore(nil))
+}
+
+// Init 按配置的日志路径重建logger，日志同时输出到控制台和文件
+func Init(path string) error {
+	if path == "" {
+		return nil
+	}
+	logPath = path
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	//指定日志文件以及写入操作
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	logger = zap.New(newCore(zapcore.AddSync(file)))
+	return nil
+}
+
+func newCore(fileWriteSyncer zapcore.WriteSyncer) zapcore.Core {
 	//new一个
 	encoderConfig := zap.NewProductionEncoderConfig()
 	//设置日志时间格式
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	//格式化为json
 	encoder := zapcore.NewJSONEncoder(encoderConfig)
-	//加载toml中的log级别信息
-	conf := config.GetConfig()
-	logPath = conf.LogPath
-	//指定日志文件以及写入操作
-	file, _ := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 644)
-	fileWriteSyncer := zapcore.AddSync(file)
+	stdoutCore := zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), zapcore.DebugLevel)
+	if fileWriteSyncer == nil {
+		return stdoutCore
+	}
 	//日志会同时输出到控制台（os.Stdout）和文件  两个 NewCore 合并为一个 Tee
-	core := zapcore.NewTee(
-		zapcore.NewCore(encoder, zapcore.AddSync(os.Stdout), zapcore.DebugLevel),
+	return zapcore.NewTee(
+		stdoutCore,
 		zapcore.NewCore(encoder, fileWriteSyncer, zapcore.DebugLevel),
 	)
-	logger = zap.New(core)
 }
 
 // 日志分割